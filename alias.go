@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// Settings a prompt alias may bundle, with their config types
+var promptAliasKeys = map[string]string{
+	"model":       "string",
+	"instruction": "string",
+	"temperature": "float64",
+}
+
+// Function to apply aliases from the `aliases` config key. A leading `@name` argument selects a prompt
+// alias, whose model, instruction and temperature are used unless set by a flag; a string alias used
+// as the model is replaced by the model it names. It returns the arguments left after the alias.
+func resolveAliases(args []string) ([]string, error) {
+	if len(args) > 0 && strings.HasPrefix(args[0], "@") {
+		name := args[0][1:]
+		alias, ok := lookupAlias(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown prompt alias %q, define it under aliases in the config file", args[0])
+		}
+		switch alias := alias.(type) {
+		case string:
+			setUnlessFlagged("model", alias)
+		case map[string]interface{}:
+			for key := range promptAliasKeys {
+				if value, ok := alias[key]; ok {
+					setUnlessFlagged(key, value)
+				}
+			}
+		}
+		args = args[1:]
+	}
+
+	model := viper.GetString("model")
+	if target, ok := lookupAlias(model); ok {
+		target, ok := target.(string)
+		if !ok {
+			return nil, fmt.Errorf("alias %q bundles a prompt, use it as @%s instead of as the model", model, model)
+		}
+		viper.Set("model", target)
+	}
+	return args, nil
+}
+
+// Function to look up an alias by name. Viper lowercases config keys, so names are case-insensitive.
+func lookupAlias(name string) (interface{}, bool) {
+	if name == "" || strings.Contains(name, ".") {
+		return nil, false
+	}
+	aliases, _ := viper.Get("aliases").(map[string]interface{})
+	alias, ok := aliases[strings.ToLower(name)]
+	return alias, ok
+}
+
+// Function to set a value unless it was given as a command line flag, which takes precedence
+func setUnlessFlagged(key string, value interface{}) {
+	if !pflag.CommandLine.Changed(key) {
+		viper.Set(key, value)
+	}
+}
+
+// Function to check the aliases config key: every alias is a model name or a mapping of prompt settings
+func (d *configDoc) checkAliases(node *yaml.Node, errs *ConfigErrors) {
+	if node.Kind != yaml.MappingNode {
+		*errs = append(*errs, fmt.Sprintf("%s:%d: aliases must be a mapping of names to models or prompts", d.file(node), node.Line))
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, alias := node.Content[i].Value, node.Content[i+1]
+		switch alias.Kind {
+		case yaml.ScalarNode:
+		case yaml.MappingNode:
+			for j := 0; j+1 < len(alias.Content); j += 2 {
+				keyNode, value := alias.Content[j], alias.Content[j+1]
+				want, ok := promptAliasKeys[keyNode.Value]
+				if !ok {
+					*errs = append(*errs, fmt.Sprintf("%s:%d: unknown key %q in alias %s, prompt aliases may set model, instruction and temperature",
+						d.file(keyNode), keyNode.Line, keyNode.Value, name))
+					continue
+				}
+				if problem := checkConfigValue(want, value); problem != "" {
+					*errs = append(*errs, fmt.Sprintf("%s:%d: aliases.%s.%s %s", d.file(value), value.Line, name, keyNode.Value, problem))
+				}
+			}
+		default:
+			*errs = append(*errs, fmt.Sprintf("%s:%d: alias %s must be a model name or a mapping of prompt settings", d.file(alias), alias.Line, name))
+		}
+	}
+}
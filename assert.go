@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"sgpt/pkg/guardrail"
+	"strings"
+)
+
+// Function to parse the assertions given with --assert
+func loadAssertions() ([]*guardrail.Assertion, error) {
+	var assertions []*guardrail.Assertion
+	for _, spec := range viper.GetStringSlice("assert") {
+		a, err := guardrail.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, a)
+	}
+	return assertions, nil
+}
+
+// Function to get a reply from call that passes every assertion. Failing replies are retried up
+// to --assertRetries times with the failures added to the instruction; if none passes, an error
+// listing the failures is returned.
+func callAsserted(assertions []*guardrail.Assertion, instruction string, call func(instruction string) (string, error)) (string, error) {
+	retries := viper.GetInt("assertRetries")
+	prompt := instruction
+	for attempt := 0; ; attempt++ {
+		reply, err := call(prompt)
+		if err != nil {
+			return "", err
+		}
+
+		var failures []string
+		for _, a := range assertions {
+			if err := a.Check(reply); err != nil {
+				failures = append(failures, err.Error())
+			}
+		}
+		if len(failures) == 0 {
+			return reply, nil
+		}
+		if attempt >= retries {
+			return "", fmt.Errorf("the reply failed its assertions after %d attempts:\n  - %s", attempt+1, strings.Join(failures, "\n  - "))
+		}
+
+		debugf("reply failed assertions, retrying: %s", strings.Join(failures, "; "))
+		prompt = instruction + "\n\nYour previous reply was rejected because it failed these checks: " +
+			strings.Join(failures, "; ") + ". The rejected reply was:\n" + reply
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Attachment read from stdin for --image -, --audio - or --video -
+var stdinAttachment []byte
+
+// Function to read an attachment given as - (--image -, --audio - or --video -) from stdin, so that a
+// screenshot or recording can be piped in. The prompt then comes from the arguments. It returns
+// whether stdin was read.
+func readStdinAttachment() (bool, error) {
+	var flags []string
+	for _, path := range viper.GetStringSlice("image") {
+		if path == "-" {
+			flags = append(flags, "--image")
+		}
+	}
+	for _, key := range []string{"audio", "video"} {
+		if viper.GetString(key) == "-" {
+			flags = append(flags, "--"+key)
+		}
+	}
+	if len(flags) == 0 {
+		return false, nil
+	}
+	if len(flags) > 1 {
+		return false, fmt.Errorf("only one attachment can be read from stdin, got %d (%v)", len(flags), flags)
+	}
+	if isTerminal(os.Stdin) {
+		return false, fmt.Errorf("%s - reads the attachment from stdin, pipe it in, e.g. `pngpaste - | sgpt --image - \"what's wrong here\"`", flags[0])
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return false, fmt.Errorf("Error reading %s from stdin: %v", flags[0], err)
+	}
+	if len(data) == 0 {
+		return false, fmt.Errorf("%s -: stdin is empty", flags[0])
+	}
+	debugf("read %d bytes for %s from stdin", len(data), flags[0])
+	stdinAttachment = data
+	return true, nil
+}
+
+// Function to write the attachment read from stdin to a file, for tools that read files such as
+// ffmpeg. dir holds the file and must be removed.
+func writeStdinAttachment() (dir, path string, err error) {
+	dir, err = os.MkdirTemp("", "sgpt-stdin-*")
+	if err != nil {
+		return "", "", err
+	}
+	path = filepath.Join(dir, "stdin")
+	if err := os.WriteFile(path, stdinAttachment, 0o600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return dir, path, nil
+}
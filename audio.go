@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sgpt/pkg/audioprep"
+	"sgpt/pkg/videoprep"
+	"strings"
+)
+
+// OpenAI rejects transcription uploads larger than this
+const maxTranscriptionUpload = 25 << 20
+
+// Function to transcribe a recording with Whisper. With ffmpeg installed the audio is transcoded
+// to 16 kHz mono FLAC and long recordings are split into overlapping segments that are
+// transcribed one by one and stitched back together. If partial is not nil it is called with
+// the new text as each segment is transcribed.
+func transcribeAudio(apiKey, path string, partial func(string)) (string, error) {
+	dir, segments, err := splitAudio(path)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	var stitcher audioprep.Stitcher
+	for i, segment := range segments {
+		debugf("transcribing segment %d of %d", i+1, len(segments))
+		data, err := uploadTranscription(apiKey, segment, "json")
+		if err != nil {
+			return "", fmt.Errorf("segment %d of %d: %w", i+1, len(segments), err)
+		}
+		var response struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(data, &response); err != nil {
+			return "", fmt.Errorf("segment %d of %d: %w", i+1, len(segments), err)
+		}
+		text := stitcher.Add(response.Text)
+		if partial != nil && text != "" {
+			partial(text)
+		}
+	}
+
+	return stitcher.String(), nil
+}
+
+// Function to prepare a recording for upload: without ffmpeg the file itself, which must be under
+// the upload limit, otherwise its transcoded segments. dir holds the segments and must be removed.
+func splitAudio(path string) (dir string, segments []string, err error) {
+	if path == "-" {
+		dir, path, err = writeStdinAttachment()
+		if err != nil {
+			return "", nil, err
+		}
+		if audioprep.Available() {
+			defer os.RemoveAll(dir) // The segments are written elsewhere
+		}
+	}
+	if !audioprep.Available() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", nil, err
+		}
+		if info.Size() > maxTranscriptionUpload {
+			os.RemoveAll(dir)
+			return "", nil, fmt.Errorf("%s is larger than the 25 MB upload limit; install ffmpeg so it can be transcoded and split", path)
+		}
+		return dir, []string{path}, nil
+	}
+	return audioprep.Split(path, viper.GetFloat64("audioSegment"), viper.GetFloat64("audioOverlap"))
+}
+
+// Function to upload one audio file to the OpenAI transcription endpoint, returning the response
+// body in the requested response_format (json or verbose_json)
+func uploadTranscription(apiKey, path, format string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// OpenAI tells the format by the file name, so name the upload after what the file contains
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	audio, ok := audioprep.Detect(head[:n], path)
+	if !ok {
+		return nil, fmt.Errorf("%s: unrecognized audio format, use mp3, mp4, m4a, wav, flac, ogg or webm, or install ffmpeg to convert it", path)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "." + audio.Ext
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("model", "whisper-1")
+	form.WriteField("response_format", format)
+	if language := viper.GetString("language"); language != "" {
+		form.WriteField("language", language)
+	}
+	header := textproto.MIMEHeader{}
+	name = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, name))
+	header.Set("Content-Type", audio.MIME)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", openAIURL(transcriptionsURL), &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("X-Client-Request-Id", newRequestID())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("transcription failed: %s", resp.Status)
+	}
+	if response.Error.Message != "" {
+		return nil, fmt.Errorf("transcription failed: %s", response.Error.Message)
+	}
+
+	return data, nil
+}
+
+// Function to sample frames from a video and add them to the attached images. The returned input
+// is the text given on the command line followed by a transcript of the video's soundtrack, if it
+// has one. cleanup removes the sampled frames and must be called once the request is done.
+func prepareVideo(path, text string) (input string, cleanup func(), err error) {
+	cleanup = func() {}
+	if path == "-" {
+		dir, stdinPath, err := writeStdinAttachment()
+		if err != nil {
+			return "", cleanup, err
+		}
+		defer os.RemoveAll(dir)
+		path = stdinPath
+	}
+
+	dir, frames, err := videoprep.SampleFrames(path, viper.GetFloat64("videoFrameRate"), viper.GetInt("videoMaxFrames"), viper.GetInt("imageMaxDim"))
+	if err != nil {
+		return "", cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	debugf("sampled %d frames from %s", len(frames), path)
+
+	viper.Set("image", append(viper.GetStringSlice("image"), frames...))
+
+	input = text
+	if input == "" {
+		input = fmt.Sprintf("The attached images are %d frames sampled in order from a video.", len(frames))
+	}
+	if videoprep.HasAudio(path) && providerAPIKey("openai") != "" {
+		transcript, err := transcribeAudio(providerAPIKey("openai"), path, nil)
+		if err != nil {
+			return "", cleanup, err
+		}
+		input += "\n\nTranscript of the video's soundtrack:\n" + transcript
+	}
+
+	return input, cleanup, nil
+}
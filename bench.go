@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// benchResult holds the measurements of one model's benchmark runs
+type benchResult struct {
+	model     string
+	latencies []time.Duration // Of successful runs
+	failures  int
+	tokens    int // Output tokens of successful runs
+	cost      float64
+	priced    bool
+	skipped   bool // The model is not usable with the current configuration
+}
+
+// Function to handle `sgpt bench --models a,b [--promptFile file] [-n runs]`, which sends the same
+// prompt to each model several times and prints a comparison of latency, throughput, failures and cost
+func runBench(args []string) error {
+	models := viper.GetStringSlice("models")
+	if len(models) == 0 {
+		return fmt.Errorf("usage: sgpt bench --models model1,model2 [--promptFile file] [-n runs] [prompt]")
+	}
+	runs := viper.GetInt("runs")
+	if runs < 1 {
+		return fmt.Errorf("the number of runs must be at least 1")
+	}
+
+	var prompt string
+	if path := viper.GetString("promptFile"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		prompt = string(data)
+	} else {
+		var err error
+		if prompt, err = readInput(args); err != nil {
+			return err
+		}
+	}
+
+	// -p sends every model to the same provider; otherwise each model's provider is inferred
+	explicit := ""
+	if pflag.CommandLine.Changed("provider") {
+		explicit = viper.GetString("provider")
+	}
+
+	instruction := viper.GetString("instruction")
+	temperature := viper.GetFloat64("temperature")
+	var results []*benchResult
+	for _, name := range models {
+		provider, model := modelProvider(strings.TrimSpace(name), explicit)
+		viper.Set("provider", provider)
+		viper.Set("model", model)
+		loadKeyringKey(provider)
+
+		result := &benchResult{model: strings.TrimSpace(name)}
+		results = append(results, result)
+		if err := validateConfig(); err != nil {
+			log.Printf("skipping %s: %v", name, err)
+			result.skipped = true
+			continue
+		}
+
+		caps := modelCapabilities[model]
+		result.priced = caps.InputPrice > 0 || caps.OutputPrice > 0
+		instructionTokens, _ := countTokens(model, instruction)
+		promptTokens, _ := countTokens(model, prompt)
+		inputTokens := instructionTokens + promptTokens
+		for i := 0; i < runs; i++ {
+			start := time.Now()
+			reply, err := callProvider(rootCtx, providerAPIKey(provider), model, instruction, prompt, temperature)
+			elapsed := time.Since(start)
+			if err != nil {
+				debugf("%s run %d failed: %v", name, i+1, err)
+				result.failures++
+				continue
+			}
+			outputTokens, _ := countTokens(model, reply)
+			result.latencies = append(result.latencies, elapsed)
+			result.tokens += outputTokens
+			result.cost += (float64(inputTokens)*caps.InputPrice + float64(outputTokens)*caps.OutputPrice) / 1e6
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d", name, i+1, runs)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+
+	printBenchResults(results, runs)
+	return nil
+}
+
+// Function to print the benchmark results as a table
+func printBenchResults(results []*benchResult, runs int) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tRUNS\tFAILED\tP50\tP90\tMAX\tTOKENS/S\tCOST/RUN")
+	for _, r := range results {
+		if r.skipped {
+			fmt.Fprintf(w, "%s\t0\t-\t-\t-\t-\t-\t-\n", r.model)
+			continue
+		}
+
+		failed := fmt.Sprintf("%.0f%%", 100*float64(r.failures)/float64(runs))
+		if len(r.latencies) == 0 {
+			fmt.Fprintf(w, "%s\t%d\t%s\t-\t-\t-\t-\t-\n", r.model, runs, failed)
+			continue
+		}
+
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		var total time.Duration
+		for _, l := range r.latencies {
+			total += l
+		}
+		cost := "-"
+		if r.priced {
+			cost = fmt.Sprintf("$%.5f", r.cost/float64(len(r.latencies)))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%.1f\t%s\n", r.model, runs, failed,
+			percentile(r.latencies, 50), percentile(r.latencies, 90), r.latencies[len(r.latencies)-1].Round(time.Millisecond),
+			float64(r.tokens)/total.Seconds(), cost)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr, "Costs are estimated from the token counts of the prompt and replies.")
+}
+
+// Function to return the p-th percentile of sorted durations, rounded to milliseconds
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i].Round(time.Millisecond)
+}
@@ -2,13 +2,17 @@
 
 set -e
 
+VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo dev)
+COMMIT=$(git rev-parse --short HEAD 2>/dev/null || echo unknown)
+LDFLAGS="-X main.version=${VERSION} -X main.commit=${COMMIT}"
+
 echo "Building for macOS (M1)..."
-env GOOS=darwin GOARCH=arm64 go build -o build/sgpt-macos-m1
+env GOOS=darwin GOARCH=arm64 go build -ldflags "${LDFLAGS}" -o build/sgpt-macos-m1
 
 echo "Building for Windows (amd64)..."
-env GOOS=windows GOARCH=amd64 go build -o build/sgpt-windows-amd64.exe
+env GOOS=windows GOARCH=amd64 go build -ldflags "${LDFLAGS}" -o build/sgpt-windows-amd64.exe
 
 echo "Building for Linux (amd64)..."
-env GOOS=linux GOARCH=amd64 go build -o build/sgpt-linux-amd64
+env GOOS=linux GOARCH=amd64 go build -ldflags "${LDFLAGS}" -o build/sgpt-linux-amd64
 
 echo "Build complete."
\ No newline at end of file
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"sgpt/pkg/cache"
+	"time"
+)
+
+// Where the model catalog is published: models.yaml of the latest sources, so that new models and
+// changed prices reach existing installs without a new release. It is only fetched when --catalogURL
+// names it.
+const catalogURL = "https://raw.githubusercontent.com/pdfinn/sgpt/main/models.yaml"
+
+// Largest model catalog read
+const maxCatalogSize = 1 << 20
+
+// Models set in the modelCapabilities section of the config file, which the catalog doesn't override
+var configuredModels = map[string]bool{}
+
+// Function to add the model catalog of --catalogURL to the known models. The catalog is kept in the
+// response cache and refreshed after --modelListTTL, revalidated with its ETag so that an unchanged
+// catalog isn't downloaded again. Failures are not fatal: the built-in models remain.
+func applyCatalog() {
+	url := viper.GetString("catalogURL")
+	if url == "" {
+		return
+	}
+	key, err := cache.Key("catalog", url)
+	if err != nil {
+		return
+	}
+	catalogs := cache.New(cacheDir(), viper.GetDuration("modelListTTL"))
+	catalog, etag, fresh, ok := catalogs.Lookup(key)
+	if !ok {
+		catalog, etag = "", ""
+	}
+
+	if !fresh && !viper.GetBool("offline") {
+		fetched, newETag, err := fetchCatalog(url, etag)
+		switch {
+		case err != nil:
+			debugf("model catalog: %v", err)
+		case fetched == nil:
+			debugf("model catalog is unchanged")
+		default:
+			catalog, etag = string(fetched), newETag
+		}
+		// Store the catalog even when the download failed, so it is tried again after a TTL, not on every run
+		if err := catalogs.PutTagged(key, catalog, etag); err != nil {
+			debugf("caching model catalog: %v", err)
+		}
+	}
+	if catalog == "" {
+		return
+	}
+
+	var entries map[string]yaml.Node
+	if err := yaml.Unmarshal([]byte(catalog), &entries); err != nil {
+		debugf("model catalog: %v", err)
+		return
+	}
+	for name, entry := range entries {
+		if configuredModels[name] {
+			continue
+		}
+		if err := applyCatalogEntry(name, &entry); err != nil {
+			debugf("model catalog: ignoring %s: %v", name, err)
+		}
+	}
+}
+
+// Function to add a model of the downloaded catalog to the known models. The catalog may add models
+// and update the limits and prices of known ones, but not send a known model to another provider or
+// endpoint, nor set anything else, such as a base URL.
+func applyCatalogEntry(name string, entry *yaml.Node) error {
+	if entry.Kind != yaml.MappingNode {
+		return fmt.Errorf("not a model entry")
+	}
+	for i := 0; i < len(entry.Content); i += 2 {
+		if _, ok := modelSpecKeys[entry.Content[i].Value]; !ok {
+			return fmt.Errorf("unknown field %s", entry.Content[i].Value)
+		}
+	}
+	var spec modelSpec
+	if err := entry.Decode(&spec); err != nil {
+		return err
+	}
+	caps, err := spec.caps()
+	if err != nil {
+		return err
+	}
+	if known, ok := modelCapabilities[name]; ok {
+		if caps.Provider != known.Provider {
+			return fmt.Errorf("it names provider %s, the model is one of %s", caps.Provider, known.Provider)
+		}
+		if caps.Endpoint != known.Endpoint {
+			return fmt.Errorf("it changes the API the model is called through")
+		}
+	}
+	modelCapabilities[name] = caps
+	return nil
+}
+
+// Function to download the model catalog. It returns nil if the catalog still has the given ETag.
+func fetchCatalog(url, etag string) ([]byte, string, error) {
+	client := &http.Client{Transport: httpClient.Transport, Timeout: 3 * time.Second}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	debugf("GET %s", url)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCatalogSize))
+	if err != nil {
+		return nil, "", err
+	}
+	// Don't keep a catalog that can't be read, the cached one is better
+	var specs map[string]modelSpec
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", url, err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The downloaded catalog may add models and update known ones, but not reroute them
+func TestApplyCatalogEntry(t *testing.T) {
+	defer func(caps ModelCaps) { modelCapabilities["gpt-4o"] = caps }(modelCapabilities["gpt-4o"])
+	defer delete(modelCapabilities, "new-model")
+
+	tests := []struct {
+		name, entry string
+		ok          bool
+	}{
+		{"gpt-4o", "{provider: openai, contextWindow: 200000, inputPrice: 1}", true},
+		{"gpt-4o", "{provider: openrouter, contextWindow: 128000}", false},
+		{"gpt-4o", "{provider: openai, api: completions}", false},
+		{"gpt-4o", "{provider: openai, baseURL: 'https://example.com/v1'}", false},
+		{"new-model", "{provider: mistral, contextWindow: 32000}", true},
+		{"other-model", "{provider: example}", false},
+	}
+	for _, tt := range tests {
+		var entry yaml.Node
+		if err := yaml.Unmarshal([]byte(tt.entry), &entry); err != nil {
+			t.Fatal(err)
+		}
+		err := applyCatalogEntry(tt.name, entry.Content[0])
+		if (err == nil) != tt.ok {
+			t.Errorf("%s %s: %v", tt.name, tt.entry, err)
+		}
+	}
+	if caps := modelCapabilities["gpt-4o"]; caps.Provider != "openai" || caps.ContextWindow != 200000 {
+		t.Errorf("gpt-4o is now %+v", caps)
+	}
+}
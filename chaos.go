@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Body of an injected failure, readable both as an OpenAI-format and as a Bedrock error
+const chaosErrorBody = `{"message":"injected failure (--chaosErrorRate)","error":{"message":"injected failure (--chaosErrorRate)","type":"server_error"}}`
+
+// chaosTransport delays requests and fails a share of them with a 503 response without sending them,
+// so that scripts wrapping sgpt can test their retries and fallbacks. The failures follow a seeded
+// sequence, so a run can be repeated exactly.
+type chaosTransport struct {
+	next      http.RoundTripper
+	errorRate float64
+	latency   time.Duration
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// Function to wrap the shared HTTP client's transport in failure injection, if --chaosErrorRate or
+// --chaosLatency is set
+func configureChaos() error {
+	rate, latency := viper.GetFloat64("chaosErrorRate"), viper.GetDuration("chaosLatency")
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("--chaosErrorRate must be between 0 and 1, got %g", rate)
+	}
+	if latency < 0 {
+		return fmt.Errorf("--chaosLatency must not be negative, got %s", latency)
+	}
+	if rate == 0 && latency == 0 {
+		return nil
+	}
+	httpClient.Transport = &chaosTransport{
+		next:      httpClient.Transport,
+		errorRate: rate,
+		latency:   latency,
+		random:    rand.New(rand.NewSource(viper.GetInt64("chaosSeed"))),
+	}
+	return nil
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.latency > 0 {
+		select {
+		case <-time.After(t.latency):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	t.mu.Lock()
+	fail := t.random.Float64() < t.errorRate
+	t.mu.Unlock()
+	if !fail {
+		return t.next.RoundTrip(req)
+	}
+
+	debugf("injecting a failure into %s %s", req.Method, req.URL.Redacted())
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		Status:        "503 Service Unavailable",
+		StatusCode:    http.StatusServiceUnavailable,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}, "Retry-After": {"1"}},
+		Body:          io.NopCloser(strings.NewReader(chaosErrorBody)),
+		ContentLength: int64(len(chaosErrorBody)),
+		Request:       req,
+	}, nil
+}
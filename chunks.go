@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"sgpt/pkg/pii"
+	"sgpt/pkg/provider/openaicompat"
+	"strconv"
+	"strings"
+)
+
+// Function to return the --separator input is split at, with escapes such as \n and \t interpreted
+// so that they can be given on the command line. --follow splits at line ends unless told otherwise.
+func inputSeparator() string {
+	sep := viper.GetString("separator")
+	if sep == "" && viper.GetBool("follow") {
+		return "\n"
+	}
+	if unquoted, err := strconv.Unquote(`"` + sep + `"`); err == nil {
+		return unquoted
+	}
+	return sep
+}
+
+// Function to return a function that reads the next chunk of r up to the separator, as soon as the
+// separator has arrived, so that endless input such as the output of `tail -f` is answered as it
+// comes. Chunks holding only whitespace, such as after a trailing separator, are skipped. At the end
+// of the input it returns io.EOF.
+func scanChunks(r io.Reader, sep string) func() (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.Index(data, []byte(sep)); i >= 0 {
+			return i + len(sep), data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	return func() (string, error) {
+		if rootCtx.Err() != nil {
+			return "", rootCtx.Err() // Interrupted: answer no more chunks, even if the input goes on
+		}
+		for scanner.Scan() {
+			if chunk := scanner.Text(); strings.TrimSpace(chunk) != "" {
+				return chunk, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return "", fmt.Errorf("Error reading input from stdin: %v", err)
+		}
+		return "", io.EOF
+	}
+}
+
+// Function to process the chunks returned by next with up to --concurrency requests at a time,
+// printing the answers to out in the order of the chunks. Each answer is printed as soon as those
+// before it are. After a chunk fails no further chunks are read, and the error is returned once the
+// answers before it are printed.
+func processChunks(out io.Writer, next func() (string, error), process func(io.Writer, string) error) error {
+	workers := viper.GetInt("concurrency")
+	if workers <= 1 {
+		for {
+			chunk, err := next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := process(out, chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	type result struct {
+		chunk  string
+		output bytes.Buffer
+		err    error
+		done   chan struct{}
+	}
+	work := make(chan *result)
+	ordered := make(chan *result, workers) // Chunks in input order, for printing
+	stop := make(chan struct{})
+	var readErr error
+	go func() {
+		defer close(work)
+		defer close(ordered)
+		for {
+			// Stop reading as soon as a chunk failed, rather than whenever the select below notices
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			chunk, err := next()
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+			r := &result{chunk: chunk, done: make(chan struct{})}
+			select {
+			case ordered <- r:
+			case <-stop:
+				return
+			}
+			select {
+			case work <- r:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			for r := range work {
+				r.err = process(&r.output, r.chunk)
+				close(r.done)
+			}
+		}()
+	}
+
+	for r := range ordered {
+		<-r.done
+		if _, err := out.Write(r.output.Bytes()); err != nil {
+			close(stop)
+			return err
+		}
+		if r.err != nil {
+			close(stop)
+			return r.err
+		}
+	}
+	return readErr
+}
+
+// Function to process the chunks returned by next as the successive turns of one conversation with
+// --chained: each chunk is answered with the chunks and answers before it as context, so a document
+// can be worked through step by step. When the conversation outgrows the model's context window,
+// its oldest turns are left out.
+func processChained(out io.Writer, next func() (string, error), model, instruction string, temperature float64, redactor *pii.Redactor) error {
+	provider := viper.GetString("provider")
+	client, err := chatClient(provider)
+	if err != nil {
+		return err
+	}
+	var turns []openaicompat.Message // Alternating user and assistant turns
+	for {
+		chunk, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if redactor != nil {
+			chunk = redactor.Redact(chunk)
+		}
+		turns = append(turns, openaicompat.Message{Role: "user", Content: chunk})
+		for len(turns) > 1 && inputBudget(model, instruction, conversationText(turns)) > 0 {
+			turns = turns[2:]
+		}
+
+		request := openaicompat.Request{
+			Model:       model,
+			System:      instruction,
+			Input:       turns[0].Content,
+			History:     turns[1:],
+			Temperature: temperature,
+			MaxTokens:   maxReplyTokens(model, instruction, conversationText(turns)),
+			Sampling:    samplingOptions(),
+			ServiceTier: serviceTier(provider),
+		}
+		debugf("POST %s model=%s turn=%d", client.Endpoint(), model, len(turns)/2+1)
+		response, err := client.CompleteContext(rootCtx, request)
+		if err != nil {
+			return err
+		}
+		recordUsage(rootCtx, provider, model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+		noteReply(rootCtx, provider, model, response.Model, response.FinishReason, response.SystemFingerprint, response.Raw)
+		reply := strings.TrimSpace(response.Text)
+		turns = append(turns, openaicompat.Message{Role: "assistant", Content: reply})
+
+		if redactor != nil {
+			reply = redactor.Restore(reply)
+		}
+		if viper.GetBool("normalizeOutput") {
+			reply = normalizeOutput(reply)
+		}
+		if _, err := fmt.Fprintln(out, reply); err != nil {
+			return err
+		}
+	}
+}
+
+// Function to join the turns of a conversation, for measuring it against the context window
+func conversationText(turns []openaicompat.Message) string {
+	var text strings.Builder
+	for _, turn := range turns {
+		text.WriteString(turn.Content)
+		text.WriteString("\n")
+	}
+	return text.String()
+}
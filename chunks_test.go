@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestScanChunks(t *testing.T) {
+	next := scanChunks(strings.NewReader("one\n---\n\n---\ntwo\n---\n"), "\n---\n")
+	var chunks []string
+	for {
+		chunk, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if got := strings.Join(chunks, "|"); got != "one|two" {
+		t.Errorf("chunks = %q, want one|two", got)
+	}
+}
+
+// Answers are printed in input order however the workers finish; run with -race
+func TestProcessChunksConcurrent(t *testing.T) {
+	viper.Set("concurrency", 8)
+	defer viper.Set("concurrency", 1)
+
+	var running, most int32
+	input := strings.Repeat("chunk\n", 100)
+	var out bytes.Buffer
+	err := processChunks(&out, scanChunks(strings.NewReader(input), "\n"), func(w io.Writer, chunk string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		_, err := fmt.Fprintln(w, strings.ToUpper(chunk))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != strings.Repeat("CHUNK\n", 100) {
+		t.Errorf("output = %q", out.String())
+	}
+	if most > 8 {
+		t.Errorf("%d chunks were processed at once with --concurrency 8", most)
+	}
+	if most < 2 {
+		t.Errorf("chunks were processed one at a time with --concurrency 8")
+	}
+}
+
+// A failing chunk stops the input from being read further, after the answers before it are printed
+func TestProcessChunksError(t *testing.T) {
+	viper.Set("concurrency", 4)
+	defer viper.Set("concurrency", 1)
+
+	var read int32
+	chunks := scanChunks(strings.NewReader("1\n2\n3\nfail\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"), "\n")
+	next := func() (string, error) {
+		atomic.AddInt32(&read, 1)
+		return chunks()
+	}
+	var out bytes.Buffer
+	err := processChunks(&out, next, func(w io.Writer, chunk string) error {
+		if chunk == "fail" {
+			return errors.New("failed")
+		}
+		_, err := fmt.Fprintln(w, chunk)
+		return err
+	})
+	if err == nil || err.Error() != "failed" {
+		t.Fatalf("err = %v, want failed", err)
+	}
+	if out.String() != "1\n2\n3\n" {
+		t.Errorf("output = %q, want the answers before the failed chunk", out.String())
+	}
+	// The failure stops the reading, at the latest once the chunks already handed to workers are done
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&read); n > 4+2*4 {
+		t.Errorf("read %d chunks, want reading to stop after the failure", n)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"sgpt/pkg/i18n"
+	"strings"
+)
+
+const commitInstruction = "You write git commit messages for staged changes. Follow the Conventional Commits style: " +
+	"a subject line of the form `type(scope): summary`, where type is one of feat, fix, docs, style, refactor, perf, " +
+	"test, build, ci or chore, the scope is optional and the summary is in the imperative mood, lower case, " +
+	"without a trailing period and at most 72 characters long. Respond with the commit message only."
+
+// Function to handle `sgpt commit [hint]`, which drafts a commit message for the staged changes and,
+// with --apply, commits them with it after confirmation. The commit.template config key replaces
+// the Conventional Commits instruction with the team's own style.
+func runCommit(args []string) error {
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	diff, err := exec.Command("git", "diff", "--cached", "--no-color").Output()
+	if err != nil {
+		return fmt.Errorf("git diff --cached: %v", err)
+	}
+	if strings.TrimSpace(string(diff)) == "" {
+		return fmt.Errorf("nothing staged to commit, stage changes with git add first")
+	}
+
+	instruction := commitInstruction
+	if template := viper.GetString("commit.template"); template != "" {
+		instruction = "You write git commit messages for staged changes. Respond with the commit message only, " +
+			"following this style:\n" + template
+	}
+	if branch, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output(); err == nil {
+		instruction += "\n\nThe changes are committed to the branch " + strings.TrimSpace(string(branch)) + "."
+	}
+	if len(args) > 0 {
+		instruction += "\n\nThe author describes the change as: " + strings.Join(args, " ")
+	}
+
+	message, err := callModelChunked(rootCtx, viper.GetString("apiKey"), viper.GetString("model"), instruction, string(diff), viper.GetFloat64("temperature"))
+	if err != nil {
+		return err
+	}
+	message = strings.Trim(stripCodeFence(message), "`\"' \n")
+
+	fmt.Println(message)
+	if !viper.GetBool("apply") {
+		return nil
+	}
+
+	if !confirm(i18n.T("Commit the staged changes with this message?")) {
+		return i18n.Errorf("nothing committed")
+	}
+	cmd := exec.Command("git", "commit", "-m", message)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
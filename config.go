@@ -0,0 +1,765 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sgpt/pkg/i18n"
+	"sgpt/pkg/normalize"
+	"sort"
+	"strings"
+)
+
+// ConfigErrors collects every problem found in the configuration so they can be reported at once
+type ConfigErrors []string
+
+func (e ConfigErrors) Error() string {
+	return i18n.T("invalid configuration:") + "\n  - " + strings.Join(e, "\n  - ")
+}
+
+// Function to check the settings needed to call the API, reporting all problems together
+func validateConfig() error {
+	var errs ConfigErrors
+
+	provider := viper.GetString("provider")
+	switch provider {
+	case "openai":
+		if providerAPIKey(provider) == "" && providerBaseURL(provider) == "" {
+			errs = append(errs, i18n.T("no API key: set SGPT_API_KEY, pass -k/--apiKey, or add apiKey to the config file"))
+		}
+	case "mistral":
+		if providerAPIKey(provider) == "" && providerBaseURL(provider) == "" {
+			errs = append(errs, i18n.T("no Mistral API key: set MISTRAL_API_KEY, pass -k/--apiKey, or add mistral.apiKey to the config file"))
+		}
+	case "groq":
+		if providerAPIKey(provider) == "" && providerBaseURL(provider) == "" {
+			errs = append(errs, i18n.T("no Groq API key: set GROQ_API_KEY, pass -k/--apiKey, or add groq.apiKey to the config file"))
+		}
+	case "openrouter":
+		if providerAPIKey(provider) == "" && providerBaseURL(provider) == "" {
+			errs = append(errs, i18n.T("no OpenRouter API key: set OPENROUTER_API_KEY, pass -k/--apiKey, or add openrouter.apiKey to the config file"))
+		}
+	case "bedrock":
+		if providerRegion(provider) == "" {
+			errs = append(errs, i18n.T("no Bedrock region: set AWS_REGION, pass --region, or add bedrock.region to the config file"))
+		}
+		if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+			errs = append(errs, i18n.T("no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY (and AWS_SESSION_TOKEN for temporary credentials)"))
+		}
+	default:
+		errs = append(errs, i18n.Sprintf("unsupported provider %q, supported providers are %s", provider, strings.Join(providers, ", ")))
+	}
+
+	if problem := checkRegion(provider); problem != "" {
+		errs = append(errs, problem)
+	}
+	if problem := checkBaseURL(provider); problem != "" {
+		errs = append(errs, problem)
+	} else if problem := checkOffline(viper.GetString("model")); problem != "" {
+		errs = append(errs, problem)
+	}
+
+	model := viper.GetString("model")
+	if model == "" {
+		errs = append(errs, i18n.T("no model: set SGPT_MODEL, pass -m/--model, or add model to the config file (e.g. gpt-3.5-turbo)"))
+	} else if caps, ok := modelCapabilities[model]; providerListsModels(provider) && (!ok || caps.Provider != provider) &&
+		(ok || !discoverModel(provider, model)) {
+		msg := i18n.Sprintf("unsupported %s model %q", provider, model)
+		if suggestion := closestModel(model, provider); suggestion != "" {
+			msg += i18n.Sprintf(", did you mean %q?", suggestion)
+		} else {
+			msg += i18n.Sprintf(", supported models are %s", strings.Join(supportedModels(provider), ", "))
+		}
+		errs = append(errs, msg)
+	}
+
+	images := len(viper.GetStringSlice("image")) > 0 || viper.GetString("video") != ""
+	if caps, known := modelCapabilities[model]; images && (providerListsModels(provider) || known) && model != "" && !caps.Vision {
+		example := "gpt-4o"
+		if provider == "bedrock" {
+			example = "anthropic.claude-3-5-sonnet-20241022-v2:0"
+		}
+		errs = append(errs, i18n.Sprintf("model %q does not accept images, use a vision model such as %s", model, example))
+	}
+	if audio := viper.GetString("audio"); audio != "" && provider != "openai" && providerAPIKey("openai") == "" {
+		errs = append(errs, i18n.Sprintf("no OpenAI API key for transcribing audio: add openai.apiKey to the config file, apiKey is the key of %s", provider))
+	} else if audio == "" && modelCapabilities[model].Endpoint == transcriptionsURL {
+		errs = append(errs, i18n.Sprintf("model %q transcribes audio, pass the recording with --audio", model))
+	}
+	if viper.GetString("toolSchema") != "" {
+		if provider == "bedrock" {
+			errs = append(errs, i18n.T("tool calling with --toolSchema is not supported on Bedrock"))
+		} else if providerListsModels(provider) && modelCapabilities[model].Endpoint == completionsURL {
+			errs = append(errs, i18n.Sprintf("model %q does not support tool calling, use a chat model such as gpt-4o", model))
+		}
+	}
+	if spec := viper.GetString("normalize"); spec != "" {
+		if _, err := normalize.ParseOptions(spec); err != nil {
+			errs = append(errs, err.Error())
+		} else if viper.GetString("jsonSchema") == "" {
+			errs = append(errs, i18n.T("--normalize rewrites structured output, it requires --jsonSchema"))
+		}
+	}
+	if _, err := loadAssertions(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if n := viper.GetInt("candidates"); n < 1 {
+		errs = append(errs, i18n.Sprintf("--candidates must be at least 1, got %d", n))
+	} else if n > 1 && (viper.GetString("jsonSchema") != "" || len(viper.GetStringSlice("assert")) > 0 || viper.GetBool("speak")) {
+		errs = append(errs, i18n.T("--candidates cannot be combined with --jsonSchema, --assert or --speak"))
+	}
+	if viper.GetBool("shell") && viper.GetInt("candidates") > 1 {
+		errs = append(errs, i18n.T("--shell generates a single command and cannot be combined with --candidates"))
+	}
+	if viper.GetBool("strictShell") && !viper.GetBool("shell") {
+		errs = append(errs, i18n.T("--strictShell checks the commands of --shell, which is not enabled"))
+	}
+	if verify := viper.GetStringSlice("verify"); len(verify) > 0 {
+		for _, name := range verify {
+			if _, ok := verifyTools[name]; !ok {
+				errs = append(errs, i18n.Sprintf("--verify tool %q is not one of calc, go, python", name))
+			}
+		}
+		if err := checkSnippetSandbox(verify); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if provider == "bedrock" || modelCapabilities[model].Endpoint == completionsURL {
+			errs = append(errs, i18n.T("--verify needs a chat model of OpenAI, Mistral AI, Groq or OpenRouter"))
+		}
+		if viper.GetString("toolSchema") != "" || viper.GetString("jsonSchema") != "" || viper.GetInt("candidates") > 1 || viper.GetDuration("deadline") > 0 {
+			errs = append(errs, i18n.T("--verify cannot be combined with --toolSchema, --jsonSchema, --candidates or --deadline"))
+		}
+	}
+	if len(viper.GetStringSlice("mcp")) > 0 {
+		errs = append(errs, checkMCP()...)
+		if provider == "bedrock" || modelCapabilities[model].Endpoint == completionsURL {
+			errs = append(errs, i18n.T("--mcp needs a chat model of OpenAI, Mistral AI, Groq or OpenRouter"))
+		}
+		if viper.GetString("toolSchema") != "" || viper.GetString("jsonSchema") != "" || viper.GetInt("candidates") > 1 || viper.GetDuration("deadline") > 0 {
+			errs = append(errs, i18n.T("--mcp cannot be combined with --toolSchema, --jsonSchema, --candidates or --deadline"))
+		}
+	}
+	if mode := viper.GetString("critique"); mode != "" {
+		if mode != "annotate" && mode != "regenerate" {
+			errs = append(errs, i18n.Sprintf("--critique must be annotate or regenerate, got %q", mode))
+		}
+		if viper.GetBool("shell") || viper.GetString("jsonSchema") != "" || viper.GetInt("candidates") > 1 || viper.GetDuration("deadline") > 0 {
+			errs = append(errs, i18n.T("--critique cannot be combined with --shell, --jsonSchema, --candidates or --deadline"))
+		}
+	}
+	if viper.GetBool("raw") && (viper.GetBool("shell") || viper.GetString("jsonSchema") != "" || viper.GetInt("candidates") > 1 ||
+		len(viper.GetStringSlice("assert")) > 0 || len(viper.GetStringSlice("verify")) > 0 || len(viper.GetStringSlice("mcp")) > 0 || viper.GetString("critique") != "" ||
+		viper.GetDuration("deadline") > 0 || viper.GetBool("streamResume") || viper.GetBool("speak")) {
+		errs = append(errs, i18n.T("--raw prints the response as it came and cannot be combined with --shell, --jsonSchema, --candidates, --assert, --verify, --mcp, --critique, --deadline, --streamResume or --speak"))
+	}
+	if format := viper.GetString("output"); format != outputFormats[0] && format != outputFormats[1] {
+		errs = append(errs, i18n.Sprintf("--output must be one of %s, got %q", strings.Join(outputFormats, ", "), format))
+	} else if format == "json" && (viper.GetBool("shell") || viper.GetInt("candidates") > 1 || viper.GetBool("raw")) {
+		errs = append(errs, i18n.T("--output json describes a single reply and cannot be combined with --shell, --candidates or --raw"))
+	}
+	if viper.GetBool("append") && viper.GetString("outputFile") == "" {
+		errs = append(errs, i18n.T("--append adds to the --outputFile, which is not set"))
+	}
+	if rate := viper.GetString("rate"); rate != "" {
+		if _, err := parseRating(rate); err != nil {
+			errs = append(errs, "--rate: "+err.Error())
+		}
+	}
+	if n := viper.GetInt("concurrency"); n < 1 {
+		errs = append(errs, i18n.Sprintf("--concurrency must be at least 1, got %d", n))
+	} else if n > 1 && (viper.GetBool("shell") || viper.GetBool("preview") || viper.GetBool("askRating") || jsonOutput() || viper.GetString("critique") != "") {
+		errs = append(errs, i18n.T("--concurrency answers several chunks at once and cannot be combined with --shell, --preview, --askRating, --output json or --critique"))
+	}
+	if viper.GetBool("chained") {
+		if inputSeparator() == "" {
+			errs = append(errs, i18n.T("--chained answers the chunks of --separator or --follow as a conversation, neither is set"))
+		}
+		if provider == "bedrock" || modelCapabilities[model].Endpoint == completionsURL {
+			errs = append(errs, i18n.T("--chained needs a chat model of OpenAI, Mistral AI, Groq or OpenRouter"))
+		}
+		if viper.GetInt("concurrency") > 1 || viper.GetBool("shell") || viper.GetInt("candidates") > 1 || viper.GetBool("raw") {
+			errs = append(errs, i18n.T("--chained answers one chunk after the other and cannot be combined with --concurrency, --shell, --candidates or --raw"))
+		}
+	}
+	if viper.GetBool("perLine") {
+		if n := viper.GetInt("perLineBatch"); n < 1 {
+			errs = append(errs, i18n.Sprintf("--perLineBatch must be at least 1, got %d", n))
+		}
+		if viper.GetBool("shell") || viper.GetInt("candidates") > 1 || viper.GetBool("raw") || jsonOutput() || viper.GetString("jsonSchema") != "" || inputSeparator() != "" ||
+			viper.GetString("audio") != "" || viper.GetString("video") != "" || viper.GetString("critique") != "" || len(viper.GetStringSlice("verify")) > 0 ||
+			len(viper.GetStringSlice("mcp")) > 0 || viper.GetDuration("deadline") > 0 {
+			errs = append(errs, i18n.T("--perLine prints one line for each input line and cannot be combined with --shell, --candidates, --raw, --output json, --jsonSchema, --separator, --follow, --audio, --video, --critique, --verify, --mcp or --deadline"))
+		}
+	}
+	if viper.GetString("criticModel") == "local" && viper.GetString("localFallback") == "" {
+		errs = append(errs, i18n.T("--criticModel local needs the local server of --localFallback"))
+	}
+	if draft := viper.GetString("draftModel"); draft != "" {
+		if !viper.GetBool("preview") {
+			errs = append(errs, i18n.T("--draftModel shows its draft in the --preview, which is not enabled"))
+		}
+		if viper.GetDuration("deadline") > 0 || viper.GetFloat64("streamRate") > 0 || viper.GetBool("streamSmooth") || viper.GetBool("raw") {
+			errs = append(errs, i18n.T("--draftModel cannot be combined with --deadline, --streamRate, --streamSmooth or --raw"))
+		}
+		if draft == "local" && viper.GetString("localFallback") == "" {
+			errs = append(errs, i18n.T("--draftModel local needs the local server of --localFallback"))
+		}
+	}
+	if viper.GetBool("writeFiles") && (viper.GetBool("shell") || viper.GetInt("candidates") > 1 || viper.GetBool("raw") || viper.GetBool("perLine") || viper.GetInt("concurrency") > 1) {
+		errs = append(errs, i18n.T("--writeFiles writes the files of one reply and cannot be combined with --shell, --candidates, --raw, --perLine or --concurrency"))
+	}
+	if viper.GetBool("stream") && viper.GetBool("noStream") {
+		errs = append(errs, i18n.T("--stream and --noStream contradict each other"))
+	}
+	if rate := viper.GetFloat64("streamRate"); rate < 0 {
+		errs = append(errs, i18n.Sprintf("--streamRate must not be negative, got %g", rate))
+	} else if (rate > 0 || viper.GetBool("streamSmooth")) && !viper.GetBool("preview") {
+		errs = append(errs, i18n.T("--streamRate and --streamSmooth pace the --preview, which is not enabled"))
+	}
+	errs = append(errs, checkSampling(provider, model)...)
+	if tier := viper.GetString("serviceTier"); tier != "" {
+		if !isServiceTier(tier) {
+			errs = append(errs, i18n.Sprintf("--serviceTier must be one of %s, got %q", strings.Join(serviceTiers, ", "), tier))
+		} else if provider != "openai" {
+			errs = append(errs, i18n.T("--serviceTier is only supported by OpenAI"))
+		}
+	}
+	if n := viper.GetInt("maxTokens"); n < 0 {
+		errs = append(errs, i18n.Sprintf("--maxTokens must not be negative, got %d", n))
+	}
+	if rate := viper.GetFloat64("compress"); rate < 0 || rate > 0.9 {
+		errs = append(errs, i18n.Sprintf("--compress must be between 0 and 0.9, got %g", rate))
+	}
+	if deadline := viper.GetDuration("deadline"); deadline < 0 {
+		errs = append(errs, i18n.Sprintf("--deadline must not be negative, got %s", deadline))
+	} else if deadline > 0 && (viper.GetString("jsonSchema") != "" || viper.GetInt("candidates") > 1) {
+		errs = append(errs, i18n.T("--deadline cannot be combined with --jsonSchema or --candidates, which need complete replies"))
+	}
+	switch format := viper.GetString("candidatesFormat"); format {
+	case "text", "json":
+	default:
+		errs = append(errs, i18n.Sprintf("candidates format %q is not one of text, json", format))
+	}
+	if viper.GetBool("speak") && providerAPIKey("openai") == "" {
+		if provider == "openai" {
+			errs = append(errs, i18n.T("no OpenAI API key for --speak: set SGPT_API_KEY, pass -k/--apiKey, or add apiKey to the config file"))
+		} else {
+			errs = append(errs, i18n.Sprintf("no OpenAI API key for --speak: add openai.apiKey to the config file, apiKey is the key of %s", provider))
+		}
+	}
+	switch detail := viper.GetString("imageDetail"); detail {
+	case "low", "high", "auto":
+	default:
+		errs = append(errs, i18n.Sprintf("image detail %q is not one of low, high, auto", detail))
+	}
+
+	if t := viper.GetFloat64("temperature"); t < 0 || t > 2 {
+		errs = append(errs, i18n.Sprintf("temperature %g is out of range, it must be between 0 and 2 (-t/--temperature or SGPT_TEMPERATURE)", t))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Function to list the names of a provider's supported models in order
+func supportedModels(provider string) []string {
+	var models []string
+	for m, caps := range modelCapabilities {
+		if caps.Provider == provider {
+			models = append(models, m)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// Function to find the provider's supported model nearest to a mistyped name, if any is close enough
+func closestModel(model, provider string) string {
+	best, bestDistance := "", len(model)/2+1
+	for _, candidate := range supportedModels(provider) {
+		if d := levenshtein(strings.ToLower(model), candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// Function to compute the edit distance between two strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// Types of config keys that have no command line flag. Keys with a flag take their type from the flag.
+var configKeyTypes = map[string]string{
+	"aliases":                "aliases",
+	"profiles":               "profiles",
+	"workspaces":             "workspaces",
+	"mcpServers":             "mcpServers",
+	"modelCapabilities":      "modelCapabilities",
+	"debug":                  "bool",
+	"githubToken":            "string",
+	"jira":                   "map",
+	"jira.url":               "string",
+	"jira.email":             "string",
+	"jira.token":             "string",
+	"jira.project":           "string",
+	"jira.issueType":         "string",
+	"jira.priorities":        "stringMap",
+	"commit":                 "map",
+	"commit.template":        "string",
+	"linear":                 "map",
+	"linear.apiKey":          "string",
+	"linear.teamId":          "string",
+	"openai":                 "map",
+	"openai.apiKey":          "string",
+	"openai.region":          "string",
+	"openai.baseURL":         "string",
+	"mistral":                "map",
+	"mistral.apiKey":         "string",
+	"mistral.region":         "string",
+	"mistral.baseURL":        "string",
+	"groq":                   "map",
+	"groq.apiKey":            "string",
+	"groq.baseURL":           "string",
+	"openrouter":             "map",
+	"openrouter.apiKey":      "string",
+	"openrouter.referer":     "string",
+	"openrouter.title":       "string",
+	"openrouter.baseURL":     "string",
+	"bedrock":                "map",
+	"bedrock.region":         "string",
+	"politeness":             "map",
+	"politeness.maxRPM":      "int",
+	"politeness.concurrency": "int",
+	"politeness.offPeak":     "stringSlice",
+	"politeness.stateFile":   "string",
+}
+
+// Function to look up the expected type of a config key
+func configKeyType(key string) (string, bool) {
+	if flag := pflag.CommandLine.Lookup(key); flag != nil {
+		return flag.Value.Type(), true
+	}
+	t, ok := configKeyTypes[key]
+	return t, ok
+}
+
+// Function to check the sampling parameters, and that the provider accepts those that are set
+func checkSampling(provider, model string) []string {
+	var errs []string
+	s := samplingOptions()
+	if s.TopP < 0 || s.TopP > 1 {
+		errs = append(errs, i18n.Sprintf("--topP must be between 0 and 1, got %g", s.TopP))
+	}
+	if s.TopK < 0 {
+		errs = append(errs, i18n.Sprintf("--topK must not be negative, got %d", s.TopK))
+	} else if s.TopK > 0 && provider != "openrouter" && !(provider == "bedrock" && strings.Contains(model, "anthropic.")) {
+		errs = append(errs, i18n.T("--topK is only supported by OpenRouter and Anthropic models on Bedrock"))
+	}
+	for _, flag := range []string{"frequencyPenalty", "presencePenalty"} {
+		if p := viper.GetFloat64(flag); p < -2 || p > 2 {
+			errs = append(errs, i18n.Sprintf("--%s must be between -2 and 2, got %g", flag, p))
+		} else if p != 0 && provider == "bedrock" {
+			errs = append(errs, i18n.Sprintf("--%s is not supported on Bedrock", flag))
+		}
+	}
+	if s.Seed != 0 && provider == "bedrock" {
+		errs = append(errs, i18n.T("--seed is not supported on Bedrock"))
+	}
+	if len(s.Stop) > 4 {
+		errs = append(errs, i18n.Sprintf("at most 4 --stop sequences are supported, got %d", len(s.Stop)))
+	}
+	for _, stop := range s.Stop {
+		if stop == "" {
+			errs = append(errs, i18n.T("--stop sequences must not be empty"))
+			break
+		}
+	}
+	return errs
+}
+
+// Function to list every known config key, for suggestions
+func configKeys() []string {
+	var keys []string
+	pflag.CommandLine.VisitAll(func(flag *pflag.Flag) {
+		keys = append(keys, flag.Name)
+	})
+	for key := range configKeyTypes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Extensions of config files, in order of preference; files without one are YAML
+var configExtensions = []string{".yaml", ".yml", ".toml", ".json"}
+
+// Function to find the config file: the one given with --config or SGPT_CONFIG, or else the first of
+// .sgpt[.{yaml,yml,toml,json}] in the working directory, config.{yaml,yml,toml,json} in
+// $XDG_CONFIG_HOME/sgpt (~/.config/sgpt by default) and .sgpt[.{yaml,yml,toml,json}] in the home
+// directory. It returns "" and the places searched when there is none.
+func findConfigFile() (string, []string, error) {
+	if path := viper.GetString("config"); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", nil, err
+		}
+		return path, nil, nil
+	}
+
+	home := os.Getenv("HOME")
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	candidates := []string{".sgpt"}
+	for _, ext := range configExtensions {
+		candidates = append(candidates, ".sgpt"+ext)
+	}
+	var searched []string
+	searched = append(searched, ".")
+	if xdg != "" {
+		for _, ext := range configExtensions {
+			candidates = append(candidates, filepath.Join(xdg, "sgpt", "config"+ext))
+		}
+		searched = append(searched, filepath.Join(xdg, "sgpt"))
+	}
+	if home != "" {
+		candidates = append(candidates, filepath.Join(home, ".sgpt"))
+		for _, ext := range configExtensions {
+			candidates = append(candidates, filepath.Join(home, ".sgpt"+ext))
+		}
+		searched = append(searched, home)
+	}
+
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil, nil
+		}
+	}
+	return "", searched, nil
+}
+
+// configDoc is a parsed config file with includes and environment variables resolved
+type configDoc struct {
+	root  *yaml.Node
+	files map[*yaml.Node]string // file each node was read from, for nodes that came from includes
+	path  string
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// Function to parse a config file, replacing `!include file.yaml` values with the contents of the
+// named file (relative to the including file) and expanding ${VAR} and ${VAR:-default} references
+func loadConfigDoc(path string) (*configDoc, error) {
+	doc := &configDoc{files: map[*yaml.Node]string{}, path: path}
+	root, err := doc.load(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	doc.root = root
+	return doc, nil
+}
+
+func (d *configDoc) load(path string, including map[string]bool) (*yaml.Node, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if including[abs] {
+		return nil, fmt.Errorf("%s: include cycle", path)
+	}
+	including[abs] = true
+	defer delete(including, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file yaml.Node
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = tomlNode(data, &file)
+	} else {
+		err = yaml.Unmarshal(data, &file) // JSON is read as YAML, which it is a subset of
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(file.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+
+	var errs ConfigErrors
+	d.resolve(path, file.Content[0], including, &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return file.Content[0], nil
+}
+
+func (d *configDoc) resolve(path string, node *yaml.Node, including map[string]bool, errs *ConfigErrors) {
+	if path != d.path {
+		d.files[node] = path
+	}
+
+	switch {
+	case node.Tag == "!include":
+		included, err := d.load(filepath.Join(filepath.Dir(path), node.Value), including)
+		if nested, ok := err.(ConfigErrors); ok {
+			*errs = append(*errs, nested...)
+			return
+		}
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s:%d: %v", path, node.Line, err))
+			return
+		}
+		*node = *included
+
+	case node.Kind == yaml.ScalarNode:
+		node.Value = envReference.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			m := envReference.FindStringSubmatch(ref)
+			if value, ok := os.LookupEnv(m[1]); ok {
+				return value
+			}
+			if strings.Contains(ref, ":-") {
+				return m[2]
+			}
+			*errs = append(*errs, fmt.Sprintf("%s:%d: environment variable %s is not set", path, node.Line, m[1]))
+			return ref
+		})
+
+	default:
+		for _, child := range node.Content {
+			d.resolve(path, child, including, errs)
+		}
+	}
+}
+
+// Function to parse a TOML config file into a YAML node, so that it is resolved and checked like YAML.
+// Keys are given the lines they are found on in the TOML text, for error messages.
+func tomlNode(data []byte, file *yaml.Node) error {
+	var settings map[string]interface{}
+	if err := toml.Unmarshal(data, &settings); err != nil {
+		return err
+	}
+	converted, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(converted, file); err != nil {
+		return err
+	}
+	if len(file.Content) > 0 {
+		tomlLines(file.Content[0], strings.Split(string(data), "\n"), 0)
+	}
+	return nil
+}
+
+// Function to set the lines of the keys of a mapping node to where they appear in TOML text, searching
+// from the line of the enclosing table
+func tomlLines(node *yaml.Node, lines []string, from int) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		key.Line, value.Line = from, from
+		for n := from; n < len(lines); n++ {
+			line := strings.Trim(strings.TrimSpace(lines[n]), "[]")
+			if line == key.Value || strings.HasSuffix(line, "."+key.Value) || strings.HasPrefix(line, key.Value+" ") ||
+				strings.HasPrefix(line, key.Value+"=") || strings.HasPrefix(line, key.Value+".") || strings.HasPrefix(line, `"`+key.Value+`"`) {
+				key.Line, value.Line = n+1, n+1
+				break
+			}
+		}
+		if value.Kind == yaml.MappingNode {
+			tomlLines(value, lines, key.Line)
+		}
+	}
+}
+
+// Function to render the resolved config as YAML for viper
+func (d *configDoc) bytes() ([]byte, error) {
+	return yaml.Marshal(d.root)
+}
+
+// Function to tell which file a node was read from
+func (d *configDoc) file(node *yaml.Node) string {
+	if path, ok := d.files[node]; ok {
+		return path
+	}
+	return d.path
+}
+
+// Function to check a YAML config file against the known keys and their types, reporting
+// unknown keys and type mismatches with their line numbers
+func checkConfigFile(path string) error {
+	doc, err := loadConfigDoc(path)
+	if err != nil {
+		if errs, ok := err.(ConfigErrors); ok {
+			return errs
+		}
+		return ConfigErrors{err.Error()}
+	}
+
+	var errs ConfigErrors
+	doc.check("", doc.root, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (d *configDoc) check(prefix string, node *yaml.Node, errs *ConfigErrors) {
+	if node.Kind != yaml.MappingNode {
+		*errs = append(*errs, fmt.Sprintf("%s:%d: expected a mapping of settings", d.file(node), node.Line))
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		key := prefix + keyNode.Value
+
+		want, ok := configKeyType(key)
+		if !ok {
+			msg := fmt.Sprintf("%s:%d: unknown key %q", d.file(keyNode), keyNode.Line, key)
+			if suggestion := closestConfigKey(key); suggestion != "" {
+				msg += fmt.Sprintf(", did you mean %q?", suggestion)
+			}
+			*errs = append(*errs, msg)
+			continue
+		}
+
+		if want == "map" {
+			d.check(key+".", value, errs)
+			continue
+		}
+		if want == "aliases" {
+			d.checkAliases(value, errs)
+			continue
+		}
+		if want == "modelCapabilities" {
+			d.checkModels(value, errs)
+			continue
+		}
+		if want == "workspaces" {
+			d.checkWorkspaces(value, errs)
+			continue
+		}
+		if want == "mcpServers" {
+			d.checkMCPServers(value, errs)
+			continue
+		}
+		if want == "profiles" {
+			d.checkProfiles(value, errs)
+			continue
+		}
+
+		if problem := checkConfigValue(want, value); problem != "" {
+			*errs = append(*errs, fmt.Sprintf("%s:%d: %s %s", d.file(value), value.Line, key, problem))
+		}
+	}
+}
+
+// Function to check a value node against the expected type, returning a description of any mismatch
+func checkConfigValue(want string, value *yaml.Node) string {
+	if want == "stringMap" {
+		if value.Kind != yaml.MappingNode {
+			return "must be a mapping"
+		}
+		return ""
+	}
+	if (want == "stringSlice" || want == "stringArray") && value.Kind == yaml.SequenceNode {
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "must be a list of strings"
+			}
+		}
+		return ""
+	}
+
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Sprintf("must be a %s", want)
+	}
+
+	var err error
+	switch want {
+	case "bool":
+		var b bool
+		err = value.Decode(&b)
+	case "int":
+		var n int
+		err = value.Decode(&n)
+	case "float64":
+		var f float64
+		err = value.Decode(&f)
+	default:
+		return ""
+	}
+	if err != nil {
+		return fmt.Sprintf("must be a %s, got %q", strings.TrimSuffix(want, "64"), value.Value)
+	}
+	return ""
+}
+
+// Function to find the known config key nearest to a mistyped one, if any is close enough
+func closestConfigKey(key string) string {
+	best, bestDistance := "", len(key)/2+1
+	for _, candidate := range configKeys() {
+		if d := levenshtein(strings.ToLower(key), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// Function to handle `sgpt config validate [file]` and `sgpt config export`
+func runConfig(args []string) error {
+	if len(args) == 1 && args[0] == "export" {
+		return exportConfig()
+	}
+	if len(args) == 0 || args[0] != "validate" || len(args) > 2 {
+		return fmt.Errorf("usage: sgpt config validate [file] | sgpt config export [--exportFormat nix|toml|env]")
+	}
+
+	path := viper.ConfigFileUsed()
+	if len(args) == 2 {
+		path = args[1]
+	}
+	if path == "" {
+		return fmt.Errorf("no config file found, pass the file to validate")
+	}
+
+	if err := checkConfigFile(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: ok\n", path)
+	return nil
+}
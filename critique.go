@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+)
+
+const critiqueInstruction = "You review answers for claims the input does not support. The input below has two parts: " +
+	"the material the answer was written from, and the answer. Check every claim of the answer against the material. " +
+	"Reply with VERDICT: SUPPORTED if every claim is supported, or VERDICT: UNSUPPORTED otherwise, on the first line, " +
+	"followed by one line starting with \"- \" for each unsupported or contradicted claim, quoting it and saying what " +
+	"the material says instead. Do not judge style, only support."
+
+const revisionInstruction = "\n\nA reviewer found these claims in an earlier answer unsupported by the input:\n%s\n" +
+	"Answer again, making only claims the input supports."
+
+// critique is the verdict of the critic pass on an answer
+type critique struct {
+	supported bool
+	issues    []string
+}
+
+// Function to run the critic pass chosen with --critique on an answer: the critic model, --criticModel
+// or the configured one, checks the answer against the input; with --criticModel local it is the
+// local model of --localFallback. The verdict is printed to stderr. With
+// annotate the unsupported claims are appended to the answer; with regenerate the answer is written
+// again by regenerate, with the claims to avoid added to the instruction.
+func critiqueAnswer(ctx context.Context, input, answer string, regenerate func(note string) (string, error)) (string, error) {
+	provider, model := viper.GetString("provider"), viper.GetString("model")
+	local := viper.GetString("criticModel") == "local"
+	criticModel := viper.GetString("localModel")
+	if !local {
+		if err := useModel(viper.GetString("criticModel"), provider, model); err != nil {
+			return "", fmt.Errorf("critic: %w", err)
+		}
+		criticModel = viper.GetString("model")
+	}
+
+	// Keep room for the answer if the material has to be shortened to fit the critic's context window
+	material := strings.TrimSpace(input)
+	if budget := inputBudget(criticModel, critiqueInstruction, material+answer); budget > 0 {
+		keep := budget - len(answer)
+		if keep < budget/2 {
+			keep = budget / 2
+		}
+		material = chunkText(material, keep)[0]
+	}
+	review := fmt.Sprintf("Material:\n%s\n\nAnswer:\n%s", material, strings.TrimSpace(answer))
+	var reply string
+	var err error
+	if local {
+		reply, err = callLocal(ctx, critiqueInstruction, review, 0)
+	} else {
+		reply, err = callModelContext(ctx, providerAPIKey(viper.GetString("provider")), criticModel, critiqueInstruction, review, 0)
+		useModel("", provider, model)
+	}
+	if err != nil {
+		return "", fmt.Errorf("critic: %w", err)
+	}
+
+	verdict := parseCritique(reply)
+	if verdict.supported {
+		fmt.Fprintln(os.Stderr, "critique: supported")
+		return answer, nil
+	}
+	fmt.Fprintf(os.Stderr, "critique: unsupported\n%s\n", strings.Join(verdict.issues, "\n"))
+
+	if viper.GetString("critique") == "regenerate" {
+		return regenerate(fmt.Sprintf(revisionInstruction, strings.Join(verdict.issues, "\n")))
+	}
+	return answer + "\n\nUnsupported claims:\n" + strings.Join(verdict.issues, "\n"), nil
+}
+
+// Function to parse the critic's reply. A reply without a recognizable verdict counts as unsupported
+// if it lists any issues.
+func parseCritique(reply string) critique {
+	var c critique
+	verdict := ""
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(line)
+		upper := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(upper, "VERDICT:"):
+			verdict = strings.TrimSpace(upper[len("VERDICT:"):])
+		case strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* "):
+			c.issues = append(c.issues, "- "+strings.TrimSpace(line[2:]))
+		}
+	}
+	c.supported = strings.HasPrefix(verdict, "SUPPORTED") || (verdict == "" && len(c.issues) == 0)
+	if !c.supported && len(c.issues) == 0 {
+		c.issues = []string{"- " + strings.TrimSpace(reply)}
+	}
+	return c
+}
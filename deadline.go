@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Added to the instruction with --deadline so the model keeps its reply short enough to finish in time
+const deadlineInstruction = "\n\nThe reply must be complete within %s, so keep it brief."
+
+// partialReply is returned when the reply was cut short at the deadline; it holds the text kept
+type partialReply struct {
+	text     string
+	deadline time.Duration
+}
+
+func (p *partialReply) Error() string {
+	return fmt.Sprintf("the output is partial: the deadline of %s passed before the reply was complete", p.deadline)
+}
+
+// Function to call the model with --deadline. The reply is streamed where the provider supports it;
+// if the deadline passes first, the text received so far is cut at the last sentence end and returned
+// as a *partialReply. Without streaming there is nothing to keep, so the call fails at the deadline.
+func callModelDeadline(ctx context.Context, apiKey, model, instruction, input string, temperature float64, deadline time.Duration, onText func(string)) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+	instruction += fmt.Sprintf(deadlineInstruction, deadline)
+
+	reply, err := callModelStream(ctx, apiKey, model, instruction, input, temperature, onText)
+	if errors.Is(err, errStreamingUnsupported) {
+		// The request is made under ctx too, so it is abandoned at the deadline rather than left running
+		reply, err = callModelContext(ctx, apiKey, model, instruction, input, temperature)
+		if err != nil && ctx.Err() != nil {
+			return "", fmt.Errorf("no reply from %s within the deadline of %s", model, deadline)
+		}
+		return reply, err
+	}
+
+	if err != nil && ctx.Err() != nil {
+		if text := cutAtSentence(reply); text != "" {
+			return "", &partialReply{text: text, deadline: deadline}
+		}
+		return "", fmt.Errorf("no reply from %s within the deadline of %s", model, deadline)
+	}
+	return reply, err
+}
+
+// Function to cut text after its last complete sentence, or its last whole word if it has none
+func cutAtSentence(text string) string {
+	text = strings.TrimRightFunc(text, unicode.IsSpace)
+	for i := len(text) - 1; i >= 0; i-- {
+		switch text[i] {
+		case '.', '!', '?', '\n':
+			if i+1 == len(text) || unicode.IsSpace(rune(text[i+1])) {
+				return strings.TrimSpace(text[:i+1])
+			}
+		}
+	}
+	if i := strings.LastIndexFunc(text, unicode.IsSpace); i > 0 {
+		return strings.TrimSpace(text[:i])
+	}
+	return ""
+}
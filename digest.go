@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const digestFileInstruction = "Summarize the file %s for a reader who has not seen it: what it is for, what it " +
+	"contains and anything notable about it. Reply with at most 120 words of plain prose, without headings."
+
+const digestFolderInstruction = "The input holds summaries of the files and subfolders of the folder %s, each headed " +
+	"by its name in square brackets. Summarize what the folder holds and how its parts relate. Reply with at most " +
+	"200 words of plain prose, without headings."
+
+// Noted in place of the part of a file beyond --digestTokens
+const digestTruncatedNote = "\n\n[The rest of the file was not read.]"
+
+// Directories and files the digest command leaves out besides those matching --ignore. Names starting
+// with a dot are left out as well.
+var digestIgnored = []string{"node_modules", "__pycache__"}
+
+// digestFolder is a folder of the tree being digested
+type digestFolder struct {
+	path    string // Relative to the digested directory, with slashes; "." for the directory itself
+	files   []*digestFile
+	folders []*digestFolder
+	// Deeper entries left out by --depth
+	skipped int
+	summary string
+}
+
+// digestFile is a file of the tree being digested
+type digestFile struct {
+	path    string
+	text    string
+	summary string
+}
+
+// Function to handle `sgpt digest <dir>`, which summarizes every file of a directory tree, then each
+// folder from the summaries of its files and subfolders, and prints the summaries as one Markdown
+// document. The summaries come from the response cache when a file, or every part of a folder, is
+// unchanged, so re-running the command on a tree only pays for what changed.
+func runDigest(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sgpt digest [--depth n] [--ignore pattern]... <dir>")
+	}
+	if err := validateConfig(); err != nil {
+		return err
+	}
+	if n := viper.GetInt("depth"); n < 0 {
+		return fmt.Errorf("--depth must not be negative, got %d", n)
+	}
+	if n := viper.GetInt("digestTokens"); n < 1 {
+		return fmt.Errorf("--digestTokens must be at least 1, got %d", n)
+	}
+	viper.Set("cache", true) // Unchanged files and folders are answered from the cache on later runs
+	for _, pattern := range viper.GetStringSlice("ignore") {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return fmt.Errorf("--ignore pattern %q: %v", pattern, err)
+		}
+	}
+
+	root, files, err := readDigestTree(args[0])
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%s holds no text files to digest", args[0])
+	}
+	if err := summarizeDigestFiles(files); err != nil {
+		return err
+	}
+	if err := summarizeDigestFolder(root, filepath.Base(filepath.Clean(args[0]))); err != nil {
+		return err
+	}
+
+	var doc strings.Builder
+	fmt.Fprintf(&doc, "# %s\n\n%s\n", filepath.Base(filepath.Clean(args[0])), root.summary)
+	writeDigest(&doc, root, 2)
+	_, err = fmt.Fprint(replyOut, doc.String())
+	return err
+}
+
+// Function to read the text files of a directory tree down to --depth, leaving out those matching
+// --ignore, hidden ones and binary ones. It returns the tree and its files in walking order.
+func readDigestTree(dir string) (*digestFolder, []*digestFile, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	depth := viper.GetInt("depth")
+	limit := int64(viper.GetInt("digestTokens")) * 8 // Bytes to read of a file; a token is rarely longer
+	var files []*digestFile
+	var read func(folder *digestFolder, level int) error
+	read = func(folder *digestFolder, level int) error {
+		entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(folder.path)))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			rel := path.Join(folder.path, entry.Name())
+			if digestIgnores(rel, entry.IsDir()) {
+				continue
+			}
+			if entry.IsDir() {
+				if depth > 0 && level == depth {
+					folder.skipped++
+					continue
+				}
+				sub := &digestFolder{path: rel}
+				if err := read(sub, level+1); err != nil {
+					return err
+				}
+				if len(sub.files) > 0 || len(sub.folders) > 0 {
+					folder.folders = append(folder.folders, sub)
+				}
+				continue
+			}
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			text, err := readDigestFile(filepath.Join(dir, filepath.FromSlash(rel)), limit)
+			if err != nil {
+				return err
+			}
+			if text == "" {
+				debugf("digest: leaving out %s, which is empty or binary", rel)
+				continue
+			}
+			file := &digestFile{path: rel, text: text}
+			folder.files = append(folder.files, file)
+			files = append(files, file)
+		}
+		return nil
+	}
+
+	root := &digestFolder{path: "."}
+	if err := read(root, 0); err != nil {
+		return nil, nil, err
+	}
+	return root, files, nil
+}
+
+// Function to tell whether the digest leaves out an entry, given by its path relative to the digested
+// directory. Patterns match the name or the whole path; those ending in / match only directories.
+func digestIgnores(rel string, isDir bool) bool {
+	name := path.Base(rel)
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, ignored := range digestIgnored {
+		if name == ignored {
+			return true
+		}
+	}
+	for _, pattern := range viper.GetStringSlice("ignore") {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to read up to limit bytes of a file, returning "" for files that hold no text
+func readDigestFile(name string, limit int64) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, limit))
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 || len(bytes.TrimSpace(data)) == 0 {
+		return "", nil
+	}
+	text := strings.ToValidUTF8(string(data), "")
+	if int64(len(data)) == limit {
+		text += digestTruncatedNote
+	}
+	return text, nil
+}
+
+// Function to summarize the files, up to --concurrency at a time, reporting progress on stderr
+func summarizeDigestFiles(files []*digestFile) error {
+	apiKey, model, temperature := viper.GetString("apiKey"), viper.GetString("model"), viper.GetFloat64("temperature")
+	budget := viper.GetInt("digestTokens")
+
+	var (
+		mu       sync.Mutex
+		done     int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	work := make(chan *digestFile)
+	for w := 0; w < viper.GetInt("concurrency"); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range work {
+				input := truncateTokens(model, file.text, budget)
+				summary, err := callModel(apiKey, model, fmt.Sprintf(digestFileInstruction, file.path), input, temperature)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", file.path, err)
+				}
+				file.summary = strings.TrimSpace(summary)
+				done++
+				fmt.Fprintf(os.Stderr, "\rSummarizing files %d/%d", done, len(files))
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, file := range files {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		work <- file
+	}
+	close(work)
+	wg.Wait()
+	fmt.Fprintln(os.Stderr)
+	return firstErr
+}
+
+// Function to cut text to about budget tokens, noting that the rest was left out
+func truncateTokens(model, text string, budget int) string {
+	tokens, _ := countTokens(model, text)
+	if tokens <= budget {
+		return text
+	}
+	cut := len(text) * budget / tokens
+	return strings.ToValidUTF8(text[:cut], "") + digestTruncatedNote
+}
+
+// Function to summarize a folder from the summaries of its files and subfolders, summarizing the
+// subfolders first. The folder is called name in the request.
+func summarizeDigestFolder(folder *digestFolder, name string) error {
+	var parts []sourceChunk
+	for _, sub := range folder.folders {
+		if err := summarizeDigestFolder(sub, sub.path); err != nil {
+			return err
+		}
+		parts = append(parts, sourceChunk{source: path.Base(sub.path) + "/", text: sub.summary})
+	}
+	for _, file := range folder.files {
+		parts = append(parts, sourceChunk{source: path.Base(file.path), text: file.summary})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].source < parts[j].source })
+
+	fmt.Fprintf(os.Stderr, "Summarizing %s/\n", name)
+	apiKey, model, temperature := viper.GetString("apiKey"), viper.GetString("model"), viper.GetFloat64("temperature")
+	summary, err := callModelChunked(rootCtx, apiKey, model, fmt.Sprintf(digestFolderInstruction, name), formatSourced(parts), temperature)
+	if err != nil {
+		return fmt.Errorf("%s: %w", folder.path, err)
+	}
+	folder.summary = strings.TrimSpace(summary)
+	return nil
+}
+
+// Function to write the summaries of a folder's files and subfolders as Markdown sections, nested
+// down to the deepest heading level
+func writeDigest(doc *strings.Builder, folder *digestFolder, level int) {
+	heading := strings.Repeat("#", minInt(level, 6))
+	switch {
+	case folder.skipped == 1:
+		fmt.Fprintf(doc, "\n_1 folder below the depth limit was not read._\n")
+	case folder.skipped > 1:
+		fmt.Fprintf(doc, "\n_%d folders below the depth limit were not read._\n", folder.skipped)
+	}
+	for _, file := range folder.files {
+		fmt.Fprintf(doc, "\n%s %s\n\n%s\n", heading, file.path, file.summary)
+	}
+	for _, sub := range folder.folders {
+		fmt.Fprintf(doc, "\n%s %s/\n\n%s\n", heading, sub.path, sub.summary)
+		writeDigest(doc, sub, level+1)
+	}
+}
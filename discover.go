@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"sgpt/pkg/cache"
+	"sgpt/pkg/provider/openaicompat"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// discoveredModel is a model listed by a provider's API
+type discoveredModel struct {
+	ID            string `json:"id"`
+	ContextWindow int    `json:"contextWindow,omitempty"`
+	Vision        bool   `json:"vision,omitempty"`
+	NoStreaming   bool   `json:"noStreaming,omitempty"`
+}
+
+// Function to list the models a provider offers from its list-models API. Lists are kept in the
+// response cache for --modelListTTL, unless --noCache is given. An expired list is revalidated with
+// the ETag the API sent it with, and used as it is when the API can't be reached.
+func listModels(provider string) ([]discoveredModel, error) {
+	endpoint := providerBaseURL(provider)
+	if provider == "bedrock" {
+		endpoint = providerRegion("bedrock")
+	}
+	key, err := cache.Key("models", provider, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	lists := cache.New(cacheDir(), viper.GetDuration("modelListTTL"))
+	var cachedModels []discoveredModel
+	cached, etag := "", ""
+	if !viper.GetBool("noCache") {
+		var fresh, ok bool
+		cached, etag, fresh, ok = lists.Lookup(key)
+		if ok && json.Unmarshal([]byte(cached), &cachedModels) == nil {
+			if fresh {
+				debugf("cached model list of %s", provider)
+				return cachedModels, nil
+			}
+		} else {
+			cachedModels, etag = nil, ""
+		}
+	}
+
+	var models []discoveredModel
+	if provider == "bedrock" {
+		client := newBedrockClient()
+		debugf("GET model list of bedrock in %s", client.Region)
+		listed, err := client.Models()
+		if err != nil {
+			return staleModels(provider, cachedModels, err)
+		}
+		for _, m := range listed {
+			models = append(models, discoveredModel{ID: m.ID, Vision: m.Vision, NoStreaming: !m.Streaming})
+		}
+		etag = ""
+	} else {
+		client, err := chatClient(provider)
+		if err != nil {
+			return staleModels(provider, cachedModels, err)
+		}
+		debugf("GET %s/models", client.BaseURL)
+		listed, newETag, err := client.ModelsIfChanged(etag)
+		if errors.Is(err, openaicompat.ErrNotModified) {
+			debugf("model list of %s is unchanged", provider)
+			if err := lists.PutTagged(key, cached, etag); err != nil {
+				debugf("caching model list: %v", err)
+			}
+			return cachedModels, nil
+		}
+		if err != nil {
+			return staleModels(provider, cachedModels, err)
+		}
+		for _, m := range listed {
+			models = append(models, discoveredModel{ID: m.ID, ContextWindow: m.ContextWindow, Vision: m.Vision})
+		}
+		etag = newETag
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+
+	if data, err := json.Marshal(models); err == nil {
+		if err := lists.PutTagged(key, string(data), etag); err != nil {
+			debugf("caching model list: %v", err)
+		}
+	}
+	return models, nil
+}
+
+// Function to fall back on an expired model list when the provider's list can't be fetched
+func staleModels(provider string, cached []discoveredModel, err error) ([]discoveredModel, error) {
+	if cached == nil {
+		return nil, err
+	}
+	debugf("using the expired model list of %s: %v", provider, err)
+	return cached, nil
+}
+
+// Function to look a model that is not among the known models up in the provider's model list,
+// adding it to the known models if the provider offers it
+func discoverModel(provider, model string) bool {
+	models, err := listModels(provider)
+	if err != nil {
+		debugf("model discovery: %v", err)
+		return false
+	}
+	for _, m := range models {
+		if m.ID == model {
+			caps := ModelCaps{Provider: provider, Vision: m.Vision, NoStreaming: m.NoStreaming, ContextWindow: m.ContextWindow}
+			if provider == "openai" {
+				caps.Endpoint = chatCompletionsURL
+			}
+			modelCapabilities[model] = caps
+			debugf("model %s found in the model list of %s", model, provider)
+			return true
+		}
+	}
+	return false
+}
+
+// Function to handle `sgpt models [provider...]`, which lists the models offered by the configured
+// provider, or the given ones, with what is known of their capabilities
+func runModels(args []string) error {
+	if len(args) == 0 {
+		args = []string{viper.GetString("provider")}
+	}
+	for _, provider := range args {
+		if !isProvider(provider) {
+			return fmt.Errorf("unsupported provider %q, supported providers are %s", provider, strings.Join(providers, ", "))
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tMODEL\tCONTEXT\tVISION\tSTREAMING\tPRICE IN/OUT")
+	for _, provider := range args {
+		models, err := listModels(provider)
+		if err != nil {
+			return err
+		}
+		for _, m := range models {
+			context, price := "-", "-"
+			caps, known := modelCapabilities[m.ID]
+			known = known && caps.Provider == provider
+			if known {
+				m.Vision = m.Vision || caps.Vision
+				m.NoStreaming = m.NoStreaming || caps.NoStreaming
+				if caps.ContextWindow > 0 {
+					m.ContextWindow = caps.ContextWindow
+				}
+				if caps.InputPrice > 0 || caps.OutputPrice > 0 {
+					price = fmt.Sprintf("$%g/$%g", caps.InputPrice, caps.OutputPrice)
+				}
+			}
+			if m.ContextWindow > 0 {
+				context = fmt.Sprint(m.ContextWindow)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", provider, m.ID, context, yesNo(m.Vision), yesNo(!m.NoStreaming), price)
+		}
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr, "Prices are USD per million tokens, for models in the model catalog or the configured model list.")
+	return nil
+}
+
+// Function to format a capability as yes or no
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
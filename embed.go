@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"os"
+	"sgpt/pkg/provider/openaicompat"
+	"strings"
+)
+
+// Base URL of the OpenAI API, used for embeddings
+const openAIBaseURL = "https://api.openai.com/v1"
+
+// Embedding model used for each provider that supports embeddings when --embeddingModel is not given
+var defaultEmbeddingModels = map[string]string{
+	"openai":  "text-embedding-3-small",
+	"mistral": "mistral-embed",
+}
+
+// Number of texts sent in one embeddings request
+const embedBatchSize = 96
+
+// embedding is one line of `sgpt embed` output
+type embedding struct {
+	Text      string    `json:"text"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// Function to handle `sgpt embed [text]`, which prints the embedding of the text given as arguments,
+// or of each non-empty line of stdin, as JSON Lines or, with --embedFormat json, as one JSON array
+func runEmbed(args []string) error {
+	format := viper.GetString("embedFormat")
+	if format != "jsonl" && format != "json" {
+		return fmt.Errorf("embedding format %q is not one of jsonl, json", format)
+	}
+
+	provider, model := viper.GetString("provider"), viper.GetString("embeddingModel")
+	if model != "" {
+		explicit := ""
+		if pflag.CommandLine.Changed("provider") {
+			explicit = provider
+		}
+		provider, model = modelProvider(model, explicit)
+	} else {
+		model = defaultEmbeddingModels[provider]
+	}
+
+	loadKeyringKey(provider)
+	var client *openaicompat.Client
+	switch provider {
+	case "openai":
+		client = openaicompat.NewClient("openai", openAIURL(openAIBaseURL+"/"), providerAPIKey(provider), httpClient)
+		client.UserAgent = userAgent()
+	case "mistral":
+		client = newCompatibleClient(provider)
+	default:
+		return fmt.Errorf("embeddings are not supported by %s, use openai or mistral", provider)
+	}
+	if client.APIKey == "" {
+		return fmt.Errorf("no %s API key: set %s, pass -k/--apiKey, or add %s to the config file", provider, providerKeyEnv[provider], apiKeyConfigKey(provider))
+	}
+
+	var texts []string
+	if len(args) > 0 {
+		texts = []string{strings.Join(args, " ")}
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				texts = append(texts, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("Error reading input from stdin: %v", err)
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	var all []embedding
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch := texts[start:minInt(start+embedBatchSize, len(texts))]
+		debugf("POST embeddings model=%s texts=%d", model, len(batch))
+		vectors, err := client.Embed(model, batch)
+		if err != nil {
+			return err
+		}
+		for i, vector := range vectors {
+			e := embedding{Text: batch[i], Embedding: vector}
+			if format == "json" {
+				all = append(all, e)
+			} else if err := encoder.Encode(e); err != nil {
+				return err
+			}
+		}
+	}
+
+	if format == "json" {
+		if all == nil {
+			all = []embedding{}
+		}
+		return encoder.Encode(all)
+	}
+	return nil
+}
+
+// Function to return the smaller of two ints
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"sort"
+	"strings"
+)
+
+// Parts of config keys that hold secrets, which `sgpt config export` leaves out
+var secretKeyParts = []string{"apikey", "token", "secret", "password"}
+
+// Function to handle `sgpt config export`, which prints the current settings from the config file,
+// environment and command line, without secrets, as a Nix attribute set, TOML or environment variables
+func exportConfig() error {
+	settings := map[string]interface{}{}
+	for _, key := range viper.AllKeys() {
+		if !viper.IsSet(key) || isSecretKey(key) || key == "exportformat" || strings.HasPrefix(key, "modelcapabilities.") {
+			continue // viper splits model names at their dots, so the model registry can't be exported from it
+		}
+		if value, ok := viper.Get(key).(string); ok && value == "" {
+			continue // Cleared, e.g. a model left for the provider to choose
+		}
+		key = canonicalKey(key)
+		setNested(settings, strings.Split(key, "."), typedSetting(key))
+	}
+
+	var b strings.Builder
+	switch format := viper.GetString("exportFormat"); format {
+	case "toml":
+		writeTOML(&b, settings, "")
+	case "nix":
+		b.WriteString("# sgpt settings, e.g. for xdg.configFile in Home Manager with (pkgs.formats.yaml { }).generate\n")
+		writeNix(&b, settings, "")
+		b.WriteString("\n")
+	case "env":
+		writeEnv(&b, settings, "")
+	default:
+		return fmt.Errorf("export format %q is not one of nix, toml, env", format)
+	}
+	fmt.Print(b.String())
+	return nil
+}
+
+// Function to report whether a config key holds a secret
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to restore the casing of a key that viper has lowercased, as far as the key is known
+func canonicalKey(key string) string {
+	known := map[string]string{}
+	for _, k := range configKeys() {
+		known[strings.ToLower(k)] = k
+	}
+	parts := strings.Split(key, ".")
+	if parts[0] == "profiles" && len(parts) > 2 {
+		return strings.Join(parts[:2], ".") + "." + canonicalKey(strings.Join(parts[2:], "."))
+	}
+	for i := len(parts); i > 0; i-- {
+		if k, ok := known[strings.Join(parts[:i], ".")]; ok {
+			return strings.Join(append(strings.Split(k, "."), parts[i:]...), ".")
+		}
+	}
+	return key
+}
+
+// Function to get a setting as the type of its flag, since viper returns flag values as strings
+func typedSetting(key string) interface{} {
+	t, _ := configKeyType(key)
+	switch t {
+	case "bool":
+		return viper.GetBool(key)
+	case "int":
+		return viper.GetInt(key)
+	case "float64":
+		return viper.GetFloat64(key)
+	case "stringSlice", "stringArray":
+		return viper.GetStringSlice(key)
+	}
+	return viper.Get(key)
+}
+
+// Function to store a value in nested maps along a key path
+func setNested(m map[string]interface{}, path []string, value interface{}) {
+	for _, part := range path[:len(path)-1] {
+		child, ok := m[part].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[part] = child
+		}
+		m = child
+	}
+	m[path[len(path)-1]] = value
+}
+
+// Function to return the keys of a map in order, with nested maps last as TOML needs its tables after plain values
+func sortedSettingKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		_, iTable := m[keys[i]].(map[string]interface{})
+		_, jTable := m[keys[j]].(map[string]interface{})
+		if iTable != jTable {
+			return jTable
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// Function to write settings as TOML, with nested maps as tables
+func writeTOML(b *strings.Builder, m map[string]interface{}, table string) {
+	for _, key := range sortedSettingKeys(m) {
+		name := tomlKey(key)
+		if table != "" {
+			name = table + "." + name
+		}
+		if child, ok := m[key].(map[string]interface{}); ok {
+			fmt.Fprintf(b, "\n[%s]\n", name)
+			writeTOML(b, child, name)
+			continue
+		}
+		fmt.Fprintf(b, "%s = %s\n", tomlKey(key), formatValue(m[key], false))
+	}
+}
+
+// Function to quote a TOML key unless it is a bare key
+func tomlKey(key string) string {
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return jsonString(key)
+		}
+	}
+	return key
+}
+
+// Function to write settings as a Nix attribute set
+func writeNix(b *strings.Builder, m map[string]interface{}, indent string) {
+	b.WriteString("{\n")
+	for _, key := range sortedSettingKeys(m) {
+		fmt.Fprintf(b, "%s  %s = ", indent, nixKey(key))
+		if child, ok := m[key].(map[string]interface{}); ok {
+			writeNix(b, child, indent+"  ")
+		} else {
+			b.WriteString(formatValue(m[key], true))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString(indent + "}")
+}
+
+// Function to quote a Nix attribute name unless it is an identifier
+func nixKey(key string) string {
+	for i, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '\'')) {
+			return nixString(key)
+		}
+	}
+	return key
+}
+
+// Function to write a Nix string literal
+func nixString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", `\${`).Replace(s)
+	return `"` + s + `"`
+}
+
+// Function to write a JSON string literal, which is also a valid TOML basic string
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// Function to format a scalar or list setting as a Nix or TOML value
+func formatValue(value interface{}, nix bool) string {
+	quote := jsonString
+	if nix {
+		quote = nixString
+	}
+	var items []string
+	switch v := value.(type) {
+	case string:
+		return quote(v)
+	case bool, int, int64, float64:
+		return fmt.Sprint(v)
+	case []string:
+		for _, item := range v {
+			items = append(items, quote(item))
+		}
+	case []interface{}:
+		for _, item := range v {
+			items = append(items, formatValue(item, nix))
+		}
+	default:
+		return quote(fmt.Sprint(value))
+	}
+	if nix {
+		return "[ " + strings.Join(items, " ") + " ]"
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// Function to write settings as shell environment variable assignments, with a comment for
+// each setting that has no environment variable
+func writeEnv(b *strings.Builder, m map[string]interface{}, prefix string) {
+	withEnv := map[string]bool{"bedrock.region": true}
+	for _, key := range envSettings {
+		withEnv[key] = true
+	}
+	for _, key := range sortedSettingKeys(m) {
+		if child, ok := m[key].(map[string]interface{}); ok {
+			writeEnv(b, child, prefix+key+".")
+			continue
+		}
+		name := prefix + key
+		value := fmt.Sprint(m[key])
+		if list, ok := m[key].([]interface{}); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			value = strings.Join(items, ",")
+		} else if list, ok := m[key].([]string); ok {
+			value = strings.Join(list, ",")
+		}
+		if !withEnv[name] {
+			fmt.Fprintf(b, "# %s = %s (no environment variable, set it in the config file)\n", name, jsonString(value))
+			continue
+		}
+		fmt.Fprintf(b, "export %s=%s\n", envVarName(name), shellQuote(value))
+	}
+}
+
+// Function to quote a value for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os/exec"
+	"sgpt/pkg/integrations/github"
+	"strconv"
+	"strings"
+)
+
+const prReviewInstruction = "You are an experienced code reviewer. Review the following pull request. " +
+	"Point out bugs, risky changes and missing tests, referring to files and lines where possible, " +
+	"and finish with an overall recommendation."
+
+const issueSummaryInstruction = "Summarize the following GitHub issue and its discussion. " +
+	"Describe the problem, the current state of the discussion, any decisions made and open questions."
+
+// Function to handle `sgpt gh <pr-review|issue-summarize> <number>`
+func runGitHub(args []string) error {
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	if len(args) != 2 {
+		return fmt.Errorf("usage: sgpt gh <pr-review|issue-summarize> <number> [--repo owner/name] [--post]")
+	}
+
+	number, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid issue or pull request number %q", args[1])
+	}
+
+	repo := viper.GetString("repo")
+	if repo == "" {
+		out, err := exec.Command("git", "remote", "get-url", "origin").Output()
+		if err != nil {
+			return fmt.Errorf("no --repo given and unable to read the origin remote: %v", err)
+		}
+		repo = string(out)
+	}
+	owner, name, err := github.ParseRepo(repo)
+	if err != nil {
+		return err
+	}
+
+	client := github.NewClient(viper.GetString("githubToken"))
+	client.HTTP = httpClient
+	client.UserAgent = userAgent()
+	instruction := viper.GetString("instruction")
+
+	var input string
+	switch args[0] {
+	case "pr-review":
+		pr, err := client.PullRequest(owner, name, number)
+		if err != nil {
+			return err
+		}
+		if instruction == "" {
+			instruction = prReviewInstruction
+		}
+		input = fmt.Sprintf("Title: %s\n\n%s\n\n%s", pr.Title, pr.Body, pr.Diff)
+
+	case "issue-summarize":
+		issue, err := client.Issue(owner, name, number)
+		if err != nil {
+			return err
+		}
+		if instruction == "" {
+			instruction = issueSummaryInstruction
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Title: %s\nState: %s\n\n%s\n", issue.Title, issue.State, issue.Body)
+		for _, c := range issue.Comments {
+			fmt.Fprintf(&b, "\n%s wrote:\n%s\n", c.User.Login, c.Body)
+		}
+		input = b.String()
+
+	default:
+		return fmt.Errorf("unknown gh command %q", args[0])
+	}
+
+	message, err := callModelChunked(rootCtx, viper.GetString("apiKey"), viper.GetString("model"), instruction, input, viper.GetFloat64("temperature"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(message)
+
+	if viper.GetBool("post") {
+		return client.PostComment(owner, name, number, message)
+	}
+	return nil
+}
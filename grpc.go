@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log"
+	"net"
+	"sgpt/pkg/provider/bedrock"
+	"sgpt/pkg/provider/openaicompat"
+	"sgpt/pkg/rpc"
+	"strings"
+)
+
+// grpcServer answers the calls of the Sgpt gRPC service through the configured providers
+type grpcServer struct {
+	rpc.UnimplementedSgptServer
+}
+
+// grpcCall is a request of the gRPC service resolved to its provider and conversation
+type grpcCall struct {
+	id       string
+	provider string
+	model    string
+	system   string
+	turns    []openaicompat.Message
+	req      *rpc.Request
+}
+
+// Function to handle `sgpt grpc`, which offers the Sgpt gRPC service defined in pkg/rpc/sgpt.proto on
+// --grpcListen. It routes requests to providers the way `sgpt serve` does, for services that would
+// rather call sgpt over HTTP/2 with streaming than run it as a process per request.
+func runGRPC(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: sgpt grpc [--grpcListen address] [--serveToken token] [--tlsCert file --tlsKey file]")
+	}
+	if err := validateConfig(); err != nil {
+		return err
+	}
+	listen, token := viper.GetString("grpcListen"), viper.GetString("serveToken")
+	tlsConfig, local, err := listenTLS("grpcListen", listen, "127.0.0.1:50051")
+	if err != nil {
+		return err
+	}
+	if !local && token == "" {
+		return fmt.Errorf("--grpcListen %s accepts requests from other machines, which would use your API keys; set --serveToken to require it as their bearer token", listen)
+	}
+	for _, provider := range providers {
+		loadKeyringKey(provider) // Before requests are served concurrently
+	}
+
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(serveMaxRequest)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if token != "" {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := grpcAuthorize(ctx, token); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := grpcAuthorize(ss.Context(), token); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}))
+	}
+	server := grpc.NewServer(opts...)
+	rpc.RegisterSgptServer(server, grpcServer{})
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving the sgpt.v1.Sgpt gRPC service on %s with %s/%s as the default model", listener.Addr(), viper.GetString("provider"), viper.GetString("model"))
+	go func() {
+		<-rootCtx.Done()
+		server.GracefulStop() // Let the calls being answered finish
+	}()
+	return server.Serve(listener)
+}
+
+// Function to check that a call carries the --serveToken as its bearer token in the authorization
+// metadata
+func grpcAuthorize(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var given string
+	if values := md.Get("authorization"); len(values) > 0 {
+		given = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid token, give the --serveToken of sgpt grpc as a bearer token in the authorization metadata")
+	}
+	return nil
+}
+
+// Function to resolve a request to its provider, model and conversation
+func newGRPCCall(req *rpc.Request) (*grpcCall, error) {
+	var messages []openaicompat.Message
+	for _, m := range req.Messages {
+		messages = append(messages, openaicompat.Message{Role: m.Role, Content: m.Content})
+	}
+	system, turns, err := splitConversation(messages)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	provider, model := serveModel(req.Model)
+	if err := serveProviderAllowed(provider); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &grpcCall{id: "sgpt-" + randomHex(12), provider: provider, model: model, system: system, turns: turns, req: req}, nil
+}
+
+// Function to return the temperature of a request, the configured one if it sets none
+func (c *grpcCall) temperature() float64 {
+	if c.req.Temperature != nil {
+		return *c.req.Temperature
+	}
+	return viper.GetFloat64("temperature")
+}
+
+// Function to send a request to Bedrock, whose replies are not streamed
+func (c *grpcCall) converse(ctx context.Context) (*rpc.Response, error) {
+	request := bedrock.Request{Model: c.model, System: c.system, Input: c.turns[0].Content, Temperature: c.temperature(),
+		MaxTokens: int(c.req.MaxTokens), TopP: c.req.TopP, Stop: c.req.Stop}
+	for _, turn := range c.turns[1:] {
+		request.History = append(request.History, bedrock.Turn{Role: turn.Role, Text: turn.Content})
+	}
+	response, err := newBedrockClient().ConverseContext(ctx, request)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	recordUsage(ctx, c.provider, c.model, response.InputTokens, response.OutputTokens)
+	return &rpc.Response{Id: c.id, Model: c.model, Text: response.Text, FinishReason: bedrockFinishReason(response.StopReason),
+		Usage: &rpc.Usage{PromptTokens: int32(response.InputTokens), CompletionTokens: int32(response.OutputTokens)}}, nil
+}
+
+// Function to build the request sent to an OpenAI-compatible provider
+func (c *grpcCall) chatRequest() openaicompat.Request {
+	return openaicompat.Request{
+		Model:       c.model,
+		System:      c.system,
+		Input:       c.turns[0].Content,
+		History:     c.turns[1:],
+		Temperature: c.temperature(),
+		MaxTokens:   int(c.req.MaxTokens),
+		Sampling: openaicompat.Sampling{TopP: c.req.TopP, FrequencyPenalty: c.req.FrequencyPenalty,
+			PresencePenalty: c.req.PresencePenalty, Stop: c.req.Stop, Seed: c.req.Seed},
+		ServiceTier: serviceTier(c.provider),
+	}
+}
+
+// Complete answers a request with the whole reply
+func (grpcServer) Complete(ctx context.Context, req *rpc.Request) (*rpc.Response, error) {
+	c, err := newGRPCCall(req)
+	if err != nil {
+		return nil, err
+	}
+	debugf("grpc: Complete with %d messages for %s/%s", len(c.turns), c.provider, c.model)
+	if c.provider == "bedrock" {
+		return c.converse(ctx)
+	}
+
+	client, err := chatClient(c.provider)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	response, err := client.CompleteContext(ctx, c.chatRequest())
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	recordUsage(ctx, c.provider, c.model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	model := c.model
+	if response.Model != "" {
+		model = response.Model
+	}
+	return &rpc.Response{Id: c.id, Model: model, Text: response.Text, FinishReason: response.FinishReason,
+		Usage: &rpc.Usage{PromptTokens: int32(response.Usage.PromptTokens), CompletionTokens: int32(response.Usage.CompletionTokens)}}, nil
+}
+
+// Stream answers a request with the reply as the provider writes it, ending with a chunk that holds
+// the finish reason and the usage
+func (grpcServer) Stream(req *rpc.Request, stream rpc.Sgpt_StreamServer) error {
+	ctx := stream.Context()
+	c, err := newGRPCCall(req)
+	if err != nil {
+		return err
+	}
+	debugf("grpc: Stream with %d messages for %s/%s", len(c.turns), c.provider, c.model)
+	if c.provider == "bedrock" {
+		// Bedrock replies are not streamed; send the whole reply as one chunk
+		response, err := c.converse(ctx)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&rpc.StreamChunk{Id: c.id, Model: c.model, Text: response.Text}); err != nil {
+			return err
+		}
+		return stream.Send(&rpc.StreamChunk{Id: c.id, Model: c.model, FinishReason: response.FinishReason, Usage: response.Usage})
+	}
+
+	client, err := chatClient(c.provider)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	var sendErr error
+	response, err := client.Stream(ctx, c.chatRequest(), func(text string) {
+		if sendErr == nil {
+			sendErr = stream.Send(&rpc.StreamChunk{Id: c.id, Model: c.model, Text: text})
+		}
+	})
+	if response != nil {
+		recordUsage(ctx, c.provider, c.model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	}
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	return stream.Send(&rpc.StreamChunk{Id: c.id, Model: c.model, FinishReason: response.FinishReason,
+		Usage: &rpc.Usage{PromptTokens: int32(response.Usage.PromptTokens), CompletionTokens: int32(response.Usage.CompletionTokens)}})
+}
+
+// Function to turn the error of a provider into a gRPC status, keeping cancellations and deadlines of
+// the call as such
+func grpcError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
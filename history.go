@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sgpt/pkg/i18n"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// historyEntry is a prompt and its reply, as stored in the history file
+type historyEntry struct {
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	Provider    string    `json:"provider"`
+	Model       string    `json:"model"`
+	Instruction string    `json:"instruction,omitempty"`
+	Input       string    `json:"input"`
+	Reply       string    `json:"reply"`
+	Tags        []string  `json:"tags,omitempty"`
+	Rating      int       `json:"rating,omitempty"` // +1 or -1, zero if unrated
+	Comment     string    `json:"comment,omitempty"`
+	// Parameters the reply was made with, for `sgpt replay --exact`
+	Temperature       float64  `json:"temperature,omitempty"`
+	TopP              float64  `json:"top_p,omitempty"`
+	TopK              int      `json:"top_k,omitempty"`
+	FrequencyPenalty  float64  `json:"frequency_penalty,omitempty"`
+	PresencePenalty   float64  `json:"presence_penalty,omitempty"`
+	Stop              []string `json:"stop,omitempty"`
+	Seed              int64    `json:"seed,omitempty"`
+	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
+}
+
+// Fine-tuning dataset formats of `sgpt history export`
+var exportFormats = []string{"openai-ft", "jsonl-chat"}
+
+// Function to return the path of the history file
+func historyFile() (string, error) {
+	if path := viper.GetString("historyFile"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sgpt", "history.jsonl"), nil
+}
+
+// Function to add a prompt and its reply to the history file with --saveHistory, tagged with --tag
+// and rated with --rate, which save the reply as well, as does --askRating. The input and reply are
+// saved as they were sent and received, so with --piiPolicy the history holds placeholders rather
+// than the personal information. The seed and sampling parameters are saved too, so that the reply
+// can be reproduced with `sgpt replay --exact`. It returns the ID of the entry, or "" if none was saved.
+func recordHistory(provider, model, instruction, input, reply, fingerprint string) string {
+	if !savesHistory() {
+		return ""
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	sampling := samplingOptions()
+	entry := historyEntry{
+		ID:                hex.EncodeToString(b),
+		Time:              time.Now().UTC(),
+		Provider:          provider,
+		Model:             model,
+		Instruction:       instruction,
+		Input:             input,
+		Reply:             reply,
+		Tags:              viper.GetStringSlice("tag"),
+		Comment:           viper.GetString("ratingComment"),
+		Temperature:       viper.GetFloat64("temperature"),
+		TopP:              sampling.TopP,
+		TopK:              sampling.TopK,
+		FrequencyPenalty:  sampling.FrequencyPenalty,
+		PresencePenalty:   sampling.PresencePenalty,
+		Stop:              sampling.Stop,
+		Seed:              requestSeed(provider),
+		SystemFingerprint: fingerprint,
+	}
+	if rate := viper.GetString("rate"); rate != "" {
+		entry.Rating, _ = parseRating(rate) // Checked by validateConfig
+	}
+
+	path, err := historyFile()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+	}
+	if err == nil {
+		err = appendJSONLine(path, entry)
+	}
+	if err != nil {
+		log.Printf("warning: reply not saved to the history: %v", err)
+		return ""
+	}
+	debugf("saved to the history as %s", entry.ID)
+	return entry.ID
+}
+
+// Function to tell whether replies are saved to the history, with --saveHistory, --rate or --askRating
+func savesHistory() bool {
+	return viper.GetBool("saveHistory") || viper.GetString("rate") != "" || viper.GetBool("askRating")
+}
+
+// Function to ask on the terminal for a rating of the reply saved as the history entry id, with
+// --askRating. A rating may be followed by a comment, e.g. "- too long"; an empty answer skips it.
+func askRating(id string) error {
+	if id == "" || !viper.GetBool("askRating") || viper.GetString("rate") != "" || !isTerminal(os.Stderr) {
+		return nil
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil // Not interactive
+	}
+	defer tty.Close()
+
+	in := bufio.NewReader(tty)
+	for {
+		fmt.Fprint(os.Stderr, i18n.T("Rate this reply: [+] good, [-] bad, optionally followed by a comment, Enter to skip: "))
+		answer, err := in.ReadString('\n')
+		if err != nil && answer == "" {
+			return nil
+		}
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return nil
+		}
+		word, comment := answer, ""
+		if i := strings.IndexAny(answer, " \t"); i > 0 {
+			word, comment = answer[:i], strings.TrimSpace(answer[i:])
+		}
+		switch word {
+		case "+":
+			word = "+1"
+		case "-":
+			word = "-1"
+		}
+		rating, err := parseRating(word)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		return rateHistory(id, rating, comment)
+	}
+}
+
+// Function to append a value as a line of JSON to a file. A single short write in append mode keeps
+// lines from concurrent runs whole.
+func appendJSONLine(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Function to read the history file, oldest entry first
+func readHistory() ([]historyEntry, error) {
+	path, err := historyFile()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+	decoder := json.NewDecoder(file)
+	for {
+		var entry historyEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Function to replace the history file with entries. The file is written to a temporary file and
+// renamed into place, so an interrupted write loses nothing.
+func writeHistory(entries []historyEntry) error {
+	path, err := historyFile()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".history-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := json.NewEncoder(tmp)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Function to handle `sgpt history [list|export]`. list, the default, prints the saved entries that
+// match the filters; export converts them into a fine-tuning dataset in the --datasetFormat given.
+func runHistory(args []string) error {
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if len(args) > 1 || (action != "list" && action != "export") {
+		return fmt.Errorf("usage: sgpt history [list|export] [--tag tag] [--since date] [--until date] [--minRating -1|0|1]")
+	}
+
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+	entries, err = filterHistory(entries)
+	if err != nil {
+		return err
+	}
+
+	if action == "export" {
+		format := viper.GetString("datasetFormat")
+		if format != exportFormats[0] && format != exportFormats[1] {
+			return fmt.Errorf("dataset format %q is not one of %s", format, strings.Join(exportFormats, ", "))
+		}
+		return exportDataset(os.Stdout, entries, format)
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("No history saved yet, or none that matches. Save replies with --saveHistory."))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tMODEL\tRATING\tTAGS\tINPUT")
+	for _, e := range entries {
+		rating := "-"
+		if e.Rating != 0 {
+			rating = fmt.Sprintf("%+d", e.Rating)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04"), e.Model, rating,
+			strings.Join(e.Tags, ","), summarize(e.Input, 50))
+	}
+	return w.Flush()
+}
+
+// Function to select the history entries given by --tag, --since, --until and --minRating
+func filterHistory(entries []historyEntry) ([]historyEntry, error) {
+	var since, until time.Time
+	for key, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value := viper.GetString(key); value != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("--%s must be a date such as 2024-05-31, got %q", key, value)
+			}
+			*t = parsed
+		}
+	}
+	if !until.IsZero() {
+		until = until.AddDate(0, 0, 1) // Include the whole day
+	}
+	tags := viper.GetStringSlice("tag")
+	minRating := viper.GetInt("minRating")
+
+	var selected []historyEntry
+	for _, e := range entries {
+		if (!since.IsZero() && e.Time.Before(since)) || (!until.IsZero() && !e.Time.Before(until)) || e.Rating < minRating {
+			continue
+		}
+		if len(tags) > 0 && !hasAnyTag(e.Tags, tags) {
+			continue
+		}
+		selected = append(selected, e)
+	}
+	return selected, nil
+}
+
+// Function to tell whether an entry has one of the tags
+func hasAnyTag(entryTags, tags []string) bool {
+	for _, t := range entryTags {
+		for _, want := range tags {
+			if t == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// datasetMessage is a message of a conversation in a fine-tuning dataset
+type datasetMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Function to write history entries as a fine-tuning dataset, one conversation per line: openai-ft
+// in the chat format OpenAI fine-tuning accepts, jsonl-chat in the same format with the entry's
+// metadata added, for other tools
+func exportDataset(w io.Writer, entries []historyEntry, format string) error {
+	encoder := json.NewEncoder(w)
+	for _, e := range entries {
+		var messages []datasetMessage
+		if e.Instruction != "" {
+			messages = append(messages, datasetMessage{"system", e.Instruction})
+		}
+		messages = append(messages, datasetMessage{"user", e.Input}, datasetMessage{"assistant", e.Reply})
+
+		var line interface{} = struct {
+			Messages []datasetMessage `json:"messages"`
+		}{messages}
+		if format == "jsonl-chat" {
+			line = struct {
+				ID       string           `json:"id"`
+				Time     time.Time        `json:"time"`
+				Model    string           `json:"model"`
+				Tags     []string         `json:"tags,omitempty"`
+				Rating   int              `json:"rating"`
+				Comment  string           `json:"comment,omitempty"`
+				Messages []datasetMessage `json:"messages"`
+			}{e.ID, e.Time, e.Provider + "/" + e.Model, e.Tags, e.Rating, e.Comment, messages}
+		}
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to handle `sgpt rate <id|last> up|down [comment]`, which records the quality of a saved
+// reply, for filtering the history and exported datasets. +1 and -1 are accepted too, though -1 has
+// to follow -- so that it isn't read as a flag.
+func runRate(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: sgpt rate <id|last> up|down [comment]")
+	}
+	rating, err := parseRating(args[1])
+	if err != nil {
+		return err
+	}
+	return rateHistory(args[0], rating, strings.Join(args[2:], " "))
+}
+
+// Function to parse a rating given as +1 or -1, also accepted as up and down
+func parseRating(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "up", "good":
+		return 1, nil
+	case "down", "bad":
+		return -1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || (n != 1 && n != -1) {
+		return 0, fmt.Errorf("rating must be up or down, got %q", s)
+	}
+	return n, nil
+}
+
+// Function to set the rating and comment of the history entry with the given ID, or of the latest
+// entry for "last"
+func rateHistory(id string, rating int, comment string) error {
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+	i, err := historyIndex(entries, id)
+	if err != nil {
+		return err
+	}
+	entries[i].Rating = rating
+	if comment != "" {
+		entries[i].Comment = comment
+	}
+	return writeHistory(entries)
+}
+
+// Function to find the history entry with the given ID, or the latest entry for "last"
+func historyIndex(entries []historyEntry, id string) (int, error) {
+	i := len(entries) - 1
+	if id != "last" {
+		for i >= 0 && entries[i].ID != id {
+			i--
+		}
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("no history entry %s, see `sgpt history`", id)
+	}
+	return i, nil
+}
+
+// Function to shorten text to one line of at most n characters
+func summarize(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return text
+}
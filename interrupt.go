@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Context of the whole run, cancelled by SIGINT or SIGTERM so that requests in flight are abandoned
+// and sgpt returns through main with its cleanup done, instead of exiting wherever it stands
+var rootCtx = context.Background()
+
+// How long after an interrupt sgpt waits for the run to wind down before saying how to quit at once
+const interruptGrace = time.Second
+
+// Function to cancel rootCtx on the first SIGINT or SIGTERM. The signals are then handled the
+// default way again, so a second one quits at once when sgpt is blocked on something the context
+// can't cancel, such as reading from a terminal.
+func handleInterrupts() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	rootCtx = ctx
+	go func() {
+		<-ctx.Done()
+		stop()
+		time.Sleep(interruptGrace)
+		log.Print("Interrupted, finishing up; interrupt again to quit at once")
+	}()
+}
+
+// Function to report a failed run and exit, with status 130 when it failed because it was
+// interrupted
+func fatal(err error) {
+	if rootCtx.Err() != nil {
+		log.Print("Interrupted")
+		os.Exit(130)
+	}
+	log.Fatal(err)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"sgpt/pkg/i18n"
+	"sgpt/pkg/integrations/kubernetes"
+)
+
+const k8sInstruction = "You are an experienced Kubernetes operator. Use the cluster context below to answer " +
+	"the user's question. Do not suggest commands that modify the cluster unless asked to."
+
+const k8sApplyInstruction = "You are an experienced Kubernetes operator. Using the cluster context below, write " +
+	"the Kubernetes manifest the user asks for. Respond only with the YAML manifest, without explanations or code fences."
+
+// Function to handle `sgpt k8s [question]`. The cluster is only read unless --apply is given.
+func runKubernetes(args []string) error {
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	question, err := readInput(args)
+	if err != nil {
+		return err
+	}
+
+	kubectl := kubernetes.New(viper.GetString("namespace"))
+	context, err := kubectl.Gather(viper.GetString("resource"))
+	if err != nil {
+		return err
+	}
+
+	apply := viper.GetBool("apply")
+	instruction := k8sInstruction
+	if apply {
+		instruction = k8sApplyInstruction
+	}
+	instruction += "\n\nCluster context:\n" + context
+
+	message, err := callModel(viper.GetString("apiKey"), viper.GetString("model"), instruction, question, viper.GetFloat64("temperature"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(message)
+
+	if !apply {
+		return nil
+	}
+
+	if !confirm(i18n.T("Apply this manifest to the cluster?")) {
+		return i18n.Errorf("manifest not applied")
+	}
+
+	out, err := kubectl.Apply(message)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	return nil
+}
+
+// Function to ask a yes/no question on stderr and read the answer from the terminal
+func confirm(question string) bool {
+	in := os.Stdin
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		in = tty
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %s ", question, i18n.T("[y/N]"))
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	return i18n.Yes(answer)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"sgpt/pkg/langdetect"
+	"strings"
+)
+
+// Function to return what to add to the instruction so the reply is in the right language: the one
+// named with --replyLanguage, or with the default auto the language of the input, detected locally.
+// English input, input whose language isn't clear and --replyLanguage off leave the instruction as is.
+func replyLanguageInstruction(input string) string {
+	switch language := viper.GetString("replyLanguage"); strings.ToLower(language) {
+	case "off", "":
+		return ""
+	case "auto":
+		detected := langdetect.Detect(input)
+		if detected == "" || detected == "English" {
+			return ""
+		}
+		debugf("input language: %s", detected)
+		return fmt.Sprintf("\n\nThe input is in %s. Reply in %s unless asked otherwise.", detected, detected)
+	default:
+		return fmt.Sprintf("\n\nReply in %s.", language)
+	}
+}
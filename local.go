@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"log"
+	"sgpt/pkg/provider/openaicompat"
+	"strings"
+)
+
+// Model asked for from the local server by default: a tiny quantized model that answers quickly on a
+// laptop CPU, as served by Ollama
+const defaultLocalModel = "qwen2.5:0.5b"
+
+// Function to create a client for the local server of --localFallback, which serves the OpenAI API.
+// sgpt doesn't run or download the model itself; the user runs the server.
+func localClient() *openaicompat.Client {
+	client := openaicompat.NewClient("local", viper.GetString("localFallback"), "", httpClient)
+	client.UserAgent = userAgent()
+	return client
+}
+
+// Function to ask the local model of --localFallback for a reply
+func callLocal(ctx context.Context, instruction, input string, temperature float64) (string, error) {
+	client := localClient()
+	model := viper.GetString("localModel")
+	debugf("POST %s model=%s", client.Endpoint(), model)
+	response, err := client.CompleteContext(ctx, openaicompat.Request{Model: model, System: instruction, Input: input, Temperature: temperature})
+	if err != nil {
+		return "", err
+	}
+	recordUsage(ctx, "local", model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	noteReply(ctx, "local", model, response.Model, response.FinishReason, response.SystemFingerprint, response.Raw)
+	return strings.TrimSpace(response.Text), nil
+}
+
+// Function to answer with the local model of --localFallback after the configured provider failed
+// with err, so that sgpt keeps working without a network or when the provider is down. Without a
+// local server, or if it fails too, err is returned.
+func localFallback(ctx context.Context, instruction, input string, temperature float64, err error) (string, error) {
+	if viper.GetString("localFallback") == "" || viper.GetBool("raw") {
+		return "", err
+	}
+	log.Printf("warning: %v; answering with the local model %s", err, viper.GetString("localModel"))
+	reply, localErr := callLocal(ctx, instruction, input, temperature)
+	if localErr != nil {
+		return "", fmt.Errorf("%w (the local fallback failed too: %v)", err, localErr)
+	}
+	return reply, nil
+}
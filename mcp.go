@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"regexp"
+	"sgpt/pkg/i18n"
+	"sgpt/pkg/mcp"
+	"sgpt/pkg/provider/openaicompat"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Settings of an MCP server in the mcpServers config key, with their config types
+var mcpServerKeys = map[string]string{"command": "stringSlice", "env": "stringSlice", "dir": "string", "url": "string", "headers": "stringMap"}
+
+// Rounds of tool calls allowed before the model must answer, when it has the tools of MCP servers
+const maxMCPRounds = 20
+
+// Time allowed for connecting to a server, and for each tool call
+const (
+	mcpConnectTimeout = 30 * time.Second
+	mcpCallTimeout    = 2 * time.Minute
+)
+
+// Result of an MCP tool returned to the model, in bytes
+const mcpResultLimit = 32 << 10
+
+// Characters allowed in the names of tools, which OpenAI limits to 64 of them
+var toolNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// mcpTools holds the connections to the MCP servers chosen with --mcp and the tools they offer
+type mcpTools struct {
+	clients []*mcp.Client
+	tools   []openaicompat.Tool
+	// routes maps the names the model knows the tools by to their server and name there
+	routes map[string]mcpRoute
+}
+
+type mcpRoute struct {
+	server string
+	client *mcp.Client
+	tool   string
+}
+
+// Function to read the servers of the mcpServers config key, as set at the top level or by the profile
+func mcpServers() (map[string]mcp.Server, error) {
+	servers := map[string]mcp.Server{}
+	for name := range viper.GetStringMap("mcpServers") {
+		var server mcp.Server
+		if err := viper.UnmarshalKey("mcpServers."+name, &server); err != nil {
+			return nil, fmt.Errorf("MCP server %s: %v", name, err)
+		}
+		servers[name] = server
+	}
+	return servers, nil
+}
+
+// Function to check the servers chosen with --mcp, returning the problems found
+func checkMCP() []string {
+	names := viper.GetStringSlice("mcp")
+	if len(names) == 0 {
+		return nil
+	}
+	servers, err := mcpServers()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var errs []string
+	for _, name := range names {
+		server, ok := servers[strings.ToLower(name)]
+		switch {
+		case !ok:
+			errs = append(errs, i18n.Sprintf("--mcp server %q is not defined under mcpServers in the config file", name))
+		case len(server.Command) > 0 && server.URL != "":
+			errs = append(errs, i18n.Sprintf("MCP server %s has both a command and a url, give one", name))
+		case len(server.Command) == 0 && server.URL == "":
+			errs = append(errs, i18n.Sprintf("MCP server %s needs a command or a url", name))
+		}
+	}
+	return errs
+}
+
+// Function to connect to the servers chosen with --mcp and list their tools. Tools are offered to the
+// model under their own names, prefixed with their server's name when two servers or a --verify tool
+// use the same one.
+func connectMCP(taken map[string]bool) (*mcpTools, error) {
+	servers, err := mcpServers()
+	if err != nil {
+		return nil, err
+	}
+	var stderr io.Writer
+	if viper.GetBool("debug") {
+		stderr = os.Stderr // Servers log to stderr
+	}
+	opts := mcp.Options{ClientName: "sgpt", ClientVersion: strings.TrimPrefix(version, "v"), HTTPClient: httpClient, Stderr: stderr}
+
+	t := &mcpTools{routes: map[string]mcpRoute{}}
+	for _, name := range viper.GetStringSlice("mcp") {
+		name = strings.ToLower(name)
+		ctx, cancel := context.WithTimeout(rootCtx, mcpConnectTimeout)
+		client, err := mcp.Connect(ctx, servers[name], opts)
+		var tools []mcp.Tool
+		if err == nil {
+			t.clients = append(t.clients, client)
+			tools, err = client.Tools(ctx)
+		}
+		cancel()
+		if err != nil {
+			t.close()
+			return nil, fmt.Errorf("MCP server %s: %v", name, err)
+		}
+		debugf("MCP server %s (%s %s) offers %d tools", name, client.ServerName, client.ServerVersion, len(tools))
+
+		for _, tool := range tools {
+			exposed := toolName(tool.Name)
+			if taken[exposed] {
+				exposed = toolName(name + "_" + tool.Name)
+			}
+			if taken[exposed] {
+				debugf("MCP server %s: skipping the tool %s, its name is taken", name, tool.Name)
+				continue
+			}
+			taken[exposed] = true
+			t.routes[exposed] = mcpRoute{server: name, client: client, tool: tool.Name}
+			t.tools = append(t.tools, openaicompat.Tool{Name: exposed, Description: tool.Description, Parameters: tool.InputSchema})
+		}
+	}
+	sort.Slice(t.tools, func(i, j int) bool { return t.tools[i].Name < t.tools[j].Name })
+	return t, nil
+}
+
+// Function to turn a tool name into one providers accept
+func toolName(name string) string {
+	name = toolNameInvalid.ReplaceAllString(name, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// Function to run a call of an MCP tool and return its result for the model. ok is false if the tool
+// is not one of the servers'.
+func (t *mcpTools) call(call openaicompat.ToolCall) (result string, ok bool) {
+	route, ok := t.routes[call.Name]
+	if !ok {
+		return "", false
+	}
+	ctx, cancel := context.WithTimeout(rootCtx, mcpCallTimeout)
+	defer cancel()
+	result, err := route.client.CallTool(ctx, route.tool, call.Arguments)
+	if err != nil {
+		result = "error: " + err.Error()
+	}
+	if len(result) > mcpResultLimit {
+		result = result[:mcpResultLimit] + "\n[result truncated]"
+	}
+	return result, true
+}
+
+// Function to disconnect from the servers, stopping those that were started
+func (t *mcpTools) close() {
+	for _, client := range t.clients {
+		client.Close()
+	}
+}
+
+// Function to check the mcpServers config key: every server is a mapping of the settings of a command
+// or a URL
+func (d *configDoc) checkMCPServers(node *yaml.Node, errs *ConfigErrors) {
+	if node.Kind != yaml.MappingNode {
+		*errs = append(*errs, fmt.Sprintf("%s:%d: mcpServers must be a mapping of names to servers", d.file(node), node.Line))
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, server := node.Content[i].Value, node.Content[i+1]
+		if server.Kind != yaml.MappingNode {
+			*errs = append(*errs, fmt.Sprintf("%s:%d: MCP server %s must be a mapping of settings", d.file(server), server.Line, name))
+			continue
+		}
+		for j := 0; j+1 < len(server.Content); j += 2 {
+			keyNode, value := server.Content[j], server.Content[j+1]
+			want, ok := mcpServerKeys[keyNode.Value]
+			if !ok {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: unknown key %q in MCP server %s, servers may set command, env, dir, url and headers",
+					d.file(keyNode), keyNode.Line, keyNode.Value, name))
+				continue
+			}
+			if problem := checkConfigValue(want, value); problem != "" {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: mcpServers.%s.%s %s", d.file(value), value.Line, name, keyNode.Value, problem))
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+//go:embed models.yaml
+var modelsYAML []byte
+
+// modelSpec is the entry of a model in models.yaml or the modelCapabilities section of the config file
+type modelSpec struct {
+	Provider        string  `yaml:"provider"`
+	API             string  `yaml:"api"` // chat, completions or transcriptions; OpenAI models only
+	Vision          bool    `yaml:"vision"`
+	Streaming       *bool   `yaml:"streaming"`
+	ContextWindow   int     `yaml:"contextWindow"`
+	MaxOutputTokens int     `yaml:"maxOutputTokens"`
+	InputPrice      float64 `yaml:"inputPrice"`
+	OutputPrice     float64 `yaml:"outputPrice"`
+}
+
+// Types of the fields of a model entry, for checking the config file
+var modelSpecKeys = map[string]string{
+	"provider":        "string",
+	"api":             "string",
+	"vision":          "bool",
+	"streaming":       "bool",
+	"contextWindow":   "int",
+	"maxOutputTokens": "int",
+	"inputPrice":      "float64",
+	"outputPrice":     "float64",
+}
+
+// OpenAI endpoints by the api of a model entry
+var modelAPIs = map[string]string{
+	"chat":           chatCompletionsURL,
+	"completions":    completionsURL,
+	"transcriptions": transcriptionsURL,
+}
+
+// Function to read the built-in models from models.yaml
+func builtinModels() map[string]ModelCaps {
+	var specs map[string]modelSpec
+	if err := yaml.Unmarshal(modelsYAML, &specs); err != nil {
+		panic(fmt.Sprintf("models.yaml: %v", err))
+	}
+	models := map[string]ModelCaps{}
+	for name, spec := range specs {
+		caps, err := spec.caps()
+		if err != nil {
+			panic(fmt.Sprintf("models.yaml: %s: %v", name, err))
+		}
+		models[name] = caps
+	}
+	return models
+}
+
+// Function to convert a model entry to the capabilities used when calling the model
+func (s modelSpec) caps() (ModelCaps, error) {
+	if !isProvider(s.Provider) {
+		return ModelCaps{}, fmt.Errorf("provider %q is not one of %s", s.Provider, strings.Join(providers, ", "))
+	}
+	caps := ModelCaps{
+		Provider:        s.Provider,
+		Vision:          s.Vision,
+		NoStreaming:     s.Streaming != nil && !*s.Streaming,
+		ContextWindow:   s.ContextWindow,
+		MaxOutputTokens: s.MaxOutputTokens,
+		InputPrice:      s.InputPrice,
+		OutputPrice:     s.OutputPrice,
+	}
+	if s.Provider == "openai" {
+		api := s.API
+		if api == "" {
+			api = "chat"
+		}
+		endpoint, ok := modelAPIs[api]
+		if !ok {
+			return ModelCaps{}, fmt.Errorf("api %q is not one of chat, completions, transcriptions", s.API)
+		}
+		caps.Endpoint = endpoint
+	} else if s.API != "" && s.API != "chat" {
+		return ModelCaps{}, fmt.Errorf("%s models are called through the chat API", s.Provider)
+	}
+	return caps, nil
+}
+
+// Function to convert capabilities back to a model entry, so the config file can change some fields
+func specOf(caps ModelCaps) modelSpec {
+	spec := modelSpec{
+		Provider:        caps.Provider,
+		Vision:          caps.Vision,
+		ContextWindow:   caps.ContextWindow,
+		MaxOutputTokens: caps.MaxOutputTokens,
+		InputPrice:      caps.InputPrice,
+		OutputPrice:     caps.OutputPrice,
+	}
+	for api, endpoint := range modelAPIs {
+		if endpoint == caps.Endpoint {
+			spec.API = api
+		}
+	}
+	if caps.NoStreaming {
+		streaming := false
+		spec.Streaming = &streaming
+	}
+	return spec
+}
+
+// Function to add the modelCapabilities section of the config file to the known models. An entry for
+// a known model changes only the fields it sets. Invalid entries are skipped; checkConfigFile reports
+// them. The section is read from the YAML node rather than from viper, which would split model names
+// such as gpt-3.5-turbo at their dots.
+func registerModels(root *yaml.Node) {
+	section := mappingValue(root, "modelCapabilities")
+	if section == nil || section.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(section.Content); i += 2 {
+		name := section.Content[i].Value
+		spec := specOf(modelCapabilities[name])
+		if err := section.Content[i+1].Decode(&spec); err != nil {
+			continue
+		}
+		if caps, err := spec.caps(); err == nil {
+			modelCapabilities[name] = caps
+			configuredModels[name] = true
+		}
+	}
+}
+
+// Function to find the value of a key in a YAML mapping, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Function to check the modelCapabilities section of a config file
+func (d *configDoc) checkModels(node *yaml.Node, errs *ConfigErrors) {
+	if node.Kind != yaml.MappingNode {
+		*errs = append(*errs, fmt.Sprintf("%s:%d: modelCapabilities must be a mapping of model names to their capabilities", d.file(node), node.Line))
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, entry := node.Content[i].Value, node.Content[i+1]
+		if entry.Kind != yaml.MappingNode {
+			*errs = append(*errs, fmt.Sprintf("%s:%d: model %s must be a mapping of capabilities", d.file(entry), entry.Line, name))
+			continue
+		}
+		for j := 0; j+1 < len(entry.Content); j += 2 {
+			keyNode, value := entry.Content[j], entry.Content[j+1]
+			want, ok := modelSpecKeys[keyNode.Value]
+			if !ok {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: unknown key %q in model %s, models may set provider, api, vision, streaming, contextWindow, maxOutputTokens, inputPrice and outputPrice",
+					d.file(keyNode), keyNode.Line, keyNode.Value, name))
+				continue
+			}
+			if problem := checkConfigValue(want, value); problem != "" {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: modelCapabilities.%s.%s %s", d.file(value), value.Line, name, keyNode.Value, problem))
+			}
+		}
+		spec := specOf(modelCapabilities[name])
+		if entry.Decode(&spec) == nil {
+			if _, err := spec.caps(); err != nil {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: model %s: %v", d.file(entry), entry.Line, name, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"os"
+	"strings"
+)
+
+// Function to parse the command line flags, preceded by those in the SGPT_OPTS environment variable.
+// Wrapper scripts and shell aliases can set defaults there without a config file; flags given on the
+// command line come later and so take precedence, while repeatable flags such as --image add up.
+func parseFlags() {
+	if opts := os.Getenv("SGPT_OPTS"); strings.TrimSpace(opts) != "" {
+		words, err := splitWords(opts)
+		if err == nil {
+			err = pflag.CommandLine.Parse(words)
+		}
+		if err == nil && pflag.NArg() > 0 {
+			err = fmt.Errorf("%q is not a flag, only flags may be given", pflag.Arg(0))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "SGPT_OPTS: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	pflag.Parse()
+}
+
+// Function to split a string into words the way a shell does: at unquoted whitespace, with single
+// quotes keeping their content as it is, double quotes allowing backslash escapes and a backslash
+// outside quotes escaping the next character. Variables and globs are not expanded.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"regexp"
+	"sgpt/pkg/provider/openaicompat"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output formats of --output
+var outputFormats = []string{"text", "json"}
+
+// Where replies are printed: stdout, and with --outputFile the file as well
+var replyOut io.Writer = os.Stdout
+
+// outputFile is the file of --outputFile. It is created, or appended to with --append, when the first
+// reply is written, so that a request that fails leaves an existing file as it was.
+type outputFile struct {
+	path string
+	flag int
+	file *os.File
+}
+
+func (f *outputFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, f.flag, 0644)
+		if err != nil {
+			return 0, err
+		}
+		f.file = file
+	}
+	return f.file.Write(p)
+}
+
+// Function to print replies to --outputFile as well as to stdout, like tee
+func configureOutputFile() {
+	path := viper.GetString("outputFile")
+	if path == "" {
+		return
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if viper.GetBool("append") {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	replyOut = io.MultiWriter(os.Stdout, &outputFile{path: path, flag: flag})
+}
+
+// replyInfo collects the responses to the requests made for one reply, for --output json and the
+// history: the latest response, and the tokens used by all of them, such as retries and the parts of
+// chunked input. Chunks of input processed concurrently each have their own.
+type replyInfo struct {
+	mu           sync.Mutex
+	provider     string
+	model        string
+	finishReason string
+	fingerprint  string
+	raw          []byte
+	usage        openaicompat.Usage
+}
+
+// Key of the replyInfo of a request's context
+type replyInfoKey struct{}
+
+// Function to return a context under which the responses to requests are noted in a new replyInfo,
+// which is returned too
+func withReplyInfo(ctx context.Context) (context.Context, *replyInfo) {
+	info := &replyInfo{}
+	return context.WithValue(ctx, replyInfoKey{}, info), info
+}
+
+// Function to return the replyInfo that the responses to requests made under ctx are noted in, nil
+// if there is none, as for the requests of sgpt serve
+func replyInfoFrom(ctx context.Context) *replyInfo {
+	info, _ := ctx.Value(replyInfoKey{}).(*replyInfo)
+	return info
+}
+
+// Function to note the response to a request for model made under ctx, for --output json and the
+// history. served is the model that answered as the provider reports it, which routers may choose,
+// and fingerprint the system fingerprint of the backend that served it, each "" if not reported.
+func noteReply(ctx context.Context, provider, model, served, finishReason, fingerprint string, raw []byte) {
+	if served != "" {
+		model = served
+	}
+	if fingerprint != "" {
+		debugf("served by the backend with system fingerprint %s", fingerprint)
+	}
+	info := replyInfoFrom(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	info.provider, info.model, info.finishReason, info.fingerprint, info.raw = provider, model, finishReason, fingerprint, raw
+	info.mu.Unlock()
+}
+
+// Function to add the tokens of a request made under ctx to the usage of its reply
+func addReplyUsage(ctx context.Context, promptTokens, completionTokens int) {
+	info := replyInfoFrom(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	info.usage.PromptTokens += promptTokens
+	info.usage.CompletionTokens += completionTokens
+	info.mu.Unlock()
+}
+
+// Function to return the system fingerprint of the latest response, "" if the provider didn't report it
+func (info *replyInfo) systemFingerprint() string {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.fingerprint
+}
+
+// Function to tell whether the reply is printed as a JSON object with --output json
+func jsonOutput() bool {
+	return viper.GetString("output") == "json"
+}
+
+// Function to print a reply to w as a single JSON object with the metadata of the responses to it
+// noted in info: the model and provider, why the reply ended, the tokens used, the time taken, the
+// seed and system fingerprint needed to reproduce it and the provider's response as it came. The
+// usage counts every request made for the reply, such as retries and the parts of chunked input.
+func printJSONReply(w io.Writer, text string, info *replyInfo, latency time.Duration) error {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	var raw json.RawMessage
+	if json.Valid(info.raw) {
+		raw = info.raw
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(struct {
+		Text              string          `json:"text"`
+		Model             string          `json:"model"`
+		Provider          string          `json:"provider"`
+		FinishReason      string          `json:"finish_reason"`
+		Usage             interface{}     `json:"usage"`
+		LatencyMS         int64           `json:"latency_ms"`
+		Seed              int64           `json:"seed,omitempty"`
+		SystemFingerprint string          `json:"system_fingerprint,omitempty"`
+		Raw               json.RawMessage `json:"raw"`
+	}{
+		Text:         text,
+		Model:        info.model,
+		Provider:     info.provider,
+		FinishReason: info.finishReason,
+		Usage: struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
+		}{info.usage.PromptTokens, info.usage.CompletionTokens, info.usage.PromptTokens + info.usage.CompletionTokens},
+		LatencyMS:         latency.Milliseconds(),
+		Seed:              requestSeed(info.provider),
+		SystemFingerprint: info.fingerprint,
+		Raw:               raw,
+	})
+}
+
+// Typographic characters replaced by --normalizeOutput: quotes, dashes and spaces become their ASCII
+// counterparts, and invisible characters such as zero-width spaces, which some models leave in their
+// replies and which show up in diffs as unexplained changes, are dropped. Zero-width (non-)joiners
+// are kept, since they change how scripts such as Persian, Devanagari or emoji sequences are shown.
+var outputReplacer = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'", "\u201a", "'", "\u201b", "'", "\u2032", "'",
+	"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u201f", `"`, "\u2033", `"`,
+	"\u2010", "-", "\u2011", "-", "\u2012", "-", "\u2013", "-", "\u2014", "--", "\u2015", "--", "\u2212", "-",
+	"\u2026", "...",
+	"\u00a0", " ", "\u2007", " ", "\u2009", " ", "\u202f", " ",
+	"\u200b", "", "\u2060", "", "\ufeff", "", "\u00ad", "",
+	"\r\n", "\n",
+)
+
+// Runs of two or more blank lines, after trailing whitespace is stripped
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// Function to make a reply diff-friendly for --normalizeOutput: typographic characters become ASCII,
+// trailing whitespace is stripped, runs of blank lines collapse into one, and the reply ends without
+// blank lines, so that it is printed with exactly one trailing newline
+func normalizeOutput(text string) string {
+	lines := strings.Split(outputReplacer.Replace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r\v\f")
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimRight(text, "\n")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Replies made concurrently, as with --concurrency, each report their own response
+func TestReplyInfoPerReply(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, info := withReplyInfo(context.Background())
+			fingerprint := fmt.Sprintf("fp_%d", i)
+			for j := 0; j < 100; j++ {
+				noteReply(ctx, "openai", "m", "", "stop", fingerprint, []byte(`{}`))
+				addReplyUsage(ctx, 1, 2)
+			}
+			if got := info.systemFingerprint(); got != fingerprint {
+				t.Errorf("reply %d has system fingerprint %q, want %q", i, got, fingerprint)
+			}
+
+			var out bytes.Buffer
+			if err := printJSONReply(&out, "text", info, 0); err != nil {
+				t.Error(err)
+				return
+			}
+			var reply struct {
+				SystemFingerprint string `json:"system_fingerprint"`
+				Usage             struct {
+					TotalTokens int `json:"total_tokens"`
+				} `json:"usage"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &reply); err != nil {
+				t.Error(err)
+				return
+			}
+			if reply.SystemFingerprint != fingerprint || reply.Usage.TotalTokens != 300 {
+				t.Errorf("reply %d printed %s", i, out.Bytes())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Requests made outside a reply, as for sgpt serve, are noted nowhere
+	noteReply(context.Background(), "openai", "m", "", "stop", "fp", nil)
+}
+
+// Replies are tidied for diffs without losing the joiners some scripts and emoji need
+func TestNormalizeOutput(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"quotes and dashes", "\u201cIt\u2019s\u201d \u2013 done\u2026", "\"It's\" - done..."},
+		{"spaces", "a\u00a0b\u202fc", "a b c"},
+		{"invisible characters", "\ufeffzero\u200bwidth\u2060join soft\u00adhyphen", "zerowidthjoin softhyphen"},
+		{"joiners kept", "\u0645\u06cc\u200c\u062e\u0648\u0627\u0647\u0645 \U0001F469\u200d\U0001F4BB", "\u0645\u06cc\u200c\u062e\u0648\u0627\u0647\u0645 \U0001F469\u200d\U0001F4BB"},
+		{"trailing whitespace", "line \t\r\nnext  ", "line\nnext"},
+		{"blank lines", "a\n\n\n\nb\n\n\n", "a\n\nb"},
+	}
+	for _, tt := range tests {
+		if got := normalizeOutput(tt.in); got != tt.want {
+			t.Errorf("%s: normalizeOutput(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// How often paced text is shown
+const paceInterval = 20 * time.Millisecond
+
+// How far --streamSmooth lets the display fall behind the stream, to even out bursts
+const smoothLag = 300 * time.Millisecond
+
+// pacer passes streamed text on at an even pace instead of in the bursts it arrives in: at a fixed
+// number of characters per second with --streamRate, like a typewriter, or with --streamSmooth at a
+// pace that follows the stream with a short lag.
+type pacer struct {
+	out  func(string)
+	rate float64 // Characters per second, zero to follow the stream
+
+	mu      sync.Mutex
+	pending []rune
+	closed  bool
+	done    chan struct{}
+}
+
+// Function to start pacing text passed to out, which is called from the pacer's own goroutine
+func newPacer(out func(string), rate float64) *pacer {
+	p := &pacer{out: out, rate: rate, done: make(chan struct{})}
+	go p.run()
+	return p
+}
+
+// Function to add a piece of streamed text
+func (p *pacer) add(text string) {
+	p.mu.Lock()
+	p.pending = append(p.pending, []rune(text)...)
+	p.mu.Unlock()
+}
+
+// Function to wait until all text added has been shown
+func (p *pacer) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	<-p.done
+}
+
+func (p *pacer) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(paceInterval)
+	defer ticker.Stop()
+
+	credit, drain := 0.0, 0.0
+	last := time.Now()
+	for now := range ticker.C {
+		elapsed := now.Sub(last)
+		last = now
+
+		p.mu.Lock()
+		n := len(p.pending)
+		if p.rate > 0 {
+			credit += p.rate * elapsed.Seconds()
+			if whole := math.Floor(credit); whole < float64(n) {
+				n = int(whole)
+				credit -= whole
+			} else {
+				credit = 0 // Waiting for the stream doesn't earn a burst later
+			}
+		} else {
+			// Show a share of the backlog, so the display keeps a steady lag behind the stream. Once the
+			// stream has ended the rest is shown at an even pace, finishing within smoothLag.
+			if p.closed && drain == 0 {
+				drain = float64(n) / smoothLag.Seconds()
+			}
+			share := math.Ceil(math.Max(float64(n)*float64(elapsed)/float64(smoothLag), drain*elapsed.Seconds()))
+			if share < float64(n) {
+				n = int(share)
+			}
+		}
+		text := string(p.pending[:n])
+		p.pending = p.pending[n:]
+		finished := p.closed && len(p.pending) == 0
+		p.mu.Unlock()
+
+		if text != "" {
+			p.out(text)
+		}
+		if finished {
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"sgpt/pkg/pii"
+	"strings"
+)
+
+// Instruction added for a batch of lines, which are sent as a JSON array
+const perLineInstruction = "\n\nThe input is a JSON array of %d lines. Apply the instructions to each line on its own and " +
+	"answer with only a JSON array of exactly %d strings, the results for the lines in the same order."
+
+// Function to transform input line by line with --perLine, printing exactly one line for each line
+// read, in order, so that sgpt can stand in a pipeline like sed or awk. Lines are sent in batches of
+// --perLineBatch; a batch whose reply doesn't hold one result per line is sent again line by line.
+// Newlines in results are written as \n, and empty lines are passed through without a request.
+func runPerLine(r io.Reader, apiKey, model, instruction string, temperature float64, redactor *pii.Redactor) error {
+	size := viper.GetInt("perLineBatch")
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	var batch []string
+	flush := func() error {
+		results, err := transformLines(apiKey, model, instruction, temperature, batch, redactor)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if _, err := fmt.Fprintln(replyOut, escapeNewlines(result)); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for scanner.Scan() {
+		batch = append(batch, strings.TrimSuffix(scanner.Text(), "\r"))
+		if len(batch) == size {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Error reading input: %v", err)
+	}
+	if len(batch) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+// Function to transform a batch of lines, returning one result for each
+func transformLines(apiKey, model, instruction string, temperature float64, lines []string, redactor *pii.Redactor) ([]string, error) {
+	results := make([]string, len(lines))
+	var pending []int // Lines that aren't empty
+	var inputs []string
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if redactor != nil {
+			line = redactor.Redact(line)
+		}
+		pending = append(pending, i)
+		inputs = append(inputs, line)
+	}
+
+	var replies []string
+	if len(inputs) > 1 {
+		data, err := json.Marshal(inputs)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := callModel(apiKey, model, instruction+fmt.Sprintf(perLineInstruction, len(inputs), len(inputs)), string(data), temperature)
+		if err != nil {
+			return nil, err
+		}
+		if json.Unmarshal([]byte(stripCodeFence(reply)), &replies) != nil || len(replies) != len(inputs) {
+			log.Printf("warning: the reply to a batch of %d lines doesn't hold a result for each, sending them one by one", len(inputs))
+			replies = nil
+		}
+	}
+	if replies == nil {
+		for _, input := range inputs {
+			reply, err := callModel(apiKey, model, instruction, input, temperature)
+			if err != nil {
+				return nil, err
+			}
+			replies = append(replies, reply)
+		}
+	}
+
+	for j, i := range pending {
+		reply := strings.TrimSpace(replies[j])
+		if redactor != nil {
+			reply = redactor.Restore(reply)
+		}
+		if viper.GetBool("normalizeOutput") {
+			reply = normalizeOutput(reply)
+		}
+		results[i] = reply
+	}
+	return results, nil
+}
+
+// Function to write the line breaks of text as \n, keeping it on one line
+func escapeNewlines(text string) string {
+	return strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(text)
+}
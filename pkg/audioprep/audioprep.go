@@ -0,0 +1,136 @@
+// Package audioprep prepares recordings for speech-to-text APIs. With
+// ffmpeg installed it transcodes any input to compact 16 kHz mono FLAC and
+// splits recordings longer than a provider's limits into overlapping
+// segments; Stitch joins the segment transcripts back together, dropping
+// the words repeated in the overlaps.
+package audioprep
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Available reports whether ffmpeg and ffprobe are installed
+func Available() bool {
+	_, ffmpeg := exec.LookPath("ffmpeg")
+	_, ffprobe := exec.LookPath("ffprobe")
+	return ffmpeg == nil && ffprobe == nil
+}
+
+// Duration returns the length of a recording in seconds
+func Duration(path string) (float64, error) {
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %s: %v", path, err)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+}
+
+// Split transcodes the recording to 16 kHz mono FLAC in segments of at most
+// segment seconds, each starting overlap seconds before the previous one
+// ends. The segment files are written to a new temporary directory, which
+// the caller must remove.
+func Split(path string, segment, overlap float64) (dir string, files []string, err error) {
+	if overlap >= segment {
+		return "", nil, fmt.Errorf("audio overlap must be shorter than the segment length")
+	}
+
+	duration, err := Duration(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err = os.MkdirTemp("", "sgpt-audio-*")
+	if err != nil {
+		return "", nil, err
+	}
+
+	for start, i := 0.0, 0; start < duration; start, i = start+segment-overlap, i+1 {
+		out := filepath.Join(dir, fmt.Sprintf("segment-%03d.flac", i))
+		cmd := exec.Command("ffmpeg", "-v", "error", "-y",
+			"-ss", strconv.FormatFloat(start, 'f', 3, 64), "-t", strconv.FormatFloat(segment, 'f', 3, 64),
+			"-i", path, "-vn", "-ac", "1", "-ar", "16000", "-c:a", "flac", out)
+		if msg, err := cmd.CombinedOutput(); err != nil {
+			os.RemoveAll(dir)
+			return "", nil, fmt.Errorf("ffmpeg %s: %v: %s", path, err, strings.TrimSpace(string(msg)))
+		}
+		files = append(files, out)
+		if start+segment >= duration {
+			break
+		}
+	}
+
+	return dir, files, nil
+}
+
+// Stitch joins segment transcripts, removing the longest run of words at
+// the start of each transcript that repeats the end of the previous one
+func Stitch(transcripts []string) string {
+	var s Stitcher
+	for _, t := range transcripts {
+		s.Add(t)
+	}
+	return s.String()
+}
+
+// Stitcher joins segment transcripts as they arrive, so that partial
+// results can be shown before the whole recording is transcribed
+type Stitcher struct {
+	words []string
+}
+
+// Add appends the next segment's transcript and returns the part of it that
+// does not repeat the end of the previous one
+func (s *Stitcher) Add(transcript string) string {
+	next := strings.Fields(transcript)
+	next = next[overlapLength(s.words, next, 50):]
+	s.words = append(s.words, next...)
+	return strings.Join(next, " ")
+}
+
+// String returns the transcript stitched so far
+func (s *Stitcher) String() string {
+	return strings.Join(s.words, " ")
+}
+
+// overlapLength returns the length of the longest suffix of prev, at most
+// limit words, that equals a prefix of next, comparing words loosely
+func overlapLength(prev, next []string, limit int) int {
+	// A single matching word is as likely to be a real repetition as an overlap
+	for n := minInt(limit, len(prev), len(next)); n > 1; n-- {
+		match := true
+		for i := 0; i < n; i++ {
+			if normalize(prev[len(prev)-n+i]) != normalize(next[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return n
+		}
+	}
+	return 0
+}
+
+// normalize lower-cases a word and strips punctuation, which transcription
+// often renders differently at segment boundaries
+func normalize(word string) string {
+	return strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return strings.ContainsRune(".,;:!?\"'()-", r)
+	}))
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
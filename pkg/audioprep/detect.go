@@ -0,0 +1,55 @@
+package audioprep
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// Format is the container format of a recording
+type Format struct {
+	// MIME is the media type, e.g. audio/mpeg
+	MIME string
+	// Ext is the file extension speech-to-text APIs recognize the format by, without the dot
+	Ext string
+}
+
+// Formats by the file extensions they are recognized by when their contents are not
+var extFormats = map[string]Format{
+	"mp3":  {"audio/mpeg", "mp3"},
+	"mpga": {"audio/mpeg", "mp3"},
+	"mpeg": {"audio/mpeg", "mp3"},
+	"wav":  {"audio/wav", "wav"},
+	"flac": {"audio/flac", "flac"},
+	"ogg":  {"audio/ogg", "ogg"},
+	"oga":  {"audio/ogg", "ogg"},
+	"opus": {"audio/ogg", "ogg"},
+	"m4a":  {"audio/mp4", "m4a"},
+	"mp4":  {"video/mp4", "mp4"},
+	"webm": {"audio/webm", "webm"},
+}
+
+// Detect returns the format of a recording from its first bytes, falling back on the extension of
+// name when the contents are not recognized. ok is false if neither tells the format.
+func Detect(head []byte, name string) (format Format, ok bool) {
+	switch {
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WAVE":
+		return Format{"audio/wav", "wav"}, true
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return Format{"audio/flac", "flac"}, true
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return Format{"audio/ogg", "ogg"}, true
+	case bytes.HasPrefix(head, []byte("ID3")), len(head) >= 2 && head[0] == 0xFF && head[1]&0xE6 == 0xE2:
+		// An ID3 tag, or an MPEG audio layer III frame header
+		return Format{"audio/mpeg", "mp3"}, true
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return Format{"audio/webm", "webm"}, true
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		if brand := string(head[8:12]); brand == "M4A " || brand == "M4B " {
+			return Format{"audio/mp4", "m4a"}, true
+		}
+		return Format{"video/mp4", "mp4"}, true
+	}
+	format, ok = extFormats[strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))]
+	return format, ok
+}
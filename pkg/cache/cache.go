@@ -0,0 +1,147 @@
+// Package cache stores model replies on disk, keyed by a hash of everything
+// that determines the reply, so that identical requests are answered without
+// calling the API again. Entries expire after a time to live. Entries made
+// from HTTP responses can keep the response's ETag, so that an expired entry
+// can be revalidated instead of downloaded again.
+//
+// A cache directory can be shared by concurrent processes, such as parallel
+// CI jobs on one runner: entries are written atomically and checked against
+// a checksum when read, so a corrupt entry is discarded rather than used, and
+// Lock lets one process make a request while the others wait for its reply.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sgpt/pkg/filelock"
+	"time"
+)
+
+// Cache is a directory of cached replies
+type Cache struct {
+	Dir string
+	// TTL is how long entries are used for; zero means they never expire
+	TTL time.Duration
+}
+
+// entry is the content of a cache file
+type entry struct {
+	Created time.Time `json:"created"`
+	Value   string    `json:"value"`
+	ETag    string    `json:"etag,omitempty"`
+	// Sum is the SHA-256 of Value; entries written before it was added have none
+	Sum string `json:"sum,omitempty"`
+}
+
+// New returns a Cache storing entries in dir
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{Dir: dir, TTL: ttl}
+}
+
+// Key returns the hash of the parts of a request, which must be encodable as JSON
+func Key(parts ...interface{}) (string, error) {
+	data, err := json.Marshal(parts)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// path returns the file of an entry, spread over subdirectories to keep directories small
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".json")
+}
+
+// Get returns the cached value for key, if there is one that has not expired. Expired entries are
+// left to be replaced by Put, since another process may be replacing them already.
+func (c *Cache) Get(key string) (string, bool) {
+	e, ok := c.read(key)
+	if !ok || (c.TTL > 0 && time.Since(e.Created) > c.TTL) {
+		return "", false
+	}
+	return e.Value, true
+}
+
+// Lookup returns the cached value for key and the ETag stored with it, whether or not it has
+// expired, and whether it is still fresh
+func (c *Cache) Lookup(key string) (value, etag string, fresh, ok bool) {
+	e, ok := c.read(key)
+	if !ok {
+		return "", "", false, false
+	}
+	fresh = c.TTL <= 0 || time.Since(e.Created) <= c.TTL
+	return e.Value, e.ETag, fresh, true
+}
+
+// read returns the entry for key. An entry that can't be parsed or doesn't match its checksum, e.g.
+// after a crash or a full disk, is removed so that it is made again.
+func (c *Cache) read(key string) (entry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return entry{}, false
+	}
+	var e entry
+	if json.Unmarshal(data, &e) != nil || (e.Sum != "" && e.Sum != checksum(e.Value)) {
+		os.Remove(c.path(key))
+		return entry{}, false
+	}
+	return e, true
+}
+
+// checksum returns the hex SHA-256 of a value
+func checksum(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lock takes the lock of the entry for key, which is shared by the processes using the cache,
+// waiting until it is free or ctx ends. It returns the function that releases the lock. Processes
+// that miss the cache take the lock and look again before making the request, so that only the
+// first of several identical requests made at the same time is sent.
+func (c *Cache) Lock(ctx context.Context, key string) (func(), error) {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return filelock.Lock(ctx, path+".lock")
+}
+
+// Put stores value for key. The entry is written to a temporary file, flushed to disk and
+// renamed into place, so concurrent readers never see a partial entry.
+func (c *Cache) Put(key, value string) error {
+	return c.PutTagged(key, value, "")
+}
+
+// PutTagged stores value for key with the ETag of the HTTP response it came from. Storing
+// a revalidated value again makes it fresh for another TTL.
+func (c *Cache) PutTagged(key, value, etag string) error {
+	data, err := json.Marshal(entry{Created: time.Now().UTC(), Value: value, ETag: etag, Sum: checksum(value)})
+	if err != nil {
+		return err
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,361 @@
+// Package calc evaluates arithmetic expressions such as "2 * (3 + 4)^2 / sqrt(9)",
+// so that a model can check its arithmetic instead of guessing. Numbers are
+// rationals: + - * / %, integer powers, abs, floor, ceil and round are computed
+// exactly, so 0.1 + 0.2 is 0.3. The constants pi and e, the other functions and
+// fractional powers are irrational in general and computed in float64, which
+// makes the result approximate. Expressions can't have side effects.
+package calc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Functions lists the supported functions of one argument, as computed in float64
+var Functions = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"log2":  math.Log2,
+	"exp":   math.Exp,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+// Functions that are computed exactly when their argument is exact
+var exactFunctions = map[string]func(*big.Rat) *big.Rat{
+	"abs":   func(r *big.Rat) *big.Rat { return new(big.Rat).Abs(r) },
+	"floor": floor,
+	"ceil":  func(r *big.Rat) *big.Rat { return new(big.Rat).Neg(floor(new(big.Rat).Neg(r))) },
+	"round": func(r *big.Rat) *big.Rat { // Half away from zero, like math.Round
+		half := big.NewRat(1, 2)
+		if r.Sign() < 0 {
+			return new(big.Rat).Neg(floor(new(big.Rat).Add(new(big.Rat).Neg(r), half)))
+		}
+		return floor(new(big.Rat).Add(r, half))
+	},
+}
+
+var constants = map[string]float64{"pi": math.Pi, "e": math.E}
+
+// Largest result of an exact power, in bits of numerator and denominator; larger powers are
+// computed in float64
+const maxPowerBits = 1 << 16
+
+// Number is the value of an expression
+type Number struct {
+	r     *big.Rat
+	exact bool
+}
+
+// Exact tells whether the number is the exact value of the expression, rather than a float64
+// approximation
+func (n Number) Exact() bool {
+	return n.exact
+}
+
+// Float64 returns the nearest float64 to the number
+func (n Number) Float64() float64 {
+	f, _ := n.r.Float64()
+	return f
+}
+
+// String formats the number: exact numbers as integers or decimals, with the fraction added where
+// the decimal is rounded, and approximate ones like a float64 without exponent notation where possible
+func (n Number) String() string {
+	if !n.exact {
+		v := n.Float64()
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatFloat(v, 'f', 0, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	if n.r.IsInt() {
+		return n.r.Num().String()
+	}
+	if digits, ok := decimalDigits(n.r.Denom()); ok && digits <= 40 {
+		return n.r.FloatString(digits)
+	}
+	rounded := new(big.Float).SetPrec(128).SetRat(n.r).Text('g', 20)
+	if fraction := n.r.String(); len(fraction) <= 60 {
+		return rounded + " (exactly " + fraction + ")"
+	}
+	return rounded
+}
+
+// Function to return the number of decimal places of the fractions with denominator d, if their
+// decimals end
+func decimalDigits(d *big.Int) (int, bool) {
+	d = new(big.Int).Set(d)
+	var twos, fives int
+	two, five, zero := big.NewInt(2), big.NewInt(5), new(big.Int)
+	for m := new(big.Int); m.Mod(d, two).Cmp(zero) == 0; twos++ {
+		d.Quo(d, two)
+	}
+	for m := new(big.Int); m.Mod(d, five).Cmp(zero) == 0; fives++ {
+		d.Quo(d, five)
+	}
+	if !d.IsInt64() || d.Int64() != 1 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
+
+// Function to round r down to an integer
+func floor(r *big.Rat) *big.Rat {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() < 0 {
+		q.Sub(q, big.NewInt(1))
+	}
+	return new(big.Rat).SetInt(q)
+}
+
+// Function to make a number from a float64, failing for infinities and NaN
+func approximate(f float64) (Number, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Number{}, fmt.Errorf("the result is not a finite number")
+	}
+	return Number{r: new(big.Rat).SetFloat64(f)}, nil
+}
+
+// parser is a recursive descent parser that evaluates while it parses
+type parser struct {
+	s   string
+	pos int
+}
+
+// Eval evaluates an expression
+func Eval(expr string) (Number, error) {
+	p := &parser{s: expr}
+	v, err := p.sum()
+	if err != nil {
+		return Number{}, err
+	}
+	p.space()
+	if p.pos < len(p.s) {
+		return Number{}, fmt.Errorf("unexpected %q at position %d", p.s[p.pos:], p.pos+1)
+	}
+	return v, nil
+}
+
+func (p *parser) space() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// next consumes c if it is the next character
+func (p *parser) next(c byte) bool {
+	p.space()
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// Function to apply an operation exactly when both operands are exact, and in float64 otherwise
+func combine(v, w Number, exact func(a, b *big.Rat) *big.Rat, inexact func(a, b float64) float64) (Number, error) {
+	if v.exact && w.exact {
+		return Number{r: exact(v.r, w.r), exact: true}, nil
+	}
+	return approximate(inexact(v.Float64(), w.Float64()))
+}
+
+// sum := product (("+" | "-") product)*
+func (p *parser) sum() (Number, error) {
+	v, err := p.product()
+	for err == nil {
+		var w Number
+		switch {
+		case p.next('+'):
+			if w, err = p.product(); err == nil {
+				v, err = combine(v, w, func(a, b *big.Rat) *big.Rat { return new(big.Rat).Add(a, b) },
+					func(a, b float64) float64 { return a + b })
+			}
+		case p.next('-'):
+			if w, err = p.product(); err == nil {
+				v, err = combine(v, w, func(a, b *big.Rat) *big.Rat { return new(big.Rat).Sub(a, b) },
+					func(a, b float64) float64 { return a - b })
+			}
+		default:
+			return v, nil
+		}
+	}
+	return Number{}, err
+}
+
+// product := unary (("*" | "/" | "%") unary)*
+func (p *parser) product() (Number, error) {
+	v, err := p.unary()
+	for err == nil {
+		var w Number
+		switch {
+		case p.next('*'):
+			if w, err = p.unary(); err == nil {
+				v, err = combine(v, w, func(a, b *big.Rat) *big.Rat { return new(big.Rat).Mul(a, b) },
+					func(a, b float64) float64 { return a * b })
+			}
+		case p.next('/'):
+			if w, err = p.unary(); err == nil && w.r.Sign() == 0 {
+				err = fmt.Errorf("division by zero")
+			}
+			if err == nil {
+				v, err = combine(v, w, func(a, b *big.Rat) *big.Rat { return new(big.Rat).Quo(a, b) },
+					func(a, b float64) float64 { return a / b })
+			}
+		case p.next('%'):
+			if w, err = p.unary(); err == nil && w.r.Sign() == 0 {
+				err = fmt.Errorf("division by zero")
+			}
+			if err == nil {
+				// The remainder has the sign of the dividend, like math.Mod
+				v, err = combine(v, w, func(a, b *big.Rat) *big.Rat {
+					q := new(big.Rat).Quo(a, b)
+					t := new(big.Int).Quo(q.Num(), q.Denom()) // Truncated towards zero
+					return new(big.Rat).Sub(a, new(big.Rat).Mul(b, new(big.Rat).SetInt(t)))
+				}, math.Mod)
+			}
+		default:
+			return v, nil
+		}
+	}
+	return Number{}, err
+}
+
+// unary := ("-" | "+") unary | power, so that -2^2 is -(2^2)
+func (p *parser) unary() (Number, error) {
+	if p.next('-') {
+		v, err := p.unary()
+		if err != nil {
+			return Number{}, err
+		}
+		return Number{r: new(big.Rat).Neg(v.r), exact: v.exact}, nil
+	}
+	if p.next('+') {
+		return p.unary()
+	}
+	return p.power()
+}
+
+// power := primary ("^" unary)?, right associative
+func (p *parser) power() (Number, error) {
+	v, err := p.primary()
+	if err != nil {
+		return Number{}, err
+	}
+	if !p.next('^') {
+		return v, nil
+	}
+	w, err := p.unary()
+	if err != nil {
+		return Number{}, err
+	}
+	if v.exact && w.exact && w.r.IsInt() && w.r.Num().IsInt64() {
+		n := w.r.Num().Int64()
+		if n < 0 && v.r.Sign() == 0 {
+			return Number{}, fmt.Errorf("division by zero")
+		}
+		abs := n
+		if abs < 0 {
+			abs = -abs
+		}
+		bits := v.r.Num().BitLen()
+		if b := v.r.Denom().BitLen(); b > bits {
+			bits = b
+		}
+		if abs <= maxPowerBits && int64(bits)*abs <= maxPowerBits {
+			e := big.NewInt(abs)
+			r := new(big.Rat).SetFrac(new(big.Int).Exp(v.r.Num(), e, nil), new(big.Int).Exp(v.r.Denom(), e, nil))
+			if n < 0 {
+				r.Inv(r)
+			}
+			return Number{r: r, exact: true}, nil
+		}
+	}
+	return approximate(math.Pow(v.Float64(), w.Float64()))
+}
+
+// primary := number | "(" sum ")" | constant | function "(" sum ")"
+func (p *parser) primary() (Number, error) {
+	p.space()
+	if p.next('(') {
+		v, err := p.sum()
+		if err != nil {
+			return Number{}, err
+		}
+		if !p.next(')') {
+			return Number{}, fmt.Errorf("missing ) at position %d", p.pos+1)
+		}
+		return v, nil
+	}
+
+	start := p.pos
+	if p.pos < len(p.s) && unicode.IsLetter(rune(p.s[p.pos])) {
+		for p.pos < len(p.s) && (unicode.IsLetter(rune(p.s[p.pos])) || unicode.IsDigit(rune(p.s[p.pos]))) {
+			p.pos++
+		}
+		name := strings.ToLower(p.s[start:p.pos])
+		if v, ok := constants[name]; ok {
+			return approximate(v)
+		}
+		f, ok := Functions[name]
+		if !ok {
+			return Number{}, fmt.Errorf("unknown name %q", name)
+		}
+		if !p.next('(') {
+			return Number{}, fmt.Errorf("%s needs an argument in parentheses", name)
+		}
+		v, err := p.sum()
+		if err != nil {
+			return Number{}, err
+		}
+		if !p.next(')') {
+			return Number{}, fmt.Errorf("missing ) at position %d", p.pos+1)
+		}
+		if exact, ok := exactFunctions[name]; ok && v.exact {
+			return Number{r: exact(v.r), exact: true}, nil
+		}
+		return approximate(f(v.Float64()))
+	}
+
+	for p.pos < len(p.s) && (unicode.IsDigit(rune(p.s[p.pos])) || p.s[p.pos] == '.' || p.s[p.pos] == '_' ||
+		(p.pos > start && (p.s[p.pos] == 'e' || p.s[p.pos] == 'E')) ||
+		(p.pos > start && (p.s[p.pos] == '-' || p.s[p.pos] == '+') && (p.s[p.pos-1] == 'e' || p.s[p.pos-1] == 'E'))) {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos == len(p.s) {
+			return Number{}, fmt.Errorf("unexpected end of expression")
+		}
+		return Number{}, fmt.Errorf("unexpected %q at position %d", p.s[p.pos:p.pos+1], p.pos+1)
+	}
+	text := strings.ReplaceAll(p.s[start:p.pos], "_", "")
+	// Parsing as a float64 first rejects malformed numbers and numbers too large to work with
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Number{}, fmt.Errorf("invalid number %q", p.s[start:p.pos])
+	}
+	if i := strings.IndexAny(text, "eE"); i >= 0 {
+		if exp, err := strconv.Atoi(text[i+1:]); err != nil || exp < -400 {
+			return approximate(f) // Too small to be worth the digits of an exact fraction
+		}
+	}
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return Number{}, fmt.Errorf("invalid number %q", p.s[start:p.pos])
+	}
+	return Number{r: r, exact: true}, nil
+}
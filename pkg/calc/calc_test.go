@@ -0,0 +1,92 @@
+package calc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2", 3},
+		{"2 * (3 + 4)^2 / sqrt(9)", 98.0 / 3},
+		{"2 + 3 * 4", 14},
+		{"(2 + 3) * 4", 20},
+		{"-2^2", -4},
+		{"2^3^2", 512},
+		{"7 % 3", 1},
+		{"1_000 + 1e3", 2000},
+		{"2.5e-1 * 4", 1},
+		{"abs(-3) + floor(2.7) + ceil(2.1) + round(2.5)", 11},
+		{"ln(e) + log(100) + log2(8)", 6},
+		{"PI", math.Pi},
+		{"  +5 - -5 ", 10},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.expr)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.expr, err)
+			continue
+		}
+		if math.Abs(got.Float64()-tt.want) > 1e-12 {
+			t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"1 +",
+		"1 / 0",
+		"5 % 0",
+		"(1 + 2",
+		"sqrt 4",
+		"foo(1)",
+		"1 2",
+		"sqrt(-1)",
+		"os.Exit(1)",
+	} {
+		if v, err := Eval(expr); err == nil {
+			t.Errorf("Eval(%q) = %v, want an error", expr, v)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		expr  string
+		want  string
+		exact bool
+	}{
+		{"0.1 + 0.2", "0.3", true},
+		{"3", "3", true},
+		{"-12", "-12", true},
+		{"1 / 8", "0.125", true},
+		{"12500 * 1.041^7", "16560.1825382588120110125", true},
+		{"2^100", "1267650600228229401496703205376", true},
+		{"2^-2", "0.25", true},
+		{"1 / 3", "0.33333333333333333333 (exactly 1/3)", true},
+		{"-7 % 3", "-1", true},
+		{"5.5 % 2", "1.5", true},
+		{"round(2.5) + round(-2.5) + floor(-1.5) + ceil(-1.5)", "-3", true},
+		{"abs(-0.1)", "0.1", true},
+		{"sqrt(2)", "1.4142135623730951", false},
+		{"pi * 0", "0", false},
+		{"2^0.5", "1.4142135623730951", false},
+		{"1e20 * e", "2.7182818284590452e+20", false},
+		{"1e-500", "0", false},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.expr)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.expr, err)
+			continue
+		}
+		if got.String() != tt.want || got.Exact() != tt.exact {
+			t.Errorf("Eval(%q) = %s, exact %v, want %s, exact %v", tt.expr, got, got.Exact(), tt.want, tt.exact)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package compress shortens large prompts before they are sent, in the manner of
+// LLMLingua but without a model: words are scored by how much information they
+// carry within the text, and the least informative are removed until the
+// requested share of words is gone. Frequent words and stop words carry little
+// information; numbers, identifiers, names and code carry a lot and are kept.
+// Whitespace is collapsed and repeated lines are dropped first, and fenced code
+// blocks are left as they are.
+package compress
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Stop words, which rarely change the meaning of a text for a model
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an the and or but nor so yet of to in on at by for with from into onto upon
+		about as than then that this these those there here is are was were be been being am do does did
+		has have had having it its it's i me my we us our you your he him his she her they them their
+		which who whom whose what when where why how all any both each few more most other some such
+		only own same very just also too can could would should will shall may might must up down out
+		over under again further once if because while until through during before after above below
+		off not no really quite rather actually basically simply however therefore thus hence indeed`) {
+		stopWords[w] = true
+	}
+}
+
+// Punctuation that ends a word without being part of it
+const punctuation = ".,;:!?"
+
+// word is a word of the text outside code blocks, with where it is and how informative it is
+type word struct {
+	line, index int
+	score       float64
+}
+
+// Compress removes about rate (0 to 1) of the words of text, least informative first
+func Compress(text string, rate float64) string {
+	lines := prepare(text)
+	if rate <= 0 {
+		return joinLines(lines)
+	}
+
+	// Count words to estimate the information each carries within this text
+	counts := map[string]int{}
+	total := 0
+	for _, l := range lines {
+		if l.code {
+			continue
+		}
+		for _, w := range l.words {
+			counts[normalizeWord(w)]++
+			total++
+		}
+	}
+
+	var words []word
+	for i, l := range lines {
+		if l.code {
+			continue
+		}
+		for j, w := range l.words {
+			if score := wordScore(w, j, counts, total); !math.IsInf(score, 1) {
+				words = append(words, word{line: i, index: j, score: score})
+			}
+		}
+	}
+	sort.SliceStable(words, func(a, b int) bool { return words[a].score < words[b].score })
+
+	remove := int(math.Round(rate * float64(total)))
+	if remove > len(words) {
+		remove = len(words)
+	}
+	removed := map[[2]int]bool{}
+	for _, w := range words[:remove] {
+		removed[[2]int{w.line, w.index}] = true
+	}
+
+	for i := range lines {
+		if lines[i].code {
+			continue
+		}
+		var kept []string
+		for j, w := range lines[i].words {
+			if !removed[[2]int{i, j}] {
+				kept = append(kept, w)
+				continue
+			}
+			// Keep the punctuation of a removed word, so sentences and clauses stay separated
+			p := w[len(strings.TrimRight(w, punctuation)):]
+			if last := len(kept) - 1; p != "" && last >= 0 && !strings.ContainsAny(kept[last][len(kept[last])-1:], punctuation) {
+				kept[last] += p
+			}
+		}
+		lines[i].words = kept
+	}
+	return joinLines(lines)
+}
+
+// line is a line of the text: the words of prose, or the verbatim text of a code block line
+type line struct {
+	indent string
+	words  []string
+	code   bool
+	text   string
+}
+
+// Function to split text into lines, collapsing whitespace, runs of blank lines and repeated lines
+// outside fenced code blocks
+func prepare(text string) []line {
+	var lines []line
+	seen := map[string]bool{}
+	inFence, blank := false, false
+	for _, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimRightFunc(raw, unicode.IsSpace)
+		trimmed := strings.TrimSpace(raw)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			lines = append(lines, line{code: true, text: raw})
+			blank = false
+			continue
+		}
+		if inFence {
+			lines = append(lines, line{code: true, text: raw})
+			continue
+		}
+
+		if trimmed == "" {
+			if !blank && len(lines) > 0 {
+				lines = append(lines, line{})
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		key := strings.Join(strings.Fields(trimmed), " ")
+		if len(key) >= 20 && seen[key] {
+			continue // Repeated boilerplate, e.g. headers and footers of pages
+		}
+		seen[key] = true
+		indent := raw[:len(raw)-len(strings.TrimLeftFunc(raw, unicode.IsSpace))]
+		if len(indent) > 4 {
+			indent = indent[:4]
+		}
+		lines = append(lines, line{indent: indent, words: strings.Fields(trimmed)})
+	}
+	return lines
+}
+
+// Function to join lines back into text
+func joinLines(lines []line) string {
+	var b strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if l.code {
+			b.WriteString(l.text)
+			continue
+		}
+		if len(l.words) > 0 {
+			b.WriteString(l.indent + strings.Join(l.words, " "))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Function to reduce a word to the form it is counted in
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.TrimRight(w, punctuation))
+}
+
+// Function to score how much information a word carries: its self-information within the text,
+// lowered for stop words and raised for names. Words that must not be removed, such as numbers,
+// identifiers, markup and the first word of a line, score +Inf.
+func wordScore(w string, index int, counts map[string]int, total int) float64 {
+	core := strings.TrimRight(w, punctuation)
+	if core == "" || index == 0 {
+		return math.Inf(1)
+	}
+	for _, r := range core {
+		if !unicode.IsLetter(r) && r != '-' && r != '\'' && r != '’' {
+			return math.Inf(1) // Numbers, identifiers, URLs, placeholders, brackets and markup
+		}
+	}
+
+	n := normalizeWord(w)
+	score := -math.Log2(float64(counts[n]) / float64(total))
+	if stopWords[n] {
+		score *= 0.25
+	}
+	if first := []rune(core)[0]; unicode.IsUpper(first) {
+		score *= 1.5 // Probably a name
+	}
+	if len(core) <= 2 {
+		score *= 0.8
+	}
+	return score
+}
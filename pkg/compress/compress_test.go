@@ -0,0 +1,61 @@
+package compress
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompressRateZero(t *testing.T) {
+	in := "  First   line  \n\n\n\nSecond line\n"
+	if got := Compress(in, 0); got != "First line\n\nSecond line" {
+		t.Errorf("Compress(rate 0) = %q", got)
+	}
+}
+
+func TestCompressRemovesStopWordsFirst(t *testing.T) {
+	in := "Deploy the service to the cluster and then restart the gateway"
+	got := Compress(in, 0.3)
+	for _, w := range []string{"Deploy", "service", "cluster", "restart", "gateway"} {
+		if !strings.Contains(got, w) {
+			t.Errorf("Compress = %q, lost %q", got, w)
+		}
+	}
+	if len(strings.Fields(got)) >= len(strings.Fields(in)) {
+		t.Errorf("Compress = %q, removed nothing", got)
+	}
+}
+
+func TestCompressKeeps(t *testing.T) {
+	in := "the the the the the port 8080 on host db-1.example.com was the the the the the problem"
+	got := Compress(in, 0.9)
+	for _, w := range []string{"the", "8080", "db-1.example.com"} {
+		if !strings.Contains(got, w) {
+			t.Errorf("Compress = %q, lost %q", got, w)
+		}
+	}
+	if !strings.HasPrefix(got, "the ") {
+		t.Errorf("Compress = %q, removed the first word of the line", got)
+	}
+}
+
+func TestCompressLeavesCodeBlocks(t *testing.T) {
+	code := "```go\nif   the  err != nil {\n\treturn   err\n}\n```"
+	got := Compress("Some of the text around the code block\n"+code, 0.5)
+	if !strings.Contains(got, code) {
+		t.Errorf("Compress changed the code block:\n%s", got)
+	}
+}
+
+func TestCompressDropsRepeatedLines(t *testing.T) {
+	in := "Page header of the report\nfirst page\nPage header of the report\nsecond page"
+	if got := Compress(in, 0); got != "Page header of the report\nfirst page\nsecond page" {
+		t.Errorf("Compress = %q", got)
+	}
+}
+
+func TestCompressKeepsPunctuation(t *testing.T) {
+	got := Compress("Restart it, then check the logs.", 0.5)
+	if !strings.HasSuffix(got, ".") {
+		t.Errorf("Compress = %q, lost the full stop", got)
+	}
+}
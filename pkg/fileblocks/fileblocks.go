@@ -0,0 +1,121 @@
+// Package fileblocks finds the files in a reply that writes several files at
+// once. A file is a fenced code block labelled with its path, either in the
+// block's info string (```go title="main.go", ```go:main.go or ```main.go) or
+// on the line before the block, as a heading, in bold or backticks, or after
+// a label such as "File:". Blocks without a path are not files.
+package fileblocks
+
+import (
+	"regexp"
+	"strings"
+)
+
+// File is a file written out in a reply
+type File struct {
+	Path    string
+	Content string
+}
+
+var (
+	fence = regexp.MustCompile("^\\s*(`{3,}|~{3,})\\s*(.*)$")
+	// Attributes of an info string naming the file, e.g. title="main.go"
+	infoAttribute = regexp.MustCompile(`\b(?:title|file|filename|path)=["']?([^"'\s]+)`)
+	// Labels introducing a path on the line before a block
+	label = regexp.MustCompile(`(?i)^(?:file|filename|path)\s*:\s*`)
+)
+
+// File names without an extension that are still recognized as paths
+var plainNames = map[string]bool{
+	"Makefile": true, "Dockerfile": true, "Containerfile": true, "Procfile": true, "Gemfile": true,
+	"Rakefile": true, "Jenkinsfile": true, "Vagrantfile": true, "LICENSE": true, "README": true,
+}
+
+// Parse returns the files of a reply in the order they appear. A path given
+// more than once keeps the content of its last block.
+func Parse(reply string) []File {
+	var files []File
+	index := map[string]int{}
+	lines := strings.Split(strings.ReplaceAll(reply, "\r\n", "\n"), "\n")
+	previous := "" // Last non-empty line outside a block
+	for i := 0; i < len(lines); i++ {
+		m := fence.FindStringSubmatch(lines[i])
+		if m == nil {
+			if strings.TrimSpace(lines[i]) != "" {
+				previous = strings.TrimSpace(lines[i])
+			}
+			continue
+		}
+
+		marker, info := m[1], strings.TrimSpace(m[2])
+		var content []string
+		j := i + 1
+		for ; j < len(lines); j++ {
+			if closing := strings.TrimSpace(lines[j]); strings.HasPrefix(closing, marker) && strings.Trim(closing, marker[:1]) == "" {
+				break
+			}
+			content = append(content, lines[j])
+		}
+		path := pathFromInfo(info)
+		if path == "" {
+			path = pathFromLine(previous)
+		}
+		if path != "" {
+			file := File{Path: path, Content: strings.Join(content, "\n") + "\n"}
+			if k, ok := index[path]; ok {
+				files[k] = file
+			} else {
+				index[path] = len(files)
+				files = append(files, file)
+			}
+		}
+		i, previous = j, ""
+	}
+	return files
+}
+
+// pathFromInfo returns the path named in the info string of a fence, if any
+func pathFromInfo(info string) string {
+	if m := infoAttribute.FindStringSubmatch(info); m != nil {
+		return m[1]
+	}
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return ""
+	}
+	word := fields[0]
+	if i := strings.Index(word, ":"); i > 0 {
+		word = word[i+1:] // go:main.go
+	}
+	if looksLikePath(word) {
+		return word
+	}
+	return ""
+}
+
+// pathFromLine returns the path a line before a block labels it with, if any
+func pathFromLine(line string) string {
+	line = strings.TrimLeft(line, "#>*- ")
+	line = strings.TrimSpace(strings.Trim(line, "*_"))
+	labelled := label.MatchString(line)
+	line = label.ReplaceAllString(line, "")
+	line = strings.TrimSuffix(strings.TrimSpace(line), ":")
+	line = strings.TrimSpace(strings.Trim(line, "`*_\"'"))
+	if strings.ContainsAny(line, " \t") || line == "" {
+		return ""
+	}
+	if labelled || looksLikePath(line) {
+		return line
+	}
+	return ""
+}
+
+// looksLikePath tells whether a word reads as a file path rather than a
+// language name or prose
+func looksLikePath(word string) bool {
+	if plainNames[word] {
+		return true
+	}
+	base := word[strings.LastIndex(word, "/")+1:]
+	dot := strings.LastIndex(base, ".")
+	return dot >= 0 && dot < len(base)-1 && !strings.HasSuffix(word, ".")
+}
@@ -0,0 +1,58 @@
+// Package filelock provides locks shared by the processes of one machine
+// through lock files. The lock is the operating system's lock on the open
+// file (flock on Unix, LockFileEx on Windows), so it is released when its
+// holder ends, however it ends, and no lock is ever left behind. The file
+// itself stays in place between holders.
+package filelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// How often a held lock is checked while waiting for it
+const poll = 100 * time.Millisecond
+
+// errLocked is returned by lockFile when another holder has the lock
+var errLocked = errors.New("locked")
+
+// TryLock takes the lock at path if it is free, returning the function that
+// releases it. ok is false if another process holds the lock.
+func TryLock(path string) (release func(), ok bool, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("locking %s: %w", path, err)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, true, nil
+}
+
+// Lock takes the lock at path, waiting until it is free or ctx ends, and
+// returns the function that releases it
+func Lock(ctx context.Context, path string) (func(), error) {
+	for {
+		release, ok, err := TryLock(path)
+		if err != nil || ok {
+			return release, err
+		}
+		timer := time.NewTimer(poll)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
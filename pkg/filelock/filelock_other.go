@@ -0,0 +1,17 @@
+//go:build !(unix && !aix) && !windows
+
+package filelock
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func lockFile(f *os.File) error {
+	return fmt.Errorf("file locks are not supported on %s", runtime.GOOS)
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package filelock
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Concurrent lockers hold the lock one at a time
+func TestLockExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	var holders, most int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				release, err := Lock(context.Background(), path)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n := atomic.AddInt32(&holders, 1)
+				for {
+					m := atomic.LoadInt32(&most)
+					if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+	if most != 1 {
+		t.Errorf("%d lockers held the lock at once", most)
+	}
+}
+
+func TestLockContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	release, ok, err := TryLock(path)
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if _, ok, err := TryLock(path); err != nil || ok {
+		t.Errorf("TryLock of a held lock = %v, %v", ok, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := Lock(ctx, path); err != context.DeadlineExceeded {
+		t.Errorf("Lock of a held lock = %v, want the context's error", err)
+	}
+	release()
+	if release, ok, err := TryLock(path); err != nil || !ok {
+		t.Errorf("TryLock after release = %v, %v", ok, err)
+	} else {
+		release()
+	}
+}
+
+// A process that ends without releasing its lock leaves nothing behind
+func TestLockReleasedOnExit(t *testing.T) {
+	if path := os.Getenv("FILELOCK_TEST_HOLD"); path != "" {
+		if _, ok, err := TryLock(path); err != nil || !ok {
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("locked\n")
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+
+	path := filepath.Join(t.TempDir(), "lock")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockReleasedOnExit$")
+	cmd.Env = append(os.Environ(), "FILELOCK_TEST_HOLD="+path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		cmd.Process.Kill()
+		t.Fatalf("the holding process said %q, %v", line, err)
+	}
+	if _, ok, _ := TryLock(path); ok {
+		t.Error("took the lock of another process")
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	release, err := Lock(ctx, path)
+	if err != nil {
+		t.Fatalf("the lock of a killed process wasn't released: %v", err)
+	}
+	release()
+}
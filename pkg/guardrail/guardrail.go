@@ -0,0 +1,163 @@
+// Package guardrail checks model output against assertions given on the
+// command line, such as "regex:^[A-Z]{3}$", "json-path:$.status" or
+// "max-words:50", so that scripts can rely on the shape of the output.
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds lists the supported assertion kinds
+var Kinds = []string{"regex", "not-regex", "json-path", "max-words", "min-words", "max-chars"}
+
+// Assertion is a single check of the output
+type Assertion struct {
+	// Spec is the assertion as it was given
+	Spec  string
+	kind  string
+	re    *regexp.Regexp
+	path  []interface{} // Object keys (string) and array indexes (int)
+	limit int
+}
+
+// Parse parses an assertion of the form kind:argument
+func Parse(spec string) (*Assertion, error) {
+	kind, arg, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("assertion %q must have the form kind:argument, with kind one of %s", spec, strings.Join(Kinds, ", "))
+	}
+
+	a := &Assertion{Spec: spec, kind: kind}
+	var err error
+	switch kind {
+	case "regex", "not-regex":
+		a.re, err = regexp.Compile(arg)
+	case "json-path":
+		a.path, err = parsePath(arg)
+	case "max-words", "min-words", "max-chars":
+		a.limit, err = strconv.Atoi(arg)
+		if err == nil && a.limit < 0 {
+			err = fmt.Errorf("limit must not be negative")
+		}
+	default:
+		return nil, fmt.Errorf("unknown assertion kind %q, supported kinds are %s", kind, strings.Join(Kinds, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("assertion %q: %v", spec, err)
+	}
+	return a, nil
+}
+
+// Check returns an error describing how output violates the assertion, or nil
+func (a *Assertion) Check(output string) error {
+	switch a.kind {
+	case "regex":
+		if !a.re.MatchString(output) {
+			return fmt.Errorf("%s: output does not match", a.Spec)
+		}
+	case "not-regex":
+		if a.re.MatchString(output) {
+			return fmt.Errorf("%s: output matches", a.Spec)
+		}
+	case "json-path":
+		var doc interface{}
+		if err := json.Unmarshal([]byte(output), &doc); err != nil {
+			return fmt.Errorf("%s: output is not valid JSON", a.Spec)
+		}
+		if value, ok := lookup(doc, a.path); !ok || value == nil {
+			return fmt.Errorf("%s: no value at this path", a.Spec)
+		}
+	case "max-words":
+		if n := len(strings.Fields(output)); n > a.limit {
+			return fmt.Errorf("%s: output has %d words", a.Spec, n)
+		}
+	case "min-words":
+		if n := len(strings.Fields(output)); n < a.limit {
+			return fmt.Errorf("%s: output has %d words", a.Spec, n)
+		}
+	case "max-chars":
+		if n := utf8.RuneCountInString(output); n > a.limit {
+			return fmt.Errorf("%s: output has %d characters", a.Spec, n)
+		}
+	}
+	return nil
+}
+
+// parsePath parses a JSON path of the form $.key.other[0]["quoted key"]
+func parsePath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSON path must start with $")
+	}
+
+	var steps []interface{}
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in JSON path")
+			}
+			steps = append(steps, rest[1:end+1])
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest, `"]`)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key in JSON path")
+			}
+			steps = append(steps, rest[2:end])
+			rest = rest[end+2:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index in JSON path")
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q in JSON path", rest[1:end])
+			}
+			steps = append(steps, i)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q in JSON path", rest)
+		}
+	}
+	return steps, nil
+}
+
+// lookup follows path through a decoded JSON document
+func lookup(doc interface{}, path []interface{}) (interface{}, bool) {
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			object, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if doc, ok = object[step]; !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := doc.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			if step < 0 {
+				step += len(array)
+			}
+			if step < 0 || step >= len(array) {
+				return nil, false
+			}
+			doc = array[step]
+		}
+	}
+	return doc, true
+}
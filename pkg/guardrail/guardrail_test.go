@@ -0,0 +1,58 @@
+package guardrail
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		spec   string
+		output string
+		ok     bool
+	}{
+		{"regex:^[A-Z]{3}$", "ABC", true},
+		{"regex:^[A-Z]{3}$", "ABCD", false},
+		{"not-regex:(?i)sorry", "Here it is", true},
+		{"not-regex:(?i)sorry", "Sorry, I can't", false},
+		{"json-path:$.status", `{"status": "ok"}`, true},
+		{"json-path:$.status", `{"status": null}`, false},
+		{"json-path:$.status", `{"state": "ok"}`, false},
+		{"json-path:$.status", `not json`, false},
+		{"json-path:$.items[0].id", `{"items": [{"id": 1}]}`, true},
+		{"json-path:$.items[-1].id", `{"items": [{"id": 1}, {"id": 2}]}`, true},
+		{"json-path:$.items[2]", `{"items": [1, 2]}`, false},
+		{`json-path:$["a b"].c`, `{"a b": {"c": false}}`, true},
+		{"max-words:3", "one two three", true},
+		{"max-words:3", "one two three four", false},
+		{"min-words:2", "one", false},
+		{"min-words:2", "one two", true},
+		{"max-chars:3", "äöü", true},
+		{"max-chars:3", "abcd", false},
+	}
+	for _, tt := range tests {
+		a, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if err := a.Check(tt.output); (err == nil) != tt.ok {
+			t.Errorf("%s on %q: got %v, want ok=%t", tt.spec, tt.output, err, tt.ok)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"regex",
+		"length:5",
+		"regex:(",
+		"json-path:status",
+		"json-path:$.",
+		"json-path:$[x]",
+		`json-path:$["a`,
+		"max-words:many",
+		"max-chars:-1",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package httpclient builds the HTTP client that sgpt sends API requests
+// with, so that the command and the sgpt library apply the same timeouts,
+// proxy settings and offline restriction.
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Options configures a client. The zero value has no time limits and honours
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+type Options struct {
+	// Timeout limits each request, including reading the reply
+	Timeout time.Duration
+	// ConnectTimeout limits connecting, including the TLS handshake
+	ConnectTimeout time.Duration
+	// IdleTimeout is how long idle connections are kept open for reuse
+	IdleTimeout time.Duration
+	// Proxy is the URL of the proxy requests go through, instead of the one
+	// of the environment
+	Proxy string
+	// Offline refuses every request to a host other than this machine
+	Offline bool
+}
+
+// DefaultOptions returns the settings sgpt uses unless told otherwise
+func DefaultOptions() Options {
+	return Options{ConnectTimeout: 10 * time.Second, IdleTimeout: 90 * time.Second}
+}
+
+// New returns a client configured with opts
+func New(opts Options) (*http.Client, error) {
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{{"timeout", opts.Timeout}, {"connect timeout", opts.ConnectTimeout}, {"idle timeout", opts.IdleTimeout}} {
+		if d.value < 0 {
+			return nil, fmt.Errorf("the %s must not be negative, got %s", d.name, d.value)
+		}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q, e.g. http://proxy.example.com:3128", opts.Proxy)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	if opts.Offline {
+		next := proxy
+		proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, err := next(req)
+			if err == nil && proxyURL != nil && !IsLocalHost(proxyURL.Hostname()) {
+				return nil, fmt.Errorf("offline: refusing to use the proxy %s, which is not this machine", proxyURL.Host)
+			}
+			return proxyURL, err
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       opts.IdleTimeout,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if opts.Offline {
+		// Check the address actually dialled as well, in case a local name resolves elsewhere
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil || !IsLocalHost(host) {
+				return fmt.Errorf("offline: refusing to connect to %s, which is not this machine", address)
+			}
+			return nil
+		}
+		transport = localTransport{next: transport}
+	}
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}, nil
+}
+
+// localTransport refuses requests to hosts other than this machine
+type localTransport struct {
+	next http.RoundTripper
+}
+
+func (t localTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !IsLocalHost(req.URL.Hostname()) {
+		return nil, fmt.Errorf("offline: refusing to connect to %s, which is not this machine", req.URL.Host)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// IsLocalHost tells whether a host name or IP address refers to this machine.
+// Names other than localhost are not resolved, since the lookup itself would
+// leave the machine.
+func IsLocalHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
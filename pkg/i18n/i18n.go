@@ -0,0 +1,108 @@
+// Package i18n translates the messages sgpt shows its users as it talks them
+// through a task: prompts and confirmation questions, what sgpt reports when
+// one is declined, the setup walkthrough and the errors of the configuration
+// check. Other errors, about files and API responses, and the flag help stay
+// in English. Messages are written in English in the source and
+// looked up by that text in the catalog of the selected language, so a message
+// missing from a catalog is shown in English. Catalogs are JSON files in the
+// catalogs directory, embedded in the binary.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed catalogs/*.json
+var catalogFiles embed.FS
+
+// Translations of the selected language, nil for English
+var current map[string]string
+
+// Locales returns the languages messages can be shown in
+func Locales() []string {
+	locales := []string{"en"}
+	entries, _ := catalogFiles.ReadDir("catalogs")
+	for _, entry := range entries {
+		locales = append(locales, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(locales[1:])
+	return locales
+}
+
+// Select chooses the language of messages: locale if it is set, such as de or
+// pt_BR.UTF-8, otherwise the first of LC_ALL, LC_MESSAGES and LANG that is
+// set. Messages stay in English for a locale from the environment that has no
+// catalog; an explicitly given one is an error.
+func Select(locale string) error {
+	explicit := locale != ""
+	if !explicit {
+		for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+			if locale = os.Getenv(name); locale != "" {
+				break
+			}
+		}
+	}
+	catalog, err := load(locale)
+	if err != nil && explicit {
+		return err
+	}
+	current = catalog
+	return nil
+}
+
+// load reads the catalog of a locale, trying the language with its region
+// first, e.g. pt-br and then pt, nil for English
+func load(locale string) (map[string]string, error) {
+	tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if i := strings.IndexAny(tag, ".@"); i >= 0 {
+		tag = tag[:i] // Encoding or modifier, as in de_DE.UTF-8 or ca_ES@valencia
+	}
+	language, _, _ := strings.Cut(tag, "-")
+	if tag == "" || tag == "c" || tag == "posix" || language == "en" {
+		return nil, nil
+	}
+	for _, name := range []string{tag, language} {
+		data, err := catalogFiles.ReadFile(path.Join("catalogs", name+".json"))
+		if err != nil {
+			continue
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("message catalog %s: %v", name, err)
+		}
+		return catalog, nil
+	}
+	return nil, fmt.Errorf("no messages in %q, available languages are %s", locale, strings.Join(Locales(), ", "))
+}
+
+// T returns the translation of message in the selected language
+func T(message string) string {
+	if translated, ok := current[message]; ok {
+		return translated
+	}
+	return message
+}
+
+// Sprintf formats the translation of format in the selected language
+func Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(T(format), args...)
+}
+
+// Errorf returns an error with the translation of format in the selected
+// language, formatted as fmt.Errorf does
+func Errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(T(format), args...)
+}
+
+// Yes tells whether the answer to a yes/no question is yes, in English or the
+// selected language
+func Yes(answer string) bool {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes" || answer == strings.ToLower(T("y")) || answer == strings.ToLower(T("yes"))
+}
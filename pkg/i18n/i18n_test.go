@@ -0,0 +1,56 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+// Formatting verbs of a message, such as %s and %d
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// Every catalog translates the same messages, keeping their formatting verbs
+func TestCatalogsMatch(t *testing.T) {
+	catalogs := map[string]map[string]string{}
+	for _, locale := range Locales()[1:] {
+		catalog, err := load(locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		catalogs[locale] = catalog
+	}
+	for locale, catalog := range catalogs {
+		for other, otherCatalog := range catalogs {
+			for message := range otherCatalog {
+				if _, ok := catalog[message]; !ok {
+					t.Errorf("%s lacks %q, which %s translates", locale, message, other)
+				}
+			}
+		}
+		for message, translated := range catalog {
+			want, got := verbs.FindAllString(message, -1), verbs.FindAllString(translated, -1)
+			if len(want) != len(got) {
+				t.Errorf("%s translates %q as %q, with other formatting verbs", locale, message, translated)
+				continue
+			}
+			for i := range want {
+				if want[i] != got[i] {
+					t.Errorf("%s translates %q as %q, with other formatting verbs", locale, message, translated)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestErrorf(t *testing.T) {
+	defer Select("en")
+	if err := Select("de_DE.UTF-8"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Errorf("nothing committed").Error(); got != "nichts committet" {
+		t.Errorf("Errorf = %q", got)
+	}
+	if err := Select("xx"); err == nil {
+		t.Error("Select accepted a language without a catalog")
+	}
+}
@@ -0,0 +1,86 @@
+package imageprep
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Extensions of camera RAW formats that are converted before upload
+var rawExtensions = map[string]bool{
+	".arw": true, ".cr2": true, ".cr3": true, ".dng": true, ".nef": true,
+	".orf": true, ".raf": true, ".rw2": true, ".pef": true, ".srw": true,
+}
+
+// isHEIF reports whether data is a HEIC/HEIF image, as saved by iPhones
+func isHEIF(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	switch string(data[8:12]) {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+		return true
+	}
+	return false
+}
+
+// isRAW reports whether path names a camera RAW file
+func isRAW(path string) bool {
+	return rawExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// converter is an external program able to turn HEIF or RAW images into JPEG
+type converter struct {
+	name string
+	heif bool // Whether it only handles HEIF
+	args func(in, out string) []string
+}
+
+// There are no pure-Go HEIF or RAW decoders in the standard library, so
+// conversion relies on whichever of these tools is installed
+var converters = []converter{
+	{"sips", false, func(in, out string) []string { return []string{"-s", "format", "jpeg", in, "--out", out} }},
+	{"heif-convert", true, func(in, out string) []string { return []string{in, out} }},
+	{"magick", false, func(in, out string) []string { return []string{in, out} }},
+	{"convert", false, func(in, out string) []string { return []string{in, out} }},
+}
+
+// convertToJPEG converts a HEIF or RAW image to JPEG with the first available converter
+func convertToJPEG(path string, heif bool) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "sgpt-image-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "converted.jpg")
+
+	var tried []string
+	for _, c := range converters {
+		if c.heif && !heif {
+			continue
+		}
+		bin, err := exec.LookPath(c.name)
+		if err != nil {
+			continue
+		}
+		tried = append(tried, c.name)
+
+		if err := exec.Command(bin, c.args(path, out)...).Run(); err != nil {
+			continue
+		}
+		if data, err := os.ReadFile(out); err == nil && len(data) > 0 {
+			return data, nil
+		}
+	}
+
+	kind := "RAW"
+	if heif {
+		kind = "HEIC/HEIF"
+	}
+	if len(tried) > 0 {
+		return nil, fmt.Errorf("%s: converting the %s image to JPEG failed (tried %s)", path, kind, strings.Join(tried, ", "))
+	}
+	return nil, fmt.Errorf("%s: %s images must be converted to JPEG before upload; install ImageMagick, libheif (heif-convert) or, on macOS, use sips", path, kind)
+}
@@ -0,0 +1,176 @@
+// Package imageprep prepares image attachments for multimodal models. It
+// detects the image format, converts HEIC and camera RAW photos to JPEG,
+// and, when asked, downscales large images so their longest side fits a
+// limit, which cuts the number of vision tokens providers charge for.
+package imageprep
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Register the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Image is an attachment ready to be sent to a provider
+type Image struct {
+	Data []byte
+	// MIME is the media type of Data, e.g. image/png
+	MIME string
+}
+
+// Format returns the short format name of the image, e.g. "png"
+func (img *Image) Format() string {
+	switch img.MIME {
+	case "image/jpeg":
+		return "jpeg"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	}
+	return "png"
+}
+
+// Load reads an image file. If maxDim is positive and the image is larger
+// than maxDim pixels on its longest side, it is downscaled to fit and
+// re-encoded; otherwise the file is returned as it is.
+func Load(path string, maxDim int) (*Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers reject HEIC and RAW photos, so convert them to JPEG first
+	if heif := isHEIF(data); heif || isRAW(path) {
+		data, err = convertToJPEG(path, heif)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return prepare(path, data, maxDim)
+}
+
+// Decode prepares an image read from elsewhere than a file, such as stdin, like Load. name
+// identifies the image in errors. RAW photos are not recognized without their file extension.
+func Decode(name string, data []byte, maxDim int) (*Image, error) {
+	if isHEIF(data) {
+		dir, err := os.MkdirTemp("", "sgpt-image-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "image.heic")
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, err
+		}
+		if data, err = convertToJPEG(path, true); err != nil {
+			return nil, err
+		}
+	}
+	return prepare(name, data, maxDim)
+}
+
+// prepare checks the format of an image and downscales it to maxDim
+func prepare(path string, data []byte, maxDim int) (*Image, error) {
+	mime := http.DetectContentType(data)
+	switch mime {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+	default:
+		return nil, fmt.Errorf("%s: unsupported image type %s", path, mime)
+	}
+
+	if maxDim <= 0 {
+		return &Image{Data: data, MIME: mime}, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if mime == "image/webp" {
+			return nil, fmt.Errorf("%s: resizing WebP images is not supported", path)
+		}
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if config.Width <= maxDim && config.Height <= maxDim {
+		return &Image{Data: data, MIME: mime}, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	width, height := fit(config.Width, config.Height, maxDim)
+	resized := Resize(src, width, height)
+
+	var out bytes.Buffer
+	if mime == "image/jpeg" {
+		err = jpeg.Encode(&out, resized, &jpeg.Options{Quality: 85})
+	} else {
+		// PNG keeps transparency; GIFs are flattened to their first frame
+		mime = "image/png"
+		err = png.Encode(&out, resized)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Image{Data: out.Bytes(), MIME: mime}, nil
+}
+
+// fit scales width and height so the longest side is maxDim, keeping the aspect ratio
+func fit(width, height, maxDim int) (int, int) {
+	if width >= height {
+		return maxDim, max1(height * maxDim / width)
+	}
+	return max1(width * maxDim / height), maxDim
+}
+
+func max1(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Resize downscales src to width x height by averaging the source pixels
+// covered by each destination pixel
+func Resize(src image.Image, width, height int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*sh/height
+		y1 := b.Min.Y + (y+1)*sh/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*sw/width
+			x1 := b.Min.X + (x+1)*sw/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(src.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,177 @@
+// Package github is a small client for the parts of the GitHub REST API used
+// by the `sgpt gh` commands: fetching pull requests and issues and posting
+// comments back to them.
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultBaseURL is the GitHub REST API endpoint used when none is configured
+const DefaultBaseURL = "https://api.github.com"
+
+// Client talks to the GitHub REST API using a personal access token
+type Client struct {
+	Token   string
+	BaseURL string
+	HTTP    *http.Client
+	// UserAgent identifies the calling application, if set
+	UserAgent string
+}
+
+// PullRequest holds the fields of a pull request needed for a review
+type PullRequest struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Diff   string `json:"-"`
+}
+
+// Comment is a single issue or pull request comment
+type Comment struct {
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Body string `json:"body"`
+}
+
+// Issue holds an issue together with its discussion
+type Issue struct {
+	Number   int       `json:"number"`
+	Title    string    `json:"title"`
+	Body     string    `json:"body"`
+	State    string    `json:"state"`
+	Comments []Comment `json:"-"`
+}
+
+// NewClient returns a Client for the public GitHub API
+func NewClient(token string) *Client {
+	return &Client{Token: token, BaseURL: DefaultBaseURL, HTTP: &http.Client{}}
+}
+
+// ParseRepo splits an "owner/name" string, also accepting GitHub remote URLs
+// such as git@github.com:owner/name.git or https://github.com/owner/name
+func ParseRepo(s string) (owner, name string, err error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, ".git")
+	if i := strings.Index(s, "github.com"); i >= 0 {
+		s = strings.TrimLeft(s[i+len("github.com"):], ":/")
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid repository %q, expected owner/name", s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// PullRequest fetches a pull request and its unified diff
+func (c *Client) PullRequest(owner, repo string, number int) (*PullRequest, error) {
+	path := fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, repo, number)
+
+	var pr PullRequest
+	if err := c.getJSON(path, &pr); err != nil {
+		return nil, err
+	}
+
+	diff, err := c.get(path, "application/vnd.github.v3.diff")
+	if err != nil {
+		return nil, err
+	}
+	pr.Diff = string(diff)
+
+	return &pr, nil
+}
+
+// Issue fetches an issue and all of its comments
+func (c *Client) Issue(owner, repo string, number int) (*Issue, error) {
+	path := fmt.Sprintf("/repos/%s/%s/issues/%d", owner, repo, number)
+
+	var issue Issue
+	if err := c.getJSON(path, &issue); err != nil {
+		return nil, err
+	}
+
+	for page := 1; ; page++ {
+		var comments []Comment
+		if err := c.getJSON(fmt.Sprintf("%s/comments?per_page=100&page=%d", path, page), &comments); err != nil {
+			return nil, err
+		}
+		issue.Comments = append(issue.Comments, comments...)
+		if len(comments) < 100 {
+			break
+		}
+	}
+
+	return &issue, nil
+}
+
+// PostComment adds a comment to an issue or pull request
+func (c *Client) PostComment(owner, repo string, number int, body string) error {
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, repo, number)
+	_, err = c.do("POST", path, "application/vnd.github+json", bytes.NewReader(payload))
+	return err
+}
+
+func (c *Client) getJSON(path string, v interface{}) error {
+	body, err := c.get(path, "application/vnd.github+json")
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (c *Client) get(path, accept string) ([]byte, error) {
+	return c.do("GET", path, accept, nil)
+}
+
+func (c *Client) do(method, path, accept string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.BaseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("github: %s %s: %s (%d)", method, path, apiErr.Message, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("github: %s %s: %s", method, path, resp.Status)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,101 @@
+// Package jira files issues through the Jira Cloud REST API.
+package jira
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client creates issues in a Jira site using an account email and API token
+type Client struct {
+	BaseURL string
+	Email   string
+	Token   string
+	HTTP    *http.Client
+	// UserAgent identifies the calling application, if set
+	UserAgent string
+}
+
+// Issue is the subset of issue fields sgpt sets when filing a ticket
+type Issue struct {
+	Project     string
+	Type        string
+	Summary     string
+	Description string
+	Priority    string
+}
+
+// NewClient returns a Client for the Jira site at baseURL, e.g. https://example.atlassian.net
+func NewClient(baseURL, email, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Email: email, Token: token, HTTP: &http.Client{}}
+}
+
+// CreateIssue files the issue and returns its key and browse URL
+func (c *Client) CreateIssue(issue Issue) (key, url string, err error) {
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": issue.Project},
+		"issuetype":   map[string]string{"name": issue.Type},
+		"summary":     issue.Summary,
+		"description": issue.Description,
+	}
+	if issue.Priority != "" {
+		fields["priority"] = map[string]string{"name": issue.Priority}
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"fields": fields})
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequest("POST", c.BaseURL+"/rest/api/2/issue", bytes.NewReader(payload))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(c.Email, c.Token)
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			ErrorMessages []string          `json:"errorMessages"`
+			Errors        map[string]string `json:"errors"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil {
+			msgs := apiErr.ErrorMessages
+			for field, msg := range apiErr.Errors {
+				msgs = append(msgs, field+": "+msg)
+			}
+			if len(msgs) > 0 {
+				return "", "", fmt.Errorf("jira: %s", strings.Join(msgs, "; "))
+			}
+		}
+		return "", "", fmt.Errorf("jira: create issue: %s", resp.Status)
+	}
+
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		return "", "", err
+	}
+
+	return created.Key, c.BaseURL + "/browse/" + created.Key, nil
+}
@@ -0,0 +1,110 @@
+// Package kubernetes gathers cluster context for the `sgpt k8s` command by
+// shelling out to kubectl. Only read-only kubectl verbs are run, except for
+// Apply, which callers must invoke explicitly.
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// readOnlyVerbs are the kubectl subcommands Kubectl.run is allowed to execute
+var readOnlyVerbs = map[string]bool{
+	"config":   true,
+	"get":      true,
+	"describe": true,
+}
+
+// Kubectl runs kubectl against the current context, optionally scoped to a namespace
+type Kubectl struct {
+	Path      string
+	Namespace string
+}
+
+// New returns a Kubectl using the kubectl binary found on PATH
+func New(namespace string) *Kubectl {
+	return &Kubectl{Path: "kubectl", Namespace: namespace}
+}
+
+// Gather collects the current context, namespaces, recent events and, when
+// resource is set (e.g. "pod/web-0"), its describe output
+func (k *Kubectl) Gather(resource string) (string, error) {
+	var b strings.Builder
+
+	current, err := k.run("config", "current-context")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "Current context: %s\n", strings.TrimSpace(current))
+	if k.Namespace != "" {
+		fmt.Fprintf(&b, "Namespace: %s\n", k.Namespace)
+	}
+
+	if namespaces, err := k.run("get", "namespaces"); err == nil {
+		fmt.Fprintf(&b, "\nNamespaces:\n%s", namespaces)
+	}
+
+	eventArgs := []string{"get", "events", "--sort-by=.lastTimestamp"}
+	if k.Namespace == "" {
+		eventArgs = append(eventArgs, "--all-namespaces")
+	}
+	if events, err := k.run(eventArgs...); err == nil {
+		fmt.Fprintf(&b, "\nRecent events:\n%s", tail(events, 50))
+	}
+
+	if resource != "" {
+		describe, err := k.run("describe", resource)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "\nkubectl describe %s:\n%s", resource, describe)
+	}
+
+	return b.String(), nil
+}
+
+// Apply runs `kubectl apply -f -` with the given manifest. This is the only
+// method that modifies the cluster.
+func (k *Kubectl) Apply(manifest string) (string, error) {
+	cmd := exec.Command(k.Path, k.withNamespace([]string{"apply", "-f", "-"})...)
+	cmd.Stdin = strings.NewReader(manifest)
+	return output(cmd)
+}
+
+func (k *Kubectl) run(args ...string) (string, error) {
+	if !readOnlyVerbs[args[0]] {
+		return "", fmt.Errorf("kubectl %s is not a read-only command", args[0])
+	}
+	return output(exec.Command(k.Path, k.withNamespace(args)...))
+}
+
+func (k *Kubectl) withNamespace(args []string) []string {
+	if k.Namespace == "" || args[0] == "config" {
+		return args
+	}
+	return append(args, "--namespace", k.Namespace)
+}
+
+func output(cmd *exec.Cmd) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", strings.Join(cmd.Args, " "), msg)
+		}
+		return "", fmt.Errorf("%s: %v", strings.Join(cmd.Args, " "), err)
+	}
+	return stdout.String(), nil
+}
+
+// tail returns the header line and the last n lines of kubectl table output
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) <= n+1 {
+		return s
+	}
+	return lines[0] + "\n" + strings.Join(lines[len(lines)-n:], "\n") + "\n"
+}
@@ -0,0 +1,114 @@
+// Package linear files issues through the Linear GraphQL API.
+package linear
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultURL is the Linear GraphQL endpoint
+const DefaultURL = "https://api.linear.app/graphql"
+
+// Client creates issues in Linear using a personal API key
+type Client struct {
+	URL    string
+	APIKey string
+	HTTP   *http.Client
+	// UserAgent identifies the calling application, if set
+	UserAgent string
+}
+
+// Issue is the subset of issue fields sgpt sets when filing a ticket.
+// Priority follows Linear's scale: 0 none, 1 urgent, 2 high, 3 medium, 4 low.
+type Issue struct {
+	TeamID      string
+	Title       string
+	Description string
+	Priority    int
+}
+
+// NewClient returns a Client for the public Linear API
+func NewClient(apiKey string) *Client {
+	return &Client{URL: DefaultURL, APIKey: apiKey, HTTP: &http.Client{}}
+}
+
+const issueCreateMutation = `mutation IssueCreate($input: IssueCreateInput!) {
+  issueCreate(input: $input) {
+    success
+    issue { identifier url }
+  }
+}`
+
+// CreateIssue files the issue and returns its identifier and URL
+func (c *Client) CreateIssue(issue Issue) (identifier, url string, err error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"query": issueCreateMutation,
+		"variables": map[string]interface{}{
+			"input": map[string]interface{}{
+				"teamId":      issue.TeamID,
+				"title":       issue.Title,
+				"description": issue.Description,
+				"priority":    issue.Priority,
+			},
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequest("POST", c.URL, bytes.NewReader(payload))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", c.APIKey)
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+
+	var result struct {
+		Data struct {
+			IssueCreate struct {
+				Success bool `json:"success"`
+				Issue   struct {
+					Identifier string `json:"identifier"`
+					URL        string `json:"url"`
+				} `json:"issue"`
+			} `json:"issueCreate"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", "", fmt.Errorf("linear: create issue: %s", resp.Status)
+	}
+
+	if len(result.Errors) > 0 {
+		var msgs []string
+		for _, e := range result.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return "", "", fmt.Errorf("linear: %s", strings.Join(msgs, "; "))
+	}
+	if !result.Data.IssueCreate.Success {
+		return "", "", fmt.Errorf("linear: issue was not created")
+	}
+
+	return result.Data.IssueCreate.Issue.Identifier, result.Data.IssueCreate.Issue.URL, nil
+}
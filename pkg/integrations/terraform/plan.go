@@ -0,0 +1,145 @@
+// Package terraform reads the JSON representation of a Terraform plan, as
+// produced by `terraform show -json plan.out`, and classifies its resource
+// changes by risk.
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Risk levels assigned to resource changes, from least to most dangerous
+const (
+	RiskNone = iota
+	RiskLow
+	RiskMedium
+	RiskHigh
+)
+
+// Plan is the subset of the plan JSON format sgpt uses
+type Plan struct {
+	FormatVersion    string           `json:"format_version"`
+	TerraformVersion string           `json:"terraform_version"`
+	ResourceChanges  []ResourceChange `json:"resource_changes"`
+}
+
+// ResourceChange describes the planned change to a single resource instance
+type ResourceChange struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Change  struct {
+		Actions      []string        `json:"actions"`
+		Before       json.RawMessage `json:"before"`
+		After        json.RawMessage `json:"after"`
+		ReplacePaths json.RawMessage `json:"replace_paths,omitempty"`
+	} `json:"change"`
+	ActionReason string `json:"action_reason,omitempty"`
+}
+
+// Parse decodes a plan from r
+func Parse(r io.Reader) (*Plan, error) {
+	var plan Plan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("not a terraform JSON plan: %v", err)
+	}
+	if plan.FormatVersion == "" {
+		return nil, fmt.Errorf("not a terraform JSON plan: missing format_version")
+	}
+	return &plan, nil
+}
+
+// Action returns the change's actions joined as Terraform displays them,
+// e.g. "create", "delete" or "delete-create" for a replacement
+func (rc *ResourceChange) Action() string {
+	return strings.Join(rc.Change.Actions, "-")
+}
+
+// Destructive reports whether the change deletes the existing resource,
+// including replacements
+func (rc *ResourceChange) Destructive() bool {
+	for _, a := range rc.Change.Actions {
+		if a == "delete" {
+			return true
+		}
+	}
+	return false
+}
+
+// Risk classifies the change: deletions and replacements are high risk,
+// in-place updates medium, creations low and no-ops and reads none
+func (rc *ResourceChange) Risk() int {
+	switch {
+	case rc.Destructive():
+		return RiskHigh
+	case rc.Action() == "update":
+		return RiskMedium
+	case rc.Action() == "create":
+		return RiskLow
+	}
+	return RiskNone
+}
+
+// RiskName returns a human readable name for a risk level
+func RiskName(risk int) string {
+	switch risk {
+	case RiskHigh:
+		return "high"
+	case RiskMedium:
+		return "medium"
+	case RiskLow:
+		return "low"
+	}
+	return "none"
+}
+
+// Changes returns the resource changes that do something, most risky first
+func (p *Plan) Changes() []ResourceChange {
+	var changes []ResourceChange
+	for _, rc := range p.ResourceChanges {
+		if rc.Risk() != RiskNone {
+			changes = append(changes, rc)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Risk() > changes[j].Risk()
+	})
+	return changes
+}
+
+// Summary renders a one-line-per-resource overview of the plan grouped by risk
+func (p *Plan) Summary() string {
+	var b strings.Builder
+	changes := p.Changes()
+	if len(changes) == 0 {
+		return "No changes.\n"
+	}
+	last := -1
+	for _, rc := range changes {
+		if risk := rc.Risk(); risk != last {
+			name := RiskName(risk)
+			fmt.Fprintf(&b, "%s%s risk:\n", strings.ToUpper(name[:1]), name[1:])
+			last = risk
+		}
+		fmt.Fprintf(&b, "  %-13s %s\n", rc.Action(), rc.Address)
+	}
+	return b.String()
+}
+
+// Details renders each change with its before and after values, for the model
+func (p *Plan) Details() string {
+	var b strings.Builder
+	for _, rc := range p.Changes() {
+		fmt.Fprintf(&b, "%s (%s, %s risk)\n", rc.Address, rc.Action(), RiskName(rc.Risk()))
+		if rc.ActionReason != "" {
+			fmt.Fprintf(&b, "reason: %s\n", rc.ActionReason)
+		}
+		if len(rc.Change.ReplacePaths) > 0 {
+			fmt.Fprintf(&b, "replaced because of: %s\n", rc.Change.ReplacePaths)
+		}
+		fmt.Fprintf(&b, "before: %s\nafter: %s\n\n", rc.Change.Before, rc.Change.After)
+	}
+	return b.String()
+}
@@ -0,0 +1,237 @@
+// Package jsonschema validates JSON documents against the commonly used
+// subset of JSON Schema: type, properties, required, additionalProperties,
+// items, enum, const, string length, numeric bounds and array length.
+// Keywords outside this subset are ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Schema is a parsed JSON schema
+type Schema struct {
+	root map[string]interface{}
+	// Raw is the schema as it was read
+	Raw json.RawMessage
+}
+
+// Parse reads a JSON schema, which must be a JSON object
+func Parse(data []byte) (*Schema, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %v", err)
+	}
+	return &Schema{root: root, Raw: json.RawMessage(bytes.TrimSpace(data))}, nil
+}
+
+// Validate checks that doc is a JSON document matching the schema. The error
+// lists every violation with the JSON path where it was found.
+func (s *Schema) Validate(doc []byte) error {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("not valid JSON: %v", err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("not valid JSON: unexpected data after the document")
+	}
+
+	var problems []string
+	validate(s.root, value, "$", &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		report("expected %s, got %s", typeNames(t), typeOf(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, value) {
+		report("value is not one of the allowed values")
+	}
+	if c, ok := schema["const"]; ok && !equalValues(c, value) {
+		report("value must be %v", c)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, present := v[name]; !present {
+						report("missing required property %q", name)
+					}
+				}
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if sub, ok := properties[name].(map[string]interface{}); ok {
+				validate(sub, v[name], path+"."+name, problems)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					report("unexpected property %q", name)
+				}
+			case map[string]interface{}:
+				validate(extra, v[name], path+"."+name, problems)
+			}
+		}
+
+	case []interface{}:
+		if min, ok := number(schema["minItems"]); ok && float64(len(v)) < min {
+			report("expected at least %g items, got %d", min, len(v))
+		}
+		if max, ok := number(schema["maxItems"]); ok && float64(len(v)) > max {
+			report("expected at most %g items, got %d", max, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := number(schema["minLength"]); ok && length < min {
+			report("expected at least %g characters", min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && length > max {
+			report("expected at most %g characters", max)
+		}
+
+	case json.Number:
+		n, _ := v.Float64()
+		if min, ok := number(schema["minimum"]); ok && n < min {
+			report("%s is less than the minimum %g", v, min)
+		}
+		if max, ok := number(schema["maximum"]); ok && n > max {
+			report("%s is greater than the maximum %g", v, max)
+		}
+	}
+}
+
+// matchesType reports whether value has the type, or one of the types, named by t
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesTypeName(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok && matchesTypeName(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, value interface{}) bool {
+	if name == "integer" {
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	}
+	return name == typeOf(value)
+}
+
+// typeOf returns the JSON Schema type name of a decoded value
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func typeNames(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		var parts []string
+		for _, name := range names {
+			parts = append(parts, fmt.Sprint(name))
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if equalValues(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares a value from the schema, decoded with float64 numbers,
+// with a value from the document, decoded with json.Number
+func equalValues(schemaValue, value interface{}) bool {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		return err == nil && schemaValue == f
+	}
+	return reflect.DeepEqual(schemaValue, normalize(value))
+}
+
+// normalize converts json.Number values nested in value to float64
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = normalize(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = normalize(item)
+		}
+		return out
+	}
+	return value
+}
@@ -0,0 +1,98 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 10},
+		"age": {"type": "integer", "minimum": 0, "maximum": 150},
+		"role": {"enum": ["admin", "user"]},
+		"kind": {"const": "person"},
+		"tags": {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 2},
+		"nickname": {"type": ["string", "null"]}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false
+}`
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse([]byte(personSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		doc string
+		// Substrings of the error, none if the document is valid
+		problems []string
+	}{
+		{`{"name": "Ann", "age": 30}`, nil},
+		{`{"name": "Ann", "age": 30, "role": "admin", "kind": "person", "tags": ["a"], "nickname": null}`, nil},
+		{`{"name": "Ann", "age": 30.0}`, nil},
+		{`{"name": "Ann"}`, []string{`$: missing required property "age"`}},
+		{`{"name": "Ann", "age": 30.5}`, []string{"$.age: expected integer, got number"}},
+		{`{"name": "Ann", "age": -1}`, []string{"$.age: -1 is less than the minimum 0"}},
+		{`{"name": "Ann", "age": 200}`, []string{"$.age: 200 is greater than the maximum 150"}},
+		{`{"name": "", "age": 1}`, []string{"$.name: expected at least 1 characters"}},
+		{`{"name": "Bartholomew!", "age": 1}`, []string{"$.name: expected at most 10 characters"}},
+		{`{"name": "Ann", "age": 1, "role": "root"}`, []string{"$.role: value is not one of the allowed values"}},
+		{`{"name": "Ann", "age": 1, "kind": "robot"}`, []string{"$.kind: value must be person"}},
+		{`{"name": "Ann", "age": 1, "tags": []}`, []string{"$.tags: expected at least 1 items"}},
+		{`{"name": "Ann", "age": 1, "tags": ["a", "b", "c"]}`, []string{"$.tags: expected at most 2 items"}},
+		{`{"name": "Ann", "age": 1, "tags": ["a", 2]}`, []string{"$.tags[1]: expected string, got number"}},
+		{`{"name": "Ann", "age": 1, "nickname": 5}`, []string{"$.nickname: expected string or null, got number"}},
+		{`{"name": "Ann", "age": 1, "extra": true}`, []string{`$: unexpected property "extra"`}},
+		// Every violation is reported
+		{`{"age": "old", "extra": 1}`, []string{`missing required property "name"`, "$.age: expected integer, got string", `unexpected property "extra"`}},
+		{`[]`, []string{"$: expected object, got array"}},
+		{`{"name": "Ann", "age": 1} {}`, []string{"unexpected data after the document"}},
+		{`{"name": `, []string{"not valid JSON"}},
+	}
+	for _, tt := range tests {
+		err := schema.Validate([]byte(tt.doc))
+		if len(tt.problems) == 0 {
+			if err != nil {
+				t.Errorf("Validate(%s): %v", tt.doc, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Validate(%s) succeeded, want %q", tt.doc, tt.problems)
+			continue
+		}
+		for _, problem := range tt.problems {
+			if !strings.Contains(err.Error(), problem) {
+				t.Errorf("Validate(%s) = %q, want it to contain %q", tt.doc, err, problem)
+			}
+		}
+	}
+}
+
+func TestValidateAdditionalPropertiesSchema(t *testing.T) {
+	schema, err := Parse([]byte(`{"type": "object", "additionalProperties": {"type": "number"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validate([]byte(`{"a": 1, "b": 2.5}`)); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if err := schema.Validate([]byte(`{"a": "x"}`)); err == nil || !strings.Contains(err.Error(), "$.a: expected number") {
+		t.Errorf("Validate = %v, want a type error at $.a", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte(`[1, 2]`)); err == nil {
+		t.Error("Parse accepted a schema that is not an object")
+	}
+	schema, err := Parse([]byte("  {\"type\": \"string\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(schema.Raw) != `{"type": "string"}` {
+		t.Errorf("Raw = %q", schema.Raw)
+	}
+}
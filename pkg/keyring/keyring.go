@@ -0,0 +1,70 @@
+// Package keyring stores secrets such as API keys in the operating system's
+// credential store, using the macOS keychain through `security` and the
+// Secret Service (GNOME Keyring, KWallet) through `secret-tool` on Linux.
+package keyring
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnavailable is returned when no supported credential store is installed
+var ErrUnavailable = errors.New("no supported keyring found (macOS keychain or secret-tool)")
+
+// ErrNotFound is returned when the keyring holds no secret for the service and account
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// Available reports whether secrets can be stored on this system
+func Available() bool {
+	_, err := exec.LookPath(tool())
+	return err == nil
+}
+
+// Get returns the secret stored for account under service
+func Get(service, account string) (string, error) {
+	if !Available() {
+		return "", ErrUnavailable
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+	out, err := cmd.Output()
+	secret := strings.TrimRight(string(out), "\r\n")
+	if err != nil || secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set stores secret for account under service, replacing any previous secret
+func Set(service, account, secret string) error {
+	if !Available() {
+		return ErrUnavailable
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", account, "-w", secret)
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.New("storing secret in keyring: " + strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// tool returns the command used to access the credential store on this system
+func tool() string {
+	if runtime.GOOS == "darwin" {
+		return "security"
+	}
+	return "secret-tool"
+}
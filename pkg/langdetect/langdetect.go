@@ -0,0 +1,153 @@
+// Package langdetect guesses the language of a text locally, without a
+// model: by the script its letters are written in, and for Latin script by
+// the share of each language's most common words. It recognizes the widely
+// used languages and says so when it isn't sure, rather than guessing.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// How much of a text is looked at
+const sampleSize = 16 << 10
+
+// Common words of languages written in Latin script. Words shared by several of the languages, such
+// as "a", "de" or "en", are left out so that they don't blur the scores.
+var stopWords = map[string][]string{
+	"English":    {"the", "and", "of", "to", "is", "that", "it", "for", "with", "was", "this", "are", "be", "have", "you", "not", "at", "by", "from", "which", "or", "we", "they", "been"},
+	"German":     {"der", "die", "und", "das", "ist", "nicht", "mit", "sich", "auf", "für", "ein", "eine", "dem", "den", "auch", "wir", "sie", "wird", "werden", "oder", "bei", "nach", "zu", "ich"},
+	"French":     {"le", "les", "et", "est", "des", "une", "du", "pour", "dans", "qui", "que", "sur", "pas", "au", "avec", "nous", "vous", "sont", "ce", "aux", "ou", "mais", "cette", "été"},
+	"Spanish":    {"el", "los", "las", "y", "es", "del", "por", "para", "se", "su", "al", "lo", "como", "más", "pero", "sus", "está", "son", "este", "también", "fue", "muy", "hay", "esta"},
+	"Italian":    {"il", "di", "che", "è", "della", "per", "non", "sono", "gli", "nel", "alla", "dei", "anche", "più", "questo", "delle", "ma", "essere", "ha", "si", "degli", "sul", "questa", "molto"},
+	"Portuguese": {"o", "os", "do", "da", "não", "uma", "com", "no", "em", "mais", "dos", "das", "ao", "seu", "sua", "é", "são", "também", "foi", "pelo", "pela", "você", "isso", "muito"},
+	"Dutch":      {"het", "een", "van", "dat", "niet", "op", "te", "zijn", "voor", "met", "ook", "maar", "wordt", "aan", "bij", "deze", "naar", "worden", "wel", "hij", "ik", "kan", "heeft", "nog"},
+	"Swedish":    {"och", "att", "är", "för", "inte", "till", "ett", "jag", "också", "eller", "från", "vid", "hur", "när", "mycket", "bara", "efter", "vara", "detta", "dessa", "andra", "utan", "sina", "finns"},
+	"Polish":     {"w", "nie", "na", "się", "jest", "że", "z", "jak", "od", "po", "są", "przez", "tak", "dla", "czy", "ale", "jego", "także", "być", "który", "już", "oraz", "tylko", "może"},
+	"Turkish":    {"ve", "bir", "bu", "için", "ile", "olarak", "çok", "daha", "gibi", "olan", "ama", "ne", "var", "değil", "kadar", "sonra", "her", "veya", "ben", "biz", "onlar", "şu", "mı", "ise"},
+	"Indonesian": {"yang", "dan", "ini", "itu", "dengan", "untuk", "tidak", "dari", "dalam", "akan", "pada", "juga", "ke", "karena", "ada", "oleh", "saya", "kami", "mereka", "bisa", "sudah", "atau", "adalah", "tersebut"},
+}
+
+var stopWordSets = func() map[string]map[string]bool {
+	sets := map[string]map[string]bool{}
+	for lang, words := range stopWords {
+		sets[lang] = map[string]bool{}
+		for _, w := range words {
+			sets[lang][w] = true
+		}
+	}
+	return sets
+}()
+
+// Detect returns the English name of the language text is written in, e.g. "German", or "" if it
+// can't tell, because the text is too short, mixes languages or is in a language it doesn't know
+func Detect(text string) string {
+	if len(text) > sampleSize {
+		text = text[:sampleSize]
+	}
+
+	// Count the letters of each script
+	var latin, cyrillic, greek, arabic, hebrew, han, kana, hangul, thai, devanagari, letters int
+	ukrainian, persian := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian++
+			}
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+			if strings.ContainsRune("پچژگ", r) {
+				persian++
+			}
+		case unicode.Is(unicode.Hebrew, r):
+			hebrew++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Thai, r):
+			thai++
+		case unicode.Is(unicode.Devanagari, r):
+			devanagari++
+		}
+	}
+	if letters < 20 {
+		return ""
+	}
+	dominant := func(n int) bool { return n*2 > letters }
+
+	switch {
+	case dominant(kana + han):
+		if kana*10 > kana+han { // Japanese mixes kana into Han characters; Chinese has none
+			return "Japanese"
+		}
+		return "Chinese"
+	case dominant(hangul):
+		return "Korean"
+	case dominant(cyrillic):
+		if ukrainian*50 > cyrillic {
+			return "Ukrainian"
+		}
+		return "Russian"
+	case dominant(greek):
+		return "Greek"
+	case dominant(arabic):
+		if persian*50 > arabic {
+			return "Persian"
+		}
+		return "Arabic"
+	case dominant(hebrew):
+		return "Hebrew"
+	case dominant(thai):
+		return "Thai"
+	case dominant(devanagari):
+		return "Hindi"
+	case dominant(latin):
+		return detectLatin(text)
+	}
+	return ""
+}
+
+// detectLatin tells the language of a text in Latin script by the common words it uses
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	scores := map[string]int{}
+	for _, w := range words {
+		for lang, set := range stopWordSets {
+			if set[w] {
+				scores[lang]++
+			}
+		}
+	}
+
+	best, second := "", 0
+	for lang, score := range scores {
+		if best == "" || score > scores[best] || (score == scores[best] && lang < best) {
+			if best != "" {
+				second = scores[best]
+			}
+			best = lang
+		} else if score > second {
+			second = score
+		}
+	}
+	// Demand enough common words, and a clear lead over the runner-up
+	if best == "" || scores[best] < 3 || scores[best]*10 < len(words) || scores[best] < second*3/2 {
+		return ""
+	}
+	return best
+}
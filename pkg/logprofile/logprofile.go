@@ -0,0 +1,190 @@
+// Package logprofile pre-parses common log formats and compresses them before
+// they are sent to a model. Lines are parsed into entries, the variable parts
+// of each message (numbers, addresses, identifiers) are masked, and entries
+// sharing the same source, level and masked message are collapsed into a
+// single line with a count and the time range they were seen in.
+package logprofile
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats lists the supported log profiles
+var Formats = []string{"syslog", "json", "apache", "nginx", "journald"}
+
+// Entry is a single parsed log line
+type Entry struct {
+	Time    string
+	Source  string
+	Level   string
+	Message string
+}
+
+var (
+	syslog3164 = regexp.MustCompile(`^(?:<\d+>)?([A-Z][a-z]{2}\s+\d+\s\d\d:\d\d:\d\d)\s(\S+)\s([^:\[\s]+)(?:\[\d+\])?:\s?(.*)$`)
+	syslog5424 = regexp.MustCompile(`^<(\d+)>\d\s(\S+)\s(\S+)\s(\S+)\s\S+\s\S+\s(?:-|\[.*?\])\s?(.*)$`)
+	accessLog  = regexp.MustCompile(`^(\S+)\s\S+\s\S+\s\[([^\]]+)\]\s"(\S+)\s(\S+)[^"]*"\s(\d{3})\s(\S+)`)
+
+	maskUUID   = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	maskIP     = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`)
+	maskHex    = regexp.MustCompile(`\b(?:0x)?[0-9a-fA-F]*\d[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\b|\b(?:0x)?[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\d[0-9a-fA-F]*\b`)
+	maskNumber = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Parse parses a single line in the given format. Lines that do not match
+// the format are returned as an entry holding only the message.
+func Parse(format, line string) (Entry, error) {
+	switch format {
+	case "syslog":
+		if m := syslog3164.FindStringSubmatch(line); m != nil {
+			return Entry{Time: m[1], Source: m[3], Message: m[4]}, nil
+		}
+		if m := syslog5424.FindStringSubmatch(line); m != nil {
+			return Entry{Time: m[2], Source: m[4], Level: severity(m[1]), Message: m[5]}, nil
+		}
+
+	case "apache", "nginx":
+		if m := accessLog.FindStringSubmatch(line); m != nil {
+			path := m[4]
+			if i := strings.IndexByte(path, '?'); i >= 0 {
+				path = path[:i] + "?<query>"
+			}
+			return Entry{Time: m[2], Level: m[5], Message: m[3] + " " + path}, nil
+		}
+
+	case "json", "journald":
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err == nil {
+			return jsonEntry(format, fields), nil
+		}
+
+	default:
+		return Entry{}, fmt.Errorf("unknown log format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+
+	return Entry{Message: line}, nil
+}
+
+// jsonEntry maps well-known keys of JSON lines logs and `journalctl -o json`
+// output onto an entry; remaining fields are appended to the message
+func jsonEntry(format string, fields map[string]interface{}) Entry {
+	var e Entry
+	take := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := fields[k]; ok {
+				delete(fields, k)
+				return fmt.Sprint(v)
+			}
+		}
+		return ""
+	}
+
+	if format == "journald" {
+		if usec, err := strconv.ParseInt(take("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+			e.Time = time.UnixMicro(usec).UTC().Format(time.RFC3339)
+		}
+		e.Source = take("SYSLOG_IDENTIFIER", "_COMM", "_SYSTEMD_UNIT")
+		e.Level = severity(take("PRIORITY"))
+		e.Message = take("MESSAGE")
+		// journald adds many bookkeeping fields that are the same or useless for analysis
+		return e
+	}
+
+	e.Time = take("time", "timestamp", "ts", "@timestamp")
+	e.Level = strings.ToLower(take("level", "severity", "lvl"))
+	e.Source = take("logger", "component", "service", "caller")
+	e.Message = take("msg", "message", "event")
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.Message += fmt.Sprintf(" %s=%v", k, fields[k])
+	}
+	return e
+}
+
+func severity(s string) string {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return s
+	}
+	if n >= 8 {
+		// RFC 5424 PRI values combine facility and severity
+		n %= 8
+	}
+	if n >= 0 && n < len(syslogSeverities) {
+		return syslogSeverities[n]
+	}
+	return s
+}
+
+// Mask replaces the variable parts of a message with placeholders so that
+// repeated events with different ids, addresses or counts compare equal
+func Mask(message string) string {
+	message = maskUUID.ReplaceAllString(message, "<uuid>")
+	message = maskIP.ReplaceAllString(message, "<ip>")
+	message = maskHex.ReplaceAllString(message, "<hex>")
+	return maskNumber.ReplaceAllString(message, "<n>")
+}
+
+type group struct {
+	entry Entry
+	count int
+	first string
+	last  string
+}
+
+// Compress parses every line of input in the given format and returns a
+// compact table of distinct events in order of first appearance
+func Compress(format, input string) (string, error) {
+	var order []string
+	groups := map[string]*group{}
+	lines := 0
+
+	for _, line := range strings.Split(input, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines++
+
+		e, err := Parse(format, line)
+		if err != nil {
+			return "", err
+		}
+		e.Message = Mask(e.Message)
+
+		key := e.Source + "\x00" + e.Level + "\x00" + e.Message
+		g, ok := groups[key]
+		if !ok {
+			g = &group{entry: e, first: e.Time}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.count++
+		g.last = e.Time
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %d %s log lines compressed to %d distinct events\n", lines, format, len(order))
+	fmt.Fprintf(&b, "# count | first seen .. last seen | source | level | message (<n>, <ip>, <hex>, <uuid> are masked values)\n")
+	for _, key := range order {
+		g := groups[key]
+		seen := g.first
+		if g.last != g.first {
+			seen += " .. " + g.last
+		}
+		fmt.Fprintf(&b, "%dx | %s | %s | %s | %s\n", g.count, seen, g.entry.Source, g.entry.Level, g.entry.Message)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,74 @@
+package logprofile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		format string
+		line   string
+		want   Entry
+	}{
+		{"syslog", "Mar  4 10:15:02 web1 sshd[1234]: Accepted publickey for deploy",
+			Entry{Time: "Mar  4 10:15:02", Source: "sshd", Message: "Accepted publickey for deploy"}},
+		{"syslog", "<34>1 2024-03-04T10:15:02Z web1 su - ID47 - 'su root' failed",
+			Entry{Time: "2024-03-04T10:15:02Z", Source: "su", Level: "crit", Message: "'su root' failed"}},
+		{"nginx", `10.0.0.1 - - [04/Mar/2024:10:15:02 +0000] "GET /api/users?id=7 HTTP/1.1" 404 153`,
+			Entry{Time: "04/Mar/2024:10:15:02 +0000", Level: "404", Message: "GET /api/users?<query>"}},
+		{"json", `{"time": "t1", "level": "ERROR", "logger": "db", "msg": "timeout", "retry": 3, "host": "a"}`,
+			Entry{Time: "t1", Level: "error", Source: "db", Message: "timeout host=a retry=3"}},
+		{"journald", `{"__REALTIME_TIMESTAMP": "1709547302000000", "SYSLOG_IDENTIFIER": "kernel", "PRIORITY": "4", "MESSAGE": "oops", "_PID": "1"}`,
+			Entry{Time: "2024-03-04T10:15:02Z", Source: "kernel", Level: "warning", Message: "oops"}},
+		{"syslog", "not a syslog line", Entry{Message: "not a syslog line"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.format, tt.line)
+		if err != nil {
+			t.Errorf("Parse(%s, %q): %v", tt.format, tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%s, %q) = %+v, want %+v", tt.format, tt.line, got, tt.want)
+		}
+	}
+	if _, err := Parse("csv", "a,b"); err == nil {
+		t.Error("Parse accepted an unknown format")
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"request 550e8400-e29b-41d4-a716-446655440000 failed", "request <uuid> failed"},
+		{"connect to 10.1.2.3:5432 refused", "connect to <ip> refused"},
+		{"object deadbeef42 and 0x1f3a gone", "object <hex> and <hex> gone"},
+		{"took 12.5 ms after 3 retries", "took <n> ms after <n> retries"},
+		{"no variable parts", "no variable parts"},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.in); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	input := strings.Join([]string{
+		`{"ts": "t1", "level": "error", "msg": "timeout after 30 s"}`,
+		`{"ts": "t2", "level": "info", "msg": "started"}`,
+		``,
+		`{"ts": "t3", "level": "error", "msg": "timeout after 45 s"}`,
+	}, "\n")
+	got, err := Compress("json", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# 3 json log lines compressed to 2 distinct events\n" +
+		"# count | first seen .. last seen | source | level | message (<n>, <ip>, <hex>, <uuid> are masked values)\n" +
+		"2x | t1 .. t3 |  | error | timeout after <n> s\n" +
+		"1x | t2 |  | info | started\n"
+	if got != want {
+		t.Errorf("Compress =\n%s\nwant\n%s", got, want)
+	}
+}
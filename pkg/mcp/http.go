@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// httpTransport talks to a server over the Streamable HTTP transport: every
+// message is POSTed to the server's URL, which answers a request with a JSON
+// response or with a stream of server-sent events ending in the response
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	// session is the ID the server assigned in its reply to initialize, if any
+	session string
+	// protocol is the version agreed on in the handshake
+	protocol string
+}
+
+func (t *httpTransport) post(ctx context.Context, m *message) (*http.Response, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	t.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound && t.session != "" {
+			return nil, fmt.Errorf("the server ended the session")
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if session := resp.Header.Get("Mcp-Session-Id"); session != "" {
+		t.session = session
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	if t.session != "" {
+		req.Header.Set("Mcp-Session-Id", t.session)
+	}
+	if t.protocol != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocol)
+	}
+}
+
+func (t *httpTransport) call(ctx context.Context, request *message) (*message, error) {
+	resp, err := t.post(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		var m message
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			return nil, fmt.Errorf("invalid response: %v", err)
+		}
+		return &m, nil
+	}
+
+	// Events may carry the server's notifications and requests before the response
+	in := bufio.NewReader(resp.Body)
+	var data bytes.Buffer
+	for {
+		line, err := in.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		if (line == "" || err != nil) && data.Len() > 0 {
+			var m message
+			if json.Unmarshal(data.Bytes(), &m) == nil && m.Method == "" && bytes.Equal(m.ID, request.ID) {
+				return &m, nil
+			}
+			data.Reset()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the event stream ended without a response")
+		}
+	}
+}
+
+func (t *httpTransport) notify(ctx context.Context, notification *message) error {
+	resp, err := t.post(ctx, notification)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// close ends the session, if the server started one
+func (t *httpTransport) close() error {
+	if t.session == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
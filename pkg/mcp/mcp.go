@@ -0,0 +1,253 @@
+// Package mcp is a client of the Model Context Protocol, through which servers
+// offer tools to models. It talks JSON-RPC to a server started as a
+// subprocess over its stdin and stdout, or to a server at a URL over the
+// Streamable HTTP transport, lists the server's tools and calls them.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ProtocolVersion is the version of the protocol the client asks for
+const ProtocolVersion = "2025-03-26"
+
+// Server is how to reach an MCP server: either a command or a URL
+type Server struct {
+	// Command starts a server that talks over its stdin and stdout, e.g.
+	// ["npx", "-y", "@modelcontextprotocol/server-filesystem", "."]
+	Command []string
+	// Env holds NAME=value variables added to the environment of Command
+	Env []string
+	// Dir is the working directory of Command, the current one if empty
+	Dir string
+	// URL of a server using the Streamable HTTP transport
+	URL string
+	// Headers sent with every HTTP request, e.g. Authorization
+	Headers map[string]string
+}
+
+// Options are the settings of a connection that don't depend on the server
+type Options struct {
+	// ClientName and ClientVersion identify the client to the server
+	ClientName    string
+	ClientVersion string
+	// HTTPClient sends the requests to servers with a URL
+	HTTPClient *http.Client
+	// Stderr receives the log a command writes to its stderr, discarded if nil
+	Stderr io.Writer
+}
+
+// Tool is a tool offered by a server
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// ToolError is returned by CallTool when the tool reports that it failed,
+// with the text of its result
+type ToolError struct {
+	Tool    string
+	Message string
+}
+
+func (e *ToolError) Error() string {
+	return e.Message
+}
+
+// Error is an error response of a server
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// message is a JSON-RPC request, notification or response
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// transport carries messages to a server and back
+type transport interface {
+	// call sends a request and returns the response with its ID
+	call(ctx context.Context, request *message) (*message, error)
+	// notify sends a notification, which has no response
+	notify(ctx context.Context, notification *message) error
+	close() error
+}
+
+// Client is a connection to a server. Its methods may be called concurrently,
+// but requests are sent one at a time.
+type Client struct {
+	mu        sync.Mutex
+	transport transport
+	nextID    int
+	// Name and version the server reported
+	ServerName    string
+	ServerVersion string
+}
+
+// Connect starts or connects to a server and goes through the initialization
+// handshake
+func Connect(ctx context.Context, server Server, opts Options) (*Client, error) {
+	var t transport
+	switch {
+	case len(server.Command) > 0 && server.URL != "":
+		return nil, fmt.Errorf("a server has either a command or a URL, not both")
+	case len(server.Command) > 0:
+		stdio, err := startCommand(server, opts.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		t = stdio
+	case server.URL != "":
+		httpClient := opts.HTTPClient
+		if httpClient == nil {
+			httpClient = http.DefaultClient
+		}
+		t = &httpTransport{url: server.URL, headers: server.Headers, client: httpClient}
+	default:
+		return nil, fmt.Errorf("a server needs a command or a URL")
+	}
+
+	c := &Client{transport: t}
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err := c.request(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": opts.ClientName, "version": opts.ClientVersion},
+	}, &result)
+	if err == nil {
+		if h, ok := t.(*httpTransport); ok {
+			h.protocol = result.ProtocolVersion
+		}
+		err = t.notify(ctx, &message{JSONRPC: "2.0", Method: "notifications/initialized"})
+	}
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("initializing: %w", err)
+	}
+	c.ServerName, c.ServerVersion = result.ServerInfo.Name, result.ServerInfo.Version
+	return c, nil
+}
+
+// Close ends the connection, stopping the server if the client started it
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+// request sends a request and decodes its result into result
+func (c *Client) request(ctx context.Context, method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	response, err := c.transport.call(ctx, &message{JSONRPC: "2.0", ID: json.RawMessage(fmt.Sprint(c.nextID)), Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("%s: invalid result: %v", method, err)
+	}
+	return nil
+}
+
+// Tools lists the tools the server offers
+func (c *Client) Tools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.request(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// content is an item of a tool's result
+type content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	MimeType string `json:"mimeType"`
+	URI      string `json:"uri"`
+	Resource *struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"resource"`
+}
+
+// CallTool calls a tool with arguments given as a JSON object and returns its
+// result as text. Images, audio and binary resources in the result are
+// replaced by a placeholder naming their type.
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (string, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result struct {
+		Content           []content       `json:"content"`
+		StructuredContent json.RawMessage `json:"structuredContent"`
+		IsError           bool            `json:"isError"`
+	}
+	err := c.request(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": arguments}, &result)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, item := range result.Content {
+		switch {
+		case item.Type == "text":
+			parts = append(parts, item.Text)
+		case item.Type == "resource" && item.Resource != nil && item.Resource.Text != "":
+			parts = append(parts, item.Resource.Text)
+		case item.Type == "resource" && item.Resource != nil:
+			parts = append(parts, fmt.Sprintf("[resource %s]", item.Resource.URI))
+		case item.Type == "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource %s]", item.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s %s]", item.Type, item.MimeType))
+		}
+	}
+	if len(parts) == 0 && len(result.StructuredContent) > 0 {
+		parts = append(parts, string(result.StructuredContent))
+	}
+	text := strings.Join(parts, "\n")
+	if result.IsError {
+		return "", &ToolError{Tool: name, Message: text}
+	}
+	return text, nil
+}
@@ -0,0 +1,126 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// How long a server may take to exit once its stdin is closed
+const exitTimeout = 2 * time.Second
+
+// stdioTransport talks to a server started as a subprocess, one JSON message
+// per line on its stdin and stdout
+type stdioTransport struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	messages chan *message
+}
+
+// startCommand starts the command of a server
+func startCommand(server Server, stderr io.Writer) (*stdioTransport, error) {
+	cmd := exec.Command(server.Command[0], server.Command[1:]...)
+	cmd.Dir = server.Dir
+	cmd.Env = append(os.Environ(), server.Env...)
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	t := &stdioTransport{cmd: cmd, stdin: stdin, messages: make(chan *message)}
+	go t.read(stdout)
+	return t, nil
+}
+
+// read passes the messages the server writes on, until its stdout is closed
+func (t *stdioTransport) read(stdout io.Reader) {
+	defer close(t.messages)
+	in := bufio.NewReader(stdout)
+	for {
+		line, err := in.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var m message
+			if json.Unmarshal(line, &m) == nil {
+				t.messages <- &m
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *stdioTransport) send(m *message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, request *message) (*message, error) {
+	if err := t.send(request); err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case m, ok := <-t.messages:
+			if !ok {
+				return nil, fmt.Errorf("the server exited")
+			}
+			switch {
+			case m.Method != "" && len(m.ID) > 0:
+				// A request of the server's own; ping is the only one a client must answer
+				reply := &message{JSONRPC: "2.0", ID: m.ID, Result: json.RawMessage("{}")}
+				if m.Method != "ping" {
+					reply = &message{JSONRPC: "2.0", ID: m.ID, Error: &Error{Code: -32601, Message: "method not found"}}
+				}
+				if err := t.send(reply); err != nil {
+					return nil, err
+				}
+			case m.Method == "" && bytes.Equal(m.ID, request.ID):
+				return m, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, notification *message) error {
+	return t.send(notification)
+}
+
+// close closes the server's stdin, which asks it to exit, and kills it if it doesn't
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	exited := make(chan struct{})
+	go func() {
+		for range t.messages {
+		}
+		t.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(exitTimeout):
+		t.cmd.Process.Kill()
+		<-exited
+	}
+	return nil
+}
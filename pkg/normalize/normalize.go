@@ -0,0 +1,260 @@
+// Package normalize rewrites locale-specific dates and numbers found in the
+// string values of a JSON document into canonical forms, so that values
+// extracted from documents written in any locale compare and parse alike.
+package normalize
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options selects the normalizations, as parsed from a spec such as
+// "dates=iso8601,numbers=decimal-point,locale=de"
+type Options struct {
+	// Dates is "iso8601" to rewrite dates as YYYY-MM-DD
+	Dates string
+	// Numbers is "decimal-point" to rewrite numbers without grouping and with a decimal point
+	Numbers string
+	// Locale of the source, e.g. en-US or de, resolves ambiguous values such as 03/04/2024 or 1.500
+	Locale string
+}
+
+// ParseOptions parses a comma separated list of key=value settings
+func ParseOptions(spec string) (Options, error) {
+	var o Options
+	for _, setting := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(setting), "=")
+		switch {
+		case key == "dates" && value == "iso8601":
+			o.Dates = value
+		case key == "numbers" && value == "decimal-point":
+			o.Numbers = value
+		case key == "locale" && value != "":
+			o.Locale = value
+		case key == "dates" || key == "numbers":
+			return o, fmt.Errorf("unsupported normalization %s=%s, supported are dates=iso8601 and numbers=decimal-point", key, value)
+		default:
+			return o, fmt.Errorf("unknown normalization setting %q, expected dates, numbers or locale", setting)
+		}
+	}
+	return o, nil
+}
+
+// JSON returns doc with every string value normalized. Keys, the order of
+// object members and values other than strings are kept as they are.
+func JSON(doc []byte, o Options) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	var out bytes.Buffer
+	if err := o.copyValue(decoder, &out); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+	return out.Bytes(), nil
+}
+
+func (o Options) copyValue(decoder *json.Decoder, out *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		out.WriteRune(rune(t))
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				writeJSON(out, key)
+				out.WriteByte(':')
+			}
+			if err := o.copyValue(decoder, out); err != nil {
+				return err
+			}
+		}
+		end, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		out.WriteRune(rune(end.(json.Delim)))
+	case string:
+		writeJSON(out, o.String(t))
+	default:
+		writeJSON(out, t)
+	}
+	return nil
+}
+
+func writeJSON(out *bytes.Buffer, v interface{}) {
+	data, _ := json.Marshal(v)
+	out.Write(data)
+}
+
+// String normalizes a single value. Values that are not entirely a date or
+// a number are returned unchanged.
+func (o Options) String(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if o.Dates != "" {
+		if date, ok := o.date(trimmed); ok {
+			return date.Format("2006-01-02")
+		}
+	}
+	if o.Numbers != "" {
+		if number, ok := o.number(trimmed); ok {
+			return number
+		}
+	}
+	return s
+}
+
+var (
+	yearFirst    = regexp.MustCompile(`^(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})$`)
+	numericDate  = regexp.MustCompile(`^(\d{1,2})([-/.])(\d{1,2})[-/.](\d{4}|\d{2})$`)
+	dayMonthName = regexp.MustCompile(`^(\d{1,2})\.?\s+(\p{L}+)\.?,?\s+(\d{4})$`)
+	monthNameDay = regexp.MustCompile(`^(\p{L}+)\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})$`)
+)
+
+// Month names and abbreviations in English, German, French, Spanish, Italian and Dutch
+var monthNames = map[string]time.Month{}
+
+func init() {
+	names := [][]string{
+		{"january", "jan", "januar", "jänner", "janvier", "janv", "enero", "ene", "gennaio", "gen", "januari"},
+		{"february", "feb", "februar", "février", "févr", "fevrier", "febrero", "febbraio", "februari"},
+		{"march", "mar", "märz", "mär", "maerz", "mars", "marzo", "maart", "mrt"},
+		{"april", "apr", "avril", "avr", "abril", "abr", "aprile"},
+		{"may", "mai", "mayo", "may", "maggio", "mag", "mei"},
+		{"june", "jun", "juni", "juin", "junio", "giugno", "giu"},
+		{"july", "jul", "juli", "juillet", "juil", "julio", "luglio", "lug"},
+		{"august", "aug", "août", "aout", "agosto", "ago", "augustus"},
+		{"september", "sep", "sept", "septembre", "septiembre", "settembre", "set"},
+		{"october", "oct", "oktober", "okt", "octobre", "octubre", "ottobre", "ott"},
+		{"november", "nov", "novembre", "noviembre"},
+		{"december", "dec", "dezember", "dez", "décembre", "déc", "diciembre", "dic", "dicembre"},
+	}
+	for i, month := range names {
+		for _, name := range month {
+			monthNames[name] = time.Month(i + 1)
+		}
+	}
+}
+
+// monthFirst reports whether numeric dates in the locale put the month before the day
+func (o Options) monthFirst() bool {
+	locale := strings.ToLower(strings.ReplaceAll(o.Locale, "_", "-"))
+	return locale == "en-us" || locale == "us" || locale == "en-ph"
+}
+
+func (o Options) date(s string) (time.Time, bool) {
+	var year, month, day int
+	atoi := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	if m := yearFirst.FindStringSubmatch(s); m != nil {
+		year, month, day = atoi(m[1]), atoi(m[2]), atoi(m[3])
+	} else if m := numericDate.FindStringSubmatch(s); m != nil {
+		first, second := atoi(m[1]), atoi(m[3])
+		year = atoi(m[4])
+		if len(m[4]) == 2 {
+			year += 2000
+			if year >= 2070 {
+				year -= 100
+			}
+		}
+		// Dotted dates are always day first; otherwise the locale decides unless one part is over 12
+		dayFirst := m[2] == "." || !o.monthFirst()
+		if first > 12 {
+			dayFirst = true
+		} else if second > 12 {
+			dayFirst = false
+		}
+		if dayFirst {
+			day, month = first, second
+		} else {
+			month, day = first, second
+		}
+	} else if m := dayMonthName.FindStringSubmatch(s); m != nil {
+		day, year = atoi(m[1]), atoi(m[3])
+		month = int(monthNames[strings.ToLower(m[2])])
+	} else if m := monthNameDay.FindStringSubmatch(s); m != nil {
+		day, year = atoi(m[2]), atoi(m[3])
+		month = int(monthNames[strings.ToLower(m[1])])
+	} else {
+		return time.Time{}, false
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if month < 1 || date.Day() != day || int(date.Month()) != month {
+		return time.Time{}, false // e.g. 31 February, which time.Date would roll over
+	}
+	return date, true
+}
+
+var groupedNumber = regexp.MustCompile(`^[+-]?\d{1,3}(?:[ .,'\x{00a0}\x{202f}]\d{3})*(?:[.,]\d+)?$|^[+-]?\d+(?:[.,]\d+)?$`)
+
+// Locales that write a decimal comma
+var decimalCommaLocales = []string{"de", "fr", "es", "it", "nl", "pt", "ru", "pl", "sv", "da", "nb", "fi", "cs", "tr"}
+
+func (o Options) decimalComma() bool {
+	language := strings.ToLower(o.Locale)
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	for _, l := range decimalCommaLocales {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) number(s string) (string, bool) {
+	if !groupedNumber.MatchString(s) {
+		return "", false
+	}
+
+	// The last '.' or ',' is the decimal separator unless it groups thousands
+	decimal := strings.LastIndexAny(s, ".,")
+	if decimal >= 0 {
+		separator := s[decimal]
+		digitsAfter := len(s) - decimal - 1
+		switch {
+		case strings.Count(s, string(separator)) > 1:
+			decimal = -1 // Repeated separators group thousands
+		case strings.ContainsAny(s[:decimal], ".,"):
+			// Both separators occur, the last one is the decimal separator
+		case digitsAfter == 3:
+			// Ambiguous, like 1.500 or 1,500: decided by the locale
+			if (separator == ',') != o.decimalComma() {
+				decimal = -1
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case i == decimal:
+			b.WriteByte('.')
+		case r == '+' || r == '-' || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), true
+}
@@ -0,0 +1,69 @@
+package normalize
+
+import "testing"
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		locale string
+		in     string
+		want   string
+	}{
+		{"", "2024-03-04", "2024-03-04"},
+		{"", "2024/3/4", "2024-03-04"},
+		{"de", "04.03.2024", "2024-03-04"},
+		{"en-US", "03/04/2024", "2024-03-04"},
+		{"en-GB", "03/04/2024", "2024-04-03"},
+		{"en-US", "25/12/2024", "2024-12-25"},
+		{"en-US", "04.03.24", "2024-03-04"},
+		{"", "4 März 2024", "2024-03-04"},
+		{"", "March 4th, 2024", "2024-03-04"},
+		{"", "1er janvier 2024", "1er janvier 2024"},
+		{"", "31.02.2024", "31.02.2024"},
+		{"", "1.234.567,89", "1234567.89"},
+		{"", "1,234,567.89", "1234567.89"},
+		{"de", "1.500", "1500"},
+		{"en", "1.500", "1.500"},
+		{"en", "1,500", "1500"},
+		{"fr", "1 500,5", "1500.5"},
+		{"de", "-12,5", "-12.5"},
+		{"", "12 apples", "12 apples"},
+		{"", "v1.2.3.4", "v1.2.3.4"},
+	}
+	for _, tt := range tests {
+		o := Options{Dates: "iso8601", Numbers: "decimal-point", Locale: tt.locale}
+		if got := o.String(tt.in); got != tt.want {
+			t.Errorf("String(%q) with locale %q = %q, want %q", tt.in, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	o, err := ParseOptions("dates=iso8601,numbers=decimal-point,locale=de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := `{"b": "24.12.2024", "a": ["1.234,5", 7, true, null, {"c": "text"}]}`
+	got, err := JSON([]byte(in), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Member order and non-string values are kept
+	if want := `{"b":"2024-12-24","a":["1234.5",7,true,null,{"c":"text"}]}`; string(got) != want {
+		t.Errorf("JSON = %s, want %s", got, want)
+	}
+	if _, err := JSON([]byte(`{} {}`), o); err == nil {
+		t.Error("JSON accepted data after the document")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	for _, spec := range []string{"dates=us", "numbers=comma", "colour=red", "locale="} {
+		if _, err := ParseOptions(spec); err == nil {
+			t.Errorf("ParseOptions(%q) succeeded", spec)
+		}
+	}
+	o, err := ParseOptions(" dates=iso8601 , locale=fr ")
+	if err != nil || o.Dates != "iso8601" || o.Locale != "fr" || o.Numbers != "" {
+		t.Errorf("ParseOptions = %+v, %v", o, err)
+	}
+}
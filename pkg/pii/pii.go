@@ -0,0 +1,149 @@
+// Package pii masks personal information in text before it is sent to a
+// cloud provider. Every distinct value is replaced by a numbered placeholder
+// such as [EMAIL_1], and the mapping is kept so that placeholders in the
+// model's answer can be turned back into the original values locally.
+package pii
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Policies lists the supported redaction policies. "basic" masks emails and
+// phone numbers; "strict" additionally masks street addresses and names.
+// Detection is pattern based: names are only found after a title such as
+// "Dr." or a label such as "Name:", so a bare "John Smith" is sent as it is.
+var Policies = []string{"basic", "strict"}
+
+type detector struct {
+	kind    string
+	pattern *regexp.Regexp
+	group   int
+}
+
+var (
+	email   = detector{"EMAIL", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), 0}
+	phone   = detector{"PHONE", regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)[\s.-]?|\b\d{2,4}[\s.-])\d{3,4}[\s.-]\d{3,4}\b`), 0}
+	address = detector{"ADDRESS", regexp.MustCompile(`\b\d{1,5}\s+(?:[A-Z][a-z]+\s+){1,3}(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Lane|Ln|Drive|Dr|Court|Ct|Place|Pl|Way|Terrace|Square|Sq)\b\.?`), 0}
+	// Without a local NER model, names are only detected when introduced by a
+	// title or a label such as "Name:"
+	name = detector{"NAME", regexp.MustCompile(`(?:\b(?:Mr|Mrs|Ms|Miss|Dr|Prof)\.?\s+|(?i:\bname:\s*))((?:[A-Z][a-z]+(?:[\s-][A-Z][a-z]+){0,2}))`), 1}
+)
+
+var policies = map[string][]detector{
+	"basic":  {email, phone},
+	"strict": {email, address, phone, name},
+}
+
+// Placeholders as Redact writes them
+var placeholderPattern = regexp.MustCompile(`\[[A-Z]+_\d+\]`)
+
+// Redactor masks and restores personal information for one policy. It is
+// safe for concurrent use.
+type Redactor struct {
+	mu        sync.Mutex
+	detectors []detector
+	// Mapping holds the original value for every placeholder
+	Mapping map[string]string
+	values  map[string]string
+	counts  map[string]int
+}
+
+// New returns a Redactor for the named policy
+func New(policy string) (*Redactor, error) {
+	detectors, ok := policies[policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown PII policy %q, expected one of %s", policy, strings.Join(Policies, ", "))
+	}
+	return &Redactor{
+		detectors: detectors,
+		Mapping:   map[string]string{},
+		values:    map[string]string{},
+		counts:    map[string]int{},
+	}, nil
+}
+
+// Redact replaces personal information in text with placeholders. The same
+// value always maps to the same placeholder.
+func (r *Redactor) Redact(text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.detectors {
+		text = replaceGroup(d.pattern, text, d.group, func(value string) string {
+			return r.placeholder(d.kind, value)
+		})
+	}
+	return text
+}
+
+// Restore replaces placeholders in text with the original values. Only whole
+// placeholders of the mapping are replaced; those the model made up are left
+// as they are.
+func (r *Redactor) Restore(text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return placeholderPattern.ReplaceAllStringFunc(text, func(p string) string {
+		if value, ok := r.Mapping[p]; ok {
+			return value
+		}
+		return p
+	})
+}
+
+// Save writes the placeholder mapping to a JSON file readable only by the user
+func (r *Redactor) Save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := json.MarshalIndent(r.Mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Load returns a Redactor that can restore text using a saved mapping file
+func Load(path string) (*Redactor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Redactor{Mapping: map[string]string{}}
+	if err := json.Unmarshal(data, &r.Mapping); err != nil {
+		return nil, fmt.Errorf("invalid PII mapping file %s: %v", path, err)
+	}
+	return r, nil
+}
+
+func (r *Redactor) placeholder(kind, value string) string {
+	key := kind + "\x00" + value
+	if p, ok := r.values[key]; ok {
+		return p
+	}
+	r.counts[kind]++
+	p := fmt.Sprintf("[%s_%d]", kind, r.counts[kind])
+	r.values[key] = p
+	r.Mapping[p] = value
+	return p
+}
+
+// replaceGroup is like Regexp.ReplaceAllStringFunc but only replaces the
+// given capture group of each match
+func replaceGroup(re *regexp.Regexp, text string, group int, repl func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(repl(text[start:end]))
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
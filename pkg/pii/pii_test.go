@@ -0,0 +1,94 @@
+package pii
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactRestoreRoundTrip(t *testing.T) {
+	tests := []struct {
+		policy string
+		text   string
+		// Values that must not be in the redacted text
+		masked []string
+	}{
+		{"basic", "Mail jane.doe@example.com or call +1 555-123-4567.", []string{"jane.doe@example.com", "555-123-4567"}},
+		{"basic", "a@b.io wrote to a@b.io and c@d.org", []string{"a@b.io", "c@d.org"}},
+		{"strict", "Dr. Jane Doe lives at 221 Baker Street.", []string{"Jane Doe", "221 Baker Street"}},
+		{"strict", "name: Ada Lovelace\nemail: ada@example.org", []string{"Ada Lovelace", "ada@example.org"}},
+		{"strict", "Nothing personal here.", nil},
+	}
+	for _, tt := range tests {
+		r, err := New(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		redacted := r.Redact(tt.text)
+		for _, value := range tt.masked {
+			if strings.Contains(redacted, value) {
+				t.Errorf("%s: Redact(%q) = %q, still holds %q", tt.policy, tt.text, redacted, value)
+			}
+		}
+		if restored := r.Restore(redacted); restored != tt.text {
+			t.Errorf("%s: Restore(Redact(%q)) = %q", tt.policy, tt.text, restored)
+		}
+	}
+}
+
+func TestRedactSameValueSamePlaceholder(t *testing.T) {
+	r, _ := New("basic")
+	if got := r.Redact("x@y.com, x@y.com, z@y.com"); got != "[EMAIL_1], [EMAIL_1], [EMAIL_2]" {
+		t.Errorf("Redact = %q", got)
+	}
+	// Placeholders carry over between calls
+	if got := r.Redact("z@y.com"); got != "[EMAIL_2]" {
+		t.Errorf("second Redact = %q", got)
+	}
+}
+
+// Names are only found after a title or a label, as the policy documents
+func TestRedactBareNameNotDetected(t *testing.T) {
+	r, _ := New("strict")
+	if got := r.Redact("John Smith called."); got != "John Smith called." {
+		t.Errorf("Redact = %q, want the bare name left as it is", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	r := &Redactor{Mapping: map[string]string{"[NAME_1]": "Ann", "[NAME_10]": "Bob"}}
+	tests := []struct{ in, want string }{
+		{"[NAME_1] and [NAME_10]", "Ann and Bob"},
+		{"[NAME_1][NAME_10]", "AnnBob"},
+		// Placeholders the model made up are left alone
+		{"[NAME_2] and [EMAIL_1]", "[NAME_2] and [EMAIL_1]"},
+		{"[NAME_1", "[NAME_1"},
+	}
+	for _, tt := range tests {
+		if got := r.Restore(tt.in); got != tt.want {
+			t.Errorf("Restore(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	r, _ := New("basic")
+	redacted := r.Redact("write to someone@example.com")
+	path := filepath.Join(t.TempDir(), "map.json")
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Restore(redacted); got != "write to someone@example.com" {
+		t.Errorf("Restore after Load = %q", got)
+	}
+}
+
+func TestNewUnknownPolicy(t *testing.T) {
+	if _, err := New("paranoid"); err == nil {
+		t.Error("New(paranoid) succeeded")
+	}
+}
@@ -0,0 +1,262 @@
+// Package bedrock calls models hosted on Amazon Bedrock (Anthropic Claude,
+// Meta Llama, Amazon Titan and others) through the Bedrock runtime Converse
+// API, which accepts the same request shape for every model family.
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client sends signed requests to the Bedrock runtime in one region. It keeps no state between requests
+// and is safe for concurrent use, as long as its fields are not changed while requests are being sent.
+type Client struct {
+	Region      string
+	Credentials Credentials
+	HTTP        *http.Client
+	// UserAgent identifies the calling application, if set
+	UserAgent string
+}
+
+// NewClient returns a Client for the Bedrock runtime in region
+func NewClient(region string, creds Credentials, httpClient *http.Client) *Client {
+	return &Client{Region: region, Credentials: creds, HTTP: httpClient}
+}
+
+// Request is a single-turn request to a Bedrock model
+type Request struct {
+	Model       string
+	System      string
+	Input       string
+	Temperature float64
+	MaxTokens   int
+	// TopP, TopK and Stop are left to the model's defaults when zero
+	TopP float64
+	// TopK is passed to the model as top_k, which Anthropic models accept
+	TopK   int
+	Stop   []string
+	Images []Image
+	// History holds the turns that followed Input, alternating between the model and the user
+	History []Turn
+}
+
+// Turn is a turn of a conversation after the first user input
+type Turn struct {
+	// Role is "assistant" or "user"
+	Role string
+	Text string
+}
+
+// Image is an image attached to a request
+type Image struct {
+	// Format is one of png, jpeg, gif or webp
+	Format string
+	Data   []byte
+}
+
+type contentBlock struct {
+	Text  string      `json:"text,omitempty"`
+	Image *imageBlock `json:"image,omitempty"`
+}
+
+type imageBlock struct {
+	Format string `json:"format"`
+	Source struct {
+		Bytes []byte `json:"bytes"`
+	} `json:"source"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type converseRequest struct {
+	Messages        []message      `json:"messages"`
+	System          []contentBlock `json:"system,omitempty"`
+	InferenceConfig struct {
+		Temperature   float64  `json:"temperature"`
+		MaxTokens     int      `json:"maxTokens,omitempty"`
+		TopP          float64  `json:"topP,omitempty"`
+		StopSequences []string `json:"stopSequences,omitempty"`
+	} `json:"inferenceConfig"`
+	// AdditionalModelRequestFields holds parameters specific to a model family
+	AdditionalModelRequestFields map[string]interface{} `json:"additionalModelRequestFields,omitempty"`
+}
+
+type converseResponse struct {
+	Output struct {
+		Message message `json:"message"`
+	} `json:"output"`
+	StopReason string `json:"stopReason"`
+	Usage      struct {
+		InputTokens  int `json:"inputTokens"`
+		OutputTokens int `json:"outputTokens"`
+	} `json:"usage"`
+	Message string `json:"message"` // Set on errors
+}
+
+// Response is the model's reply
+type Response struct {
+	Text       string
+	StopReason string
+	// Tokens billed for the request
+	InputTokens  int
+	OutputTokens int
+	// Raw is the response as the API sent it
+	Raw json.RawMessage
+}
+
+// Endpoint returns the Bedrock runtime URL for the client's region
+func (c *Client) Endpoint() string {
+	return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", c.Region)
+}
+
+// Model is a foundation model available in the client's region
+type Model struct {
+	ID       string
+	Provider string
+	// Vision tells whether the model accepts images
+	Vision    bool
+	Streaming bool
+}
+
+// Models returns the foundation models that answer text in the client's region, from the Bedrock
+// ListFoundationModels API
+func (c *Client) Models() ([]Model, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://bedrock.%s.amazonaws.com/foundation-models?byOutputModality=TEXT", c.Region), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	sign(req, nil, c.Credentials, c.Region, "bedrock", time.Now())
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		ModelSummaries []struct {
+			ModelID                    string   `json:"modelId"`
+			ProviderName               string   `json:"providerName"`
+			InputModalities            []string `json:"inputModalities"`
+			ResponseStreamingSupported bool     `json:"responseStreamingSupported"`
+		} `json:"modelSummaries"`
+		Message string `json:"message"` // Set on errors
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("bedrock: %s", resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		if response.Message != "" {
+			return nil, fmt.Errorf("bedrock: %s (%d)", response.Message, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("bedrock: %s", resp.Status)
+	}
+
+	var models []Model
+	for _, s := range response.ModelSummaries {
+		m := Model{ID: s.ModelID, Provider: s.ProviderName, Streaming: s.ResponseStreamingSupported}
+		for _, modality := range s.InputModalities {
+			m.Vision = m.Vision || modality == "IMAGE"
+		}
+		models = append(models, m)
+	}
+	return models, nil
+}
+
+// Converse sends the request and returns the model's reply
+func (c *Client) Converse(r Request) (*Response, error) {
+	return c.ConverseContext(context.Background(), r)
+}
+
+// ConverseContext is Converse with a context that can cancel the request
+func (c *Client) ConverseContext(ctx context.Context, r Request) (*Response, error) {
+	var payload converseRequest
+	content := []contentBlock{{Text: r.Input}}
+	for _, img := range r.Images {
+		block := &imageBlock{Format: img.Format}
+		block.Source.Bytes = img.Data // Marshalled as base64
+		content = append(content, contentBlock{Image: block})
+	}
+	payload.Messages = []message{{Role: "user", Content: content}}
+	for _, turn := range r.History {
+		payload.Messages = append(payload.Messages, message{Role: turn.Role, Content: []contentBlock{{Text: turn.Text}}})
+	}
+	if r.System != "" {
+		payload.System = []contentBlock{{Text: r.System}}
+	}
+	payload.InferenceConfig.Temperature = r.Temperature
+	payload.InferenceConfig.MaxTokens = r.MaxTokens
+	payload.InferenceConfig.TopP = r.TopP
+	payload.InferenceConfig.StopSequences = r.Stop
+	if r.TopK > 0 {
+		payload.AdditionalModelRequestFields = map[string]interface{}{"top_k": r.TopK}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := c.Endpoint() + "/model/" + url.PathEscape(r.Model) + "/converse"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	sign(req, body, c.Credentials, c.Region, "bedrock", time.Now())
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response converseResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("bedrock: %s", resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		if response.Message != "" {
+			return nil, fmt.Errorf("bedrock: %s (%d)", response.Message, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("bedrock: %s", resp.Status)
+	}
+
+	var text []string
+	for _, block := range response.Output.Message.Content {
+		text = append(text, block.Text)
+	}
+	reply := strings.TrimSpace(strings.Join(text, ""))
+	if reply == "" {
+		return nil, fmt.Errorf("bedrock: no text in the model response (stop reason %q)", response.StopReason)
+	}
+	return &Response{Text: reply, StopReason: response.StopReason, InputTokens: response.Usage.InputTokens, OutputTokens: response.Usage.OutputTokens,
+		Raw: data}, nil
+}
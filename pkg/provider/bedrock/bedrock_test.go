@@ -0,0 +1,68 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// redirect sends every request to a test server instead of the Bedrock endpoint
+type redirect struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = r.target.Scheme, r.target.Host
+	return r.next.RoundTrip(req)
+}
+
+// A Client is shared by concurrent requests, as in --concurrency and sgpt serve; run with -race
+func TestClientConcurrentUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, `{"message": "unsigned"}`, http.StatusForbidden)
+			return
+		}
+		var req converseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"output": {"message": {"content": [{"text": %q}]}}, "stopReason": "end_turn",
+			"usage": {"inputTokens": 1, "outputTokens": 1}}`, req.Messages[0].Content[0].Text)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	c := NewClient("us-east-1", Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		&http.Client{Transport: redirect{target: target, next: server.Client().Transport}})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := fmt.Sprintf("request number %d", i)
+			response, err := c.ConverseContext(context.Background(), Request{Model: "anthropic.claude-3-haiku-20240307-v1:0", Input: input})
+			if err == nil && response.Text != input {
+				err = fmt.Errorf("got %q for %q", response.Text, input)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package bedrock
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Credentials, region, service and time of the AWS Signature Version 4 test suite
+var (
+	suiteCredentials = Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	suiteTime        = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSignTestSuite(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		body      string
+		signature string
+	}{
+		{"get-vanilla", "GET", "https://example.amazonaws.com/", "",
+			"5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"post-vanilla", "POST", "https://example.amazonaws.com/", "",
+			"5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{"get-vanilla-query-order-key-case", "GET", "https://example.amazonaws.com/?Param2=value2&Param1=value1", "",
+			"b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"post-vanilla-query", "POST", "https://example.amazonaws.com/?Param1=value1", "",
+			"28038455d6de14eafc1f9222cf5aa6f1a96197d7deb8263271d420d138af7f11"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sign(req, []byte(tt.body), suiteCredentials, "us-east-1", "service", suiteTime)
+
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+			"SignedHeaders=host;x-amz-date, Signature=" + tt.signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("%s: Authorization = %q, want %q", tt.name, got, want)
+		}
+		if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+			t.Errorf("%s: X-Amz-Date = %q", tt.name, got)
+		}
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://bedrock-runtime.us-east-1.amazonaws.com/model/m/converse", nil)
+	creds := suiteCredentials
+	creds.SessionToken = "token"
+	sign(req, nil, creds, "us-east-1", "bedrock", suiteTime)
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "token" {
+		t.Errorf("X-Amz-Security-Token = %q", got)
+	}
+	// The token is signed along with the other headers
+	if auth := req.Header.Get("Authorization"); !strings.Contains(auth, "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
+
+// The signing key example of the AWS documentation
+func TestSigningKey(t *testing.T) {
+	key := hmacSHA256([]byte("AWS4wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"), "20120215")
+	key = hmacSHA256(key, "us-east-1")
+	key = hmacSHA256(key, "iam")
+	key = hmacSHA256(key, "aws4_request")
+	if got, want := hex.EncodeToString(key), "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"; got != want {
+		t.Errorf("signing key = %s, want %s", got, want)
+	}
+}
+
+func TestCanonicalURI(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"", "/"},
+		{"/", "/"},
+		{"/model/anthropic.claude-3-haiku-20240307-v1:0/converse", "/model/anthropic.claude-3-haiku-20240307-v1%3A0/converse"},
+		// Escaped paths are encoded a second time
+		{"/model/a%3Ab/converse", "/model/a%253Ab/converse"},
+	}
+	for _, tt := range tests {
+		if got := canonicalURI(tt.path); got != tt.want {
+			t.Errorf("canonicalURI(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// Package groq configures the OpenAI-compatible client for the Groq API.
+package groq
+
+import (
+	"net/http"
+	"sgpt/pkg/provider/openaicompat"
+)
+
+// DefaultBaseURL is the Groq OpenAI-compatible API endpoint
+const DefaultBaseURL = "https://api.groq.com/openai/v1"
+
+// NewClient returns a client for the public Groq API
+func NewClient(apiKey string, httpClient *http.Client) *openaicompat.Client {
+	return openaicompat.NewClient("groq", DefaultBaseURL, apiKey, httpClient)
+}
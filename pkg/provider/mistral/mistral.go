@@ -0,0 +1,18 @@
+// Package mistral configures the OpenAI-compatible client for the Mistral AI
+// chat completions API.
+package mistral
+
+import (
+	"net/http"
+	"sgpt/pkg/provider/openaicompat"
+)
+
+// DefaultBaseURL is the Mistral AI API endpoint
+const DefaultBaseURL = "https://api.mistral.ai/v1"
+
+// NewClient returns a client for the public Mistral AI API
+func NewClient(apiKey string, httpClient *http.Client) *openaicompat.Client {
+	client := openaicompat.NewClient("mistral", DefaultBaseURL, apiKey, httpClient)
+	client.RandomSeed = true
+	return client
+}
@@ -0,0 +1,713 @@
+// Package openaicompat is a client for chat completions APIs that follow
+// the OpenAI request and response format, as offered by Mistral AI,
+// OpenRouter, Groq and many self-hosted servers.
+package openaicompat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client sends chat requests to one OpenAI-compatible API. It keeps no state between requests and is
+// safe for concurrent use, as long as its fields are not changed while requests are being sent.
+type Client struct {
+	// Name identifies the provider in error messages
+	Name    string
+	APIKey  string
+	BaseURL string
+	HTTP    *http.Client
+	// Headers are added to every request, e.g. provider specific attribution headers
+	Headers map[string]string
+	// UserAgent identifies the calling application, if set
+	UserAgent string
+	// RandomSeed sends the seed as random_seed, as the API of Mistral AI expects, rather than seed
+	RandomSeed bool
+}
+
+// NewClient returns a Client for the API at baseURL, e.g. https://api.mistral.ai/v1
+func NewClient(name, baseURL, apiKey string, httpClient *http.Client) *Client {
+	return &Client{Name: name, APIKey: apiKey, BaseURL: baseURL, HTTP: httpClient, Headers: map[string]string{}}
+}
+
+// Request is a single-turn chat request
+type Request struct {
+	Model       string
+	System      string
+	Input       string
+	Temperature float64
+	MaxTokens   int
+	Sampling
+	// Tools the model may call instead of replying with text
+	Tools []Tool
+	// JSONSchema, if set, asks for a reply that is a JSON document matching this schema
+	JSONSchema json.RawMessage
+	// N asks for this many alternative replies, where the API supports it
+	N int
+	// ServiceTier selects the processing tier where the API offers several, e.g. flex or priority with OpenAI
+	ServiceTier string
+	// History holds the turns that followed Input, e.g. the model's tool calls and their results
+	History []Message
+}
+
+// Sampling holds the optional sampling parameters of a request. Zero values leave the API's defaults.
+type Sampling struct {
+	TopP float64
+	// TopK is accepted by OpenRouter but not by every API
+	TopK             int
+	FrequencyPenalty float64
+	PresencePenalty  float64
+	// Stop sequences end the reply where the model writes them
+	Stop []string
+	// Seed asks for the same reply to the same request, as far as the API can guarantee it
+	Seed int64 `json:",omitempty"`
+}
+
+// Message is a turn of a conversation after the first user input
+type Message struct {
+	// Role is "assistant", "tool" or "user"
+	Role    string
+	Content string
+	// ToolCalls are the calls made in an assistant message
+	ToolCalls []ToolCall
+	// ToolCallID is the call a tool message answers
+	ToolCallID string
+}
+
+// Tool is a function the model may call
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON schema of the function's arguments
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a call of one of the request's tools by the model
+type ToolCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Response is the model's reply
+type Response struct {
+	Text string
+	// Model is the model that actually served the request, which routers may choose
+	Model        string
+	FinishReason string
+	// ServiceTier is the processing tier that served the request, if the API reports it
+	ServiceTier string
+	// SystemFingerprint identifies the backend configuration that served the request, if the API
+	// reports it. Replies to the same request and seed can differ when it changes.
+	SystemFingerprint string
+	ToolCalls         []ToolCall
+	// Alternatives holds the text of every reply when more than one was requested, starting with Text
+	Alternatives []string
+	// Usage is the number of tokens billed, zero if the API didn't report it
+	Usage Usage
+	// Raw is the response as the API sent it; for a streamed response, a JSON array of the data of its events
+	Raw json.RawMessage
+}
+
+// Usage is the token usage reported for a request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []WireToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+// WireTool is a tool as it is sent in OpenAI-format requests
+type WireTool struct {
+	Type     string `json:"type"`
+	Function Tool   `json:"function"`
+}
+
+// WireToolCall is a tool call as it appears in OpenAI-format responses
+type WireToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatRequest struct {
+	Model            string        `json:"model"`
+	Messages         []chatMessage `json:"messages"`
+	Temperature      float64       `json:"temperature"`
+	MaxTokens        int           `json:"max_tokens,omitempty"`
+	TopP             float64       `json:"top_p,omitempty"`
+	TopK             int           `json:"top_k,omitempty"`
+	FrequencyPenalty float64       `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64       `json:"presence_penalty,omitempty"`
+	Stop             []string      `json:"stop,omitempty"`
+	Seed             int64         `json:"seed,omitempty"`
+	// RandomSeed is the seed as Mistral AI names it
+	RandomSeed int64      `json:"random_seed,omitempty"`
+	Tools      []WireTool `json:"tools,omitempty"`
+	// ResponseFormat is the response_format of structured output requests
+	ResponseFormat interface{} `json:"response_format,omitempty"`
+	N              int         `json:"n,omitempty"`
+	ServiceTier    string      `json:"service_tier,omitempty"`
+	Stream         bool        `json:"stream,omitempty"`
+}
+
+type chatResponse struct {
+	Model             string `json:"model"`
+	ServiceTier       string `json:"service_tier"`
+	SystemFingerprint string `json:"system_fingerprint"`
+	Usage             Usage  `json:"usage"`
+	Choices           []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// apiError holds the error fields of a response. Providers report errors in different shapes.
+type apiError struct {
+	Error   json.RawMessage `json:"error"`
+	Message string          `json:"message"`
+	Detail  interface{}     `json:"detail"`
+}
+
+// errorMessage extracts a readable message from any of the error shapes
+func (r *apiError) errorMessage() string {
+	if len(r.Error) > 0 && string(r.Error) != "null" {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(r.Error, &e) == nil && e.Message != "" {
+			return e.Message
+		}
+		var s string
+		if json.Unmarshal(r.Error, &s) == nil {
+			return s
+		}
+	}
+	if r.Message != "" {
+		return r.Message
+	}
+	if r.Detail != nil {
+		return fmt.Sprint(r.Detail)
+	}
+	return ""
+}
+
+// chatPayload converts a request to the wire format
+func (c *Client) chatPayload(r Request) chatRequest {
+	payload := chatRequest{Model: r.Model, Temperature: r.Temperature, MaxTokens: r.MaxTokens, TopP: r.TopP, TopK: r.TopK,
+		FrequencyPenalty: r.FrequencyPenalty, PresencePenalty: r.PresencePenalty, Stop: r.Stop, ServiceTier: r.ServiceTier}
+	if r.N > 1 {
+		payload.N = r.N
+	}
+	if c.RandomSeed {
+		payload.RandomSeed = r.Seed
+	} else {
+		payload.Seed = r.Seed
+	}
+	if r.System != "" {
+		payload.Messages = append(payload.Messages, chatMessage{Role: "system", Content: r.System})
+	}
+	payload.Messages = append(payload.Messages, chatMessage{Role: "user", Content: r.Input})
+	for _, m := range r.History {
+		payload.Messages = append(payload.Messages, chatMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCalls:  wireToolCalls(m.ToolCalls),
+			ToolCallID: m.ToolCallID,
+		})
+	}
+	payload.Tools = WireTools(r.Tools)
+	if len(r.JSONSchema) > 0 {
+		payload.ResponseFormat = ResponseFormat(r.JSONSchema)
+	}
+	return payload
+}
+
+// Complete sends the request and returns the model's reply
+func (c *Client) Complete(r Request) (*Response, error) {
+	return c.CompleteContext(context.Background(), r)
+}
+
+// CompleteContext is Complete with a context that can cancel the request
+func (c *Client) CompleteContext(ctx context.Context, r Request) (*Response, error) {
+	data, err := c.post(ctx, c.Endpoint(), c.chatPayload(r))
+	if err != nil {
+		return nil, err
+	}
+
+	var response chatResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("%s: %v", c.Name, err)
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("%s: no choices returned from the API", c.Name)
+	}
+	choice := response.Choices[0]
+	text := strings.TrimSpace(choice.Message.Content)
+	calls := ToolCalls(choice.Message.ToolCalls)
+	if text == "" && len(calls) == 0 {
+		return nil, fmt.Errorf("%s: empty reply (finish reason %q)", c.Name, choice.FinishReason)
+	}
+
+	reply := &Response{Text: text, Model: response.Model, FinishReason: choice.FinishReason, ServiceTier: response.ServiceTier,
+		SystemFingerprint: response.SystemFingerprint, ToolCalls: calls, Usage: response.Usage, Raw: data}
+	if r.N > 1 {
+		for _, c := range response.Choices {
+			if text := strings.TrimSpace(c.Message.Content); text != "" {
+				reply.Alternatives = append(reply.Alternatives, text)
+			}
+		}
+	}
+	return reply, nil
+}
+
+// Stream sends the request with streaming enabled and calls onText with each piece of the reply as it
+// arrives. Tool calls and alternative replies are not streamed. When ctx ends before the reply is
+// complete, the text received so far is returned together with the context's error.
+func (c *Client) Stream(ctx context.Context, r Request, onText func(string)) (*Response, error) {
+	payload := c.chatPayload(r)
+	payload.Stream = true
+	payload.N = 0
+
+	resp, err := c.send(ctx, c.Endpoint(), payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, c.statusError(resp)
+	}
+
+	response, err := ReadStream(resp.Body, onText)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return response, fmt.Errorf("%s: %w", c.Name, err)
+	}
+	return response, nil
+}
+
+// Largest stream event kept while waiting for the rest of a JSON object split over several events
+const maxPendingEvent = 1 << 20
+
+// streamChunk is the data of one event of a streamed chat completion
+type streamChunk struct {
+	Model             string `json:"model"`
+	ServiceTier       string `json:"service_tier"`
+	SystemFingerprint string `json:"system_fingerprint"`
+	Choices           []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"` // In the last event, if the API reports usage when streaming
+	apiError
+}
+
+// ReadStream reads the server-sent events of a streamed chat completion, calling onText with the
+// text of each delta, and returns the reply. Events are assembled from all their data lines, and
+// JSON objects that a server or proxy split over several lines or events are joined back together
+// before they are parsed, so no text is lost. When the stream breaks off, the reply received so far
+// is returned with the error; a stream that ends without [DONE] is incomplete, even after a finish
+// reason, and returns io.ErrUnexpectedEOF. A missing finish reason is left empty.
+func ReadStream(body io.Reader, onText func(string)) (*Response, error) {
+	var text strings.Builder
+	response := &Response{}
+	var data []string // Data lines of the event being read
+	pending := ""     // Data of earlier events that is not a complete JSON object on its own
+	done := false
+	var events []json.RawMessage
+	defer func() { response.Raw = rawEvents(events) }()
+
+	// Function to handle the event read so far
+	var dispatch func() error
+	dispatch = func() error {
+		if len(data) == 0 {
+			return nil
+		}
+		if len(data) > 1 && pending == "" && separateEvents(data) {
+			// Events whose blank line separators were lost
+			lines := data
+			for _, line := range lines {
+				data = []string{line}
+				if err := dispatch(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if strings.TrimSpace(strings.Join(data, "\n")) == "[DONE]" {
+			data, done = data[:0], true
+			if pending != "" {
+				return fmt.Errorf("malformed stream event: %.100s", pending)
+			}
+			return nil
+		}
+		payload := pending + strings.Join(data, "\n")
+		joined := pending + strings.Join(data, "") // In case lines were split inside a string
+		data = data[:0]
+
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			if json.Unmarshal([]byte(joined), &chunk) != nil {
+				if len(joined) > maxPendingEvent {
+					return fmt.Errorf("malformed stream event: %v", err)
+				}
+				pending = joined // Wait for the rest of the object
+				return nil
+			}
+			payload = joined
+		}
+		pending = ""
+		events = append(events, json.RawMessage(payload))
+
+		if msg := chunk.errorMessage(); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		if chunk.Model != "" {
+			response.Model = chunk.Model
+		}
+		if chunk.ServiceTier != "" {
+			response.ServiceTier = chunk.ServiceTier
+		}
+		if chunk.SystemFingerprint != "" {
+			response.SystemFingerprint = chunk.SystemFingerprint
+		}
+		if chunk.Usage != nil {
+			response.Usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				text.WriteString(choice.Delta.Content)
+				if onText != nil {
+					onText(choice.Delta.Content)
+				}
+			}
+			if choice.FinishReason != "" {
+				response.FinishReason = choice.FinishReason
+			}
+		}
+		return nil
+	}
+
+	reader := bufio.NewReader(body)
+	for !done {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		var eventErr error
+		switch {
+		case line == "":
+			if err == nil {
+				eventErr = dispatch() // A blank line ends the event
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case strings.HasPrefix(line, ":"), strings.HasPrefix(line, "event:"), strings.HasPrefix(line, "id:"), strings.HasPrefix(line, "retry:"):
+			// Comments, e.g. keep-alives, and fields that don't carry the reply
+		default:
+			if len(data) > 0 || pending != "" {
+				data = append(data, line) // The rest of a data line broken by a stray newline
+			}
+		}
+		if err == io.EOF && eventErr == nil {
+			eventErr = dispatch() // The last event may not be followed by a blank line
+			if eventErr == nil && pending != "" {
+				eventErr = fmt.Errorf("malformed stream event: %.100s", pending)
+			}
+			if eventErr == nil && !done {
+				err = io.ErrUnexpectedEOF // The connection closed before the reply was complete
+			}
+		}
+		if eventErr != nil {
+			err = eventErr
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			response.Text = text.String()
+			return response, err
+		}
+	}
+
+	response.Text = strings.TrimSpace(text.String())
+	if response.Text == "" {
+		return response, fmt.Errorf("empty reply (finish reason %q)", response.FinishReason)
+	}
+	return response, nil
+}
+
+// rawEvents returns the data of stream events as a JSON array
+func rawEvents(events []json.RawMessage) json.RawMessage {
+	raw, err := json.Marshal(events)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// Function to tell whether each data line of an event is a complete event of its own
+func separateEvents(lines []string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "[DONE]" && !json.Valid([]byte(line)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Embed returns the embedding vectors of texts, in the same order, computed by model
+func (c *Client) Embed(model string, texts []string) ([][]float64, error) {
+	data, err := c.post(context.Background(), c.apiURL("/embeddings"), map[string]interface{}{"model": model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("%s: %v", c.Name, err)
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("%s: %d embeddings returned for %d texts", c.Name, len(response.Data), len(texts))
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, d := range response.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("%s: embedding index %d out of range", c.Name, d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// Model is a model offered by the API
+type Model struct {
+	ID      string
+	OwnedBy string
+	// ContextWindow is the model's context window in tokens, zero if the API doesn't report it
+	ContextWindow int
+	// Vision tells whether the model accepts images, as far as the API reports it
+	Vision bool
+}
+
+// modelEntry holds the fields of an entry of the model list. Besides the OpenAI fields, it has those
+// with which Mistral AI, Groq and OpenRouter report context windows and image input.
+type modelEntry struct {
+	ID               string `json:"id"`
+	OwnedBy          string `json:"owned_by"`
+	ContextLength    int    `json:"context_length"`     // OpenRouter
+	ContextWindow    int    `json:"context_window"`     // Groq
+	MaxContextLength int    `json:"max_context_length"` // Mistral AI
+	Capabilities     struct {
+		Vision bool `json:"vision"`
+	} `json:"capabilities"`
+	Architecture struct {
+		InputModalities []string `json:"input_modalities"`
+	} `json:"architecture"`
+}
+
+// ErrNotModified is returned by ModelsIfChanged when the model list hasn't changed
+var ErrNotModified = errors.New("not modified")
+
+// Models returns the models the API offers, from GET /models
+func (c *Client) Models() ([]Model, error) {
+	models, _, err := c.ModelsIfChanged("")
+	return models, err
+}
+
+// ModelsIfChanged returns the models the API offers and the ETag of the list. If etag is not empty it
+// is sent as If-None-Match, and ErrNotModified is returned when the list still has that ETag.
+func (c *Client) ModelsIfChanged(etag string) ([]Model, string, error) {
+	req, err := http.NewRequest("GET", c.apiURL("/models"), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	c.setHeaders(req)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, ErrNotModified
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := c.checkError(resp, data); err != nil {
+		return nil, "", err
+	}
+	var response struct {
+		Data []modelEntry `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", c.Name, err)
+	}
+
+	var models []Model
+	for _, e := range response.Data {
+		m := Model{ID: e.ID, OwnedBy: e.OwnedBy, Vision: e.Capabilities.Vision}
+		for _, n := range []int{e.ContextLength, e.ContextWindow, e.MaxContextLength} {
+			if n > 0 {
+				m.ContextWindow = n
+			}
+		}
+		for _, modality := range e.Architecture.InputModalities {
+			m.Vision = m.Vision || modality == "image"
+		}
+		models = append(models, m)
+	}
+	return models, resp.Header.Get("ETag"), nil
+}
+
+// post sends payload as JSON to url and returns the response body, or the API's error
+func (c *Client) post(ctx context.Context, url string, payload interface{}) ([]byte, error) {
+	resp, err := c.send(ctx, url, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return data, c.checkError(resp, data)
+}
+
+// send posts payload as JSON to url
+func (c *Client) send(ctx context.Context, url string, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req)
+	return c.HTTP.Do(req)
+}
+
+// setHeaders adds the headers every request carries: authorization, user agent and the client's own
+func (c *Client) setHeaders(req *http.Request) {
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// statusError reads the body of a failed response and returns the API's error
+func (c *Client) statusError(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %s", c.Name, resp.Status)
+	}
+	return c.checkError(resp, data)
+}
+
+// checkError returns the error reported in a response body, if any
+func (c *Client) checkError(resp *http.Response, data []byte) error {
+	var apiErr apiError
+	if err := json.Unmarshal(data, &apiErr); err != nil {
+		return fmt.Errorf("%s: %s", c.Name, resp.Status)
+	}
+	if msg := apiErr.errorMessage(); resp.StatusCode >= 300 || msg != "" {
+		if msg != "" {
+			return fmt.Errorf("%s: %s (%d)", c.Name, msg, resp.StatusCode)
+		}
+		return fmt.Errorf("%s: %s", c.Name, resp.Status)
+	}
+	return nil
+}
+
+// ResponseFormat returns the response_format asking for a reply matching schema
+func ResponseFormat(schema json.RawMessage) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   "response",
+			"schema": schema,
+		},
+	}
+}
+
+// WireTools converts tools to the OpenAI request format
+func WireTools(tools []Tool) []WireTool {
+	var wire []WireTool
+	for _, tool := range tools {
+		wire = append(wire, WireTool{Type: "function", Function: tool})
+	}
+	return wire
+}
+
+// ToolCalls converts tool calls in the wire format, where the arguments are a JSON
+// document encoded as a string, to ToolCall values carrying the arguments as JSON
+func ToolCalls(wire []WireToolCall) []ToolCall {
+	var calls []ToolCall
+	for _, w := range wire {
+		args := json.RawMessage(w.Function.Arguments)
+		if !json.Valid(args) {
+			args, _ = json.Marshal(w.Function.Arguments) // Keep malformed arguments as a string
+		}
+		calls = append(calls, ToolCall{ID: w.ID, Name: w.Function.Name, Arguments: args})
+	}
+	return calls
+}
+
+// wireToolCalls converts tool calls back to the wire format, for sending them as history
+func wireToolCalls(calls []ToolCall) []WireToolCall {
+	var wire []WireToolCall
+	for _, call := range calls {
+		w := WireToolCall{ID: call.ID, Type: "function"}
+		w.Function.Name = call.Name
+		w.Function.Arguments = string(call.Arguments)
+		wire = append(wire, w)
+	}
+	return wire
+}
+
+// Endpoint returns the chat completions URL
+func (c *Client) Endpoint() string {
+	return c.apiURL("/chat/completions")
+}
+
+// apiURL returns the URL of an API path such as /embeddings
+func (c *Client) apiURL(path string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + path
+}
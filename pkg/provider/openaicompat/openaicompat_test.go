@@ -0,0 +1,163 @@
+package openaicompat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Function to start a server that replies to each chat request with the content of its last
+// message, streamed word by word when asked to stream
+func echoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		text := req.Messages[len(req.Messages)-1].Content
+		if !req.Stream {
+			fmt.Fprintf(w, `{"model": %q, "choices": [{"message": {"role": "assistant", "content": %q}, "finish_reason": "stop"}],
+				"usage": {"prompt_tokens": 1, "completion_tokens": 1}}`, req.Model, text)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range strings.SplitAfter(text, " ") {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", word)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {}, \"finish_reason\": \"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// A Client is shared by concurrent requests, as in --concurrency and sgpt serve; run with -race
+func TestClientConcurrentUse(t *testing.T) {
+	server := echoServer(t)
+	c := NewClient("test", server.URL, "key", server.Client())
+	c.Headers["X-Test"] = "1"
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := fmt.Sprintf("request number %d", i)
+			request := Request{Model: "m", System: "echo", Input: input, Sampling: Sampling{Stop: []string{"###"}}}
+			if i%2 == 0 {
+				response, err := c.CompleteContext(context.Background(), request)
+				if err == nil && response.Text != input {
+					err = fmt.Errorf("Complete got %q for %q", response.Text, input)
+				}
+				errs <- err
+				return
+			}
+			var streamed strings.Builder
+			response, err := c.Stream(context.Background(), request, func(text string) { streamed.WriteString(text) })
+			if err == nil && (response.Text != input || streamed.String() != input) {
+				err = fmt.Errorf("Stream got %q and %q for %q", response.Text, streamed.String(), input)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// Function to return a reader that returns at most n bytes per read, as a slow connection does
+func chunkedReader(s string, n int) io.Reader {
+	return &chunked{s: s, n: n}
+}
+
+type chunked struct {
+	s string
+	n int
+}
+
+func (c *chunked) Read(p []byte) (int, error) {
+	if c.s == "" {
+		return 0, io.EOF
+	}
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+	n := copy(p, c.s)
+	c.s = c.s[n:]
+	return n, nil
+}
+
+func TestReadStream(t *testing.T) {
+	const (
+		hello  = "data: {\"model\": \"m\", \"choices\": [{\"delta\": {\"content\": \"Hello\"}}]}\n\n"
+		world  = "data: {\"choices\": [{\"delta\": {\"content\": \" world\"}}]}\n\n"
+		finish = "data: {\"choices\": [{\"delta\": {}, \"finish_reason\": \"stop\"}], \"usage\": {\"prompt_tokens\": 3, \"completion_tokens\": 2}}\n\n"
+		done   = "data: [DONE]\n\n"
+	)
+	tests := []struct {
+		name   string
+		stream string
+		chunk  int // Bytes per read, 0 for all at once
+		text   string
+		finish string
+		err    error
+	}{
+		{name: "complete", stream: hello + world + finish + done, text: "Hello world", finish: "stop"},
+		{name: "one byte per read", stream: hello + world + finish + done, chunk: 1, text: "Hello world", finish: "stop"},
+		{name: "data line split across reads", stream: hello + world + finish + done, chunk: 7, text: "Hello world", finish: "stop"},
+		{name: "CRLF and keep-alives", stream: strings.ReplaceAll(": ping\n\n"+hello+"event: chunk\n"+world+finish+done, "\n", "\r\n"),
+			text: "Hello world", finish: "stop"},
+		{name: "multi-line event", stream: "data: {\"choices\": [{\"delta\":\ndata: {\"content\": \"Hello\"}}]}\n\n" + finish + done,
+			text: "Hello", finish: "stop"},
+		{name: "object split over events", stream: "data: {\"choices\": [{\"delta\": {\"con\n\ndata: tent\": \"Hello\"}}]}\n\n" + finish + done,
+			text: "Hello", finish: "stop"},
+		{name: "lost blank lines", stream: strings.ReplaceAll(hello+world+finish+done, "\n\n", "\n"), text: "Hello world", finish: "stop"},
+		{name: "missing [DONE]", stream: hello + world + finish, text: "Hello world", finish: "stop", err: io.ErrUnexpectedEOF},
+		{name: "broken off", stream: hello + world, text: "Hello world", err: io.ErrUnexpectedEOF},
+		{name: "missing finish_reason", stream: hello + world + done, text: "Hello world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.stream)
+			if tt.chunk > 0 {
+				body = chunkedReader(tt.stream, tt.chunk)
+			}
+			var streamed strings.Builder
+			response, err := ReadStream(body, func(text string) { streamed.WriteString(text) })
+			if !errors.Is(err, tt.err) || (err != nil && tt.err == nil) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if response.Text != tt.text || streamed.String() != tt.text {
+				t.Errorf("text = %q, streamed %q, want %q", response.Text, streamed.String(), tt.text)
+			}
+			if response.FinishReason != tt.finish {
+				t.Errorf("finish reason = %q, want %q", response.FinishReason, tt.finish)
+			}
+		})
+	}
+}
+
+func TestReadStreamErrors(t *testing.T) {
+	for name, stream := range map[string]string{
+		"error event":    "data: {\"error\": {\"message\": \"overloaded\"}}\n\n",
+		"malformed JSON": "data: {\"choices\": [\n\ndata: [DONE]\n\n",
+		"empty reply":    "data: {\"choices\": [{\"delta\": {}, \"finish_reason\": \"length\"}]}\n\ndata: [DONE]\n\n",
+	} {
+		if _, err := ReadStream(strings.NewReader(stream), nil); err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: err = %v, want a stream error", name, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Package openrouter configures the OpenAI-compatible client for OpenRouter,
+// which routes requests to many upstream model providers with one API key.
+package openrouter
+
+import (
+	"net/http"
+	"sgpt/pkg/provider/openaicompat"
+)
+
+// DefaultBaseURL is the OpenRouter API endpoint
+const DefaultBaseURL = "https://openrouter.ai/api/v1"
+
+// NewClient returns a client for OpenRouter. OpenRouter attributes requests
+// to an application using the HTTP-Referer and X-Title headers.
+func NewClient(apiKey, referer, title string, httpClient *http.Client) *openaicompat.Client {
+	client := openaicompat.NewClient("openrouter", DefaultBaseURL, apiKey, httpClient)
+	if referer != "" {
+		client.Headers["HTTP-Referer"] = referer
+	}
+	if title != "" {
+		client.Headers["X-Title"] = title
+	}
+	return client
+}
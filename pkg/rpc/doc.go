@@ -0,0 +1,5 @@
+// Package rpc holds the protocol buffer messages and gRPC service of
+// `sgpt grpc`, generated from sgpt.proto. Clients dial the server with
+// NewSgptClient and send a Request to Complete for the whole reply, or to
+// Stream for the reply as it is written, one StreamChunk at a time.
+package rpc
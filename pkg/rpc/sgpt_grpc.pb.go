@@ -0,0 +1,192 @@
+// The gRPC interface of `sgpt grpc`, which answers requests through the
+// providers configured for sgpt. Regenerate the Go code after a change with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative sgpt.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: sgpt.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Sgpt_Complete_FullMethodName = "/sgpt.v1.Sgpt/Complete"
+	Sgpt_Stream_FullMethodName   = "/sgpt.v1.Sgpt/Stream"
+)
+
+// SgptClient is the client API for Sgpt service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Sgpt answers conversations with a model
+type SgptClient interface {
+	// Complete returns the whole reply at once
+	Complete(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	// Stream returns the reply as it is written, ending with a chunk that holds
+	// the finish reason and the usage
+	Stream(ctx context.Context, in *Request, opts ...grpc.CallOption) (Sgpt_StreamClient, error)
+}
+
+type sgptClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSgptClient(cc grpc.ClientConnInterface) SgptClient {
+	return &sgptClient{cc}
+}
+
+func (c *sgptClient) Complete(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Sgpt_Complete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sgptClient) Stream(ctx context.Context, in *Request, opts ...grpc.CallOption) (Sgpt_StreamClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Sgpt_ServiceDesc.Streams[0], Sgpt_Stream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sgptStreamClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Sgpt_StreamClient interface {
+	Recv() (*StreamChunk, error)
+	grpc.ClientStream
+}
+
+type sgptStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *sgptStreamClient) Recv() (*StreamChunk, error) {
+	m := new(StreamChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SgptServer is the server API for Sgpt service.
+// All implementations must embed UnimplementedSgptServer
+// for forward compatibility
+//
+// Sgpt answers conversations with a model
+type SgptServer interface {
+	// Complete returns the whole reply at once
+	Complete(context.Context, *Request) (*Response, error)
+	// Stream returns the reply as it is written, ending with a chunk that holds
+	// the finish reason and the usage
+	Stream(*Request, Sgpt_StreamServer) error
+	mustEmbedUnimplementedSgptServer()
+}
+
+// UnimplementedSgptServer must be embedded to have forward compatible implementations.
+type UnimplementedSgptServer struct {
+}
+
+func (UnimplementedSgptServer) Complete(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Complete not implemented")
+}
+func (UnimplementedSgptServer) Stream(*Request, Sgpt_StreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedSgptServer) mustEmbedUnimplementedSgptServer() {}
+
+// UnsafeSgptServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SgptServer will
+// result in compilation errors.
+type UnsafeSgptServer interface {
+	mustEmbedUnimplementedSgptServer()
+}
+
+func RegisterSgptServer(s grpc.ServiceRegistrar, srv SgptServer) {
+	s.RegisterService(&Sgpt_ServiceDesc, srv)
+}
+
+func _Sgpt_Complete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SgptServer).Complete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sgpt_Complete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SgptServer).Complete(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sgpt_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Request)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SgptServer).Stream(m, &sgptStreamServer{ServerStream: stream})
+}
+
+type Sgpt_StreamServer interface {
+	Send(*StreamChunk) error
+	grpc.ServerStream
+}
+
+type sgptStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *sgptStreamServer) Send(m *StreamChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Sgpt_ServiceDesc is the grpc.ServiceDesc for Sgpt service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Sgpt_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sgpt.v1.Sgpt",
+	HandlerType: (*SgptServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Complete",
+			Handler:    _Sgpt_Complete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _Sgpt_Stream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sgpt.proto",
+}
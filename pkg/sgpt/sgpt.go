@@ -0,0 +1,386 @@
+// Package sgpt is the library behind the sgpt command, for Go programs that
+// want to ask a model without running the binary. A Client sends requests to
+// OpenAI, Mistral AI, Groq, OpenRouter, Amazon Bedrock or any server with an
+// OpenAI-compatible API, and is configured with functional options:
+//
+//	client, err := sgpt.New(sgpt.WithModel("gpt-4o"), sgpt.WithAPIKey(os.Getenv("OPENAI_API_KEY")))
+//	if err != nil {
+//		return err
+//	}
+//	reply, err := client.Complete(ctx, "Explain Go interfaces in one paragraph")
+//
+// A Client is safe for concurrent use.
+package sgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sgpt/pkg/httpclient"
+	"sgpt/pkg/provider/bedrock"
+	"sgpt/pkg/provider/groq"
+	"sgpt/pkg/provider/mistral"
+	"sgpt/pkg/provider/openaicompat"
+	"sgpt/pkg/provider/openrouter"
+	"strconv"
+	"strings"
+)
+
+// Providers lists the providers a Client can send requests to
+var Providers = []string{"openai", "mistral", "groq", "openrouter", "bedrock"}
+
+// OpenAIBaseURL is the OpenAI API endpoint
+const OpenAIBaseURL = "https://api.openai.com/v1"
+
+// Model name prefixes used to infer the provider when it is not given explicitly
+var providerPrefixes = []struct{ prefix, provider string }{
+	{"gpt-", "openai"},
+	{"text-", "openai"},
+	{"whisper-", "openai"},
+	{"mistral-", "mistral"},
+	{"open-mistral-", "mistral"},
+	{"codestral-", "mistral"},
+	{"anthropic.", "bedrock"},
+	{"meta.", "bedrock"},
+	{"amazon.", "bedrock"},
+	{"cohere.", "bedrock"},
+}
+
+// InferProvider returns the provider serving a model from the prefix of its
+// name, defaulting to OpenAI
+func InferProvider(model string) string {
+	for _, p := range providerPrefixes {
+		if strings.HasPrefix(model, p.prefix) {
+			return p.provider
+		}
+	}
+	return "openai"
+}
+
+// Message is a turn of a conversation
+type Message struct {
+	// Role is "user" or "assistant"
+	Role    string
+	Content string
+}
+
+// Response is the model's reply
+type Response struct {
+	Text string
+	// Model is the model that served the request as the provider reports it,
+	// which routers may choose
+	Model string
+	// FinishReason tells why the reply ended, e.g. stop or length
+	FinishReason string
+	// SystemFingerprint identifies the backend configuration that served the
+	// request, if the provider reports it
+	SystemFingerprint string
+	// Tokens billed for the request, zero if the provider didn't report them
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Client sends requests to one model
+type Client struct {
+	provider    string
+	model       string
+	apiKey      string
+	baseURL     string
+	region      string
+	system      string
+	temperature float64
+	maxTokens   int
+	sampling    openaicompat.Sampling
+	http        *http.Client
+	httpOptions httpclient.Options
+	userAgent   string
+	credentials *bedrock.Credentials
+
+	chat    *openaicompat.Client
+	bedrock *bedrock.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithProvider selects the provider, which is otherwise inferred from the
+// model name
+func WithProvider(provider string) Option {
+	return func(c *Client) { c.provider = provider }
+}
+
+// WithModel selects the model, also given as provider/model such as
+// mistral/mistral-small-latest
+func WithModel(model string) Option {
+	return func(c *Client) { c.model = model }
+}
+
+// WithAPIKey sets the provider's API key. Bedrock uses AWS credentials
+// instead, see WithAWSCredentials.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithBaseURL sends requests to an OpenAI-compatible server such as
+// http://localhost:11434/v1 instead of the provider's public API
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) { c.baseURL = baseURL }
+}
+
+// WithRegion selects a regional endpoint: eu for OpenAI, or the AWS region
+// of Bedrock, which needs one
+func WithRegion(region string) Option {
+	return func(c *Client) { c.region = region }
+}
+
+// WithAWSCredentials sets the credentials Bedrock requests are signed with.
+// By default they are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+func WithAWSCredentials(creds bedrock.Credentials) Option {
+	return func(c *Client) { c.credentials = &creds }
+}
+
+// WithSystem sets the instruction sent with every request
+func WithSystem(instruction string) Option {
+	return func(c *Client) { c.system = instruction }
+}
+
+// WithTemperature sets the sampling temperature, 0.5 by default
+func WithTemperature(temperature float64) Option {
+	return func(c *Client) { c.temperature = temperature }
+}
+
+// WithMaxTokens limits the length of replies
+func WithMaxTokens(n int) Option {
+	return func(c *Client) { c.maxTokens = n }
+}
+
+// WithSampling sets the optional sampling parameters, such as top_p, stop
+// sequences and the seed
+func WithSampling(sampling openaicompat.Sampling) Option {
+	return func(c *Client) { c.sampling = sampling }
+}
+
+// WithHTTPClient sets the HTTP client requests are sent with, instead of one
+// built from the HTTP options
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.http = httpClient }
+}
+
+// WithHTTPOptions sets the timeouts, proxy and offline restriction of the
+// HTTP client, as the command's --timeout, --connectTimeout, --idleTimeout,
+// --proxy and --offline do. By default the command's defaults apply, and
+// SGPT_OFFLINE=true restricts requests to this machine as it does for the
+// command.
+func WithHTTPOptions(opts httpclient.Options) Option {
+	return func(c *Client) { c.httpOptions = opts }
+}
+
+// WithUserAgent sets the User-Agent header of requests
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// ErrNoModel is returned by New when no model is given
+var ErrNoModel = errors.New("sgpt: no model given")
+
+// New returns a Client configured with the options. A model is required; the
+// provider is taken from a provider/model name or inferred from the model.
+func New(opts ...Option) (*Client, error) {
+	c := &Client{temperature: 0.5, httpOptions: httpclient.DefaultOptions(), userAgent: "sgpt-go"}
+	c.httpOptions.Offline, _ = strconv.ParseBool(os.Getenv("SGPT_OFFLINE"))
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.model == "" {
+		return nil, ErrNoModel
+	}
+	if c.http == nil {
+		httpClient, err := httpclient.New(c.httpOptions)
+		if err != nil {
+			return nil, fmt.Errorf("sgpt: %w", err)
+		}
+		c.http = httpClient
+	}
+	if i := strings.Index(c.model, "/"); i > 0 && (c.provider == "" || c.provider == c.model[:i]) {
+		c.provider, c.model = c.model[:i], c.model[i+1:]
+	}
+	if c.provider == "" {
+		c.provider = InferProvider(c.model)
+	}
+
+	switch c.provider {
+	case "openai":
+		baseURL := OpenAIBaseURL
+		if c.region == "eu" {
+			baseURL = "https://eu.api.openai.com/v1"
+		} else if c.region != "" && c.region != "us" {
+			return nil, fmt.Errorf("sgpt: OpenAI has no region %q, only us and eu", c.region)
+		}
+		c.chat = openaicompat.NewClient("openai", baseURL, c.apiKey, c.http)
+	case "mistral":
+		c.chat = mistral.NewClient(c.apiKey, c.http)
+	case "groq":
+		c.chat = groq.NewClient(c.apiKey, c.http)
+	case "openrouter":
+		c.chat = openrouter.NewClient(c.apiKey, "", "", c.http)
+	case "bedrock":
+		if c.baseURL != "" {
+			return nil, fmt.Errorf("sgpt: Bedrock endpoints follow the region, give a region instead of a base URL")
+		}
+		if c.httpOptions.Offline {
+			return nil, fmt.Errorf("sgpt: offline, requests may only go to this machine, which Bedrock is not")
+		}
+		if c.region == "" {
+			return nil, fmt.Errorf("sgpt: Bedrock needs an AWS region, e.g. WithRegion(\"us-east-1\")")
+		}
+		creds := bedrock.Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if c.credentials != nil {
+			creds = *c.credentials
+		}
+		c.bedrock = bedrock.NewClient(c.region, creds, c.http)
+		c.bedrock.UserAgent = c.userAgent
+		return c, nil
+	default:
+		return nil, fmt.Errorf("sgpt: unsupported provider %q, use one of %s", c.provider, strings.Join(Providers, ", "))
+	}
+	if c.baseURL != "" {
+		c.chat.BaseURL = c.baseURL
+	} else if c.apiKey == "" {
+		return nil, fmt.Errorf("sgpt: no API key given for %s", c.provider)
+	}
+	if endpoint, err := url.Parse(c.chat.BaseURL); c.httpOptions.Offline && (err != nil || !httpclient.IsLocalHost(endpoint.Hostname())) {
+		return nil, fmt.Errorf("sgpt: offline, requests may only go to this machine, not %s; give the base URL of a local server", c.chat.BaseURL)
+	}
+	c.chat.UserAgent = c.userAgent
+	return c, nil
+}
+
+// Provider returns the provider the client sends requests to
+func (c *Client) Provider() string {
+	return c.provider
+}
+
+// Model returns the model the client asks
+func (c *Client) Model() string {
+	return c.model
+}
+
+// Complete asks the model to reply to input
+func (c *Client) Complete(ctx context.Context, input string) (*Response, error) {
+	return c.Chat(ctx, []Message{{Role: "user", Content: input}})
+}
+
+// Chat asks the model for the next turn of a conversation, which starts with
+// a user message and alternates between the user and the model
+func (c *Client) Chat(ctx context.Context, messages []Message) (*Response, error) {
+	if err := checkConversation(messages); err != nil {
+		return nil, err
+	}
+	if c.bedrock != nil {
+		request := c.bedrockRequest(messages)
+		response, err := c.bedrock.ConverseContext(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Text: response.Text, Model: c.model, FinishReason: response.StopReason,
+			PromptTokens: response.InputTokens, CompletionTokens: response.OutputTokens}, nil
+	}
+	response, err := c.chat.CompleteContext(ctx, c.chatRequest(messages))
+	if err != nil {
+		return nil, err
+	}
+	return c.response(response), nil
+}
+
+// Stream asks the model to reply to input and calls onText with each piece
+// of the reply as it arrives. When ctx ends before the reply is complete, the
+// reply received so far is returned with the context's error. Bedrock replies
+// are not streamed: onText is called once with the whole reply. onText may be
+// nil.
+func (c *Client) Stream(ctx context.Context, input string, onText func(string)) (*Response, error) {
+	messages := []Message{{Role: "user", Content: input}}
+	if c.bedrock != nil {
+		response, err := c.Chat(ctx, messages)
+		if err != nil {
+			return nil, err
+		}
+		if onText != nil {
+			onText(response.Text)
+		}
+		return response, nil
+	}
+	response, err := c.chat.Stream(ctx, c.chatRequest(messages), onText)
+	if response == nil {
+		return nil, err
+	}
+	return c.response(response), err
+}
+
+// checkConversation checks that a conversation starts with the user and alternates
+func checkConversation(messages []Message) error {
+	if len(messages) == 0 {
+		return fmt.Errorf("sgpt: no messages given")
+	}
+	for i, m := range messages {
+		want := "user"
+		if i%2 == 1 {
+			want = "assistant"
+		}
+		if m.Role != want {
+			return fmt.Errorf("sgpt: message %d has the role %q, a conversation alternates between user and assistant starting with user", i+1, m.Role)
+		}
+	}
+	return nil
+}
+
+// chatRequest builds the request for a conversation to an OpenAI-compatible API
+func (c *Client) chatRequest(messages []Message) openaicompat.Request {
+	request := openaicompat.Request{
+		Model:       c.model,
+		System:      c.system,
+		Input:       messages[0].Content,
+		Temperature: c.temperature,
+		MaxTokens:   c.maxTokens,
+		Sampling:    c.sampling,
+	}
+	for _, m := range messages[1:] {
+		request.History = append(request.History, openaicompat.Message{Role: m.Role, Content: m.Content})
+	}
+	return request
+}
+
+// bedrockRequest builds the request for a conversation to Bedrock
+func (c *Client) bedrockRequest(messages []Message) bedrock.Request {
+	request := bedrock.Request{
+		Model:       c.model,
+		System:      c.system,
+		Input:       messages[0].Content,
+		Temperature: c.temperature,
+		MaxTokens:   c.maxTokens,
+		TopP:        c.sampling.TopP,
+		TopK:        c.sampling.TopK,
+		Stop:        c.sampling.Stop,
+	}
+	for _, m := range messages[1:] {
+		request.History = append(request.History, bedrock.Turn{Role: m.Role, Text: m.Content})
+	}
+	return request
+}
+
+// response converts a response of an OpenAI-compatible API
+func (c *Client) response(r *openaicompat.Response) *Response {
+	model := r.Model
+	if model == "" {
+		model = c.model
+	}
+	return &Response{Text: r.Text, Model: model, FinishReason: r.FinishReason, SystemFingerprint: r.SystemFingerprint,
+		PromptTokens: r.Usage.PromptTokens, CompletionTokens: r.Usage.CompletionTokens}
+}
@@ -0,0 +1,193 @@
+package sgpt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sgpt/pkg/httpclient"
+	"sgpt/pkg/provider/bedrock"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Function to start an OpenAI-compatible server that replies with the last message it was sent,
+// streamed word by word when asked to stream
+func echoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+			Stream bool `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		text := req.Messages[len(req.Messages)-1].Content
+		if !req.Stream {
+			fmt.Fprintf(w, `{"model": %q, "choices": [{"message": {"role": "assistant", "content": %q}, "finish_reason": "stop"}],
+				"usage": {"prompt_tokens": 3, "completion_tokens": 2}}`, req.Model, text)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range strings.SplitAfter(text, " ") {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {}, \"finish_reason\": \"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// A Client is documented as safe for concurrent use; run with -race
+func TestClientConcurrentUse(t *testing.T) {
+	server := echoServer(t)
+	client, err := New(WithModel("openai/local-model"), WithBaseURL(server.URL), WithHTTPClient(server.Client()), WithSystem("echo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := fmt.Sprintf("request number %d", i)
+			var response *Response
+			var err error
+			if i%2 == 0 {
+				response, err = client.Complete(context.Background(), input)
+			} else {
+				response, err = client.Stream(context.Background(), input, func(string) {})
+			}
+			if err == nil && response.Text != input {
+				err = fmt.Errorf("got %q for %q", response.Text, input)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestChatChecksConversation(t *testing.T) {
+	server := echoServer(t)
+	client, err := New(WithModel("local-model"), WithProvider("openai"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, messages := range [][]Message{
+		nil,
+		{{Role: "assistant", Content: "hi"}},
+		{{Role: "user", Content: "a"}, {Role: "user", Content: "b"}},
+	} {
+		if _, err := client.Chat(context.Background(), messages); err == nil {
+			t.Errorf("Chat(%v) succeeded", messages)
+		}
+	}
+	response, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "a"}, {Role: "assistant", Content: "b"}, {Role: "user", Content: "c"}})
+	if err != nil || response.Text != "c" || response.PromptTokens != 3 {
+		t.Errorf("Chat = %+v, %v", response, err)
+	}
+}
+
+// Clients are built with the command's transport, so they honour its offline restriction and timeouts
+func TestHTTPOptions(t *testing.T) {
+	server := echoServer(t)
+	offline := httpclient.DefaultOptions()
+	offline.Offline = true
+	if _, err := New(WithModel("openai/gpt-4o"), WithAPIKey("key"), WithHTTPOptions(offline)); err == nil {
+		t.Error("an offline client accepted the OpenAI API")
+	}
+	if _, err := New(WithModel("bedrock/meta.llama3-8b-instruct-v1:0"), WithRegion("us-east-1"), WithHTTPOptions(offline)); err == nil {
+		t.Error("an offline client accepted Bedrock")
+	}
+	t.Setenv("SGPT_OFFLINE", "true")
+	if _, err := New(WithModel("openai/gpt-4o"), WithAPIKey("key")); err == nil {
+		t.Error("SGPT_OFFLINE=true didn't make the client offline")
+	}
+	client, err := New(WithModel("openai/local-model"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := client.Complete(context.Background(), "hello"); err != nil || response.Text != "hello" {
+		t.Errorf("offline request to a local server = %+v, %v", response, err)
+	}
+
+	if _, err := New(WithModel("openai/gpt-4o"), WithAPIKey("key"), WithHTTPOptions(httpclient.Options{Proxy: "not a URL"})); err == nil {
+		t.Error("New accepted an invalid proxy")
+	}
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer slow.Close()
+	client, err = New(WithModel("openai/local-model"), WithBaseURL(slow.URL), WithHTTPOptions(httpclient.Options{Timeout: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Complete(context.Background(), "hello"); err == nil {
+		t.Error("the request outlasted the timeout")
+	}
+}
+
+func TestInferProvider(t *testing.T) {
+	for model, want := range map[string]string{
+		"gpt-4o":                     "openai",
+		"mistral-small-latest":       "mistral",
+		"anthropic.claude-v2":        "bedrock",
+		"claude-3-5-sonnet-latest":   "openai",
+		"gemini-1.5-pro":             "openai",
+		"meta.llama3-8b-instruct-v1": "bedrock",
+	} {
+		if got := InferProvider(model); got != want {
+			t.Errorf("InferProvider(%q) = %q, want %q", model, got, want)
+		}
+	}
+}
+
+// roundTripFunc answers requests without a network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Stream accepts a nil callback, for Bedrock as for the other providers
+func TestStreamNilCallback(t *testing.T) {
+	server := echoServer(t)
+	client, err := New(WithModel("openai/local-model"), WithBaseURL(server.URL), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := client.Stream(context.Background(), "hello there", nil); err != nil || response.Text != "hello there" {
+		t.Errorf("Stream = %+v, %v", response, err)
+	}
+
+	converse := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"output": {"message": {"role": "assistant", "content": [{"text": "hi"}]}}, "stopReason": "end_turn",
+			"usage": {"inputTokens": 1, "outputTokens": 1}}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})
+	client, err = New(WithModel("bedrock/meta.llama3-8b-instruct-v1:0"), WithRegion("us-east-1"),
+		WithAWSCredentials(bedrock.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}),
+		WithHTTPClient(&http.Client{Transport: converse}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := client.Stream(context.Background(), "hello", nil); err != nil || response.Text != "hi" {
+		t.Errorf("Bedrock Stream = %+v, %v", response, err)
+	}
+}
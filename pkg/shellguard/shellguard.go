@@ -0,0 +1,76 @@
+// Package shellguard checks shell commands written by a model before they
+// are offered for execution: that the reply is a single command and nothing
+// else, and that the command is not one of the well-known destructive or
+// remote-code patterns, such as deleting the root directory, a fork bomb or
+// piping a download into a shell. The checks are a safety net for commands
+// a person confirms, not a sandbox.
+package shellguard
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// rule is a destructive pattern and why it is refused
+type rule struct {
+	re     *regexp.Regexp
+	reason string
+}
+
+// Patterns of commands that are refused. Commands are matched after collapsing whitespace.
+var denylist = []rule{
+	{regexp.MustCompile(`\brm\s+(-[a-zA-Z]*\s+)*(-[a-zA-Z]*[rR][a-zA-Z]*|--recursive)\b[^;&|]*\s(/|/\*|~/?|\$HOME/?|/(bin|boot|dev|etc|lib|lib64|sbin|usr|var|System|Users|home))(\s|$|;|&|\|)`),
+		"it recursively deletes the root, a system or the home directory"},
+	{regexp.MustCompile(`--no-preserve-root`), "it disables the protection of the root directory"},
+	{regexp.MustCompile(`:\s*\(\s*\)\s*\{.*:\s*\|\s*:.*&.*\}`), "it is a fork bomb"},
+	{regexp.MustCompile(`\b(curl|wget|fetch)\b[^|;&]*\|\s*(sudo\s+)?(ba|z|da|k|fi)?sh\b`), "it pipes a download into a shell"},
+	{regexp.MustCompile(`\b(ba|z|da|k)?sh\s+(-c\s+)?["']?\$\(\s*(curl|wget)\b`), "it runs a downloaded script"},
+	{regexp.MustCompile(`\b(ba|z|da|k)?sh\s+<\(\s*(curl|wget)\b`), "it runs a downloaded script"},
+	{regexp.MustCompile(`\bmkfs(\.\w+)?\b`), "it formats a file system"},
+	{regexp.MustCompile(`\bdd\b[^;&|]*\bof=/dev/(sd|hd|nvme|disk|mmcblk|xvd|vd)`), "it overwrites a disk"},
+	{regexp.MustCompile(`>\s*/dev/(sd|hd|nvme|disk|mmcblk|xvd|vd)\w*`), "it overwrites a disk"},
+	{regexp.MustCompile(`\bchmod\s+(-[a-zA-Z]*\s+)*-[a-zA-Z]*R[a-zA-Z]*\s+[0-7]*7{2,}\s+/(\s|$)`), "it makes the whole file system writable by everyone"},
+	{regexp.MustCompile(`\bchown\s+(-[a-zA-Z]*\s+)*-[a-zA-Z]*R[a-zA-Z]*\s+\S+\s+/(\s|$)`), "it changes the owner of the whole file system"},
+}
+
+// Dangerous returns why a command is refused, or "" if it matches none of the destructive patterns
+func Dangerous(command string) string {
+	normalized := strings.Join(strings.Fields(command), " ")
+	for _, r := range denylist {
+		if r.re.MatchString(normalized) {
+			return r.reason
+		}
+	}
+	return ""
+}
+
+// Phrases that start prose rather than a command
+var prosePrefixes = []string{"here is", "here's", "sure,", "sure ", "certainly", "to ", "this command", "you can", "the command", "i "}
+
+// Single returns the command a reply consists of, with surrounding whitespace removed. It fails if
+// the reply holds more than one line, other than lines continued with a trailing backslash, or
+// reads like an explanation rather than a command.
+func Single(reply string) (string, error) {
+	command := strings.TrimSpace(reply)
+	if command == "" {
+		return "", fmt.Errorf("the reply is empty")
+	}
+	lines := strings.Split(command, "\n")
+	for i, line := range lines[:len(lines)-1] {
+		if !strings.HasSuffix(strings.TrimRight(line, " \t\r"), `\`) {
+			return "", fmt.Errorf("the reply has %d lines where line %d doesn't continue the command, it must be a single command without explanations", len(lines), i+1)
+		}
+	}
+
+	lower := strings.ToLower(command)
+	for _, prefix := range prosePrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return "", fmt.Errorf("the reply starts like an explanation (%q), it must be the command only", command[:len(prefix)])
+		}
+	}
+	if strings.HasSuffix(command, ".") && strings.Count(command, " ") > 3 && !strings.ContainsAny(command, "|&;<>$/=-") {
+		return "", fmt.Errorf("the reply reads like a sentence, it must be the command only")
+	}
+	return command, nil
+}
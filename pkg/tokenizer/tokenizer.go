@@ -0,0 +1,141 @@
+// Package tokenizer counts tokens locally with the byte pair encodings used by
+// OpenAI models. Encodings are read from the rank files published for tiktoken
+// (one base64 token and its rank per line), and text is split into pieces with
+// the same pre-tokenization patterns, so counts match those of the API.
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Names lists the supported encodings
+var Names = []string{"cl100k_base", "o200k_base"}
+
+// Pre-tokenization patterns of the encodings. Go's regexp has no lookahead, so the `\s+(?!\S)`
+// alternative of tiktoken is written as `\s+` and corrected in pieces.
+var patterns = map[string]string{
+	"cl100k_base": `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`,
+	"o200k_base": `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`,
+}
+
+// Go's \s only matches ASCII whitespace, the patterns mean Unicode whitespace
+const whitespace = `\t\n\v\f\r \p{Z}\x{85}`
+
+var unicodeSpace = strings.NewReplacer(`[^\s`, `[^`+whitespace, `\s`, `[`+whitespace+`]`)
+
+// Encoding is a byte pair encoding
+type Encoding struct {
+	Name    string
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// Load reads the named encoding from a tiktoken rank file
+func Load(name string, r io.Reader) (*Encoding, error) {
+	pattern, ok := patterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q, supported encodings are %s", name, strings.Join(Names, ", "))
+	}
+
+	e := &Encoding{Name: name, ranks: map[string]int{}, pattern: regexp.MustCompile(unicodeSpace.Replace(pattern))}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		token, rank, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", name, line, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid rank %q", name, line, rank)
+		}
+		e.ranks[string(data)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(e.ranks) == 0 {
+		return nil, fmt.Errorf("%s: no tokens", name)
+	}
+	return e, nil
+}
+
+// Count returns the number of tokens of text
+func (e *Encoding) Count(text string) int {
+	n := 0
+	for len(text) > 0 {
+		loc := e.pattern.FindStringIndex(text)
+		if loc == nil {
+			break
+		}
+		piece := text[loc[0]:loc[1]]
+
+		// Emulate `\s+(?!\S)`: a run of spaces before other text leaves its last space to that text
+		if isSpace(piece) && !strings.HasSuffix(piece, "\n") && !strings.HasSuffix(piece, "\r") && loc[1] < len(text) {
+			if _, size := utf8.DecodeLastRuneInString(piece); size < len(piece) {
+				piece = piece[:len(piece)-size]
+			}
+		}
+		n += e.bpeCount(piece)
+		text = text[loc[0]+len(piece):]
+	}
+	return n
+}
+
+// Function to count the tokens of a piece by merging the pair of parts with the lowest rank until none is left
+func (e *Encoding) bpeCount(piece string) int {
+	if piece == "" {
+		return 0
+	}
+	if _, ok := e.ranks[piece]; ok {
+		return 1
+	}
+
+	// Start from single bytes, with the parts given by their boundaries
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := e.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// Function to report whether a piece is whitespace only
+func isSpace(piece string) bool {
+	for _, r := range piece {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Estimate approximates the number of tokens of text at about four characters per token,
+// for models whose encoding is unknown or not available
+func Estimate(text string) int {
+	return (len(text) + 3) / 4
+}
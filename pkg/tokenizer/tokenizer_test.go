@@ -0,0 +1,72 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Function to write a rank file of the given tokens, ranked in order
+func rankFile(tokens ...string) string {
+	var b strings.Builder
+	for i, token := range tokens {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), i)
+	}
+	return b.String()
+}
+
+func TestCount(t *testing.T) {
+	e, err := Load("cl100k_base", strings.NewReader(rankFile("a", "b", "ab", "abab", "hello", " world", " ", " b", "!", "123")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},
+		{"hello world", 2},
+		{"hello world!", 3},
+		// ab, ab and abab are merged by rank, leaving abab + a
+		{"ababa", 2},
+		// The last space of a run goes to the following word: a, " ", " b"
+		{"a  b", 3},
+		// Bytes without a rank count one each, and digits are split in threes
+		{"xyz", 3},
+		{"1234", 2},
+	}
+	for _, tt := range tests {
+		if got := e.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load("p50k_base", strings.NewReader(rankFile("a"))); err == nil {
+		t.Error("Load accepted an unknown encoding")
+	}
+	if _, err := Load("o200k_base", strings.NewReader("!!! 0\n")); err == nil {
+		t.Error("Load accepted invalid base64")
+	}
+	if _, err := Load("o200k_base", strings.NewReader("YQ== x\n")); err == nil {
+		t.Error("Load accepted an invalid rank")
+	}
+	if _, err := Load("o200k_base", strings.NewReader("")); err == nil {
+		t.Error("Load accepted an empty file")
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{{"", 0}, {"a", 1}, {"abcd", 1}, {"abcde", 2}}
+	for _, tt := range tests {
+		if got := Estimate(tt.text); got != tt.want {
+			t.Errorf("Estimate(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package videoprep samples still frames from video files with ffmpeg so
+// that models without native video support can be shown a recording as a
+// sequence of images.
+package videoprep
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SampleFrames extracts up to maxFrames JPEG frames from the video at rate
+// frames per second, scaled so their longest side is at most maxDim pixels
+// (0 keeps the original size). The frames are written to a new temporary
+// directory, which the caller must remove.
+func SampleFrames(path string, rate float64, maxFrames, maxDim int) (dir string, frames []string, err error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return "", nil, fmt.Errorf("video input requires ffmpeg to be installed")
+	}
+	if rate <= 0 {
+		return "", nil, fmt.Errorf("video frame rate must be positive")
+	}
+
+	dir, err = os.MkdirTemp("", "sgpt-video-*")
+	if err != nil {
+		return "", nil, err
+	}
+
+	filter := "fps=" + strconv.FormatFloat(rate, 'f', -1, 64)
+	if maxDim > 0 {
+		filter += fmt.Sprintf(",scale='if(gt(iw,ih),min(%d,iw),-2)':'if(gt(iw,ih),-2,min(%d,ih))'", maxDim, maxDim)
+	}
+
+	args := []string{"-v", "error", "-i", path, "-vf", filter}
+	if maxFrames > 0 {
+		args = append(args, "-frames:v", strconv.Itoa(maxFrames))
+	}
+	args = append(args, "-q:v", "3", filepath.Join(dir, "frame-%04d.jpg"))
+
+	if out, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("ffmpeg %s: %v: %s", path, err, strings.TrimSpace(string(out)))
+	}
+
+	frames, err = filepath.Glob(filepath.Join(dir, "frame-*.jpg"))
+	if err != nil || len(frames) == 0 {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("%s: no frames could be extracted", path)
+	}
+	sort.Strings(frames)
+	return dir, frames, nil
+}
+
+// HasAudio reports whether the file contains an audio stream
+func HasAudio(path string) bool {
+	out, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "a",
+		"-show_entries", "stream=index", "-of", "csv=p=0", path).Output()
+	return err == nil && strings.TrimSpace(string(out)) != ""
+}
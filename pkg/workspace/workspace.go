@@ -0,0 +1,181 @@
+// Package workspace runs a task through a team of agents, each a model with
+// its own role, and has their contributions synthesized into one answer. In
+// a round-robin the agents take turns building on the transcript so far; in
+// a debate each round they all answer at once, then revise after reading the
+// others' answers. The package makes no API calls itself: the caller passes
+// the function that asks a model.
+package workspace
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Patterns are the ways the agents of a workspace can work together
+var Patterns = []string{"roundrobin", "debate"}
+
+// Agent is a named role in a workspace
+type Agent struct {
+	Name string
+	// Instruction describes the agent's role
+	Instruction string
+	// Model answers for the agent; empty means the configured model
+	Model string
+	// Temperature, if set, replaces the configured temperature for the agent
+	Temperature *float64
+}
+
+// Workspace is a team of agents and the way they work together
+type Workspace struct {
+	// Pattern is roundrobin (the default) or debate
+	Pattern string
+	// Rounds is how often every agent takes a turn, 2 if zero
+	Rounds int
+	Agents []Agent
+	// Synthesizer is the instruction of the final call that writes the answer from the transcript
+	Synthesizer string
+}
+
+// Turn is an agent's contribution to the transcript
+type Turn struct {
+	Agent string
+	Round int
+	Text  string
+}
+
+// Call asks a model, on behalf of agent, to reply to input following instruction. The final
+// synthesis is made with an agent named "synthesizer" that has no model or temperature of its own.
+type Call func(agent Agent, instruction, input string) (string, error)
+
+const defaultSynthesizer = "You lead a team that worked on the task below. Using their discussion, write the final " +
+	"answer to the task as one coherent response. Resolve disagreements by judging the arguments, keep what the " +
+	"critique showed to be sound, and do not mention the team or the discussion."
+
+const turnInstruction = "%s\n\nYou are %s, working with a team (%s) on the task below. The discussion so far " +
+	"follows the task. Contribute from your role: add what is missing, correct what is wrong and build on the " +
+	"others' work rather than repeating it. Be concise."
+
+const debateInstruction = "%s\n\nYou are %s, one of several agents (%s) answering the task below independently. " +
+	"If the other agents' answers from the previous round follow the task, weigh them: keep your position where you " +
+	"are right, change it where they are, and say briefly why."
+
+// Default returns the built-in workspace of a researcher, a coder and a critic taking turns
+func Default() Workspace {
+	return Workspace{
+		Pattern: "roundrobin",
+		Rounds:  2,
+		Agents: []Agent{
+			{Name: "researcher", Instruction: "You are a researcher. Establish the requirements, constraints, relevant facts and prior art, and point out open questions."},
+			{Name: "coder", Instruction: "You are a senior engineer. Turn the requirements into a concrete design or code, with the trade-offs of your choices."},
+			{Name: "critic", Instruction: "You are a critical reviewer. Find flaws, risks, missing cases and unjustified assumptions in the work so far, and propose fixes."},
+		},
+	}
+}
+
+// Validate checks that a workspace can run
+func (w Workspace) Validate() error {
+	if len(w.Agents) == 0 {
+		return fmt.Errorf("a workspace needs at least one agent")
+	}
+	if w.Pattern != "" && w.Pattern != "roundrobin" && w.Pattern != "debate" {
+		return fmt.Errorf("pattern %q is not one of %s", w.Pattern, strings.Join(Patterns, ", "))
+	}
+	if w.Rounds < 0 {
+		return fmt.Errorf("rounds must not be negative, got %d", w.Rounds)
+	}
+	seen := map[string]bool{}
+	for i, agent := range w.Agents {
+		if agent.Name == "" {
+			return fmt.Errorf("agent %d has no name", i+1)
+		}
+		if seen[agent.Name] {
+			return fmt.Errorf("agent %s appears twice", agent.Name)
+		}
+		seen[agent.Name] = true
+	}
+	return nil
+}
+
+// Run works on task with the workspace's agents and returns the synthesized answer and the
+// transcript. onTurn, if not nil, is called with each turn as soon as it is made.
+func (w Workspace) Run(task string, call Call, onTurn func(Turn)) (string, []Turn, error) {
+	if err := w.Validate(); err != nil {
+		return "", nil, err
+	}
+	rounds := w.Rounds
+	if rounds == 0 {
+		rounds = 2
+	}
+	var names []string
+	for _, agent := range w.Agents {
+		names = append(names, agent.Name)
+	}
+	team := strings.Join(names, ", ")
+
+	var transcript []Turn
+	record := func(turn Turn) {
+		transcript = append(transcript, turn)
+		if onTurn != nil {
+			onTurn(turn)
+		}
+	}
+
+	for round := 1; round <= rounds; round++ {
+		if w.Pattern == "debate" {
+			// Every agent sees the answers of the previous round only, not those of this one
+			previous := format(task, lastRound(transcript, round-1))
+			var turns []Turn
+			for _, agent := range w.Agents {
+				text, err := call(agent, fmt.Sprintf(debateInstruction, agent.Instruction, agent.Name, team), previous)
+				if err != nil {
+					return "", transcript, fmt.Errorf("%s, round %d: %w", agent.Name, round, err)
+				}
+				turns = append(turns, Turn{Agent: agent.Name, Round: round, Text: strings.TrimSpace(text)})
+			}
+			for _, turn := range turns {
+				record(turn)
+			}
+			continue
+		}
+		for _, agent := range w.Agents {
+			text, err := call(agent, fmt.Sprintf(turnInstruction, agent.Instruction, agent.Name, team), format(task, transcript))
+			if err != nil {
+				return "", transcript, fmt.Errorf("%s, round %d: %w", agent.Name, round, err)
+			}
+			record(Turn{Agent: agent.Name, Round: round, Text: strings.TrimSpace(text)})
+		}
+	}
+
+	synthesizer := w.Synthesizer
+	if synthesizer == "" {
+		synthesizer = defaultSynthesizer
+	}
+	answer, err := call(Agent{Name: "synthesizer"}, synthesizer, format(task, transcript))
+	if err != nil {
+		return "", transcript, fmt.Errorf("synthesizer: %w", err)
+	}
+	return strings.TrimSpace(answer), transcript, nil
+}
+
+// lastRound returns the turns of one round
+func lastRound(transcript []Turn, round int) []Turn {
+	var turns []Turn
+	for _, turn := range transcript {
+		if turn.Round == round {
+			turns = append(turns, turn)
+		}
+	}
+	return turns
+}
+
+// format renders the task and the turns so far as the input of a call
+func format(task string, turns []Turn) string {
+	var b strings.Builder
+	b.WriteString("Task:\n")
+	b.WriteString(strings.TrimSpace(task))
+	b.WriteString("\n")
+	for _, turn := range turns {
+		fmt.Fprintf(&b, "\n[%s, round %d]\n%s\n", turn.Agent, turn.Round, turn.Text)
+	}
+	return b.String()
+}
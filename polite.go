@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sgpt/pkg/filelock"
+	"sgpt/pkg/httpclient"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the concurrency slots are tried again while all are taken
+const politeSlotPoll = 100 * time.Millisecond
+
+// politeState is the state shared by the sgpt processes on a machine through the politeness state file
+type politeState struct {
+	// Requests holds the start times of the requests of the last minute
+	Requests []time.Time `json:"requests"`
+}
+
+// offPeakWindow is a daily time window, in minutes after local midnight, in which requests may be
+// sent. A window whose end is before its start runs past midnight.
+type offPeakWindow struct {
+	start, end int
+}
+
+// politeTransport lets the sgpt processes of a machine that share an organization's API key take
+// turns: requests wait for an off-peak window, at most maxRPM are started per minute and at most
+// concurrency run at once across all processes. Requests to this machine, such as to a local model
+// server, and the HEAD requests of --prewarm, which only open a connection, are not held back.
+type politeTransport struct {
+	next        http.RoundTripper
+	maxRPM      int
+	concurrency int
+	offPeak     []offPeakWindow
+	stateFile   string
+}
+
+// politeBody is the body of a response, which holds its request's concurrency slot until it is closed
+type politeBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *politeBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// Function to wrap the shared HTTP client's transport in the politeness settings of the config file,
+// if any are set
+func configurePoliteness() error {
+	maxRPM := viper.GetInt("politeness.maxRPM")
+	if maxRPM < 0 {
+		return fmt.Errorf("politeness.maxRPM must not be negative, got %d", maxRPM)
+	}
+	concurrency := 1
+	if viper.IsSet("politeness.concurrency") {
+		concurrency = viper.GetInt("politeness.concurrency")
+		if concurrency < 0 {
+			return fmt.Errorf("politeness.concurrency must not be negative, got %d", concurrency)
+		}
+	}
+	var windows []offPeakWindow
+	for _, spec := range viper.GetStringSlice("politeness.offPeak") {
+		window, err := parseOffPeakWindow(spec)
+		if err != nil {
+			return err
+		}
+		windows = append(windows, window)
+	}
+	if maxRPM == 0 && len(windows) == 0 && !viper.IsSet("politeness.concurrency") {
+		return nil
+	}
+	stateFile := viper.GetString("politeness.stateFile")
+	if stateFile == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			dir = os.TempDir()
+		}
+		stateFile = filepath.Join(dir, "sgpt", "politeness.json")
+		if err := os.MkdirAll(filepath.Dir(stateFile), 0755); err != nil {
+			return fmt.Errorf("politeness: %v", err)
+		}
+	}
+	httpClient.Transport = &politeTransport{next: httpClient.Transport, maxRPM: maxRPM, concurrency: concurrency,
+		offPeak: windows, stateFile: stateFile}
+	return nil
+}
+
+// Function to parse an off-peak window given as HH:MM-HH:MM in local time, e.g. 19:00-07:00
+func parseOffPeakWindow(spec string) (offPeakWindow, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+	end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil || start.Equal(end) {
+		return offPeakWindow{}, fmt.Errorf("politeness.offPeak window %q is not a time range such as 19:00-07:00", spec)
+	}
+	return offPeakWindow{start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute()}, nil
+}
+
+// Function to tell how long it is from now until one of the off-peak windows is open, 0 if one is
+func (t *politeTransport) untilOffPeak(now time.Time) time.Duration {
+	if len(t.offPeak) == 0 {
+		return 0
+	}
+	minute := now.Hour()*60 + now.Minute()
+	wait := 24 * 60
+	for _, w := range t.offPeak {
+		if (w.start < w.end && minute >= w.start && minute < w.end) || (w.start > w.end && (minute >= w.start || minute < w.end)) {
+			return 0
+		}
+		if d := (w.start - minute + 24*60) % (24 * 60); d < wait {
+			wait = d
+		}
+	}
+	return time.Duration(wait)*time.Minute - time.Duration(now.Second())*time.Second
+}
+
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if httpclient.IsLocalHost(req.URL.Hostname()) || req.Method == http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+	release, err := t.takeSlot(req.Context())
+	if err == nil {
+		if err = t.acquire(req.Context()); err != nil {
+			release()
+		}
+	}
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &politeBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// Function to wait for one of the politeness.concurrency slots, each a lock file next to the state
+// file, returning the function that frees it again. The slot is held until the response is read.
+func (t *politeTransport) takeSlot(ctx context.Context) (func(), error) {
+	if t.concurrency == 0 {
+		return func() {}, nil
+	}
+	for waiting := false; ; waiting = true {
+		for i := 0; i < t.concurrency; i++ {
+			release, ok, err := filelock.TryLock(fmt.Sprintf("%s.slot%d", t.stateFile, i))
+			if err != nil {
+				return nil, fmt.Errorf("politeness: %w", err)
+			}
+			if ok {
+				return release, nil
+			}
+		}
+		if !waiting {
+			debugf("politeness: waiting for one of %d running requests to finish", t.concurrency)
+		}
+		if err := sleepContext(ctx, politeSlotPoll); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Function to wait for the turn of a request: an off-peak window and room under politeness.maxRPM.
+// The lock on the state file is held only while the request's start is recorded, so the request
+// itself runs alongside those of other processes.
+func (t *politeTransport) acquire(ctx context.Context) error {
+	if wait := t.untilOffPeak(time.Now()); wait > 0 {
+		log.Printf("politeness: waiting %s for the next off-peak window", wait.Round(time.Minute))
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+
+	lock := t.stateFile + ".lock"
+	release, ok, err := filelock.TryLock(lock)
+	if err == nil && !ok {
+		debugf("politeness: waiting for another request to finish")
+		release, err = filelock.Lock(ctx, lock)
+	}
+	if err != nil {
+		return fmt.Errorf("politeness: %w", err)
+	}
+	defer release()
+	return t.recordRequest(ctx)
+}
+
+// Function to wait until a request can be started without exceeding politeness.maxRPM across the
+// machine, and record its start in the state file. It is called with the lock held.
+func (t *politeTransport) recordRequest(ctx context.Context) error {
+	var state politeState
+	if data, err := os.ReadFile(t.stateFile); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			debugf("politeness: ignoring the unreadable state file %s: %v", t.stateFile, err)
+		}
+	}
+
+	for {
+		now := time.Now()
+		recent := state.Requests[:0]
+		for _, started := range state.Requests {
+			if now.Sub(started) < time.Minute {
+				recent = append(recent, started)
+			}
+		}
+		state.Requests = recent
+		if t.maxRPM == 0 || len(recent) < t.maxRPM {
+			break
+		}
+		wait := time.Minute - now.Sub(recent[len(recent)-t.maxRPM])
+		debugf("politeness: %d requests in the last minute, waiting %s", len(recent), wait.Round(time.Second))
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+
+	state.Requests = append(state.Requests, time.Now())
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(t.stateFile, data, 0666); err != nil {
+		return fmt.Errorf("politeness: %v", err)
+	}
+	return nil
+}
+
+// Function to wait for d, or until ctx ends
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc answers requests without a network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// A rate-limit turn ends once the request is started: a response still being read only holds its
+// concurrency slot, and the HEAD request of --prewarm takes no turn
+func TestPoliteTransport(t *testing.T) {
+	transport := &politeTransport{
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+		}),
+		maxRPM:      2,
+		concurrency: 2,
+		stateFile:   filepath.Join(t.TempDir(), "politeness.json"),
+	}
+	send := func(method string) *http.Response {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, method, "https://api.example.com/v1/chat/completions", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s request: %v", method, err)
+		}
+		return resp
+	}
+
+	send(http.MethodHead)
+	open := send(http.MethodPost) // Its body stays open
+	defer open.Body.Close()
+	send(http.MethodPost).Body.Close()
+
+	data, err := os.ReadFile(transport.stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state politeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Requests) != 2 {
+		t.Errorf("%d requests recorded, want 2", len(state.Requests))
+	}
+
+	// A third request within the minute waits for room under maxRPM
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.example.com/v1/chat/completions", nil)
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Error("a third request was started within the minute with maxRPM 2")
+	}
+}
+
+// trackedBody counts a response as running until it is closed
+type trackedBody struct {
+	io.Reader
+	running *int32
+}
+
+func (b trackedBody) Close() error {
+	atomic.AddInt32(b.running, -1)
+	return nil
+}
+
+// Processes sharing a state file run at most politeness.concurrency requests at once, each until its
+// response is closed
+func TestPoliteConcurrency(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "politeness.json")
+	var running, most int32
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: trackedBody{strings.NewReader(""), &running}, Request: req}, nil
+	})
+
+	for _, concurrency := range []int32{1, 2} {
+		running, most = 0, 0
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Each request has a transport of its own, as a process of its own would
+				transport := &politeTransport{next: next, concurrency: int(concurrency), stateFile: stateFile}
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.example.com/v1/chat/completions", nil)
+				resp, err := transport.RoundTrip(req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				time.Sleep(20 * time.Millisecond)
+				resp.Body.Close()
+			}()
+		}
+		wg.Wait()
+		if most > concurrency {
+			t.Errorf("concurrency %d: up to %d requests ran at once", concurrency, most)
+		}
+	}
+}
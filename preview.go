@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// preview shows the latest text of a streaming reply on one status line of stderr, for --preview.
+// stdout receives only the complete reply, so it stays safe to pipe.
+type preview struct {
+	text  strings.Builder
+	width int
+}
+
+// Function to start a preview sized to the terminal
+func newPreview() *preview {
+	return &preview{width: terminalWidth()}
+}
+
+// Function to add a piece of the reply and redraw the status line with the end of the text so far
+func (p *preview) add(text string) {
+	p.text.WriteString(text)
+	line := strings.Join(strings.Fields(p.text.String()), " ")
+	if n := utf8.RuneCountInString(line); n > p.width-1 {
+		line = string([]rune(line)[n-(p.width-1):])
+	}
+	fmt.Fprint(os.Stderr, "\r\x1b[K"+line)
+}
+
+// Function to remove the status line
+func (p *preview) clear() {
+	if p.text.Len() > 0 {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+}
+
+// Function to return the width of the terminal on stderr, from COLUMNS or stty, defaulting to 80
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 1 {
+		return columns
+	}
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stderr
+	if out, err := cmd.Output(); err == nil {
+		if fields := strings.Fields(string(out)); len(fields) == 2 {
+			if columns, err := strconv.Atoi(fields[1]); err == nil && columns > 1 {
+				return columns
+			}
+		}
+	}
+	return 80
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+)
+
+// Function to merge the settings of the profile chosen with --profile, SGPT_PROFILE or the profile key
+// over the top-level settings of the config file. Flags and environment variables still take
+// precedence over both.
+func applyProfile() error {
+	name := viper.GetString("profile")
+	if name == "" {
+		return nil
+	}
+	profiles := viper.GetStringMap("profiles")
+	settings, ok := profiles[strings.ToLower(name)].(map[string]interface{})
+	if !ok {
+		if len(profiles) == 0 {
+			return fmt.Errorf("no profile %q: the config file defines no profiles", name)
+		}
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("no profile %q in the config file, the profiles are %s", name, strings.Join(names, ", "))
+	}
+	debugf("using profile %s", name)
+	return viper.MergeConfigMap(settings)
+}
+
+// Function to check the profiles of a config file, each of which may hold any top-level setting
+// except profiles
+func (d *configDoc) checkProfiles(node *yaml.Node, errs *ConfigErrors) {
+	if node.Kind != yaml.MappingNode {
+		*errs = append(*errs, fmt.Sprintf("%s:%d: profiles must be a mapping of names to settings", d.file(node), node.Line))
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, profile := node.Content[i].Value, node.Content[i+1]
+		if profile.Kind != yaml.MappingNode {
+			*errs = append(*errs, fmt.Sprintf("%s:%d: profile %s must be a mapping of settings", d.file(profile), profile.Line, name))
+			continue
+		}
+		settings := &yaml.Node{Kind: yaml.MappingNode}
+		for j := 0; j+1 < len(profile.Content); j += 2 {
+			keyNode := profile.Content[j]
+			if keyNode.Value == "profiles" || keyNode.Value == "profile" || keyNode.Value == "modelCapabilities" {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: profile %s can't set %s", d.file(keyNode), keyNode.Line, name, keyNode.Value))
+				continue
+			}
+			settings.Content = append(settings.Content, keyNode, profile.Content[j+1])
+		}
+		d.check("", settings, errs)
+	}
+}
@@ -0,0 +1,728 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sgpt/pkg/cache"
+	"sgpt/pkg/i18n"
+	"sgpt/pkg/imageprep"
+	"sgpt/pkg/provider/bedrock"
+	"sgpt/pkg/provider/groq"
+	"sgpt/pkg/provider/mistral"
+	"sgpt/pkg/provider/openaicompat"
+	"sgpt/pkg/provider/openrouter"
+	"sgpt/pkg/sgpt"
+	"strings"
+)
+
+// Supported providers
+var providers = []string{"openai", "bedrock", "mistral", "openrouter", "groq"}
+
+// ModelCaps describes which provider serves a model and what the model supports
+type ModelCaps struct {
+	Provider string
+	Endpoint string // API endpoint for OpenAI models
+	Vision   bool   // Whether the model accepts images
+	// Whether replies can't be streamed, e.g. from servers without streaming support
+	NoStreaming bool
+	// Context window in tokens, zero if unknown
+	ContextWindow int
+	// Most tokens the model writes in one reply, zero if only the context window limits it
+	MaxOutputTokens int
+	// Prices in USD per million input and output tokens, zero if unknown
+	InputPrice  float64
+	OutputPrice float64
+}
+
+// Known models, from models.yaml, the downloaded model catalog and the modelCapabilities section of the config file
+var modelCapabilities = builtinModels()
+
+// Function to choose the provider. A `provider/model` model name selects the provider unless a
+// different one is given explicitly (OpenRouter model names contain a slash themselves). Otherwise
+// an explicit provider wins, and without one the provider is inferred from the model name.
+func resolveProvider() {
+	provider, model := modelProvider(viper.GetString("model"), viper.GetString("provider"))
+	viper.Set("provider", provider)
+	viper.Set("model", model)
+}
+
+// Function to choose the provider for a model name, given the explicitly chosen provider if any.
+// It returns the provider and the model name without any `provider/` prefix.
+func modelProvider(model, explicit string) (string, string) {
+	if i := strings.Index(model, "/"); i > 0 && (explicit == "" || explicit == model[:i]) {
+		return model[:i], model[i+1:]
+	}
+	if explicit == "" {
+		return inferProvider(model), model
+	}
+	return explicit, model
+}
+
+// Function to select the provider and model that answer next: the model called name (also given as
+// provider/model), or provider and model if name is empty. The selection is checked like the configuration.
+func useModel(name, provider, model string) error {
+	if name != "" {
+		provider, model = modelProvider(name, "")
+	}
+	if viper.GetString("provider") == provider && viper.GetString("model") == model {
+		return nil
+	}
+	viper.Set("provider", provider)
+	viper.Set("model", model)
+	loadKeyringKey(provider)
+	return validateConfig()
+}
+
+// Function to infer the provider serving a model from the model list or its name, defaulting to OpenAI
+func inferProvider(model string) string {
+	if caps, ok := modelCapabilities[model]; ok {
+		return caps.Provider
+	}
+	return sgpt.InferProvider(model)
+}
+
+// Function to tell whether name is a supported provider
+func isProvider(name string) bool {
+	for _, p := range providers {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to tell whether the models of a provider are listed in modelCapabilities. A server at a
+// custom base URL may serve any model.
+func providerListsModels(provider string) bool {
+	return provider != "bedrock" && provider != "openrouter" && providerBaseURL(provider) == ""
+}
+
+// Provider that the generic apiKey (-k, SGPT_API_KEY) belongs to: the one configured when sgpt
+// started. Other providers, such as those of agents, critics, drafts and the models asked for through
+// sgpt serve, need a <provider>.apiKey of their own, so that a key is never sent to another vendor.
+var apiKeyProvider = "openai"
+
+// Function to look up the API key for a provider: its own config key, falling back to apiKey for the
+// provider apiKey belongs to
+func providerAPIKey(provider string) string {
+	if key := viper.GetString(provider + ".apiKey"); key != "" {
+		return key
+	}
+	if provider == apiKeyProvider {
+		return viper.GetString("apiKey")
+	}
+	return ""
+}
+
+// Function to check that requests can be sent to a provider: that it has an API key, or a base URL
+// whose server may not need one. Bedrock signs requests with AWS credentials instead.
+func checkProviderKey(provider string) error {
+	if provider == "bedrock" || providerAPIKey(provider) != "" || providerBaseURL(provider) != "" {
+		return nil
+	}
+	return fmt.Errorf("no API key configured for %s", provider)
+}
+
+// Regional endpoints of providers that offer data residency, selected with --region or <provider>.region.
+// Bedrock takes any AWS region.
+var providerRegions = map[string][]string{
+	"openai":  {"us", "eu"},
+	"mistral": {"eu"},
+}
+
+var awsRegion = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]*)?-[a-z]+-\d+$`)
+
+// Function to look up the region of a provider: --region for the configured provider, falling back to <provider>.region
+func providerRegion(provider string) string {
+	if region := viper.GetString("region"); region != "" && provider == viper.GetString("provider") {
+		return region
+	}
+	return viper.GetString(provider + ".region")
+}
+
+// Function to check the region of a provider, returning a description of the problem or ""
+func checkRegion(provider string) string {
+	region := providerRegion(provider)
+	if region == "" {
+		return ""
+	}
+	if provider == "bedrock" {
+		if !awsRegion.MatchString(region) {
+			return i18n.Sprintf("%q is not an AWS region, e.g. us-east-1 or eu-central-1", region)
+		}
+		return ""
+	}
+	regions, ok := providerRegions[provider]
+	if !ok {
+		return i18n.Sprintf("%s has no regional endpoints, remove the region", provider)
+	}
+	for _, r := range regions {
+		if r == region {
+			return ""
+		}
+	}
+	return i18n.Sprintf("%s region %q is not one of %s", provider, region, strings.Join(regions, ", "))
+}
+
+// Function to look up the base URL of a provider's API: --baseURL for the configured provider, falling
+// back to <provider>.baseURL. It is empty for the provider's own endpoint.
+func providerBaseURL(provider string) string {
+	if baseURL := viper.GetString("baseURL"); baseURL != "" && provider == viper.GetString("provider") {
+		return baseURL
+	}
+	return viper.GetString(provider + ".baseURL")
+}
+
+// Function to check the base URL of a provider, returning a description of the problem or ""
+func checkBaseURL(provider string) string {
+	baseURL := providerBaseURL(provider)
+	if baseURL == "" {
+		return ""
+	}
+	if provider == "bedrock" {
+		return i18n.T("Bedrock endpoints follow the region, use --region instead of a base URL")
+	}
+	if u, err := url.Parse(baseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return i18n.Sprintf("%s base URL %q is not an http or https URL, e.g. http://localhost:8000/v1", provider, baseURL)
+	}
+	return ""
+}
+
+// Function to return the OpenAI endpoint of a model. Models a server at a custom base URL serves
+// that are not known to sgpt are taken to be chat models.
+func openAIEndpoint(model string) string {
+	if endpoint := modelCapabilities[model].Endpoint; endpoint != "" || providerBaseURL("openai") == "" {
+		return endpoint
+	}
+	return chatCompletionsURL
+}
+
+// Function to point an OpenAI API URL at the configured base URL, or the endpoint of the configured
+// OpenAI region
+func openAIURL(url string) string {
+	if baseURL := providerBaseURL("openai"); baseURL != "" {
+		return strings.Replace(url, openAIBaseURL, strings.TrimSuffix(baseURL, "/"), 1)
+	}
+	if providerRegion("openai") == "eu" {
+		return strings.Replace(url, "https://api.openai.com/", "https://eu.api.openai.com/", 1)
+	}
+	return url
+}
+
+// Function to send a request to the model, answering it from the response cache when an identical
+// request was made before, or from the local model of --localFallback when the request fails
+func callModel(apiKey, model, instruction, input string, temperature float64) (string, error) {
+	return callModelContext(rootCtx, apiKey, model, instruction, input, temperature)
+}
+
+// Function to send a request to the model like callModel, abandoning it when ctx ends. A request
+// that ctx ended is not answered by the local model.
+func callModelContext(ctx context.Context, apiKey, model, instruction, input string, temperature float64) (string, error) {
+	reply, err := cachedCall(ctx, model, instruction, input, temperature, func() (string, error) {
+		return callProvider(ctx, apiKey, model, instruction, input, temperature)
+	})
+	if err != nil && ctx.Err() == nil {
+		return localFallback(ctx, instruction, input, temperature, err)
+	}
+	return reply, err
+}
+
+// Function to stream a reply, calling onText with each piece as it arrives. Replies that can't be
+// streamed, or come from the response cache, are returned whole without calling onText.
+func callModelStreamed(ctx context.Context, apiKey, model, instruction, input string, temperature float64, onText func(string)) (string, error) {
+	reply, err := cachedCall(ctx, model, instruction, input, temperature, func() (string, error) {
+		reply, err := callModelStream(ctx, apiKey, model, instruction, input, temperature, onText)
+		if errors.Is(err, errStreamingUnsupported) {
+			return callProvider(ctx, apiKey, model, instruction, input, temperature)
+		}
+		return reply, err
+	})
+	if err != nil && ctx.Err() == nil {
+		return localFallback(ctx, instruction, input, temperature, err)
+	}
+	return reply, err
+}
+
+// Function to answer a request from the response cache, or make it with call and cache the reply.
+// Processes making the same request at the same time wait for the first one's reply. The cache is
+// only used with --cache, since a request with a temperature above 0 is expected to get a fresh reply.
+func cachedCall(ctx context.Context, model, instruction, input string, temperature float64, call func() (string, error)) (string, error) {
+	if !viper.GetBool("cache") || viper.GetBool("noCache") || viper.GetBool("raw") || jsonOutput() {
+		return call() // Raw responses and --output json are for inspecting what the provider sends now
+	}
+
+	key, err := requestKey(model, instruction, input, temperature)
+	if err != nil {
+		return "", err
+	}
+	responses := cache.New(cacheDir(), viper.GetDuration("cacheTTL"))
+	if reply, ok := responses.Get(key); ok {
+		debugf("cached reply %s", key)
+		return reply, nil
+	}
+	// Wait for any other process making the same request, then use its reply
+	if unlock, err := responses.Lock(ctx, key); err != nil {
+		debugf("locking cache entry %s: %v", key, err)
+	} else {
+		defer unlock()
+		if reply, ok := responses.Get(key); ok {
+			debugf("cached reply %s, made while waiting", key)
+			return reply, nil
+		}
+	}
+
+	reply, err := call()
+	if err != nil {
+		return "", err
+	}
+	if !replyPasses(reply) {
+		debugf("not caching reply %s, which fails the --jsonSchema or --assert checks", key)
+		return reply, nil
+	}
+	if err := responses.Put(key, reply); err != nil {
+		debugf("caching reply: %v", err)
+	}
+	return reply, nil
+}
+
+// Function to tell whether a reply passes the --jsonSchema and --assert checks it is put through
+// after it returns, so that a rejected reply isn't cached and given again when the request is retried
+func replyPasses(reply string) bool {
+	schema, err := loadJSONSchema()
+	if err != nil {
+		return false
+	}
+	if schema != nil {
+		reply = stripCodeFence(reply)
+		if schema.Validate([]byte(reply)) != nil {
+			return false
+		}
+		if reply, err = normalizeReply(reply); err != nil {
+			return false
+		}
+	}
+	assertions, err := loadAssertions()
+	if err != nil {
+		return false
+	}
+	for _, a := range assertions {
+		if a.Check(reply) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Function to return the directory of the response cache
+func cacheDir() string {
+	if dir := viper.GetString("cacheDir"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "sgpt", "responses")
+}
+
+// Function to return the sampling parameters set with --topP, --topK, --frequencyPenalty, --presencePenalty,
+// --stop and --seed
+func samplingOptions() openaicompat.Sampling {
+	return openaicompat.Sampling{
+		TopP:             viper.GetFloat64("topP"),
+		TopK:             viper.GetInt("topK"),
+		FrequencyPenalty: viper.GetFloat64("frequencyPenalty"),
+		PresencePenalty:  viper.GetFloat64("presencePenalty"),
+		Stop:             viper.GetStringSlice("stop"),
+		Seed:             viper.GetInt64("seed"),
+	}
+}
+
+// OpenAI processing tiers, selected with --serviceTier
+var serviceTiers = []string{"auto", "default", "flex", "priority"}
+
+// Function to return the processing tier requested with --serviceTier, for providers that offer tiers
+func serviceTier(provider string) string {
+	if provider != "openai" {
+		return ""
+	}
+	return viper.GetString("serviceTier")
+}
+
+// Function to tell whether name is an OpenAI processing tier
+func isServiceTier(name string) bool {
+	for _, t := range serviceTiers {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to add the sampling parameters to a request payload for the OpenAI API
+func addSampling(payload map[string]interface{}) {
+	s := samplingOptions()
+	if s.TopP > 0 {
+		payload["top_p"] = s.TopP
+	}
+	if s.FrequencyPenalty != 0 {
+		payload["frequency_penalty"] = s.FrequencyPenalty
+	}
+	if s.PresencePenalty != 0 {
+		payload["presence_penalty"] = s.PresencePenalty
+	}
+	if len(s.Stop) > 0 {
+		payload["stop"] = s.Stop
+	}
+	if s.Seed != 0 {
+		payload["seed"] = s.Seed
+	}
+}
+
+// Function to compute the cache key of a request from everything that is sent with it
+func requestKey(model, instruction, input string, temperature float64) (string, error) {
+	images, err := loadImages()
+	if err != nil {
+		return "", err
+	}
+	var imageHashes []string
+	for _, img := range images {
+		sum := sha256.Sum256(img.Data)
+		imageHashes = append(imageHashes, hex.EncodeToString(sum[:]))
+	}
+	tools, err := loadTools()
+	if err != nil {
+		return "", err
+	}
+	schema, err := loadJSONSchema()
+	if err != nil {
+		return "", err
+	}
+	var rawSchema json.RawMessage
+	if schema != nil {
+		rawSchema = schema.Raw
+	}
+	provider := viper.GetString("provider")
+	return cache.Key(provider, providerBaseURL(provider), model, instruction, input, temperature,
+		imageHashes, viper.GetString("imageDetail"), tools, rawSchema, samplingOptions(),
+		maxReplyTokens(model, instruction, input), serviceTier(provider))
+}
+
+// Function to send a request to the model through the configured provider
+func callProvider(ctx context.Context, apiKey, model, instruction, input string, temperature float64) (string, error) {
+	provider := viper.GetString("provider")
+	if err := checkProviderKey(provider); err != nil {
+		return "", err
+	}
+	switch provider {
+	case "openai":
+		return callOpenAI(ctx, apiKey, model, instruction, input, temperature)
+	case "bedrock":
+		return callBedrock(ctx, model, instruction, input, temperature)
+	case "mistral", "openrouter", "groq":
+		return callCompatible(ctx, provider, model, instruction, input, temperature)
+	default:
+		return "", fmt.Errorf("unsupported provider: %s", provider)
+	}
+}
+
+// Returned by callModelStream when the provider or model can't stream replies
+var errStreamingUnsupported = errors.New("streaming is not supported")
+
+// Function to stream a reply through the configured provider, calling onText with each piece as it
+// arrives. Replies that call tools are not streamed. When ctx ends first, the text received so far
+// is returned with the context's error. With --streamResume, a reply whose stream breaks off is continued.
+func callModelStream(ctx context.Context, apiKey, model, instruction, input string, temperature float64, onText func(string)) (string, error) {
+	reply, err := callProviderStream(ctx, apiKey, model, instruction, input, temperature, onText)
+	if err != nil && viper.GetBool("streamResume") && ctx.Err() == nil && reply != "" && !errors.Is(err, errStreamingUnsupported) {
+		return resumeStream(ctx, model, instruction, input, temperature, reply, err, onText)
+	}
+	return reply, err
+}
+
+// Function to stream a reply through the configured provider, without resuming broken streams.
+// --noStream turns streaming off, and --stream streams models the model list says can't stream.
+func callProviderStream(ctx context.Context, apiKey, model, instruction, input string, temperature float64, onText func(string)) (string, error) {
+	tools, err := loadTools()
+	if err != nil {
+		return "", err
+	}
+	if len(tools) > 0 || viper.GetBool("noStream") || (modelCapabilities[model].NoStreaming && !viper.GetBool("stream")) {
+		return "", errStreamingUnsupported
+	}
+	if viper.GetBool("raw") {
+		onText = nil // The reply is the stream's events, not its text
+	}
+
+	provider := viper.GetString("provider")
+	if err := checkProviderKey(provider); err != nil {
+		return "", err
+	}
+	switch provider {
+	case "openai":
+		return callOpenAIStream(ctx, apiKey, model, instruction, input, temperature, onText)
+	case "mistral", "openrouter", "groq":
+		request := openaicompat.Request{Model: model, System: instruction, Input: input, Temperature: temperature,
+			MaxTokens: maxReplyTokens(model, instruction, input), Sampling: samplingOptions()}
+		schema, err := loadJSONSchema()
+		if err != nil {
+			return "", err
+		}
+		if schema != nil {
+			request.JSONSchema = schema.Raw
+		}
+		client := newCompatibleClient(provider)
+		debugf("POST %s model=%s stream=true", client.Endpoint(), model)
+		response, err := client.Stream(ctx, request, onText)
+		if response == nil {
+			return "", err
+		}
+		recordUsage(ctx, provider, model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+		noteReply(ctx, provider, model, response.Model, response.FinishReason, response.SystemFingerprint, response.Raw)
+		if viper.GetBool("raw") {
+			return string(response.Raw), err
+		}
+		return response.Text, err
+	}
+	return "", errStreamingUnsupported
+}
+
+// Function to get n alternative replies to one prompt. OpenAI and Mistral AI return several replies
+// to one request; for other providers, or when fewer replies come back, further requests are made.
+func callModelCandidates(ctx context.Context, apiKey, model, instruction, input string, temperature float64, n int) ([]string, error) {
+	provider := viper.GetString("provider")
+	if err := checkProviderKey(provider); err != nil {
+		return nil, err
+	}
+	var replies []string
+	var err error
+	switch provider {
+	case "openai":
+		replies, err = callOpenAIChoices(ctx, apiKey, model, instruction, input, temperature, n)
+	case "mistral":
+		replies, err = callCompatibleChoices(ctx, provider, model, instruction, input, temperature, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for len(replies) < n {
+		reply, err := callProvider(ctx, apiKey, model, instruction, input, temperature)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies[:n], nil
+}
+
+// Function to return the URL a request for model will be sent to, used for pre-warming
+func providerEndpoint(model string) string {
+	switch provider := viper.GetString("provider"); provider {
+	case "bedrock":
+		return newBedrockClient().Endpoint()
+	case "mistral", "openrouter", "groq":
+		return newCompatibleClient(provider).Endpoint()
+	}
+	return openAIURL(openAIEndpoint(model))
+}
+
+// Function to create a Bedrock client from the configured region and the standard AWS environment variables
+func newBedrockClient() *bedrock.Client {
+	client := bedrock.NewClient(providerRegion("bedrock"), bedrock.Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}, httpClient)
+	client.UserAgent = userAgent()
+	return client
+}
+
+// Limits of the Bedrock Converse API on the images of one request
+const (
+	bedrockMaxImages    = 20
+	bedrockMaxImageSize = 3750 << 10
+)
+
+// Function to handle API calls to models hosted on Amazon Bedrock
+func callBedrock(ctx context.Context, model, instruction, input string, temperature float64) (string, error) {
+	images, err := loadImages()
+	if err != nil {
+		return "", err
+	}
+
+	request := bedrock.Request{
+		Model:       model,
+		System:      instruction,
+		Input:       input,
+		Temperature: temperature,
+		MaxTokens:   maxReplyTokens(model, instruction, input),
+	}
+	sampling := samplingOptions()
+	request.TopP, request.TopK, request.Stop = sampling.TopP, sampling.TopK, sampling.Stop
+	if len(images) > bedrockMaxImages {
+		return "", fmt.Errorf("bedrock accepts at most %d images per request, got %d", bedrockMaxImages, len(images))
+	}
+	for i, img := range images {
+		if len(img.Data) > bedrockMaxImageSize {
+			return "", fmt.Errorf("%s is %.1f MB, bedrock accepts images up to 3.75 MB; downscale it with --imageMaxDim",
+				viper.GetStringSlice("image")[i], float64(len(img.Data))/(1<<20))
+		}
+		request.Images = append(request.Images, bedrock.Image{Format: img.Format(), Data: img.Data})
+	}
+
+	client := newBedrockClient()
+	debugf("POST %s/model/%s/converse", client.Endpoint(), model)
+	response, err := client.ConverseContext(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	recordUsage(ctx, "bedrock", model, response.InputTokens, response.OutputTokens)
+	noteReply(ctx, "bedrock", model, "", response.StopReason, "", response.Raw)
+	if viper.GetBool("raw") {
+		return string(response.Raw), nil
+	}
+	return response.Text, nil
+}
+
+// Function to create the client for a provider with an OpenAI-compatible API
+func newCompatibleClient(provider string) *openaicompat.Client {
+	var client *openaicompat.Client
+	switch provider {
+	case "mistral":
+		client = mistral.NewClient(providerAPIKey(provider), httpClient)
+	case "groq":
+		client = groq.NewClient(providerAPIKey(provider), httpClient)
+	case "openrouter":
+		client = openrouter.NewClient(providerAPIKey(provider), viper.GetString("openrouter.referer"), viper.GetString("openrouter.title"), httpClient)
+	}
+	if baseURL := providerBaseURL(provider); baseURL != "" {
+		client.BaseURL = baseURL
+	}
+	client.UserAgent = userAgent()
+	return client
+}
+
+// Function to create an OpenAI-format chat client for a provider, including OpenAI itself, for requests
+// that need tool calling or the turns of a conversation
+func chatClient(provider string) (*openaicompat.Client, error) {
+	if err := checkProviderKey(provider); err != nil {
+		return nil, err
+	}
+	if provider == "openai" {
+		client := openaicompat.NewClient("openai", openAIURL(openAIBaseURL+"/"), providerAPIKey(provider), httpClient)
+		client.UserAgent = userAgent()
+		return client, nil
+	}
+	return newCompatibleClient(provider), nil
+}
+
+// Function to handle API calls to providers with an OpenAI-compatible API
+func callCompatible(ctx context.Context, provider, model, instruction, input string, temperature float64) (string, error) {
+	replies, err := callCompatibleChoices(ctx, provider, model, instruction, input, temperature, 1)
+	if err != nil {
+		return "", err
+	}
+	return replies[0], nil
+}
+
+// Function to call a provider with an OpenAI-compatible API asking for n alternative replies
+func callCompatibleChoices(ctx context.Context, provider, model, instruction, input string, temperature float64, n int) ([]string, error) {
+	tools, err := loadTools()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := loadJSONSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	client := newCompatibleClient(provider)
+	debugf("POST %s model=%s", client.Endpoint(), model)
+
+	request := openaicompat.Request{
+		Model:       model,
+		System:      instruction,
+		Input:       input,
+		Temperature: temperature,
+		MaxTokens:   maxReplyTokens(model, instruction, input),
+		Sampling:    samplingOptions(),
+		Tools:       tools,
+		N:           n,
+	}
+	if schema != nil {
+		request.JSONSchema = schema.Raw
+	}
+
+	response, err := client.CompleteContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Model != "" && response.Model != model {
+		debugf("%s routed the request to %s", provider, response.Model)
+	}
+	recordUsage(ctx, provider, model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	noteReply(ctx, provider, model, response.Model, response.FinishReason, response.SystemFingerprint, response.Raw)
+	if viper.GetBool("raw") {
+		return []string{string(response.Raw)}, nil
+	}
+	if len(response.ToolCalls) > 0 {
+		calls, err := formatToolCalls(response.ToolCalls)
+		return []string{calls}, err
+	}
+	if len(response.Alternatives) > 0 {
+		return response.Alternatives, nil
+	}
+	return []string{response.Text}, nil
+}
+
+// Function to build the content of the user message for chat models: the input alone, or the
+// input followed by the attached images
+func chatContent(input string) (interface{}, error) {
+	images, err := loadImages()
+	if err != nil || len(images) == 0 {
+		return input, err
+	}
+
+	parts := []map[string]interface{}{{"type": "text", "text": input}}
+	for _, img := range images {
+		parts = append(parts, map[string]interface{}{
+			"type": "image_url",
+			"image_url": map[string]string{
+				"url":    "data:" + img.MIME + ";base64," + base64.StdEncoding.EncodeToString(img.Data),
+				"detail": viper.GetString("imageDetail"),
+			},
+		})
+	}
+	return parts, nil
+}
+
+// Function to load the images given with --image, downscaled to --imageMaxDim
+func loadImages() ([]*imageprep.Image, error) {
+	var images []*imageprep.Image
+	for _, path := range viper.GetStringSlice("image") {
+		var img *imageprep.Image
+		var err error
+		if path == "-" {
+			img, err = imageprep.Decode("stdin", stdinAttachment, viper.GetInt("imageMaxDim"))
+		} else {
+			img, err = imageprep.Load(path, viper.GetInt("imageMaxDim"))
+		}
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Every setting that changes the request sent must change its cache key
+func TestRequestKeyCoversParameters(t *testing.T) {
+	viper.Set("provider", "openai")
+	defer viper.Set("provider", "")
+	base, err := requestKey("m", "instruction", "input", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, setting := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"maxTokens", 100},
+		{"serviceTier", "flex"},
+		{"topP", 0.5},
+		{"seed", 7},
+		{"stop", []string{"END"}},
+	} {
+		viper.Set(setting.name, setting.value)
+		key, err := requestKey("m", "instruction", "input", 0)
+		viper.Set(setting.name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key == base {
+			t.Errorf("--%s doesn't change the cache key", setting.name)
+		}
+	}
+}
+
+// The cache is opt-in, and only replies that pass --assert are cached
+func TestCachedCall(t *testing.T) {
+	viper.Set("cacheDir", t.TempDir())
+	defer viper.Set("cacheDir", "")
+	calls := 0
+	call := func(reply string) func() (string, error) {
+		return func() (string, error) {
+			calls++
+			return reply, nil
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		cachedCall(context.Background(), "m", "off", "input", 0, call("reply"))
+	}
+	if calls != 2 {
+		t.Errorf("without --cache: %d calls, want 2", calls)
+	}
+
+	viper.Set("cache", true)
+	defer viper.Set("cache", false)
+	viper.Set("assert", []string{"regex:yes"})
+	calls = 0
+	for i := 0; i < 2; i++ {
+		cachedCall(context.Background(), "m", "rejected", "input", 0, call("no"))
+	}
+	if calls != 2 {
+		t.Errorf("reply failing --assert: %d calls, want 2", calls)
+	}
+	viper.Set("assert", nil)
+
+	calls = 0
+	for i := 0; i < 2; i++ {
+		if reply, err := cachedCall(context.Background(), "m", "on", "input", 0, call("reply")); err != nil || reply != "reply" {
+			t.Fatalf("cachedCall = %q, %v", reply, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("with --cache: %d calls, want 1", calls)
+	}
+}
+
+// The generic apiKey is only sent to the provider it belongs to; other providers need their own key
+func TestProviderAPIKey(t *testing.T) {
+	viper.Set("apiKey", "sk-openai")
+	viper.Set("groq.apiKey", "gsk-groq")
+	defer viper.Set("apiKey", "")
+	defer viper.Set("groq.apiKey", "")
+	defer func(provider string) { apiKeyProvider = provider }(apiKeyProvider)
+	apiKeyProvider = "openai"
+
+	for provider, want := range map[string]string{"openai": "sk-openai", "groq": "gsk-groq", "mistral": "", "openrouter": ""} {
+		if got := providerAPIKey(provider); got != want {
+			t.Errorf("providerAPIKey(%q) = %q, want %q", provider, got, want)
+		}
+	}
+	if err := checkProviderKey("mistral"); err == nil || err.Error() != "no API key configured for mistral" {
+		t.Errorf("checkProviderKey(mistral) = %v", err)
+	}
+	for _, provider := range []string{"openai", "groq", "bedrock"} {
+		if err := checkProviderKey(provider); err != nil {
+			t.Errorf("checkProviderKey(%q) = %v", provider, err)
+		}
+	}
+	if _, err := chatClient("openrouter"); err == nil {
+		t.Error("chatClient(openrouter) made a client with the OpenAI key")
+	}
+
+	viper.Set("provider", "mistral")
+	defer viper.Set("provider", "")
+	if _, err := callProvider(context.Background(), "sk-openai", "mistral-small-latest", "instruction", "input", 0); err == nil {
+		t.Error("callProvider sent a request to mistral without its key")
+	}
+}
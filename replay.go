@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+)
+
+// Function to return the seed sent with requests to provider: --seed, or the seed chosen for the run
+// by chooseSeed. Bedrock and the local model of --localFallback are sent no seed, so it is 0 for them.
+func requestSeed(provider string) int64 {
+	if provider == "bedrock" || provider == "local" {
+		return 0
+	}
+	return viper.GetInt64("seed")
+}
+
+// Function to choose a random seed for the requests of this run when replies are saved to the history
+// and no --seed is given, so that every saved reply can be reproduced with `sgpt replay --exact`
+func chooseSeed() {
+	if viper.GetInt64("seed") != 0 || !savesHistory() || viper.GetString("provider") == "bedrock" {
+		return
+	}
+	var b [4]byte
+	rand.Read(b[:])
+	seed := int64(binary.BigEndian.Uint32(b[:])>>1) + 1 // Positive and within 32 bits, which every API accepts
+	viper.Set("seed", seed)
+	debugf("seed %d", seed)
+}
+
+// Function to handle `sgpt replay <id|last>`, which sends the prompt of a saved reply to its model
+// again. With --exact the reply's temperature, sampling parameters and seed are reused as well, to
+// reproduce it as closely as the provider allows; the reply is then compared with the saved one,
+// and a change of the provider's system fingerprint, which can change replies, is reported.
+func runReplay(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sgpt replay <id|last> [--exact]")
+	}
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+	i, err := historyIndex(entries, args[0])
+	if err != nil {
+		return err
+	}
+	entry := entries[i]
+	if entry.Provider == "local" {
+		return fmt.Errorf("history entry %s was answered by the local model of --localFallback, which can't be replayed", entry.ID)
+	}
+
+	viper.Set("provider", entry.Provider)
+	viper.Set("model", entry.Model)
+	exact := viper.GetBool("exact")
+	if exact {
+		if entry.Seed == 0 {
+			return fmt.Errorf("history entry %s was saved without a seed, so it can't be replayed exactly", entry.ID)
+		}
+		viper.Set("temperature", entry.Temperature)
+		viper.Set("topP", entry.TopP)
+		viper.Set("topK", entry.TopK)
+		viper.Set("frequencyPenalty", entry.FrequencyPenalty)
+		viper.Set("presencePenalty", entry.PresencePenalty)
+		viper.Set("stop", entry.Stop)
+		viper.Set("seed", entry.Seed)
+	}
+	loadKeyringKey(entry.Provider)
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	ctx, info := withReplyInfo(rootCtx)
+	reply, err := callProvider(ctx, providerAPIKey(entry.Provider), entry.Model, entry.Instruction, entry.Input, viper.GetFloat64("temperature"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(reply)
+	if !exact {
+		return nil
+	}
+
+	if fingerprint := info.systemFingerprint(); fingerprint != "" && entry.SystemFingerprint != "" && fingerprint != entry.SystemFingerprint {
+		fmt.Fprintf(os.Stderr, "The provider's system fingerprint changed from %s to %s, so the reply may differ.\n", entry.SystemFingerprint, fingerprint)
+	}
+	if reply == entry.Reply {
+		fmt.Fprintln(os.Stderr, "The reply is identical to the saved one.")
+	} else {
+		fmt.Fprintln(os.Stderr, "The reply differs from the saved one.")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"log"
+	"sgpt/pkg/provider/openaicompat"
+	"strings"
+)
+
+// Sent after the partial reply when a broken stream is resumed
+const resumeInstruction = "Your previous reply was cut off by a network error where it ends above. " +
+	"Continue it from exactly that point: do not repeat any of it, and do not add a preamble or acknowledge the interruption."
+
+// Times a broken stream is resumed before giving up
+const maxStreamResumes = 3
+
+// Bytes of a continuation held back until it can be checked for text repeating the end of the partial reply
+const resumeOverlap = 64
+
+// Shortest repetition that is cut off; shorter ones are as likely to be the continuation of a word
+const minResumeOverlap = 8
+
+// Function to continue a streamed reply that broke off with err after the text in partial. The request
+// is sent again with the partial reply as the assistant's turn and a request to continue, and the
+// continuation is streamed on after the text already shown. Text the model repeats from the end of
+// the partial reply is dropped.
+func resumeStream(ctx context.Context, model, instruction, input string, temperature float64, partial string, err error, onText func(string)) (string, error) {
+	provider := viper.GetString("provider")
+	if provider == "bedrock" || viper.GetString("jsonSchema") != "" {
+		return partial, err // A JSON document can't be continued in a new structured reply
+	}
+
+	client, clientErr := chatClient(provider)
+	if clientErr != nil {
+		return partial, err
+	}
+	for attempt := 1; attempt <= maxStreamResumes; attempt++ {
+		log.Printf("warning: the reply stream broke off (%v), resuming (%d/%d)", err, attempt, maxStreamResumes)
+		request := openaicompat.Request{
+			Model:       model,
+			System:      instruction,
+			Input:       input,
+			Temperature: temperature,
+			MaxTokens:   maxReplyTokens(model, instruction, input+partial+resumeInstruction),
+			Sampling:    samplingOptions(),
+			ServiceTier: serviceTier(provider),
+			History: []openaicompat.Message{
+				{Role: "assistant", Content: partial},
+				{Role: "user", Content: resumeInstruction},
+			},
+		}
+
+		splice := &continuation{partial: partial, onText: onText}
+		debugf("POST %s model=%s stream=true resume=%d", client.Endpoint(), model, attempt)
+		var response *openaicompat.Response
+		response, err = client.Stream(ctx, request, splice.add)
+		if response != nil {
+			recordUsage(ctx, provider, model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+			noteReply(ctx, provider, model, response.Model, response.FinishReason, response.SystemFingerprint, response.Raw)
+		}
+		partial += splice.flush()
+		if err == nil || ctx.Err() != nil {
+			return strings.TrimSpace(partial), err
+		}
+	}
+	return partial, fmt.Errorf("the reply stream broke off %d times: %w", maxStreamResumes+1, err)
+}
+
+// continuation passes on the streamed text of a resumed reply, holding back its start until the text
+// the model repeated from the end of the partial reply can be cut off
+type continuation struct {
+	partial string
+	onText  func(string)
+	held    strings.Builder
+	text    strings.Builder // Text passed on so far
+	started bool
+}
+
+// add receives a piece of the continuation
+func (c *continuation) add(piece string) {
+	if c.started {
+		c.emit(piece)
+		return
+	}
+	c.held.WriteString(piece)
+	if c.held.Len() >= resumeOverlap {
+		c.flush()
+	}
+}
+
+// flush passes on the held back text without the overlap, and returns the continuation so far
+func (c *continuation) flush() string {
+	if !c.started {
+		c.started = true
+		held := c.held.String()
+		c.emit(held[overlap(c.partial, held):])
+	}
+	return c.text.String()
+}
+
+func (c *continuation) emit(piece string) {
+	c.text.WriteString(piece)
+	if c.onText != nil && piece != "" {
+		c.onText(piece)
+	}
+}
+
+// Function to return the length of the longest prefix of next that repeats the end of text
+func overlap(text, next string) int {
+	for n := len(next); n >= minResumeOverlap; n-- {
+		if strings.HasSuffix(text, next[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"net/http"
+	"sgpt/pkg/httpclient"
+	"sgpt/pkg/provider/bedrock"
+	"sgpt/pkg/provider/openaicompat"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serveRequest is a chat completions request as OpenAI-compatible tools send it to `sgpt serve`
+type serveRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Temperature      *float64        `json:"temperature"`
+	MaxTokens        int             `json:"max_tokens"`
+	TopP             float64         `json:"top_p"`
+	FrequencyPenalty float64         `json:"frequency_penalty"`
+	PresencePenalty  float64         `json:"presence_penalty"`
+	Stop             json.RawMessage `json:"stop"`
+	Seed             int64           `json:"seed"`
+	Stream           bool            `json:"stream"`
+	Tools            json.RawMessage `json:"tools"`
+}
+
+// serveMessage is a message of a chat completion sent back by `sgpt serve`
+type serveMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// Function to handle `sgpt serve`, which offers the OpenAI chat completions API on --listen and
+// answers each request through the provider of its model, so that any tool that speaks the OpenAI
+// API can use the providers, profiles and keys configured for sgpt.
+func runServe(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: sgpt serve [--listen address] [--serveToken token] [--tlsCert file --tlsKey file]")
+	}
+	if err := validateConfig(); err != nil {
+		return err
+	}
+	listen, token := viper.GetString("listen"), viper.GetString("serveToken")
+	tlsConfig, local, err := listenTLS("listen", listen, "127.0.0.1:8080")
+	if err != nil {
+		return err
+	}
+	if !local && token == "" {
+		return fmt.Errorf("--listen %s accepts requests from other machines, which would use your API keys; set --serveToken to require it as their API key", listen)
+	}
+	for _, provider := range providers {
+		loadKeyringKey(provider) // Before requests are served concurrently
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", serveChat)
+	mux.HandleFunc("/v1/models", serveModels)
+	handler := http.Handler(mux)
+	if token != "" {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				serveError(w, http.StatusUnauthorized, "invalid API key, give the --serveToken of sgpt serve")
+				return
+			}
+			mux.ServeHTTP(w, r)
+		})
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	log.Printf("serving the OpenAI API at %s://%s/v1 with %s/%s as the default model", scheme, listen, viper.GetString("provider"), viper.GetString("model"))
+	server := &http.Server{Addr: listen, Handler: handler, TLSConfig: tlsConfig}
+	go func() {
+		<-rootCtx.Done()
+		server.Shutdown(context.Background()) // Let the requests being answered finish
+	}()
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Function to check the address a server listens on, given with --flag, and load the certificate of
+// --tlsCert and --tlsKey. It returns the TLS configuration, nil without a certificate, and whether
+// only this machine can connect. Other machines can only connect over TLS, since the token and the
+// requests, which are paid with your API keys, would otherwise cross the network in the clear.
+func listenTLS(flag, listen, example string) (*tls.Config, bool, error) {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return nil, false, fmt.Errorf("--%s %q is not an address such as %s", flag, listen, example)
+	}
+	local := httpclient.IsLocalHost(host)
+	certFile, keyFile := viper.GetString("tlsCert"), viper.GetString("tlsKey")
+	if (certFile == "") != (keyFile == "") {
+		return nil, local, fmt.Errorf("--tlsCert and --tlsKey must be given together")
+	}
+	if certFile == "" {
+		if !local {
+			return nil, local, fmt.Errorf("--%s %s accepts connections from other machines, which would send the token and requests unencrypted; set --tlsCert and --tlsKey to serve over TLS", flag, listen)
+		}
+		return nil, local, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, local, fmt.Errorf("--tlsCert and --tlsKey: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, local, nil
+}
+
+// Largest request body sgpt serve accepts, and largest message sgpt grpc receives
+const serveMaxRequest = 10 << 20
+
+// Function to answer a chat completions request through the provider of its model
+func serveChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		serveError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var req serveRequest
+	r.Body = http.MaxBytesReader(w, r.Body, serveMaxRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		serveError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	if len(req.Tools) > 0 && string(req.Tools) != "null" {
+		serveError(w, http.StatusBadRequest, "tools are not supported by sgpt serve")
+		return
+	}
+
+	provider, model := serveModel(req.Model)
+	if err := serveProviderAllowed(provider); err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	system, turns, err := serveConversation(req)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	temperature := viper.GetFloat64("temperature")
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+	var stop []string
+	if len(req.Stop) > 0 && json.Unmarshal(req.Stop, &stop) != nil {
+		var one string
+		if json.Unmarshal(req.Stop, &one) != nil {
+			serveError(w, http.StatusBadRequest, "stop must be a string or a list of strings")
+			return
+		}
+		stop = []string{one}
+	}
+	debugf("serve: %d messages for %s/%s stream=%t", len(turns), provider, model, req.Stream)
+
+	id := "chatcmpl-sgpt-" + randomHex(12)
+	created := time.Now().Unix()
+	if provider == "bedrock" {
+		request := bedrock.Request{Model: model, System: system, Input: turns[0].Content, Temperature: temperature,
+			MaxTokens: req.MaxTokens, TopP: req.TopP, Stop: stop}
+		for _, turn := range turns[1:] {
+			request.History = append(request.History, bedrock.Turn{Role: turn.Role, Text: turn.Content})
+		}
+		response, err := newBedrockClient().ConverseContext(r.Context(), request)
+		if err != nil {
+			serveError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		recordUsage(r.Context(), provider, model, response.InputTokens, response.OutputTokens)
+		usage := openaicompat.Usage{PromptTokens: response.InputTokens, CompletionTokens: response.OutputTokens}
+		finish := bedrockFinishReason(response.StopReason)
+		if req.Stream {
+			// Bedrock replies are not streamed; send the whole reply as one event
+			stream := newServeStream(w, id, model, created)
+			stream.send(serveMessage{Role: "assistant", Content: response.Text}, "")
+			stream.send(serveMessage{}, finish)
+			stream.done()
+			return
+		}
+		serveCompletion(w, id, model, created, response.Text, finish, usage)
+		return
+	}
+
+	request := openaicompat.Request{
+		Model:       model,
+		System:      system,
+		Input:       turns[0].Content,
+		History:     turns[1:],
+		Temperature: temperature,
+		MaxTokens:   req.MaxTokens,
+		Sampling: openaicompat.Sampling{TopP: req.TopP, FrequencyPenalty: req.FrequencyPenalty,
+			PresencePenalty: req.PresencePenalty, Stop: stop, Seed: req.Seed},
+		ServiceTier: serviceTier(provider),
+	}
+	client, err := chatClient(provider)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !req.Stream {
+		response, err := client.CompleteContext(r.Context(), request)
+		if err != nil {
+			serveError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		recordUsage(r.Context(), provider, model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+		if response.Model != "" {
+			model = response.Model
+		}
+		serveCompletion(w, id, model, created, response.Text, response.FinishReason, response.Usage)
+		return
+	}
+
+	var stream *serveStream
+	response, err := client.Stream(r.Context(), request, func(text string) {
+		if stream == nil {
+			stream = newServeStream(w, id, model, created)
+			stream.send(serveMessage{Role: "assistant"}, "")
+		}
+		stream.send(serveMessage{Content: text}, "")
+	})
+	if response != nil {
+		recordUsage(r.Context(), provider, model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	}
+	if stream == nil {
+		// Nothing was sent yet, so the failure can still be reported with a status
+		if err == nil {
+			err = fmt.Errorf("%s: empty reply", provider)
+		}
+		serveError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("serve: the stream from %s/%s broke off: %v", provider, model, err)
+		return // Ending without [DONE] tells the client the reply is incomplete
+	}
+	stream.send(serveMessage{}, response.FinishReason)
+	stream.done()
+}
+
+// Function to choose the provider and model that answer a request for model. A provider/model name
+// or a model of the catalog selects its provider, other names are sent to the configured provider as
+// they are, and requests naming no model go to the configured model.
+func serveModel(name string) (string, string) {
+	if name == "" {
+		return viper.GetString("provider"), viper.GetString("model")
+	}
+	if i := strings.Index(name, "/"); i > 0 && isProvider(name[:i]) {
+		return name[:i], name[i+1:]
+	}
+	if caps, ok := modelCapabilities[name]; ok && isProvider(caps.Provider) {
+		return caps.Provider, name
+	}
+	return viper.GetString("provider"), name
+}
+
+// Function to check that clients may have a provider answer: one listed in --serveProviders, or
+// without the list the configured provider and those with an API key of their own. Other providers
+// would be paid with keys, or AWS credentials, that were not meant for them.
+func serveProviderAllowed(provider string) error {
+	if allowed := viper.GetStringSlice("serveProviders"); len(allowed) > 0 {
+		for _, p := range allowed {
+			if p == provider {
+				return checkProviderKey(provider)
+			}
+		}
+		return fmt.Errorf("provider %s is not one of --serveProviders %s", provider, strings.Join(allowed, ","))
+	}
+	if provider == viper.GetString("provider") || viper.GetString(provider+".apiKey") != "" {
+		return checkProviderKey(provider)
+	}
+	return fmt.Errorf("no API key configured for %s, add %s.apiKey to the config file or list it in --serveProviders", provider, provider)
+}
+
+// Function to split the messages of a request into the system instruction and the turns of the
+// conversation, which must start with the user. Text parts of multi-part contents are joined.
+func serveConversation(req serveRequest) (string, []openaicompat.Message, error) {
+	var messages []openaicompat.Message
+	for i, m := range req.Messages {
+		content, err := serveContent(m.Content)
+		if err != nil {
+			return "", nil, fmt.Errorf("message %d: %v", i+1, err)
+		}
+		messages = append(messages, openaicompat.Message{Role: m.Role, Content: content})
+	}
+	return splitConversation(messages)
+}
+
+// Function to set the system and developer messages of a conversation apart from its turns, which
+// must start with the user, returning the system instruction and the turns
+func splitConversation(messages []openaicompat.Message) (string, []openaicompat.Message, error) {
+	var system []string
+	var turns []openaicompat.Message
+	for i, m := range messages {
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, m.Content)
+		case "user", "assistant":
+			if len(turns) == 0 && m.Role != "user" {
+				return "", nil, fmt.Errorf("message %d: the conversation must start with a user message", i+1)
+			}
+			turns = append(turns, m)
+		default:
+			return "", nil, fmt.Errorf("message %d: the role %q is not supported", i+1, m.Role)
+		}
+	}
+	if len(turns) == 0 {
+		return "", nil, fmt.Errorf("messages must hold a user message")
+	}
+	return strings.Join(system, "\n\n"), turns, nil
+}
+
+// Function to return the text of a message content, given as a string or a list of parts
+func serveContent(raw json.RawMessage) (string, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("content must be a string or a list of parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("%s content is not supported by sgpt serve, only text", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// Function to send a whole chat completion
+func serveCompletion(w http.ResponseWriter, id, model string, created int64, text, finishReason string, usage openaicompat.Usage) {
+	type choice struct {
+		Index        int          `json:"index"`
+		Message      serveMessage `json:"message"`
+		FinishReason string       `json:"finish_reason"`
+	}
+	serveJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   model,
+		"choices": []choice{{Message: serveMessage{Role: "assistant", Content: text}, FinishReason: finishReason}},
+		"usage": map[string]int{
+			"prompt_tokens":     usage.PromptTokens,
+			"completion_tokens": usage.CompletionTokens,
+			"total_tokens":      usage.PromptTokens + usage.CompletionTokens,
+		},
+	})
+}
+
+// serveStream writes a streamed chat completion as server-sent events
+type serveStream struct {
+	w       http.ResponseWriter
+	id      string
+	model   string
+	created int64
+}
+
+// Function to start a streamed chat completion
+func newServeStream(w http.ResponseWriter, id, model string, created int64) *serveStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	return &serveStream{w: w, id: id, model: model, created: created}
+}
+
+// Function to send a delta of the reply, with the finish reason in the last one
+func (s *serveStream) send(delta serveMessage, finishReason string) {
+	type choice struct {
+		Index        int          `json:"index"`
+		Delta        serveMessage `json:"delta"`
+		FinishReason *string      `json:"finish_reason"`
+	}
+	c := choice{Delta: delta}
+	if finishReason != "" {
+		c.FinishReason = &finishReason
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []choice{c},
+	})
+	fmt.Fprintf(s.w, "data: %s\n\n", data)
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Function to end a streamed chat completion
+func (s *serveStream) done() {
+	fmt.Fprint(s.w, "data: [DONE]\n\n")
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Function to list the models sgpt knows, named provider/model so that requests for them are routed
+// to their provider
+func serveModels(w http.ResponseWriter, r *http.Request) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		OwnedBy string `json:"owned_by"`
+	}
+	var models []model
+	for name, caps := range modelCapabilities {
+		if isProvider(caps.Provider) && caps.Endpoint != transcriptionsURL && serveProviderAllowed(caps.Provider) == nil {
+			models = append(models, model{ID: caps.Provider + "/" + name, Object: "model", OwnedBy: caps.Provider})
+		}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	serveJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": models})
+}
+
+// Function to map a Bedrock stop reason to the finish reasons of the OpenAI API
+func bedrockFinishReason(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return "length"
+	case "content_filtered", "guardrail_intervened":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// Function to send an error in the shape of OpenAI API errors
+func serveError(w http.ResponseWriter, status int, message string) {
+	serveJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"message": message, "type": "sgpt_serve_error"},
+	})
+}
+
+// Function to send a JSON response
+func serveJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// Function to return n random bytes as hex, for IDs
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sgpt/pkg/rpc"
+)
+
+// Function to write a self-signed certificate and its key for localhost into dir
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// Addresses beyond this machine are only served over TLS
+func TestListenTLS(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+	defer viper.Set("tlsCert", "")
+	defer viper.Set("tlsKey", "")
+	tests := []struct {
+		listen, cert, key string
+		ok, tls, local    bool
+	}{
+		{"127.0.0.1:8080", "", "", true, false, true},
+		{"localhost:8080", certFile, keyFile, true, true, true},
+		{"0.0.0.0:8080", "", "", false, false, false},
+		{"0.0.0.0:8080", certFile, keyFile, true, true, false},
+		{"0.0.0.0:8080", certFile, "", false, false, false},
+		{"0.0.0.0:8080", certFile, certFile, false, false, false},
+		{"8080", "", "", false, false, false},
+	}
+	for _, tt := range tests {
+		viper.Set("tlsCert", tt.cert)
+		viper.Set("tlsKey", tt.key)
+		config, local, err := listenTLS("listen", tt.listen, "127.0.0.1:8080")
+		if (err == nil) != tt.ok || (config != nil) != tt.tls || (err == nil && local != tt.local) {
+			t.Errorf("listenTLS(%q) with certificate %q and key %q = %v, %v, %v", tt.listen, tt.cert, tt.key, config != nil, local, err)
+		}
+	}
+}
+
+// Requests are only routed to providers the key is meant for, and bodies are limited in size
+func TestServeChatProviders(t *testing.T) {
+	viper.Set("provider", "openai")
+	viper.Set("apiKey", "sk-openai")
+	defer viper.Set("provider", "")
+	defer viper.Set("apiKey", "")
+	defer func(provider string) { apiKeyProvider = provider }(apiKeyProvider)
+	apiKeyProvider = "openai"
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		serveChat(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		return w
+	}
+	request := `{"model": "%s", "messages": [{"role": "user", "content": "hi"}]}`
+	for _, model := range []string{"mistral/mistral-small-latest", "groq/llama-3.1-8b-instant", "bedrock/anthropic.claude-3-haiku"} {
+		if w := post(strings.Replace(request, "%s", model, 1)); w.Code != http.StatusBadRequest || strings.Contains(w.Body.String(), "sk-openai") {
+			t.Errorf("%s: status %d, %s", model, w.Code, w.Body)
+		}
+	}
+
+	viper.Set("serveProviders", []string{"groq"})
+	defer viper.Set("serveProviders", nil)
+	if err := serveProviderAllowed("openai"); err == nil {
+		t.Error("--serveProviders groq allows openai")
+	}
+	if err := serveProviderAllowed("groq"); err == nil || err.Error() != "no API key configured for groq" {
+		t.Errorf("serveProviderAllowed(groq) without a key = %v", err)
+	}
+	viper.Set("groq.apiKey", "gsk-groq")
+	defer viper.Set("groq.apiKey", "")
+	if err := serveProviderAllowed("groq"); err != nil {
+		t.Errorf("serveProviderAllowed(groq) = %v", err)
+	}
+
+	if w := post(`{"messages": [{"role": "user", "content": "` + strings.Repeat("x", serveMaxRequest) + `"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("oversized request: status %d", w.Code)
+	}
+}
+
+// Calls of sgpt grpc are routed to the same providers as requests to sgpt serve
+func TestGRPCCallProviders(t *testing.T) {
+	viper.Set("provider", "openai")
+	viper.Set("apiKey", "sk-openai")
+	defer viper.Set("provider", "")
+	defer viper.Set("apiKey", "")
+	messages := []*rpc.Message{{Role: "user", Content: "hi"}}
+
+	_, err := newGRPCCall(&rpc.Request{Model: "mistral/mistral-small-latest", Messages: messages})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("call for mistral without its key: %v", err)
+	}
+	if _, err := newGRPCCall(&rpc.Request{Model: "openai/gpt-4o", Messages: messages}); err != nil {
+		t.Errorf("call for the configured provider: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sgpt/pkg/i18n"
+	"sgpt/pkg/keyring"
+	"strconv"
+	"strings"
+)
+
+// Keyring service under which `sgpt setup` stores API keys, with the provider as the account
+const keyringService = "sgpt"
+
+// Model suggested by `sgpt setup` for each provider
+var setupDefaultModels = map[string]string{
+	"openai":     "gpt-4o-mini",
+	"bedrock":    "anthropic.claude-3-haiku-20240307-v1:0",
+	"mistral":    "mistral-small-latest",
+	"openrouter": "openai/gpt-4o-mini",
+	"groq":       "llama-3.1-8b-instant",
+}
+
+// Environment variable each provider's API key can also be given in
+var providerKeyEnv = map[string]string{
+	"openai":     "SGPT_API_KEY",
+	"mistral":    "MISTRAL_API_KEY",
+	"openrouter": "OPENROUTER_API_KEY",
+	"groq":       "GROQ_API_KEY",
+}
+
+// Function to tell whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Function to return the config key holding a provider's API key
+func apiKeyConfigKey(provider string) string {
+	if provider == "openai" {
+		return "apiKey"
+	}
+	return provider + ".apiKey"
+}
+
+// Function to fall back to the API key `sgpt setup` stored in the keyring when none is configured
+func loadKeyringKey(provider string) {
+	if provider == "bedrock" || providerAPIKey(provider) != "" {
+		return
+	}
+	if key, err := keyring.Get(keyringService, provider); err == nil {
+		if provider == apiKeyProvider {
+			viper.Set("apiKey", key)
+		} else {
+			viper.Set(provider+".apiKey", key)
+		}
+	}
+}
+
+// setupPrompter asks the questions of `sgpt setup` on the terminal
+type setupPrompter struct {
+	tty *os.File
+	in  *bufio.Reader
+}
+
+// Function to ask a question on stderr, returning the answer or def if the answer is empty
+func (p *setupPrompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", question)
+	}
+	answer, _ := p.in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def
+	}
+	return answer
+}
+
+// Function to ask a yes/no question
+func (p *setupPrompter) confirm(question string) bool {
+	return i18n.Yes(p.ask(question+" "+i18n.T("[y/N]"), ""))
+}
+
+// Function to ask for a secret without echoing it to the terminal
+func (p *setupPrompter) askSecret(question string) string {
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = p.tty
+		cmd.Run()
+	}
+	stty("-echo")
+	defer fmt.Fprintln(os.Stderr)
+	defer stty("echo")
+	return p.ask(question, "")
+}
+
+// Function to handle `sgpt setup`, which walks through choosing a provider, storing its API key,
+// picking a default model and sending a test request, then writes a commented config file
+func runSetup(args []string) error {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		tty = os.Stdin
+	} else {
+		defer tty.Close()
+	}
+	p := &setupPrompter{tty: tty, in: bufio.NewReader(tty)}
+
+	path := filepath.Join(os.Getenv("HOME"), ".sgpt.yaml")
+	if explicit := viper.GetString("config"); explicit != "" {
+		path = explicit
+	}
+	if len(args) > 0 {
+		path = args[0]
+	}
+	if _, err := os.Stat(path); err == nil && !p.confirm(i18n.Sprintf("%s already exists. Overwrite it?", path)) {
+		return i18n.Errorf("setup cancelled, %s left unchanged", path)
+	}
+
+	fmt.Fprintln(os.Stderr, i18n.T("Setting up sgpt. Press Enter to accept the suggested value in brackets."))
+	for i, name := range providers {
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, name)
+	}
+	provider := p.ask(i18n.T("Provider"), "openai")
+	if n, err := strconv.Atoi(provider); err == nil && n >= 1 && n <= len(providers) {
+		provider = providers[n-1]
+	}
+	if !isProvider(provider) {
+		return i18n.Errorf("unsupported provider %q, supported providers are %s", provider, strings.Join(providers, ", "))
+	}
+	viper.Set("provider", provider)
+
+	settings := map[string]string{}
+	inKeyring := false
+	if provider == "bedrock" {
+		region := p.ask(i18n.T("AWS region"), viper.GetString("bedrock.region"))
+		viper.Set("bedrock.region", region)
+		settings["bedrock.region"] = region
+		fmt.Fprintln(os.Stderr, i18n.T("Bedrock uses the AWS credentials in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY."))
+	} else {
+		key := providerAPIKey(provider)
+		if key == "" {
+			key = p.askSecret(i18n.Sprintf("%s API key (input is hidden)", provider))
+		}
+		if key == "" {
+			return i18n.Errorf("no API key given, it can also be set in %s", providerKeyEnv[provider])
+		}
+		viper.Set(apiKeyConfigKey(provider), key)
+
+		if err := keyring.Set(keyringService, provider, key); err == nil {
+			inKeyring = true
+			fmt.Fprintln(os.Stderr, i18n.T("API key stored in the system keyring."))
+		} else {
+			debugf("keyring: %v", err)
+			settings[apiKeyConfigKey(provider)] = key
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("No system keyring available, the API key will be saved in %s.", path))
+		}
+	}
+
+	if providerListsModels(provider) {
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("Models: %s", strings.Join(supportedModels(provider), ", ")))
+	}
+	model := p.ask(i18n.T("Default model"), setupDefaultModels[provider])
+	viper.Set("model", model)
+
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, i18n.T("Sending a test request..."))
+	reply, err := callProvider(rootCtx, providerAPIKey(provider), model, "Reply with the single word OK.", "ping", 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("Test request failed: %v", err))
+		if !p.confirm(i18n.T("Save the configuration anyway?")) {
+			return i18n.Errorf("setup cancelled")
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("%s replied: %s", model, reply))
+	}
+
+	if err := os.WriteFile(path, []byte(setupConfigFile(provider, model, settings, inKeyring)), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, i18n.Sprintf("Configuration written to %s", path))
+	return nil
+}
+
+// Function to render the config file written by `sgpt setup`
+func setupConfigFile(provider, model string, settings map[string]string, inKeyring bool) string {
+	var b strings.Builder
+	b.WriteString("# sgpt configuration written by `sgpt setup`.\n")
+	b.WriteString("# Command line flags and SGPT_* environment variables take precedence over these values.\n\n")
+
+	fmt.Fprintf(&b, "# Provider serving requests (%s)\n", strings.Join(providers, ", "))
+	fmt.Fprintf(&b, "provider: %s\n\n", provider)
+	b.WriteString("# Model used unless -m is given\n")
+	fmt.Fprintf(&b, "model: %q\n\n", model)
+
+	switch {
+	case provider == "bedrock":
+		b.WriteString("# AWS region of the Bedrock runtime\n")
+		fmt.Fprintf(&b, "bedrock:\n  region: %q\n\n", settings["bedrock.region"])
+	case inKeyring:
+		fmt.Fprintf(&b, "# The API key is stored in the system keyring (service %q, account %q).\n", keyringService, provider)
+		fmt.Fprintf(&b, "# It can also be set in %s.\n\n", providerKeyEnv[provider])
+	case provider == "openai":
+		fmt.Fprintf(&b, "# API key, which can also be set in %s\n", providerKeyEnv[provider])
+		fmt.Fprintf(&b, "apiKey: %q\n\n", settings["apiKey"])
+	default:
+		fmt.Fprintf(&b, "# API key, which can also be set in %s\n", providerKeyEnv[provider])
+		fmt.Fprintf(&b, "%s:\n  apiKey: %q\n\n", provider, settings[apiKeyConfigKey(provider)])
+	}
+
+	b.WriteString("# Default instruction and temperature\n")
+	b.WriteString("#instruction: \"Your instruction here\"\n")
+	b.WriteString("#temperature: 0.5\n")
+	return b.String()
+}
@@ -3,183 +3,1088 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"sgpt/pkg/i18n"
+	"sgpt/pkg/jsonschema"
+	"sgpt/pkg/logprofile"
+	"sgpt/pkg/pii"
+	"sgpt/pkg/provider/openaicompat"
 	"strings"
+	"time"
+	"unicode"
 )
 
 // OpenAIResponse structure to handle JSON response from OpenAI API
 type OpenAIResponse struct {
-	Choices []struct {
-		Text    string `json:"text,omitempty"`
-		Message struct {
-			Role    string `json:"role,omitempty"`
-			Content string `json:"content,omitempty"`
+	Model             string             `json:"model,omitempty"`
+	ServiceTier       string             `json:"service_tier,omitempty"`
+	SystemFingerprint string             `json:"system_fingerprint,omitempty"`
+	Usage             openaicompat.Usage `json:"usage"`
+	Choices           []struct {
+		FinishReason string `json:"finish_reason,omitempty"`
+		Text         string `json:"text,omitempty"`
+		Message      struct {
+			Role      string                      `json:"role,omitempty"`
+			Content   string                      `json:"content,omitempty"`
+			ToolCalls []openaicompat.WireToolCall `json:"tool_calls,omitempty"`
 		} `json:"message,omitempty"`
 	} `json:"choices"`
 }
 
+// OpenAI API endpoints
+const (
+	chatCompletionsURL = "https://api.openai.com/v1/chat/completions"
+	completionsURL     = "https://api.openai.com/v1/completions"
+	transcriptionsURL  = "https://api.openai.com/v1/audio/transcriptions"
+)
+
+// HTTP client shared by all API calls so that connections, including a pre-warmed one, are reused.
+// Its transport is set up from the timeout and proxy settings by configureHTTP.
+var httpClient = &http.Client{}
+
+// Settings that can be given in an SGPT_ environment variable, e.g. logFormat in SGPT_LOG_FORMAT
+var envSettings = []string{"apiKey", "provider", "model", "instruction", "temperature", "debug", "checkUpdate", "logFormat", "prewarm", "piiPolicy", "offline", "profile", "config", "replyLanguage", "saveHistory", "askRating", "localFallback", "separator", "locale"}
+
+// Function to return the SGPT_ environment variable of a setting
+func envVarName(key string) string {
+	var b strings.Builder
+	b.WriteString("SGPT_")
+	for i, r := range key {
+		switch {
+		case r == '.':
+			b.WriteByte('_')
+		case unicode.IsUpper(r) && i > 0:
+			b.WriteByte('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
 // Function to setup configuration using viper and pflag
 func setupConfig() {
-	viper.SetConfigName(".sgpt")           // Name of the configuration file without the extension
-	viper.SetConfigType("yaml")            // Extension of the configuration file
-	viper.AddConfigPath(".")               // First look for config in the working directory
-	viper.AddConfigPath(os.Getenv("HOME")) // Fallback to the home directory
+	viper.SetConfigType("yaml") // Config files are read as YAML once includes are resolved; see findConfigFile
 
 	// Setting up command line flags using Unix style single-character flags
+	pflag.String("config", "", "Config file to use instead of searching for one (YAML, TOML or JSON)")
+	pflag.String("profile", "", "Profile of the config file to use, e.g. work or local")
 	pflag.StringP("apiKey", "k", "", "API key for OpenAI")
+	pflag.StringP("provider", "p", "", "Provider serving the model ("+strings.Join(providers, ", ")+"), inferred from the model if not set")
 	pflag.StringP("model", "m", "", "Model to use for OpenAI API")
 	pflag.StringP("instruction", "i", "", "Instruction for OpenAI")
 	pflag.Float64P("temperature", "t", 0.5, "Temperature setting for the model")
+	pflag.String("serviceTier", "", "OpenAI processing tier: auto, default, flex (cheaper, slower) or priority")
+	pflag.Float64("topP", 0, "Sample only from the most likely tokens making up this probability mass (nucleus sampling)")
+	pflag.Int("topK", 0, "Sample only from this many most likely tokens (OpenRouter and Anthropic models on Bedrock)")
+	pflag.Float64("frequencyPenalty", 0, "Penalize tokens by how often they already appear in the reply, from -2 to 2")
+	pflag.Float64("presencePenalty", 0, "Penalize tokens that already appear in the reply, from -2 to 2")
+	pflag.StringArray("stop", nil, "Sequence that ends the reply, repeat for up to 4")
+	pflag.Int64("seed", 0, "Seed for sampling, so that the same request gets the same reply as far as the provider allows")
+	pflag.StringArray("image", nil, "Image file to attach to the request, - to read it from stdin (may be repeated)")
+	pflag.String("imageDetail", "auto", "Level of detail the model uses for images (low, high, auto)")
+	pflag.Int("imageMaxDim", 0, "Downscale images so their longest side is at most this many pixels")
+	pflag.String("audio", "", "Audio recording to transcribe with whisper-1; with other models the transcript is used as input")
+	pflag.Float64("audioSegment", 600, "Length in seconds of the segments long recordings are split into (requires ffmpeg)")
+	pflag.Float64("audioOverlap", 5, "Seconds of overlap between audio segments, removed again from the transcript")
+	pflag.String("language", "", "Language of the recording as an ISO-639-1 code, e.g. de, which improves transcription")
+	pflag.String("transcriptFormat", "text", "Output format of the transcribe command (text, srt, vtt, json)")
+	pflag.Bool("speak", false, "Speak the response aloud with OpenAI text-to-speech")
+	pflag.String("speechFile", "", "Save the speech of --speak or the tts command to this file instead of playing it")
+	pflag.String("voice", "alloy", "Voice used for speech (alloy, echo, fable, onyx, nova, shimmer)")
+	pflag.String("speechFormat", "mp3", "Audio format of speech (mp3, opus, aac, flac, wav, pcm)")
+	pflag.String("speechModel", "tts-1", "OpenAI model used for speech (tts-1, tts-1-hd)")
+	pflag.String("video", "", "Video to sample frames from and attach as images, with its soundtrack transcribed as input (requires ffmpeg)")
+	pflag.Float64("videoFrameRate", 0.2, "Frames per second sampled from --video")
+	pflag.Int("videoMaxFrames", 20, "Maximum number of frames sampled from --video")
+	pflag.String("toolSchema", "", "JSON file describing tools the model may call; tool calls are printed as JSON")
+	pflag.String("jsonSchema", "", "JSON schema file the reply must match; the reply is validated and retried if invalid")
+	pflag.Int("jsonRetries", 2, "Number of times to retry a reply that does not match --jsonSchema")
+	pflag.String("normalize", "", "Normalize values in --jsonSchema replies, e.g. dates=iso8601,numbers=decimal-point,locale=de")
+	pflag.Bool("normalizeOutput", false, "Make replies diff-friendly: ASCII quotes and dashes, no trailing whitespace or repeated blank lines")
+	pflag.StringArray("assert", nil, "Check the reply, e.g. regex:^[A-Z]{3}$, json-path:$.status or max-words:50 (may be repeated)")
+	pflag.Int("assertRetries", 2, "Number of times to retry a reply that fails an --assert check")
+	pflag.Int("candidates", 1, "Number of alternative replies to request and print")
+	pflag.String("candidatesFormat", "text", "How to print --candidates replies (text, json)")
+	pflag.Bool("shell", false, "Generate a shell command for the request and offer to execute or copy it")
+	pflag.Bool("strictShell", false, "With --shell, accept only a single command that passes a syntax check and refuse destructive ones")
+	pflag.String("locale", "", "Language of sgpt's prompts and messages, e.g. de, es or fr (default from LANG)")
+	pflag.BoolP("debug", "d", false, "Enable debug output")
+	pflag.Bool("version", false, "Print the version and exit")
+	pflag.Bool("checkUpdate", false, "Warn when a newer release of sgpt is available")
+	pflag.Bool("prewarm", false, "Open the connection to the API while input is still being read")
+	pflag.String("logFormat", "", "Pre-parse and compress log input ("+strings.Join(logprofile.Formats, ", ")+")")
+	pflag.Int("maxTokens", 0, "Most tokens the model may write in a reply (default: what the context window leaves, up to the model's limit)")
+	pflag.String("replyLanguage", "auto", "Language of the reply: auto for the language of the input, off, or a language such as German")
+	pflag.Float64("compress", 0, "Share of the input's words to remove, least informative first, before sending (0 to 0.9)")
+	pflag.String("piiPolicy", "", "Mask personal information before sending ("+strings.Join(pii.Policies, ", ")+"); names are only found after a title or Name:")
+	pflag.String("piiMap", "", "File to save the PII placeholder mapping to, or to read it from for pii-restore")
+	pflag.StringP("separator", "s", "", "Split stdin at this separator, e.g. \\n, and answer each chunk on its own")
+	pflag.Bool("follow", false, "Answer each line of stdin as soon as it arrives, e.g. from tail -f (with --separator, each chunk)")
+	pflag.Bool("chained", false, "Answer --separator chunks as the turns of one conversation, with the earlier chunks and answers as context")
+	pflag.Int("concurrency", 1, "Number of --separator chunks, or files of the digest command, answered at the same time; answers are printed in input order")
+	pflag.Bool("writeFiles", false, "Write the files of a reply with several code blocks labelled with file names, after confirmation")
+	pflag.String("out", ".", "Directory --writeFiles writes into")
+	pflag.Bool("perLine", false, "Send each line of stdin as its own request and print exactly one line for each")
+	pflag.Int("perLineBatch", 20, "Number of lines --perLine sends in one request")
+	pflag.Int("chunkSize", 12000, "Maximum characters of input sent in a single request by chunked commands")
+	pflag.String("question", "", "Question the synthesize command answers from the given files")
+	pflag.Int("depth", 3, "Deepest folder level the digest command reads below the directory, 0 for all")
+	pflag.StringArray("ignore", nil, "Files and folders the digest command leaves out, e.g. '*.lock' or testdata/ (may be repeated)")
+	pflag.Int("digestTokens", 4000, "Most tokens of each file the digest command reads")
+	pflag.String("workspace", "", "Workspace of agents the team command uses (default: researcher, coder and critic)")
+	pflag.StringSlice("verify", nil, "Built-in tools the model checks its work with: calc, go, python")
+	pflag.Bool("verifyUnsandboxed", false, "Run the code of --verify go and python with access to your files where bubblewrap isn't available to sandbox it")
+	pflag.StringSlice("mcp", nil, "MCP servers of the config file whose tools the model may call, e.g. files,search")
+	pflag.String("critique", "", "Check the answer against the input for unsupported claims, then annotate or regenerate it")
+	pflag.String("criticModel", "", "Model that checks answers with --critique, local for the --localFallback model (default: the configured model)")
+	pflag.Bool("raw", false, "Print the provider's response JSON as it came instead of the reply text; with --preview, the JSON of each stream event")
+	pflag.StringP("outputFile", "o", "", "Write the reply to this file as well as to stdout")
+	pflag.Bool("append", false, "Add to --outputFile instead of replacing it")
+	pflag.String("output", "text", "Output format of the reply: text, or json for an object with the model, finish reason, token usage, latency and raw response")
+	pflag.Bool("preview", false, "Show the reply on stderr as it streams in; stdout still receives only the complete reply")
+	pflag.String("draftModel", "", "Fast model that streams a draft into the --preview while the configured model writes the answer, or local")
+	pflag.Duration("deadline", 0, "Time after which a streamed reply is cut at a sentence end and marked partial, e.g. 10s")
+	pflag.Float64("streamRate", 0, "Show the --preview at this many characters per second, like a typewriter")
+	pflag.Bool("streamSmooth", false, "Even out bursts in the --preview instead of showing text as it arrives")
+	pflag.Bool("stream", false, "Stream replies even where the model list says the model can't")
+	pflag.Bool("noStream", false, "Never stream replies, requesting each reply whole")
+	pflag.Bool("streamResume", false, "Continue a streamed reply whose connection breaks off by asking the model to pick up where it stopped")
+	pflag.String("localFallback", "", "OpenAI-compatible local server, e.g. http://localhost:11434/v1, whose model answers when the provider fails")
+	pflag.String("localModel", defaultLocalModel, "Model of the --localFallback server")
+	pflag.Bool("offline", false, "Refuse every request that would leave this machine, for air-gapped use with a local server")
+	pflag.Duration("timeout", 0, "Time limit of each API request, including reading the reply (0 for none)")
+	pflag.Duration("connectTimeout", 10*time.Second, "Time limit for connecting to an API, including the TLS handshake")
+	pflag.Duration("idleTimeout", 90*time.Second, "How long idle connections are kept open for reuse")
+	pflag.String("proxy", "", "Proxy for API requests, e.g. http://proxy:3128 (default: HTTP_PROXY and HTTPS_PROXY)")
+	pflag.Float64("chaosErrorRate", 0, "Share of API requests to fail with an injected 503 response, from 0 to 1, for testing wrappers")
+	pflag.Duration("chaosLatency", 0, "Delay added to every API request, for testing wrappers")
+	pflag.Int64("chaosSeed", 1, "Seed of the sequence of injected failures")
+	for _, name := range []string{"chaosErrorRate", "chaosLatency", "chaosSeed"} {
+		pflag.CommandLine.MarkHidden(name) // For testing only, so kept out of --help
+	}
+	pflag.Bool("cache", false, "Answer repeated requests from the response cache instead of calling the API again")
+	pflag.Bool("noCache", false, "Always call the API instead of answering repeated requests from the response cache")
+	pflag.Duration("cacheTTL", 24*time.Hour, "How long cached responses are used for (0 keeps them forever)")
+	pflag.Duration("modelListTTL", 24*time.Hour, "How long model lists fetched by the models command and model discovery are used for")
+	pflag.String("catalogURL", "", "Where the model catalog of context windows and prices is refreshed from, e.g. "+catalogURL+" (default: the built-in one)")
+	pflag.String("cacheDir", "", "Directory of the response cache (default: the user cache directory)")
+	pflag.Bool("saveHistory", false, "Save each prompt and reply to the history, for rating and exporting as a fine-tuning dataset")
+	pflag.String("historyFile", "", "File the history is saved in (default: history.jsonl in the user config directory)")
+	pflag.StringArray("tag", nil, "Tag saved replies with this, or select history entries by it (may be repeated)")
+	pflag.String("since", "", "Select history entries from this date on, e.g. 2024-05-01")
+	pflag.String("until", "", "Select history entries up to this date")
+	pflag.Int("minRating", -1, "Select history entries rated at least this: 1 for good, 0 to leave out bad ones")
+	pflag.String("rate", "", "Rate the reply +1 (good) or -1 (bad) in the history, saving it there")
+	pflag.String("ratingComment", "", "Comment saved with the reply in the history, e.g. why it was rated so")
+	pflag.Bool("askRating", false, "Ask on the terminal for a rating and comment of each reply, saving it in the history")
+	pflag.String("datasetFormat", "openai-ft", "Format of `sgpt history export`: openai-ft or jsonl-chat")
+	pflag.Bool("exact", false, "Reuse the seed and sampling parameters of the saved reply with the replay command")
+	pflag.String("listen", "127.0.0.1:8080", "Address the serve command offers the OpenAI API on")
+	pflag.String("grpcListen", "127.0.0.1:50051", "Address the grpc command offers the gRPC service on")
+	pflag.String("serveToken", "", "API key clients of the serve and grpc commands must give, required when they listen beyond this machine")
+	pflag.String("tlsCert", "", "Certificate file (PEM) the serve and grpc commands offer TLS with, required when they listen beyond this machine")
+	pflag.String("tlsKey", "", "Private key file (PEM) of --tlsCert")
+	pflag.StringSlice("serveProviders", nil, "Comma separated providers clients of the serve and grpc commands may choose (default: the configured provider and those with an API key of their own)")
+	pflag.Bool("showCost", false, "Print the token usage and cost of each request to stderr")
+	pflag.Bool("trackUsage", true, "Record the token usage of each request for `sgpt usage`")
+	pflag.String("usageFile", "", "File the token usage is recorded in (default: usage.jsonl in the user config directory)")
+	pflag.String("baseURL", "", "Base URL of an OpenAI-compatible server to send requests to, e.g. http://localhost:8000/v1")
+	pflag.String("region", "", "Regional endpoint of the provider, for data residency: us or eu for OpenAI, an AWS region for Bedrock")
+	pflag.Bool("showTokens", false, "Print the token counts of each request to stderr")
+	pflag.String("tokenizerDir", "", "Directory of tokenizer rank files, downloaded on first use (default: the user cache directory)")
+	pflag.Int64("spoolThreshold", 64<<20, "Input size in bytes above which stdin is spooled to a temporary file and processed in chunkSize windows")
+	pflag.String("embeddingModel", "", "Model used by the embed command, defaults to the provider's embedding model")
+	pflag.String("embedFormat", "jsonl", "Output format of the embed command (jsonl, json)")
+	pflag.String("exportFormat", "toml", "Output format of the config export command (nix, toml, env)")
+	pflag.StringSlice("models", nil, "Comma separated models to compare with the bench command")
+	pflag.String("promptFile", "", "File holding the prompt sent by the bench command")
+	pflag.IntP("runs", "n", 5, "Number of requests per model made by the bench command")
+	pflag.String("repo", "", "GitHub repository (owner/name) for gh commands, defaults to the origin remote")
+	pflag.Bool("post", false, "Post the result back to GitHub as a comment")
+	pflag.Bool("create", false, "File the drafted ticket in the configured tracker")
+	pflag.String("tracker", "", "Issue tracker for the ticket command (jira or linear)")
+	pflag.String("namespace", "", "Kubernetes namespace for the k8s command")
+	pflag.String("resource", "", "Kubernetes resource to describe for the k8s command, e.g. pod/web-0")
+	pflag.Bool("apply", false, "Apply the manifest generated by the k8s command, or make the commit drafted by the commit command, after confirmation")
+	pflag.String("plan", "", "Terraform plan for the tfplan command, as a saved plan or `terraform show -json` output")
 
 	// Bind environment variables
-	viper.BindEnv("apiKey", "SGPT_API_KEY")
-	viper.BindEnv("model", "SGPT_MODEL")
-	viper.BindEnv("instruction", "SGPT_INSTRUCTION")
-	viper.BindEnv("temperature", "SGPT_TEMPERATURE")
+	for _, key := range envSettings {
+		viper.BindEnv(key, envVarName(key))
+	}
+	viper.BindEnv("githubToken", "SGPT_GITHUB_TOKEN", "GITHUB_TOKEN")
+	viper.BindEnv("jira.token", "SGPT_JIRA_TOKEN", "JIRA_API_TOKEN")
+	viper.BindEnv("linear.apiKey", "SGPT_LINEAR_API_KEY", "LINEAR_API_KEY")
+	viper.BindEnv("mistral.apiKey", "SGPT_MISTRAL_API_KEY", "MISTRAL_API_KEY")
+	viper.BindEnv("groq.apiKey", "SGPT_GROQ_API_KEY", "GROQ_API_KEY")
+	viper.BindEnv("openrouter.apiKey", "SGPT_OPENROUTER_API_KEY", "OPENROUTER_API_KEY")
+	viper.SetDefault("openrouter.referer", "https://github.com/pdfinn/sgpt")
+	viper.SetDefault("openrouter.title", "sgpt")
+	viper.BindEnv("baseURL", "SGPT_BASE_URL")
+	viper.BindEnv("openai.baseURL", "OPENAI_BASE_URL")
+	viper.BindEnv("bedrock.region", "SGPT_BEDROCK_REGION", "AWS_REGION", "AWS_DEFAULT_REGION")
+	viper.SetDefault("jira.issueType", "Bug")
 
 	// Parsing the flags
-	pflag.Parse()
+	parseFlags()
 	viper.BindPFlags(pflag.CommandLine)
+	configureLocale()
 
-	err := viper.ReadInConfig() // Find and read the config file
+	path, searched, err := findConfigFile()
 	if err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			log.Printf("Config file not found: %v", err) // Non-fatal error
-		} else {
-			log.Fatalf("Error reading config file: %v", err)
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	if path == "" {
+		log.Print(i18n.Sprintf("Config file not found in %s", strings.Join(searched, ", "))) // Non-fatal error
+		if profile := viper.GetString("profile"); profile != "" {
+			log.Fatalf("Profile %q not found: there is no config file", profile)
+		}
+		return
+	}
+	viper.SetConfigFile(path)
+
+	// Read the file with includes and ${ENV_VAR} references resolved
+	doc, err := loadConfigDoc(path)
+	if err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	data, err := doc.bytes()
+	if err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	if err := viper.ReadConfig(bytes.NewReader(data)); err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	registerModels(doc.root)
+	if err := applyProfile(); err != nil {
+		log.Fatal(err)
+	}
+	configureLocale() // The config file may set the locale
+
+	if pflag.Arg(0) != "config" {
+		if err := checkConfigFile(viper.ConfigFileUsed()); err != nil {
+			log.Printf("Warning: %v", err) // viper ignores unknown keys, so point out likely typos
 		}
 	}
 }
 
+// Function to select the language of prompts and messages from --locale or the environment
+func configureLocale() {
+	if err := i18n.Select(viper.GetString("locale")); err != nil {
+		log.Fatalf("--locale: %v", err)
+	}
+}
+
 // Function to handle API calls to OpenAI based on model
-func callOpenAI(apiKey, model, instruction, input string, temperature float64) (string, error) {
-	var url string
+func callOpenAI(ctx context.Context, apiKey, model, instruction, input string, temperature float64) (string, error) {
+	replies, err := callOpenAIChoices(ctx, apiKey, model, instruction, input, temperature, 1)
+	if err != nil {
+		return "", err
+	}
+	return replies[0], nil
+}
+
+// Function to call OpenAI asking for n alternative replies, of which it returns all that are not empty
+func callOpenAIChoices(ctx context.Context, apiKey, model, instruction, input string, temperature float64, n int) ([]string, error) {
+	req, err := newOpenAIRequest(ctx, apiKey, model, instruction, input, temperature, n, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response OpenAIResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+	recordUsage(ctx, "openai", model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	if viper.GetBool("raw") {
+		return []string{string(body)}, nil
+	}
+
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no choices returned from the API")
+	}
+	if response.ServiceTier != "" {
+		debugf("served by the %s tier", response.ServiceTier)
+	}
+	noteReply(ctx, "openai", model, response.Model, response.Choices[0].FinishReason, response.SystemFingerprint, body)
+
+	var replies []string
+	for _, choice := range response.Choices {
+		if calls := openaicompat.ToolCalls(choice.Message.ToolCalls); len(calls) > 0 {
+			reply, err := formatToolCalls(calls)
+			if err != nil {
+				return nil, err
+			}
+			replies = append(replies, reply)
+			continue
+		}
+		reply := strings.TrimSpace(choice.Text)
+		if choice.Message.Role == "assistant" {
+			reply = strings.TrimSpace(choice.Message.Content)
+		}
+		if reply != "" {
+			replies = append(replies, reply)
+		}
+	}
+
+	if len(replies) == 0 {
+		return nil, fmt.Errorf("no assistant message found in the API response")
+	}
+
+	return replies, nil
+}
+
+// Function to stream a reply from an OpenAI chat model, calling onText with each piece as it arrives.
+// When ctx ends first, the text received so far is returned with the context's error.
+func callOpenAIStream(ctx context.Context, apiKey, model, instruction, input string, temperature float64, onText func(string)) (string, error) {
+	if openAIEndpoint(model) != chatCompletionsURL {
+		return "", errStreamingUnsupported
+	}
+	req, err := newOpenAIRequest(ctx, apiKey, model, instruction, input, temperature, 1, true)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var response struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(body, &response) == nil && response.Error.Message != "" {
+			return "", fmt.Errorf("%s (%d)", response.Error.Message, resp.StatusCode)
+		}
+		return "", fmt.Errorf("OpenAI: %s", resp.Status)
+	}
+
+	reply, err := openaicompat.ReadStream(resp.Body, onText)
+	if reply.ServiceTier != "" {
+		debugf("served by the %s tier", reply.ServiceTier)
+	}
+	recordUsage(ctx, "openai", model, reply.Usage.PromptTokens, reply.Usage.CompletionTokens)
+	noteReply(ctx, "openai", model, reply.Model, reply.FinishReason, reply.SystemFingerprint, reply.Raw)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if viper.GetBool("raw") {
+		return string(reply.Raw), err
+	}
+	return reply.Text, err
+}
+
+// Function to build a request to OpenAI for model asking for n replies, streamed if stream is set
+func newOpenAIRequest(ctx context.Context, apiKey, model, instruction, input string, temperature float64, n int, stream bool) (*http.Request, error) {
 	var jsonData []byte
 	var err error
 
-	switch model {
-	case "gpt-4", "gpt-4-0314", "gpt-4-32k", "gpt-4-32k-0314", "gpt-3.5-turbo":
-		url = "https://api.openai.com/v1/chat/completions"
+	url := openAIEndpoint(model)
+	switch url {
+	case chatCompletionsURL:
 		// Prepare JSON data for GPT-4 models
-		messages := []map[string]string{
+		var content interface{}
+		content, err = chatContent(input)
+		if err != nil {
+			return nil, err
+		}
+		messages := []map[string]interface{}{
 			{"role": "system", "content": instruction},
-			{"role": "user", "content": input},
+			{"role": "user", "content": content},
 		}
-		jsonData, err = json.Marshal(map[string]interface{}{
+		payload := map[string]interface{}{
 			"model":       model,
 			"messages":    messages,
 			"temperature": temperature,
-			"max_tokens":  100,
-			"stop":        []string{"\n"},
-		})
+		}
+		if maxTokens := maxReplyTokens(model, instruction, input); maxTokens > 0 {
+			payload["max_tokens"] = maxTokens
+		}
+		addSampling(payload)
+		if tier := serviceTier("openai"); tier != "" {
+			payload["service_tier"] = tier
+		}
+		var tools []openaicompat.Tool
+		tools, err = loadTools()
+		if err != nil {
+			return nil, err
+		}
+		if len(tools) > 0 {
+			payload["tools"] = openaicompat.WireTools(tools)
+		}
+		var schema *jsonschema.Schema
+		schema, err = loadJSONSchema()
+		if err != nil {
+			return nil, err
+		}
+		if schema != nil {
+			payload["response_format"] = openaicompat.ResponseFormat(schema.Raw)
+		}
+		if n > 1 {
+			payload["n"] = n
+		}
+		if stream {
+			payload["stream"] = true
+			payload["stream_options"] = map[string]bool{"include_usage": true}
+		}
+		jsonData, err = json.Marshal(payload)
 
-	case "text-davinci-003", "text-davinci-002", "text-curie-001", "text-babbage-001", "text-ada-001":
-		url = "https://api.openai.com/v1/completions"
+	case completionsURL:
 		// Prepare JSON data for GPT-3 models
 		prompt := instruction + " " + input
-		jsonData, err = json.Marshal(map[string]interface{}{
+		payload := map[string]interface{}{
 			"model":       model,
 			"prompt":      prompt,
 			"temperature": temperature,
-			"max_tokens":  100,
-			"stop":        []string{"\n"},
-		})
+		}
+		if maxTokens := maxReplyTokens(model, "", prompt); maxTokens > 0 {
+			payload["max_tokens"] = maxTokens
+		}
+		addSampling(payload)
+		if n > 1 {
+			payload["n"] = n
+		}
+		jsonData, err = json.Marshal(payload)
 
-	case "whisper-1":
-		url = "https://api.openai.com/v1/audio/transcriptions"
+	case transcriptionsURL:
 	default:
-		return "", fmt.Errorf("unsupported model: %s", model)
+		return nil, fmt.Errorf("unsupported model: %s", model)
 	}
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	data := bytes.NewReader(jsonData)
-	req, err := http.NewRequest("POST", url, data)
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIURL(url), data)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
+	requestID := newRequestID()
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("X-Client-Request-Id", requestID)
+	debugf("POST %s model=%s request=%s", req.URL, model, requestID)
+	return req, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// Function to print alternative replies to w, separated by lines of dashes or as a JSON array
+func printCandidates(w io.Writer, replies []string) error {
+	if viper.GetString("candidatesFormat") == "json" {
+		return json.NewEncoder(w).Encode(replies)
+	}
+	_, err := fmt.Fprintln(w, strings.Join(replies, "\n---\n"))
+	return err
+}
+
+// Function to open and TLS-handshake a connection to the API host ahead of the actual request.
+// The connection is returned to httpClient's pool, where the request picks it up.
+func prewarm(url string) {
+	req, err := http.NewRequest("HEAD", url, nil)
 	if err != nil {
-		return "", err
+		return
 	}
-	defer resp.Body.Close()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return // The real request will report any connection problem
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// Function to read the request input from the remaining arguments, or from stdin if there are none
+func readInput(args []string) (string, error) {
+	if len(args) > 0 {
+		return strings.Join(args, " "), nil
+	}
+
+	var input strings.Builder
+	if _, err := io.Copy(&input, os.Stdin); err != nil {
+		return "", fmt.Errorf("Error reading input from stdin: %v", err)
+	}
+	return input.String(), nil
+}
+
+// Function to read stdin into memory up to limit bytes. Larger input is spooled to a temporary
+// file instead, which is returned positioned at the start; the caller must close and remove it.
+func spoolInput(limit int64) (string, *os.File, error) {
+	var input strings.Builder
+	n, err := io.Copy(&input, io.LimitReader(os.Stdin, limit+1))
 	if err != nil {
-		return "", err
+		return "", nil, fmt.Errorf("Error reading input from stdin: %v", err)
+	}
+	if n <= limit {
+		return input.String(), nil, nil
 	}
 
-	var response OpenAIResponse
-	err = json.Unmarshal(body, &response)
+	spool, err := os.CreateTemp("", "sgpt-input-*")
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	if _, err := io.WriteString(spool, input.String()); err == nil {
+		_, err = io.Copy(spool, os.Stdin)
 	}
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return "", nil, fmt.Errorf("Error spooling input to %s: %v", spool.Name(), err)
+	}
+	return "", spool, nil
+}
 
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("no choices returned from the API")
+// windowReader splits input too large to keep in memory into windows that are processed one at a time
+type windowReader struct {
+	r       *bufio.Reader
+	size    int
+	pending string
+}
+
+// Function to read the next window of about size bytes, ending on a line boundary where possible.
+// It returns io.EOF together with the last window.
+func (w *windowReader) next() (string, error) {
+	var window strings.Builder
+	window.WriteString(w.pending)
+	w.pending = ""
+
+	for window.Len() < w.size {
+		line, err := w.r.ReadString('\n')
+		if window.Len() > 0 && window.Len()+len(line) > w.size {
+			w.pending = line // Keep the line whole for the next window
+			return window.String(), nil
+		}
+		window.WriteString(line)
+		if err != nil {
+			return window.String(), err
+		}
+	}
+	return window.String(), nil
+}
+
+// Function to split input into chunks of at most size bytes, breaking on line boundaries where possible
+func chunkText(input string, size int) []string {
+	if size <= 0 {
+		return []string{input}
 	}
 
-	assistantMessage := ""
-	for _, choice := range response.Choices {
-		if choice.Message.Role == "assistant" {
-			assistantMessage = strings.TrimSpace(choice.Message.Content)
-			break
+	var chunks []string
+	for len(input) > size {
+		cut := strings.LastIndex(input[:size], "\n") + 1
+		if cut == 0 {
+			cut = size
 		}
-		if choice.Text != "" {
-			assistantMessage = strings.TrimSpace(choice.Text)
-			break
+		chunks = append(chunks, input[:cut])
+		input = input[cut:]
+	}
+	if input != "" {
+		chunks = append(chunks, input)
+	}
+	return chunks
+}
+
+// Function to run an instruction over input too large for one request by analysing
+// each chunk separately and then combining the partial results
+func callModelChunked(ctx context.Context, apiKey, model, instruction, input string, temperature float64) (string, error) {
+	// With a known context window, split only input that does not fit, into parts that do
+	size := viper.GetInt("chunkSize")
+	if modelCapabilities[model].ContextWindow > 0 {
+		size = inputBudget(model, instruction, input)
+	}
+	chunks := chunkText(input, size)
+	if len(chunks) <= 1 {
+		return callModelContext(ctx, apiKey, model, instruction, input, temperature)
+	}
+
+	var partials []string
+	for i, chunk := range chunks {
+		partInstruction := fmt.Sprintf("%s\n\nThis is part %d of %d of the input.", instruction, i+1, len(chunks))
+		partial, err := callModelContext(ctx, apiKey, model, partInstruction, chunk, temperature)
+		if err != nil {
+			return "", fmt.Errorf("chunk %d of %d: %w", i+1, len(chunks), err)
 		}
+		partials = append(partials, partial)
+	}
+
+	combineInstruction := instruction + "\n\nThe input was too large to process at once. " +
+		"Combine the following partial results into a single coherent answer."
+	return callModelContext(ctx, apiKey, model, combineInstruction, strings.Join(partials, "\n\n---\n\n"), temperature)
+}
+
+// Function to handle `sgpt pii-restore`, which re-identifies previously redacted text using a mapping file
+func runPIIRestore(args []string) error {
+	path := viper.GetString("piiMap")
+	if path == "" {
+		return fmt.Errorf("pii-restore requires --piiMap")
+	}
+
+	redactor, err := pii.Load(path)
+	if err != nil {
+		return err
+	}
+
+	input, err := readInput(args)
+	if err != nil {
+		return err
 	}
 
-	if assistantMessage == "" {
-		return "", fmt.Errorf("no assistant message found in the API response")
+	fmt.Print(redactor.Restore(input))
+	return nil
+}
+
+// Function to process spooled input one window of chunkSize bytes at a time
+// When interrupted it reports how much input was already answered, so the run can be resumed from
+// that point instead of starting over, and returns for the caller to remove the spool file.
+func processWindows(spool *os.File, process func(string) error) error {
+	var done int64 // Bytes of input whose answers have been printed
+	interrupted := func() error {
+		log.Printf("Interrupted after answering the first %d bytes of input; resume with `tail -c +%d <input> | sgpt ...`", done, done+1)
+		return rootCtx.Err()
 	}
 
-	return assistantMessage, nil
+	windows := &windowReader{r: bufio.NewReader(spool), size: viper.GetInt("chunkSize")}
+	for {
+		if rootCtx.Err() != nil {
+			return interrupted()
+		}
+		window, err := windows.next()
+		if strings.TrimSpace(window) != "" {
+			if err := process(window); err != nil {
+				if rootCtx.Err() != nil {
+					return interrupted()
+				}
+				return err
+			}
+		}
+		done += int64(len(window))
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading spooled input: %v", err)
+		}
+	}
+}
+
+// Subcommands selected by the first positional argument
+var commands = map[string]func(args []string) error{
+	"bench":       runBench,
+	"commit":      runCommit,
+	"config":      runConfig,
+	"digest":      runDigest,
+	"embed":       runEmbed,
+	"gh":          runGitHub,
+	"k8s":         runKubernetes,
+	"models":      runModels,
+	"grpc":        runGRPC,
+	"history":     runHistory,
+	"pii-restore": runPIIRestore,
+	"rate":        runRate,
+	"replay":      runReplay,
+	"serve":       runServe,
+	"setup":       runSetup,
+	"synthesize":  runSynthesize,
+	"team":        runTeam,
+	"tfplan":      runTerraformPlan,
+	"transcribe":  runTranscribe,
+	"tts":         runTTS,
+	"ticket":      runTicket,
+	"usage":       runUsage,
 }
 
 func main() {
 	setupConfig() // Set up configuration
+	if err := configureHTTP(); err != nil {
+		log.Fatal(err)
+	}
+	if viper.GetBool("version") {
+		fmt.Println(versionString())
+		return
+	}
+	debugf("%s", versionString())
+	applyCatalog()
+
+	args, err := resolveAliases(pflag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	resolveProvider()
+	apiKeyProvider = viper.GetString("provider")
+	loadKeyringKey(apiKeyProvider)
+	if viper.GetString("audio") != "" || viper.GetString("video") != "" || viper.GetBool("speak") {
+		loadKeyringKey("openai") // Recordings are transcribed and speech made by OpenAI whichever provider answers
+	}
+
+	handleInterrupts()
+	if viper.GetBool("checkUpdate") && !viper.GetBool("offline") {
+		checkForUpdate()
+	}
+
+	stdinAttached, err := readStdinAttachment()
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(args) > 0 {
+		if run, ok := commands[args[0]]; ok {
+			if err := run(args[1:]); err != nil {
+				fatal(err)
+			}
+			return
+		}
+	}
+
+	if err := validateConfig(); err != nil {
+		if viper.ConfigFileUsed() == "" {
+			// Nothing is configured yet: guide through the setup instead of just failing
+			if isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+				if err := runSetup(nil); err != nil {
+					fatal(err)
+				}
+				return
+			}
+			log.Fatalf("%v\n%s", err, i18n.T("Run `sgpt setup` to configure sgpt."))
+		}
+		fatal(err)
+	}
+
+	configureOutputFile()
+	chooseSeed()
 
 	// Fetch configurations from Viper
 	apiKey := viper.GetString("apiKey")
 	model := viper.GetString("model")
 	instruction := viper.GetString("instruction")
 	temperature := viper.GetFloat64("temperature")
+	if viper.GetBool("shell") {
+		instruction = shellModeInstruction(instruction)
+	}
+	if viper.GetBool("writeFiles") {
+		instruction += writeFilesInstruction
+	}
 
-	var input string
-	if pflag.NArg() > 0 {
-		// Process additional arguments as input
-		input = strings.Join(pflag.Args(), " ")
-	} else {
-		// Read from stdin if no arguments are provided
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			input += scanner.Text() + "\n"
+	if viper.GetBool("prewarm") {
+		go prewarm(providerEndpoint(model))
+	}
+
+	schema, err := loadJSONSchema()
+	if err != nil {
+		fatal(err)
+	}
+	assertions, err := loadAssertions()
+	if err != nil {
+		fatal(err)
+	}
+
+	// Mask personal information locally so only placeholders leave the machine
+	var redactor *pii.Redactor
+	if policy := viper.GetString("piiPolicy"); policy != "" {
+		var err error
+		redactor, err = pii.New(policy)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	// Function to send one piece of input to the model and print the answer to out
+	processTo := func(out io.Writer, input string) error {
+		var err error
+
+		// Ask for a reply in the language of the input; commands are written the same in any language
+		instruction := instruction
+		if !viper.GetBool("shell") {
+			instruction += replyLanguageInstruction(input)
+		}
+
+		// Compress repetitive log lines before they are sent to the model
+		if format := viper.GetString("logFormat"); format != "" {
+			input, err = logprofile.Compress(format, input)
+			if err != nil {
+				return err
+			}
+		}
+
+		if rate := viper.GetFloat64("compress"); rate > 0 {
+			input = compressInput(model, input, rate)
+		}
+
+		if redactor != nil {
+			input = redactor.Redact(input)
+			if path := viper.GetString("piiMap"); path != "" {
+				if err := redactor.Save(path); err != nil {
+					return fmt.Errorf("Error writing PII mapping file: %v", err)
+				}
+			}
+		}
+
+		// Split or truncate input that does not fit the model's context window
+		chunked := false
+		if budget := inputBudget(model, instruction, input); budget > 0 {
+			if schema != nil || viper.GetInt("candidates") > 1 || viper.GetBool("shell") || viper.GetBool("raw") {
+				log.Printf("warning: the input exceeds the context window of %s and is truncated to %d bytes", model, budget)
+				input = chunkText(input, budget)[0]
+			} else {
+				log.Printf("warning: the input exceeds the context window of %s and is processed in parts", model)
+				chunked = true
+			}
+		}
+
+		if n := viper.GetInt("candidates"); n > 1 {
+			replies, err := callModelCandidates(rootCtx, apiKey, model, instruction, input, temperature, n)
+			if err != nil {
+				return err
+			}
+			if redactor != nil {
+				for i := range replies {
+					replies[i] = redactor.Restore(replies[i])
+				}
+			}
+			if viper.GetBool("showTokens") {
+				showTokens(model, instruction, input, strings.Join(replies, "\n"))
+			}
+			return printCandidates(out, replies)
+		}
+
+		// Print the provider's response as it came, streamed with --preview or --stream
+		if viper.GetBool("raw") {
+			call := callModel
+			if viper.GetBool("preview") || viper.GetBool("stream") {
+				call = func(apiKey, model, instruction, input string, temperature float64) (string, error) {
+					return callModelStreamed(rootCtx, apiKey, model, instruction, input, temperature, nil)
+				}
+			}
+			response, err := call(apiKey, model, instruction, input, temperature)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(out, response)
+			return err
+		}
+
+		start := time.Now()
+		ctx, info := withReplyInfo(rootCtx) // Each window of spooled input is reported on its own
+		call := func(instruction string) (string, error) {
+			if schema != nil {
+				return callModelJSON(ctx, schema, apiKey, model, instruction, input, temperature)
+			}
+			if chunked {
+				return callModelChunked(ctx, apiKey, model, instruction, input, temperature)
+			}
+			if len(viper.GetStringSlice("verify")) > 0 || len(viper.GetStringSlice("mcp")) > 0 {
+				return callModelVerified(ctx, model, instruction, input, temperature)
+			}
+			// Show the reply on stderr as it streams in, printing only the complete reply to stdout
+			var onText func(string)
+			if viper.GetBool("preview") && isTerminal(os.Stderr) {
+				p := newPreview()
+				defer p.clear()
+				onText = p.add
+				if rate := viper.GetFloat64("streamRate"); rate > 0 || viper.GetBool("streamSmooth") {
+					paced := newPacer(p.add, rate)
+					defer paced.close()
+					onText = paced.add
+				}
+			}
+			if viper.GetString("draftModel") != "" && onText != nil {
+				return callModelSpeculative(ctx, apiKey, model, instruction, input, temperature, onText)
+			}
+			if deadline := viper.GetDuration("deadline"); deadline > 0 {
+				return callModelDeadline(ctx, apiKey, model, instruction, input, temperature, deadline, onText)
+			}
+			if onText != nil || viper.GetBool("streamResume") || viper.GetBool("stream") {
+				return callModelStreamed(ctx, apiKey, model, instruction, input, temperature, onText)
+			}
+			return callModelContext(ctx, apiKey, model, instruction, input, temperature)
+		}
+		message, err := callAsserted(assertions, instruction, call)
+		// Print what was received by the deadline, then fail to mark the output as partial
+		var partial *partialReply
+		if errors.As(err, &partial) && !viper.GetBool("shell") {
+			message, err = partial.text, nil
+		}
+		if err != nil {
+			return err
+		}
+		if viper.GetString("critique") != "" && partial == nil {
+			message, err = critiqueAnswer(ctx, input, message, func(note string) (string, error) {
+				return callAsserted(assertions, instruction+note, call)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if viper.GetBool("showTokens") {
+			showTokens(model, instruction, input, message)
+		}
+		historyID := recordHistory(viper.GetString("provider"), viper.GetString("model"), instruction, input, message, info.systemFingerprint())
+
+		if redactor != nil {
+			message = redactor.Restore(message)
+		}
+		if viper.GetBool("normalizeOutput") {
+			message = normalizeOutput(message)
+		}
+
+		if viper.GetBool("shell") {
+			if viper.GetBool("strictShell") {
+				message, err = checkShellContract(message, func(note string) (string, error) {
+					reply, err := callAsserted(assertions, instruction+note, call)
+					if redactor != nil {
+						reply = redactor.Restore(reply)
+					}
+					return reply, err
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return offerCommand(message)
+		}
+
+		if jsonOutput() {
+			if err := printJSONReply(out, message, info, time.Since(start)); err != nil {
+				return err
+			}
+		} else if _, err := fmt.Fprintln(out, message); err != nil { // Output only the message
+			return err
+		}
+		if err := askRating(historyID); err != nil {
+			return err
+		}
+		if viper.GetBool("writeFiles") && partial == nil {
+			if err := writeFiles(message); err != nil {
+				return err
+			}
 		}
-		if err := scanner.Err(); err != nil {
-			log.Fatalf("Error reading input from stdin: %v", err)
+		if partial != nil {
+			return partial
 		}
+		if viper.GetBool("speak") {
+			return speak(message)
+		}
+		return nil
 	}
 
-	message, err := callOpenAI(apiKey, model, instruction, input, temperature)
-	if err != nil {
-		log.Fatal(err)
+	process := func(input string) error {
+		return processTo(replyOut, input)
+	}
+
+	// Transform stdin line by line, one output line for each input line
+	if viper.GetBool("perLine") {
+		if len(args) > 0 {
+			log.Fatal("--perLine transforms the lines of stdin, give the instructions with -i instead of as arguments")
+		}
+		if err := runPerLine(os.Stdin, apiKey, model, instruction, temperature, redactor); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// Transcribe a recording; for anything but a transcription model the transcript becomes the input
+	if path := viper.GetString("audio"); path != "" {
+		transcript, err := transcribeAudio(providerAPIKey("openai"), path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		if modelCapabilities[model].Endpoint == transcriptionsURL {
+			if _, err := fmt.Fprintln(replyOut, transcript); err != nil {
+				fatal(err)
+			}
+			return
+		}
+		if len(args) > 0 {
+			transcript = strings.Join(args, " ") + "\n\n" + transcript
+		}
+		if err := process(transcript); err != nil {
+			fatal(err)
+		}
+		return
 	}
 
-	fmt.Println(message) // Output only the message
+	// Attach frames sampled from a video as images, with the transcript of its soundtrack as input
+	if path := viper.GetString("video"); path != "" {
+		input, cleanup, err := prepareVideo(path, strings.Join(args, " "))
+		if err == nil {
+			err = process(input)
+		}
+		cleanup()
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// Process additional arguments as input
+	if len(args) > 0 {
+		if err := process(strings.Join(args, " ")); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// Read from stdin if no arguments are provided, spooling very large input to disk
+	if stdinAttached {
+		log.Fatal("the attachment was read from stdin, give the prompt as arguments")
+	}
+	if sep := inputSeparator(); sep != "" {
+		// Answer each chunk between separators as it arrives, several at a time with --concurrency,
+		// or as the turns of one conversation with --chained
+		if viper.GetBool("chained") {
+			err = processChained(replyOut, scanChunks(os.Stdin, sep), model, instruction, temperature, redactor)
+		} else {
+			err = processChunks(replyOut, scanChunks(os.Stdin, sep), processTo)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+	input, spool, err := spoolInput(viper.GetInt64("spoolThreshold"))
+	if err != nil {
+		fatal(err)
+	}
+	if spool == nil {
+		err = process(input)
+	} else {
+		err = processWindows(spool, process)
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	if err != nil {
+		fatal(err)
+	}
 }
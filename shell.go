@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sgpt/pkg/i18n"
+	"sgpt/pkg/shellguard"
+	"strings"
+)
+
+const shellInstruction = "You are a command line expert on %s, using the %s shell. Reply with a single %s command " +
+	"that does what the user asks. Reply with the command only, on one line, without explanations, code fences or quotes."
+
+// Clipboard commands tried in order by the copy action of --shell
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// Function to find the user's shell, as a name for the model and a path to run commands with
+func detectShell() (name, path string) {
+	if runtime.GOOS == "windows" {
+		if _, err := exec.LookPath("pwsh"); err == nil {
+			return "PowerShell", "pwsh"
+		}
+		return "cmd.exe", "cmd"
+	}
+	path = os.Getenv("SHELL")
+	if path == "" {
+		path = "/bin/sh"
+	}
+	return filepath.Base(path), path
+}
+
+// Function to describe the operating system, including the Linux distribution where known
+func detectOS() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macOS"
+	case "linux":
+		data, err := os.ReadFile("/etc/os-release")
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if name := strings.TrimPrefix(line, "PRETTY_NAME="); name != line {
+					return "Linux (" + strings.Trim(name, `"`) + ")"
+				}
+			}
+		}
+		return "Linux"
+	}
+	return runtime.GOOS
+}
+
+// Function to build the instruction of --shell mode, followed by any instruction given with -i
+func shellModeInstruction(extra string) string {
+	shell, _ := detectShell()
+	instruction := fmt.Sprintf(shellInstruction, detectOS(), shell, shell)
+	if extra != "" {
+		instruction += "\n\n" + extra
+	}
+	return instruction
+}
+
+// Number of times a command that breaks the --strictShell contract is generated again
+const shellRetries = 2
+
+// Shells whose syntax check is `shell -n -c command`
+var syntaxCheckingShells = map[string]bool{"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true, "mksh": true}
+
+// Function to enforce the --strictShell contract on a generated command: the reply must be a single
+// command that the shell can parse, and not a known destructive one. Replies that aren't a single
+// parsable command are generated again with the problem pointed out; destructive commands are refused.
+func checkShellContract(reply string, regenerate func(note string) (string, error)) (string, error) {
+	for attempt := 0; ; attempt++ {
+		command, err := shellguard.Single(stripCodeFence(reply))
+		if err == nil {
+			if reason := shellguard.Dangerous(command); reason != "" {
+				return "", fmt.Errorf("refusing the generated command because %s: %s", reason, command)
+			}
+			err = checkShellSyntax(command)
+		}
+		if err == nil {
+			return command, nil
+		}
+		if attempt >= shellRetries {
+			return "", fmt.Errorf("no usable command after %d attempts: %v", attempt+1, err)
+		}
+
+		debugf("generated command rejected, retrying: %v", err)
+		reply, err = regenerate("\n\nYour previous reply was rejected: " + err.Error() + ". The rejected reply was:\n" + reply)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// Function to check the syntax of a command with the user's shell, without running it. Shells
+// without a syntax check, such as PowerShell and fish, pass.
+func checkShellSyntax(command string) error {
+	_, shell := detectShell()
+	if !syntaxCheckingShells[filepath.Base(shell)] {
+		return nil
+	}
+	out, err := exec.Command(shell, "-n", "-c", command).CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("%s reports a syntax error: %s", filepath.Base(shell), msg)
+	}
+	return nil
+}
+
+// Function to print a generated command and, on a terminal, offer to execute or copy it
+func offerCommand(command string) error {
+	command = strings.TrimSpace(stripCodeFence(command))
+	if _, err := fmt.Fprintln(replyOut, command); err != nil {
+		return err
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil || !isTerminal(os.Stdout) {
+		return nil // Not interactive: printing the command is all that is wanted
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, i18n.T("[e]xecute, [c]opy, [a]bort? "))
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "e", "execute":
+		_, shell := detectShell()
+		flag := "-c"
+		if shell == "cmd" {
+			flag = "/C"
+		} else if shell == "pwsh" {
+			flag = "-Command"
+		}
+		cmd := exec.Command(shell, flag, command)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, os.Stdout, os.Stderr
+		return cmd.Run()
+	case "c", "copy":
+		return copyToClipboard(command)
+	}
+	return nil
+}
+
+// Function to copy text to the clipboard with the first installed clipboard command
+func copyToClipboard(text string) error {
+	for _, clipboard := range clipboardCommands {
+		if _, err := exec.LookPath(clipboard[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(clipboard[0], clipboard[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return fmt.Errorf("no clipboard command found (pbcopy, wl-copy, xclip, xsel or clip.exe)")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"sgpt/pkg/provider/openaicompat"
+	"sync"
+)
+
+// Function to create the client and model name of the --draftModel, which is a model name (also
+// given as provider/model) of a provider with an OpenAI-format API, or local for the model of
+// --localFallback
+func draftClient() (*openaicompat.Client, string, error) {
+	draft := viper.GetString("draftModel")
+	if draft == "local" {
+		return localClient(), viper.GetString("localModel"), nil
+	}
+	provider, model := modelProvider(draft, "")
+	if provider == "bedrock" {
+		return nil, "", fmt.Errorf("--draftModel %s: drafts are streamed from OpenAI, Mistral AI, Groq, OpenRouter or the local model, not Bedrock", draft)
+	}
+	loadKeyringKey(provider)
+	client, err := chatClient(provider)
+	if err != nil {
+		return nil, "", fmt.Errorf("--draftModel %s: %w", draft, err)
+	}
+	return client, model, nil
+}
+
+// Function to answer speculatively with --draftModel: a fast draft model streams a provisional answer
+// into the preview while the configured model writes the answer in parallel. Once that is complete
+// it replaces the draft, which is cut off if it is still streaming. A draft that ends first is marked
+// as such in the preview. Drafts that fail are only reported with --debug.
+func callModelSpeculative(ctx context.Context, apiKey, model, instruction, input string, temperature float64, onText func(string)) (string, error) {
+	client, draftModel, err := draftClient()
+	if err != nil {
+		return "", err
+	}
+
+	type result struct {
+		reply string
+		err   error
+	}
+	final := make(chan result, 1)
+	go func() {
+		reply, err := callModelContext(ctx, apiKey, model, instruction, input, temperature)
+		final <- result{reply, err}
+	}()
+
+	draftCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	replaced := false
+	show := func(text string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !replaced {
+			onText(text)
+		}
+	}
+	go func() {
+		debugf("POST %s model=%s stream=true draft", client.Endpoint(), draftModel)
+		request := openaicompat.Request{Model: draftModel, System: instruction, Input: input, Temperature: temperature}
+		response, err := client.Stream(draftCtx, request, show)
+		if response != nil {
+			recordUsage(ctx, client.Name, draftModel, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+		}
+		if err != nil {
+			if draftCtx.Err() == nil {
+				debugf("draft by %s failed: %v", draftModel, err)
+			}
+			return
+		}
+		show(fmt.Sprintf(" [draft by %s, waiting for %s]", draftModel, model))
+	}()
+
+	r := <-final
+	mu.Lock()
+	replaced = true
+	mu.Unlock()
+	return r.reply, r.err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// OpenAI speech endpoint
+const speechURL = "https://api.openai.com/v1/audio/speech"
+
+// Audio players tried in order to play speech when no --speechFile is given
+var audioPlayers = [][]string{
+	{"afplay"},
+	{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"},
+	{"mpv", "--no-video", "--really-quiet"},
+	{"paplay"},
+}
+
+// Function to handle `sgpt tts [text]`, which speaks the text given as arguments or on stdin
+func runTTS(args []string) error {
+	text, err := readInput(args)
+	if err != nil {
+		return err
+	}
+	return speak(text)
+}
+
+// Function to turn text into speech with OpenAI and save it to --speechFile or play it
+func speak(text string) error {
+	loadKeyringKey("openai")
+	apiKey := providerAPIKey("openai")
+	if apiKey == "" {
+		return fmt.Errorf("no OpenAI API key for speech: set SGPT_API_KEY, pass -k/--apiKey, or add apiKey to the config file")
+	}
+
+	audio, err := callSpeech(apiKey, text)
+	if err != nil {
+		return err
+	}
+
+	if path := viper.GetString("speechFile"); path != "" {
+		return os.WriteFile(path, audio, 0644)
+	}
+	return playAudio(audio)
+}
+
+// Function to send text to the OpenAI speech endpoint and return the audio
+func callSpeech(apiKey, text string) ([]byte, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":           viper.GetString("speechModel"),
+		"input":           text,
+		"voice":           viper.GetString("voice"),
+		"response_format": viper.GetString("speechFormat"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", openAIURL(speechURL), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	requestID := newRequestID()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("X-Client-Request-Id", requestID)
+	debugf("POST %s request=%s", req.URL, requestID)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var response struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &response) == nil && response.Error.Message != "" {
+			return nil, fmt.Errorf("speech failed: %s", response.Error.Message)
+		}
+		return nil, fmt.Errorf("speech failed: %s", resp.Status)
+	}
+	return data, nil
+}
+
+// Function to play audio through the default audio device with the first installed player
+func playAudio(audio []byte) error {
+	file, err := os.CreateTemp("", "sgpt-speech-*."+viper.GetString("speechFormat"))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(audio)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, player := range audioPlayers {
+		if player[0] == "afplay" && runtime.GOOS != "darwin" {
+			continue
+		}
+		if _, err := exec.LookPath(player[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(player[0], append(player[1:], file.Name())...)
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+	return fmt.Errorf("no audio player found (afplay, ffplay, mpv or paplay), save the speech with --speechFile instead")
+}
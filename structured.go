@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"sgpt/pkg/jsonschema"
+	"sgpt/pkg/normalize"
+	"strings"
+)
+
+// Function to load the schema given with --jsonSchema, or nil if there is none
+func loadJSONSchema() (*jsonschema.Schema, error) {
+	path := viper.GetString("jsonSchema")
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := jsonschema.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return schema, nil
+}
+
+// Function to ask the model for a JSON document matching schema. Replies are validated locally
+// and the request is repeated up to --jsonRetries times, telling the model what was wrong.
+// Dates and numbers in a valid reply are then rewritten as selected by --normalize.
+func callModelJSON(ctx context.Context, schema *jsonschema.Schema, apiKey, model, instruction, input string, temperature float64) (string, error) {
+	instruction += "\n\nRespond only with a JSON document, without code fences, that matches this JSON schema:\n" + string(schema.Raw)
+
+	retries := viper.GetInt("jsonRetries")
+	prompt := instruction
+	for attempt := 0; ; attempt++ {
+		reply, err := callModelContext(ctx, apiKey, model, prompt, input, temperature)
+		if err != nil {
+			return "", err
+		}
+
+		reply = stripCodeFence(reply)
+		problem := schema.Validate([]byte(reply))
+		if problem == nil {
+			return normalizeReply(reply)
+		}
+		if attempt >= retries {
+			return "", fmt.Errorf("the reply does not match the JSON schema after %d attempts: %v", attempt+1, problem)
+		}
+
+		debugf("invalid JSON reply, retrying: %v", problem)
+		prompt = instruction + "\n\nYour previous reply was rejected because it does not match the schema (" +
+			problem.Error() + "). The rejected reply was:\n" + reply
+	}
+}
+
+// Function to apply the --normalize settings to a validated JSON reply
+func normalizeReply(reply string) (string, error) {
+	spec := viper.GetString("normalize")
+	if spec == "" {
+		return reply, nil
+	}
+	options, err := normalize.ParseOptions(spec)
+	if err != nil {
+		return "", err
+	}
+	normalized, err := normalize.JSON([]byte(reply), options)
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
+
+// Function to remove a Markdown code fence around a reply, which models add despite being told not to
+func stripCodeFence(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if !strings.HasPrefix(reply, "```") || !strings.HasSuffix(reply, "```") {
+		return reply
+	}
+	reply = strings.TrimSuffix(reply, "```")
+	if i := strings.Index(reply, "\n"); i >= 0 {
+		reply = reply[i+1:]
+	}
+	return strings.TrimSpace(reply)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const synthesizeExtractInstruction = "You are helping answer this question from several documents: %s\n\n" +
+	"The input is one excerpt, from %s. List every fact in it that is relevant to the question as short bullet points, " +
+	"keeping numbers, names and qualifications exact. If nothing in the excerpt is relevant, reply with NONE only."
+
+const synthesizeAnswerInstruction = "Answer this question using only the sourced material in the input: %s\n\n" +
+	"Each block of material starts with its source in square brackets. After every claim, cite the source it comes from " +
+	"in the same square brackets, e.g. [guide.md § Installation]. If sources disagree, say so and cite each. " +
+	"If the material does not answer the question, say that instead of guessing."
+
+// sourceChunk is a piece of a file with the file and section it came from
+type sourceChunk struct {
+	source string // e.g. "guide.md § Installation"
+	text   string
+}
+
+// Function to handle `sgpt synthesize --question "..." file...`, which answers a question from several
+// files with every claim attributed to the file and section it came from. Files that fit are sent in
+// one request; otherwise the relevant facts of each section are extracted first (map) and the answer
+// is written from those notes (reduce), keeping the source of every note.
+func runSynthesize(args []string) error {
+	question := viper.GetString("question")
+	if question == "" || len(args) == 0 {
+		return fmt.Errorf("usage: sgpt synthesize --question \"...\" file...")
+	}
+
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	var chunks []sourceChunk
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, splitSections(filepath.Base(path), string(data))...)
+	}
+
+	apiKey, model, temperature := viper.GetString("apiKey"), viper.GetString("model"), viper.GetFloat64("temperature")
+	instruction := fmt.Sprintf(synthesizeAnswerInstruction, question)
+
+	material := formatSourced(chunks)
+	if inputBudget(model, instruction, material) > 0 || len(material) > viper.GetInt("chunkSize") {
+		var notes []sourceChunk
+		for i, chunk := range chunks {
+			fmt.Fprintf(os.Stderr, "\rReading %d/%d", i+1, len(chunks))
+			extract := fmt.Sprintf(synthesizeExtractInstruction, question, chunk.source)
+			note, err := callModel(apiKey, model, extract, chunk.text, temperature)
+			if err != nil {
+				return fmt.Errorf("%s: %w", chunk.source, err)
+			}
+			if strings.TrimSpace(strings.Trim(note, ".")) != "NONE" {
+				notes = append(notes, sourceChunk{source: chunk.source, text: note})
+			}
+		}
+		fmt.Fprintln(os.Stderr)
+		if len(notes) == 0 {
+			return fmt.Errorf("none of the files contain anything relevant to the question")
+		}
+		material = formatSourced(notes)
+	}
+
+	answer, err := callModelChunked(rootCtx, apiKey, model, instruction, material, temperature)
+	if err != nil {
+		return err
+	}
+	fmt.Println(answer)
+
+	// List the sources the answer cites, in the order of the files
+	var cited []string
+	seen := map[string]bool{}
+	for _, chunk := range chunks {
+		if !seen[chunk.source] && strings.Contains(answer, "["+chunk.source+"]") {
+			seen[chunk.source] = true
+			cited = append(cited, chunk.source)
+		}
+	}
+	if len(cited) > 0 {
+		fmt.Println("\nSources:")
+		for _, source := range cited {
+			fmt.Println("- " + source)
+		}
+	}
+	return nil
+}
+
+// Function to split a file into chunks at Markdown headings, and sections longer than chunkSize further,
+// labelling each with the file name and heading
+func splitSections(name, text string) []sourceChunk {
+	var chunks []sourceChunk
+	heading := ""
+	var section strings.Builder
+	flush := func() {
+		if strings.TrimSpace(section.String()) == "" {
+			section.Reset()
+			return
+		}
+		source := name
+		if heading != "" {
+			source += " § " + heading
+		}
+		parts := chunkText(section.String(), viper.GetInt("chunkSize"))
+		for i, part := range parts {
+			label := source
+			if len(parts) > 1 {
+				label += fmt.Sprintf(" (part %d)", i+1)
+			}
+			chunks = append(chunks, sourceChunk{source: label, text: part})
+		}
+		section.Reset()
+	}
+
+	inFence := false
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if !inFence && strings.HasPrefix(trimmed, "#") {
+			if title := strings.TrimSpace(strings.TrimLeft(trimmed, "#")); title != "" {
+				flush()
+				heading = title
+			}
+		}
+		section.WriteString(line)
+	}
+	flush()
+	return chunks
+}
+
+// Function to join chunks into one input, each headed by its source in square brackets
+func formatSourced(chunks []sourceChunk) string {
+	var b strings.Builder
+	for _, chunk := range chunks {
+		fmt.Fprintf(&b, "[%s]\n%s\n\n", chunk.source, strings.TrimSpace(chunk.text))
+	}
+	return b.String()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sgpt/pkg/workspace"
+	"strings"
+)
+
+// Settings of a workspace and of its agents, with their config types
+var (
+	workspaceKeys = map[string]string{"pattern": "string", "rounds": "int", "agents": "agents", "synthesizer": "string"}
+	agentKeys     = map[string]string{"name": "string", "instruction": "string", "model": "string", "temperature": "float64"}
+)
+
+// Function to handle `sgpt team [--workspace name] "task"`, which has the agents of a workspace work on
+// the task in turn or in debate and prints their synthesized answer. The discussion is printed to
+// stderr as it happens. Without --workspace the built-in researcher, coder and critic take turns.
+func runTeam(args []string) error {
+	task, err := readInput(args)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(task) == "" {
+		return fmt.Errorf("usage: sgpt team [--workspace name] \"task\"")
+	}
+
+	ws := workspace.Default()
+	if name := viper.GetString("workspace"); name != "" {
+		workspaces, _ := viper.Get("workspaces").(map[string]interface{})
+		if _, ok := workspaces[strings.ToLower(name)]; !ok {
+			return fmt.Errorf("unknown workspace %q, define it under workspaces in the config file", name)
+		}
+		ws = workspace.Workspace{}
+		if err := viper.UnmarshalKey("workspaces."+strings.ToLower(name), &ws); err != nil {
+			return fmt.Errorf("workspace %s: %v", name, err)
+		}
+	}
+	if err := ws.Validate(); err != nil {
+		return fmt.Errorf("workspace %s: %v", viper.GetString("workspace"), err)
+	}
+
+	// Check every model the team uses before the first call
+	if err := validateConfig(); err != nil {
+		return err
+	}
+	provider, model, temperature := viper.GetString("provider"), viper.GetString("model"), viper.GetFloat64("temperature")
+	for _, agent := range ws.Agents {
+		if err := useModel(agent.Model, provider, model); err != nil {
+			return fmt.Errorf("agent %s: %w", agent.Name, err)
+		}
+	}
+
+	call := func(agent workspace.Agent, instruction, input string) (string, error) {
+		useModel(agent.Model, provider, model)
+		t := temperature
+		if agent.Temperature != nil {
+			t = *agent.Temperature
+		}
+		return callModel(providerAPIKey(viper.GetString("provider")), viper.GetString("model"), instruction, input, t)
+	}
+	onTurn := func(turn workspace.Turn) {
+		fmt.Fprintf(os.Stderr, "── %s, round %d ──\n%s\n\n", turn.Agent, turn.Round, turn.Text)
+	}
+
+	answer, _, err := ws.Run(task, call, onTurn)
+	if err != nil {
+		return err
+	}
+	fmt.Println(answer)
+	return nil
+}
+
+// Function to check the workspaces config key: every workspace is a mapping of settings whose agents
+// are a list of named roles
+func (d *configDoc) checkWorkspaces(node *yaml.Node, errs *ConfigErrors) {
+	if node.Kind != yaml.MappingNode {
+		*errs = append(*errs, fmt.Sprintf("%s:%d: workspaces must be a mapping of names to workspaces", d.file(node), node.Line))
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, ws := node.Content[i].Value, node.Content[i+1]
+		if ws.Kind != yaml.MappingNode {
+			*errs = append(*errs, fmt.Sprintf("%s:%d: workspace %s must be a mapping of settings", d.file(ws), ws.Line, name))
+			continue
+		}
+		for j := 0; j+1 < len(ws.Content); j += 2 {
+			keyNode, value := ws.Content[j], ws.Content[j+1]
+			want, ok := workspaceKeys[keyNode.Value]
+			if !ok {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: unknown key %q in workspace %s, workspaces may set pattern, rounds, agents and synthesizer",
+					d.file(keyNode), keyNode.Line, keyNode.Value, name))
+				continue
+			}
+			if want == "agents" {
+				d.checkAgents(name, value, errs)
+				continue
+			}
+			if problem := checkConfigValue(want, value); problem != "" {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: workspaces.%s.%s %s", d.file(value), value.Line, name, keyNode.Value, problem))
+			} else if keyNode.Value == "pattern" && value.Value != "roundrobin" && value.Value != "debate" {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: workspaces.%s.pattern %q is not one of %s",
+					d.file(value), value.Line, name, value.Value, strings.Join(workspace.Patterns, ", ")))
+			}
+		}
+	}
+}
+
+// Function to check the agents of a workspace
+func (d *configDoc) checkAgents(workspaceName string, node *yaml.Node, errs *ConfigErrors) {
+	if node.Kind != yaml.SequenceNode {
+		*errs = append(*errs, fmt.Sprintf("%s:%d: workspaces.%s.agents must be a list of agents", d.file(node), node.Line, workspaceName))
+		return
+	}
+	for _, agent := range node.Content {
+		if agent.Kind != yaml.MappingNode {
+			*errs = append(*errs, fmt.Sprintf("%s:%d: an agent of workspace %s must be a mapping of settings", d.file(agent), agent.Line, workspaceName))
+			continue
+		}
+		named := false
+		for j := 0; j+1 < len(agent.Content); j += 2 {
+			keyNode, value := agent.Content[j], agent.Content[j+1]
+			want, ok := agentKeys[keyNode.Value]
+			if !ok {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: unknown key %q in an agent of workspace %s, agents may set name, instruction, model and temperature",
+					d.file(keyNode), keyNode.Line, keyNode.Value, workspaceName))
+				continue
+			}
+			named = named || keyNode.Value == "name"
+			if problem := checkConfigValue(want, value); problem != "" {
+				*errs = append(*errs, fmt.Sprintf("%s:%d: workspaces.%s.agents %s %s", d.file(value), value.Line, workspaceName, keyNode.Value, problem))
+			}
+		}
+		if !named {
+			*errs = append(*errs, fmt.Sprintf("%s:%d: an agent of workspace %s has no name", d.file(agent), agent.Line, workspaceName))
+		}
+	}
+}
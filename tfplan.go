@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"sgpt/pkg/integrations/terraform"
+	"strings"
+)
+
+const tfplanInstruction = "You are an experienced infrastructure engineer reviewing a Terraform plan. " +
+	"Summarize the changes grouped by risk, call out every destructive action (deletions and replacements) " +
+	"and what could break, and mention anything that looks unintended."
+
+const tfplanQuestionInstruction = "You are an experienced infrastructure engineer. " +
+	"Answer the user's question about the following Terraform plan."
+
+// Function to handle `sgpt tfplan [question]`
+func runTerraformPlan(args []string) error {
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	plan, err := loadTerraformPlan(viper.GetString("plan"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(plan.Summary())
+
+	changes := plan.Details()
+	if changes == "" {
+		return nil
+	}
+
+	instruction := tfplanInstruction
+	if len(args) > 0 {
+		instruction = tfplanQuestionInstruction + "\n\nQuestion: " + strings.Join(args, " ")
+	}
+
+	message, err := callModelChunked(rootCtx, viper.GetString("apiKey"), viper.GetString("model"), instruction, changes, viper.GetFloat64("temperature"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(message)
+	return nil
+}
+
+// Function to load a plan from a JSON file, a saved binary plan (via `terraform show -json`), or stdin
+func loadTerraformPlan(path string) (*terraform.Plan, error) {
+	if path == "" {
+		return terraform.Parse(os.Stdin)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		cmd := exec.Command("terraform", "show", "-json", path)
+		cmd.Stderr = os.Stderr
+		data, err = cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("terraform show -json %s: %v", path, err)
+		}
+	}
+
+	return terraform.Parse(bytes.NewReader(data))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"sgpt/pkg/integrations/jira"
+	"sgpt/pkg/integrations/linear"
+	"strings"
+)
+
+const ticketInstruction = "You turn bug descriptions and stack traces into well-structured bug tickets. " +
+	"Respond only with a single line of JSON with the keys \"title\", \"steps\" (an array of strings), " +
+	"\"expected\", \"actual\" and \"severity\" (one of \"critical\", \"high\", \"medium\", \"low\")."
+
+// Ticket is a bug report drafted by the model
+type Ticket struct {
+	Title    string   `json:"title"`
+	Steps    []string `json:"steps"`
+	Expected string   `json:"expected"`
+	Actual   string   `json:"actual"`
+	Severity string   `json:"severity"`
+}
+
+// Markdown renders the ticket body, without the title
+func (t *Ticket) Markdown() string {
+	var b strings.Builder
+	b.WriteString("## Steps to reproduce\n\n")
+	for i, step := range t.Steps {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+	}
+	fmt.Fprintf(&b, "\n## Expected behaviour\n\n%s\n", t.Expected)
+	fmt.Fprintf(&b, "\n## Actual behaviour\n\n%s\n", t.Actual)
+	fmt.Fprintf(&b, "\n**Severity:** %s\n", t.Severity)
+	return b.String()
+}
+
+// Function to parse the model's reply into a Ticket, tolerating a surrounding code fence
+func parseTicket(reply string) (*Ticket, error) {
+	reply = strings.TrimSpace(reply)
+	reply = strings.TrimPrefix(reply, "```json")
+	reply = strings.TrimPrefix(reply, "```")
+	reply = strings.TrimSuffix(reply, "```")
+
+	var t Ticket
+	if err := json.Unmarshal([]byte(reply), &t); err != nil {
+		return nil, fmt.Errorf("model did not return a valid ticket: %v", err)
+	}
+	if t.Title == "" {
+		return nil, fmt.Errorf("model returned a ticket without a title")
+	}
+	t.Severity = strings.ToLower(t.Severity)
+	return &t, nil
+}
+
+// Function to handle `sgpt ticket [description]`
+func runTicket(args []string) error {
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	input, err := readInput(args)
+	if err != nil {
+		return err
+	}
+
+	instruction := ticketInstruction
+	if extra := viper.GetString("instruction"); extra != "" {
+		instruction += " " + extra
+	}
+
+	reply, err := callModel(viper.GetString("apiKey"), viper.GetString("model"), instruction, input, viper.GetFloat64("temperature"))
+	if err != nil {
+		return err
+	}
+
+	ticket, err := parseTicket(reply)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("# %s\n\n%s", ticket.Title, ticket.Markdown())
+
+	if !viper.GetBool("create") {
+		return nil
+	}
+
+	var id, url string
+	switch tracker := viper.GetString("tracker"); tracker {
+	case "jira":
+		client := jira.NewClient(viper.GetString("jira.url"), viper.GetString("jira.email"), viper.GetString("jira.token"))
+		client.HTTP = httpClient
+		client.UserAgent = userAgent()
+		id, url, err = client.CreateIssue(jira.Issue{
+			Project:     viper.GetString("jira.project"),
+			Type:        viper.GetString("jira.issueType"),
+			Summary:     ticket.Title,
+			Description: ticket.Markdown(),
+			Priority:    viper.GetStringMapString("jira.priorities")[ticket.Severity],
+		})
+	case "linear":
+		client := linear.NewClient(viper.GetString("linear.apiKey"))
+		client.HTTP = httpClient
+		client.UserAgent = userAgent()
+		id, url, err = client.CreateIssue(linear.Issue{
+			TeamID:      viper.GetString("linear.teamId"),
+			Title:       ticket.Title,
+			Description: ticket.Markdown(),
+			Priority:    linearPriority(ticket.Severity),
+		})
+	case "":
+		return fmt.Errorf("--create requires a tracker, set --tracker to jira or linear")
+	default:
+		return fmt.Errorf("unsupported tracker: %s", tracker)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nCreated %s: %s\n", id, url)
+	return nil
+}
+
+// Function to map a ticket severity onto Linear's priority scale
+func linearPriority(severity string) int {
+	switch severity {
+	case "critical":
+		return 1
+	case "high":
+		return 2
+	case "medium":
+		return 3
+	case "low":
+		return 4
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sgpt/pkg/compress"
+	"sgpt/pkg/tokenizer"
+	"strings"
+	"sync"
+)
+
+// Where tiktoken rank files are downloaded from the first time an encoding is needed
+const encodingURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+// Tokens kept free in the context window for the reply
+const replyTokenReserve = 1024
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = map[string]*tokenizer.Encoding{}
+)
+
+// Function to return the name of the encoding of a model, or "" if it is not known
+func modelEncoding(model string) string {
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"):
+		return "o200k_base"
+	case strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "gpt-3.5"), strings.HasPrefix(model, "text-embedding-"):
+		return "cl100k_base"
+	}
+	return ""
+}
+
+// Function to load an encoding from the cache directory, downloading its rank file once if needed
+func loadEncoding(name string) (*tokenizer.Encoding, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if e, ok := encodings[name]; ok {
+		if e == nil {
+			return nil, fmt.Errorf("the %s encoding is not available", name)
+		}
+		return e, nil
+	}
+
+	dir := viper.GetString("tokenizerDir")
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(cache, "sgpt", "tokenizers")
+	}
+	path := filepath.Join(dir, name+".tiktoken")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := downloadEncoding(name, path); err != nil {
+			encodings[name] = nil // Don't try again for every count
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	e, err := tokenizer.Load(name, file)
+	encodings[name] = e
+	return e, err
+}
+
+// Function to download the rank file of an encoding to path
+func downloadEncoding(name, path string) error {
+	debugf("GET %s%s.tiktoken", encodingURL, name)
+	resp, err := httpClient.Get(encodingURL + name + ".tiktoken")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s encoding failed: %s", name, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Function to count the tokens of text for a model. The count is exact for OpenAI models whose encoding
+// is available and estimated otherwise.
+func countTokens(model, text string) (n int, exact bool) {
+	if name := modelEncoding(model); name != "" {
+		e, err := loadEncoding(name)
+		if err == nil {
+			return e.Count(text), true
+		}
+		debugf("estimating tokens: %v", err)
+	}
+	return tokenizer.Estimate(text), false
+}
+
+// Function to return how many bytes of input fit in one request with the instruction,
+// leaving room for the reply, or 0 if the input fits or its context window is not known
+func inputBudget(model, instruction, input string) int {
+	window := modelCapabilities[model].ContextWindow
+	reserve := minInt(replyTokenReserve, window/4)
+	if window == 0 || len(instruction)+len(input) <= window-reserve {
+		return 0 // Every token is at least a byte long, so this fits without counting
+	}
+	inputTokens, _ := countTokens(model, input)
+	instructionTokens, _ := countTokens(model, instruction)
+	available := window - instructionTokens - reserve
+	if inputTokens <= available || available <= 0 {
+		return 0 // If the instruction alone fills the window, splitting the input can't help
+	}
+	return len(input) * available / inputTokens
+}
+
+// Function to choose the max_tokens of a request: --maxTokens if given, otherwise what the model's
+// context window leaves after the prompt, less a safety margin for miscounted tokens, up to the most
+// the model writes in one reply. It returns 0, leaving the provider's default, for unknown models and
+// prompts that fill the window.
+func maxReplyTokens(model, instruction, input string) int {
+	if n := viper.GetInt("maxTokens"); n > 0 {
+		return n
+	}
+	caps := modelCapabilities[model]
+	if caps.ContextWindow == 0 {
+		return 0
+	}
+	inputTokens, exact := countTokens(model, input)
+	instructionTokens, _ := countTokens(model, instruction)
+	prompt := inputTokens + instructionTokens
+	margin := 32 + prompt/20
+	if !exact {
+		margin = 32 + prompt/4 // Estimates can be far off, e.g. for code or other languages
+	}
+	available := caps.ContextWindow - prompt - margin
+	if caps.MaxOutputTokens > 0 && available > caps.MaxOutputTokens {
+		available = caps.MaxOutputTokens
+	}
+	if available <= 0 {
+		return 0
+	}
+	return available
+}
+
+// Function to print the token counts of a request for --showTokens
+func showTokens(model, instruction, input, reply string) {
+	instructionTokens, exact := countTokens(model, instruction)
+	inputTokens, _ := countTokens(model, input)
+	replyTokens, _ := countTokens(model, reply)
+	counted := "counted"
+	if !exact {
+		counted = "estimated"
+	}
+	window := "unknown"
+	if w := modelCapabilities[model].ContextWindow; w > 0 {
+		window = fmt.Sprint(w)
+	}
+	fmt.Fprintf(os.Stderr, "tokens (%s): instruction %d, input %d, reply %d, total %d of context window %s\n",
+		counted, instructionTokens, inputTokens, replyTokens, instructionTokens+inputTokens+replyTokens, window)
+}
+
+// Function to compress input with --compress, reporting the tokens saved on stderr
+func compressInput(model, input string, rate float64) string {
+	compressed := compress.Compress(input, rate)
+	before, exact := countTokens(model, input)
+	after, _ := countTokens(model, compressed)
+	counted := "counted"
+	if !exact {
+		counted = "estimated"
+	}
+	saved := 0.0
+	if before > 0 {
+		saved = 100 * float64(before-after) / float64(before)
+	}
+	fmt.Fprintf(os.Stderr, "compression (%s): input %d tokens, sent %d tokens, %.0f%% saved\n", counted, before, after, saved)
+	return compressed
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"sgpt/pkg/provider/openaicompat"
+	"strings"
+)
+
+// Function to load the tools given with --toolSchema: a JSON file holding one tool or an array of
+// tools, each with a name, a description and the JSON schema of its parameters
+func loadTools() ([]openaicompat.Tool, error) {
+	path := viper.GetString("toolSchema")
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tools []openaicompat.Tool
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var tool openaicompat.Tool
+		err = json.Unmarshal(trimmed, &tool)
+		tools = append(tools, tool)
+	} else {
+		err = json.Unmarshal(data, &tools)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for i, tool := range tools {
+		if tool.Name == "" {
+			return nil, fmt.Errorf("%s: tool %d has no name", path, i+1)
+		}
+	}
+	return tools, nil
+}
+
+// Function to print the model's tool calls as one JSON object per line, so scripts can dispatch on them
+func formatToolCalls(calls []openaicompat.ToolCall) (string, error) {
+	var lines []string
+	for _, call := range calls {
+		line, err := json.Marshal(call)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, string(line))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+)
+
+// transcriptCue is a timed piece of a transcript
+type transcriptCue struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Function to handle `sgpt transcribe [--audio] <file>`, which prints the transcript of a recording
+// as text, srt, vtt or json. Text and subtitles are printed segment by segment as they are transcribed.
+func runTranscribe(args []string) error {
+	path := viper.GetString("audio")
+	if path == "" && len(args) == 1 {
+		path = args[0]
+	}
+	if path == "" {
+		return fmt.Errorf("usage: sgpt transcribe [--language code] [--transcriptFormat text|srt|vtt|json] <file>")
+	}
+
+	loadKeyringKey("openai")
+	apiKey := providerAPIKey("openai")
+	if apiKey == "" {
+		return fmt.Errorf("no OpenAI API key for transcribing audio: set SGPT_API_KEY, pass -k/--apiKey, or add apiKey to the config file")
+	}
+
+	switch format := viper.GetString("transcriptFormat"); format {
+	case "text":
+		_, err := transcribeAudio(apiKey, path, func(text string) {
+			fmt.Println(text)
+		})
+		return err
+
+	case "srt", "vtt":
+		if format == "vtt" {
+			fmt.Print("WEBVTT\n\n")
+		}
+		n := 0
+		return transcribeCues(apiKey, path, func(cues []transcriptCue) {
+			for _, cue := range cues {
+				n++
+				fmt.Print(formatCue(format, n, cue))
+			}
+		})
+
+	case "json":
+		var all []transcriptCue
+		err := transcribeCues(apiKey, path, func(cues []transcriptCue) {
+			all = append(all, cues...)
+		})
+		if err != nil {
+			return err
+		}
+		var text []string
+		for _, cue := range all {
+			text = append(text, cue.Text)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]interface{}{
+			"text":     strings.Join(text, " "),
+			"segments": all,
+		})
+
+	default:
+		return fmt.Errorf("transcript format %q is not one of text, srt, vtt, json", format)
+	}
+}
+
+// Function to transcribe a recording into timed cues, calling emit with the cues of each audio
+// segment as it is transcribed. Cue times are relative to the start of the recording. Cues starting
+// in the overlap between two segments are kept from one segment only, split at the middle of the overlap.
+func transcribeCues(apiKey, path string, emit func([]transcriptCue)) error {
+	dir, segments, err := splitAudio(path)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	length, overlap := viper.GetFloat64("audioSegment"), viper.GetFloat64("audioOverlap")
+	for i, segment := range segments {
+		debugf("transcribing segment %d of %d", i+1, len(segments))
+		data, err := uploadTranscription(apiKey, segment, "verbose_json")
+		if err != nil {
+			return fmt.Errorf("segment %d of %d: %w", i+1, len(segments), err)
+		}
+		var response struct {
+			Segments []transcriptCue `json:"segments"`
+		}
+		if err := json.Unmarshal(data, &response); err != nil {
+			return fmt.Errorf("segment %d of %d: %w", i+1, len(segments), err)
+		}
+
+		offset := float64(i) * (length - overlap)
+		var cues []transcriptCue
+		for _, cue := range response.Segments {
+			if i > 0 && cue.Start < overlap/2 {
+				continue // Transcribed at the end of the previous segment
+			}
+			if i < len(segments)-1 && cue.Start >= length-overlap/2 {
+				continue // Transcribed at the start of the next segment
+			}
+			cues = append(cues, transcriptCue{Start: cue.Start + offset, End: cue.End + offset, Text: strings.TrimSpace(cue.Text)})
+		}
+		emit(cues)
+	}
+	return nil
+}
+
+// Function to format a cue as an SRT or WebVTT subtitle
+func formatCue(format string, n int, cue transcriptCue) string {
+	separator := ","
+	if format == "vtt" {
+		separator = "."
+	}
+	timestamp := func(seconds float64) string {
+		ms := int(seconds*1000 + 0.5)
+		return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+	}
+
+	times := timestamp(cue.Start) + " --> " + timestamp(cue.End)
+	if format == "vtt" {
+		return fmt.Sprintf("%s\n%s\n\n", times, cue.Text)
+	}
+	return fmt.Sprintf("%d\n%s\n%s\n\n", n, times, cue.Text)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"net/url"
+	"sgpt/pkg/httpclient"
+	"sgpt/pkg/i18n"
+)
+
+// Function to configure the shared HTTP client from the timeout and proxy settings. Without --proxy,
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are honoured. With --offline, the
+// client refuses every request to a host other than this machine. The chaos flags inject failures.
+func configureHTTP() error {
+	for _, key := range []string{"timeout", "connectTimeout", "idleTimeout"} {
+		if d := viper.GetDuration(key); d < 0 {
+			return fmt.Errorf("--%s must not be negative, got %s", key, d)
+		}
+	}
+
+	client, err := httpclient.New(httpclient.Options{
+		Timeout:        viper.GetDuration("timeout"),
+		ConnectTimeout: viper.GetDuration("connectTimeout"),
+		IdleTimeout:    viper.GetDuration("idleTimeout"),
+		Proxy:          viper.GetString("proxy"),
+		Offline:        viper.GetBool("offline"),
+	})
+	if err != nil {
+		return fmt.Errorf("--proxy: %w", err)
+	}
+	httpClient.Transport, httpClient.Timeout = client.Transport, client.Timeout
+	if err := configurePoliteness(); err != nil {
+		return err
+	}
+	return configureChaos()
+}
+
+// Function to check that the configured provider is served from this machine with --offline,
+// returning a description of the problem or ""
+func checkOffline(model string) string {
+	if !viper.GetBool("offline") {
+		return ""
+	}
+	provider := viper.GetString("provider")
+	if provider == "bedrock" {
+		return i18n.T("--offline needs a provider served from this machine, Bedrock is not")
+	}
+	endpoint, err := url.Parse(providerEndpoint(model))
+	if err != nil || !httpclient.IsLocalHost(endpoint.Hostname()) {
+		return i18n.Sprintf("--offline needs a provider served from this machine, point --baseURL at a local server such as http://localhost:8000/v1 (%s requests go to %s)", provider, endpoint.Host)
+	}
+	return ""
+}
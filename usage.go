@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// usageRecord is the token usage of one request, as stored in the usage file
+type usageRecord struct {
+	Time             time.Time `json:"time"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	Cost             float64   `json:"cost"` // USD, zero if the model's price is unknown
+}
+
+// Function to return the path of the usage file
+func usageFile() (string, error) {
+	if path := viper.GetString("usageFile"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sgpt", "usage.jsonl"), nil
+}
+
+// Function to account for the tokens used by a request made under ctx: print its cost with
+// --showCost, and add it to the usage file and to the usage of its reply reported by --output json.
+// Requests for which the API reported no usage are not counted.
+func recordUsage(ctx context.Context, provider, model string, promptTokens, completionTokens int) {
+	if promptTokens == 0 && completionTokens == 0 {
+		return
+	}
+	addReplyUsage(ctx, promptTokens, completionTokens)
+	caps := modelCapabilities[model]
+	record := usageRecord{
+		Time:             time.Now().UTC(),
+		Provider:         provider,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Cost:             (float64(promptTokens)*caps.InputPrice + float64(completionTokens)*caps.OutputPrice) / 1e6,
+	}
+
+	if viper.GetBool("showCost") {
+		cost := "unknown"
+		if caps.InputPrice > 0 || caps.OutputPrice > 0 {
+			cost = fmt.Sprintf("$%.5f", record.Cost)
+		}
+		fmt.Fprintf(os.Stderr, "cost: %s/%s %d prompt + %d completion tokens = %s\n", provider, model, promptTokens, completionTokens, cost)
+	}
+
+	if !viper.GetBool("trackUsage") {
+		return
+	}
+	if err := appendUsage(record); err != nil {
+		log.Printf("warning: usage not recorded: %v", err)
+	}
+}
+
+// Function to append a record to the usage file
+func appendUsage(record usageRecord) error {
+	path, err := usageFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return appendJSONLine(path, record)
+}
+
+// usageTotal sums the usage of one group of requests
+type usageTotal struct {
+	requests         int
+	promptTokens     int
+	completionTokens int
+	cost             float64
+}
+
+// Function to handle `sgpt usage [day|model|provider]`, which reports the recorded token usage
+// and spend grouped by day (the default), model or provider
+func runUsage(args []string) error {
+	group := "day"
+	if len(args) > 0 {
+		group = args[0]
+	}
+	if len(args) > 1 || (group != "day" && group != "model" && group != "provider") {
+		return fmt.Errorf("usage: sgpt usage [day|model|provider]")
+	}
+
+	path, err := usageFile()
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "No usage recorded yet.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	totals := map[string]*usageTotal{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var record usageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+
+		key := record.Time.Local().Format("2006-01-02")
+		switch group {
+		case "model":
+			key = record.Provider + "/" + record.Model
+		case "provider":
+			key = record.Provider
+		}
+		total := totals[key]
+		if total == nil {
+			total = &usageTotal{}
+			totals[key] = total
+		}
+		total.requests++
+		total.promptTokens += record.PromptTokens
+		total.completionTokens += record.CompletionTokens
+		total.cost += record.Cost
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tREQUESTS\tPROMPT TOKENS\tCOMPLETION TOKENS\tCOST\n", map[string]string{"day": "DAY", "model": "MODEL", "provider": "PROVIDER"}[group])
+	var all usageTotal
+	for _, key := range keys {
+		t := totals[key]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t$%.4f\n", key, t.requests, t.promptTokens, t.completionTokens, t.cost)
+		all.requests += t.requests
+		all.promptTokens += t.promptTokens
+		all.completionTokens += t.completionTokens
+		all.cost += t.cost
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t$%.4f\n", all.requests, all.promptTokens, all.completionTokens, all.cost)
+	w.Flush()
+	fmt.Fprintln(os.Stderr, "Costs are computed from the list prices of known models; models without a known price count as free.")
+	return nil
+}
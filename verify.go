@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sgpt/pkg/calc"
+	"sgpt/pkg/i18n"
+	"sgpt/pkg/provider/openaicompat"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Added to the instruction with --verify
+const verifyInstruction = "\n\nDo not work out arithmetic or the output of code in your head. Check every calculation " +
+	"and every code result you present with the tools you have, and base your answer on what they return."
+
+// Rounds of tool calls allowed before the model must answer
+const maxVerifyRounds = 6
+
+// Time a code snippet may run, including compiling it
+const snippetTimeout = 30 * time.Second
+
+// Output of a snippet returned to the model, in bytes
+const snippetOutputLimit = 8 << 10
+
+// Built-in tools that --verify can give the model
+var verifyTools = map[string]openaicompat.Tool{
+	"calc": {
+		Name:        "calculate",
+		Description: "Evaluate an arithmetic expression. + - * / %, integer powers, abs, floor, ceil and round are computed exactly with fractions; pi, e, fractional powers and the functions sqrt, ln, log, log2, exp, sin, cos and tan are computed in floating point, and their results are marked as approximate. Supports parentheses.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"expression":{"type":"string"}},"required":["expression"]}`),
+	},
+	"go": {
+		Name:        "run_go",
+		Description: "Run a complete Go program (package main, standard library only) in an empty directory and return its output. It gets no input and must not rely on network access or on files outside its directory.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"code":{"type":"string"}},"required":["code"]}`),
+	},
+	"python": {
+		Name:        "run_python",
+		Description: "Run a Python 3 script (standard library only) in an empty directory and return its output. It gets no input and must not rely on network access or on files outside its directory.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"code":{"type":"string"}},"required":["code"]}`),
+	},
+}
+
+// Function to call the model with the built-in tools chosen with --verify and the tools of the MCP
+// servers chosen with --mcp, running the tools it calls and sending back their results until it answers
+func callModelVerified(ctx context.Context, model, instruction, input string, temperature float64) (string, error) {
+	var tools []openaicompat.Tool
+	taken := map[string]bool{}
+	rounds := maxVerifyRounds
+	if names := viper.GetStringSlice("verify"); len(names) > 0 {
+		for _, name := range names {
+			tools = append(tools, verifyTools[name])
+			taken[verifyTools[name].Name] = true
+		}
+		instruction += verifyInstruction
+	}
+	var servers *mcpTools
+	if len(viper.GetStringSlice("mcp")) > 0 {
+		var err error
+		if servers, err = connectMCP(taken); err != nil {
+			return "", err
+		}
+		defer servers.close()
+		tools = append(tools, servers.tools...)
+		rounds = maxMCPRounds
+	}
+
+	provider := viper.GetString("provider")
+	client, err := chatClient(provider)
+	if err != nil {
+		return "", err
+	}
+	request := openaicompat.Request{
+		Model:       model,
+		System:      instruction,
+		Input:       input,
+		Temperature: temperature,
+		MaxTokens:   maxReplyTokens(model, instruction, input),
+		Sampling:    samplingOptions(),
+		ServiceTier: serviceTier(provider),
+		Tools:       tools,
+	}
+	for round := 0; ; round++ {
+		if round == rounds {
+			request.Tools = nil // Make the model answer with what it has
+		}
+		debugf("POST %s model=%s round=%d", client.Endpoint(), model, round+1)
+		response, err := client.CompleteContext(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		recordUsage(ctx, provider, model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+		noteReply(ctx, provider, model, response.Model, response.FinishReason, response.SystemFingerprint, response.Raw)
+		if len(response.ToolCalls) == 0 {
+			return response.Text, nil
+		}
+
+		request.History = append(request.History, openaicompat.Message{Role: "assistant", Content: response.Text, ToolCalls: response.ToolCalls})
+		for _, call := range response.ToolCalls {
+			result, ok := "", false
+			if servers != nil {
+				result, ok = servers.call(call)
+			}
+			if !ok {
+				result = runVerifyTool(call)
+			}
+			debugf("%s %s: %s", call.Name, call.Arguments, result)
+			request.History = append(request.History, openaicompat.Message{Role: "tool", Content: result, ToolCallID: call.ID})
+		}
+	}
+}
+
+// Function to run a call of a built-in tool and return its result for the model
+func runVerifyTool(call openaicompat.ToolCall) string {
+	var args struct {
+		Expression string `json:"expression"`
+		Code       string `json:"code"`
+	}
+	if err := json.Unmarshal(call.Arguments, &args); err != nil {
+		return "error: invalid arguments: " + err.Error()
+	}
+
+	switch call.Name {
+	case "calculate":
+		v, err := calc.Eval(args.Expression)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		if !v.Exact() {
+			return v.String() + " (approximate)"
+		}
+		return v.String()
+	case "run_go":
+		return runSnippet("go", args.Code)
+	case "run_python":
+		return runSnippet("python", args.Code)
+	}
+	return fmt.Sprintf("error: unknown tool %q", call.Name)
+}
+
+// Directories of the system that snippets can read inside the sandbox
+var sandboxSystemDirs = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/etc/alternatives", "/etc/ld.so.cache"}
+
+var (
+	sandboxOnce   sync.Once
+	sandboxBwrap  bool     // bubblewrap works here
+	sandboxUnsafe []string // Command prefix for --verifyUnsandboxed: a network namespace where possible
+)
+
+// Function to find out how snippets can be isolated. bubblewrap runs them in new namespaces with only
+// the system directories, the toolchain and the snippet's directory visible, and no network. Without
+// it, --verifyUnsandboxed runs them in a network namespace where unprivileged user namespaces allow.
+func detectSandbox() {
+	sandboxOnce.Do(func() {
+		if exec.Command("bwrap", "--unshare-all", "--ro-bind", "/", "/", "true").Run() == nil {
+			sandboxBwrap = true
+			return
+		}
+		debugf("bubblewrap is not available to sandbox code snippets")
+		if exec.Command("unshare", "-rn", "true").Run() == nil {
+			sandboxUnsafe = []string{"unshare", "-rn"}
+		}
+	})
+}
+
+// Function to check that the go and python tools of --verify can run snippets in a sandbox, or
+// that --verifyUnsandboxed accepts running them without one
+func checkSnippetSandbox(tools []string) error {
+	for _, name := range tools {
+		if name != "go" && name != "python" {
+			continue
+		}
+		if detectSandbox(); !sandboxBwrap && !viper.GetBool("verifyUnsandboxed") {
+			return i18n.Errorf("--verify %s runs code the model writes, which needs bubblewrap (bwrap) to sandbox it; install bubblewrap, or pass --verifyUnsandboxed to run the code with access to your files", name)
+		}
+	}
+	return nil
+}
+
+// Function to return the command running a snippet of language in dir, and the directories of its
+// toolchain and build cache, which the sandbox must show read-only and writable respectively
+func snippetCommand(language, dir string) (args, toolchain, writable []string, err error) {
+	switch language {
+	case "go":
+		goroot, err := exec.Command("go", "env", "GOROOT").Output()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("go is not installed: %v", err)
+		}
+		root := strings.TrimSpace(string(goroot))
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			cache = os.TempDir()
+		}
+		goCache := filepath.Join(cache, "sgpt", "go-build") // Kept apart from the user's own build cache
+		if err := os.MkdirAll(goCache, 0700); err != nil {
+			return nil, nil, nil, err
+		}
+		return []string{filepath.Join(root, "bin", "go"), "run", "main.go"}, []string{root}, []string{goCache}, nil
+	case "python":
+		// Run the interpreter itself, as version manager shims such as pyenv's live in the home directory
+		out, err := exec.Command("python3", "-I", "-c", "import sys; print(sys.executable); print(sys.base_prefix)").Output()
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if err != nil || len(lines) != 2 {
+			return nil, nil, nil, fmt.Errorf("python3 is not installed: %v", err)
+		}
+		return []string{lines[0], "-I", "main.py"}, []string{lines[1], filepath.Dir(lines[0])}, nil, nil
+	}
+	return nil, nil, nil, fmt.Errorf("unknown language %q", language)
+}
+
+// Function to return the bubblewrap command prefix that runs a snippet in dir in new namespaces, with
+// no network, a private /tmp and only the system directories and the given ones visible
+func bwrapArgs(dir string, toolchain, writable []string) []string {
+	args := []string{"bwrap", "--unshare-all", "--die-with-parent", "--new-session"}
+	for _, d := range append(append([]string(nil), sandboxSystemDirs...), toolchain...) {
+		args = append(args, "--ro-bind-try", d, d)
+	}
+	args = append(args, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp")
+	for _, d := range append(writable, dir) {
+		args = append(args, "--bind", d, d)
+	}
+	return append(args, "--chdir", dir, "--")
+}
+
+// Function to run a Go or Python snippet in an empty temporary directory, with a minimal environment,
+// no input and a time limit, returning its output. It runs in the bubblewrap sandbox, or with
+// --verifyUnsandboxed without one.
+func runSnippet(language, code string) string {
+	if detectSandbox(); !sandboxBwrap && !viper.GetBool("verifyUnsandboxed") {
+		return "error: there is no sandbox to run code in"
+	}
+	dir, err := os.MkdirTemp("", "sgpt-verify-*")
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	defer os.RemoveAll(dir)
+
+	args, toolchain, writable, err := snippetCommand(language, dir)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	env := []string{"PATH=/usr/local/bin:/usr/bin:/bin", "HOME=" + dir, "TMPDIR=" + dir}
+	switch language {
+	case "go":
+		env = append(env, "GOCACHE="+writable[0], "GOPATH="+filepath.Join(dir, "go"), "GOTOOLCHAIN=local", "GOFLAGS=")
+		err = os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0600)
+	case "python":
+		err = os.WriteFile(filepath.Join(dir, "main.py"), []byte(code), 0600)
+	}
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	if sandboxBwrap {
+		args = append(bwrapArgs(dir, toolchain, writable), args...)
+	} else {
+		args = append(sandboxUnsafe, args...)
+	}
+
+	ctx, cancel := context.WithTimeout(rootCtx, snippetTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir, cmd.Env = dir, env
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err = cmd.Run()
+
+	result := output.String()
+	if len(result) > snippetOutputLimit {
+		result = result[:snippetOutputLimit] + "\n[output truncated]"
+	}
+	if ctx.Err() != nil {
+		return result + fmt.Sprintf("\nerror: stopped after %s", snippetTimeout)
+	}
+	if err != nil {
+		return result + "\nerror: " + err.Error()
+	}
+	return strings.TrimRight(result, "\n")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"sgpt/pkg/provider/openaicompat"
+)
+
+func TestRunVerifyToolCalc(t *testing.T) {
+	tests := []struct{ expression, want string }{
+		{"0.1 + 0.2", "0.3"},
+		{"sqrt(2)", "1.4142135623730951 (approximate)"},
+		{"1 / 0", "error: division by zero"},
+	}
+	for _, tt := range tests {
+		args, _ := json.Marshal(map[string]string{"expression": tt.expression})
+		if got := runVerifyTool(openaicompat.ToolCall{Name: "calculate", Arguments: args}); got != tt.want {
+			t.Errorf("calculate %q = %q, want %q", tt.expression, got, tt.want)
+		}
+	}
+}
+
+// The sandbox shows the snippet's directory writable and the toolchain read-only, after the private /tmp
+func TestBwrapArgs(t *testing.T) {
+	args := strings.Join(bwrapArgs("/tmp/sgpt-verify-1", []string{"/opt/go"}, []string{"/cache/go-build"}), " ")
+	for _, want := range []string{"--unshare-all", "--ro-bind-try /opt/go /opt/go", "--bind /cache/go-build /cache/go-build",
+		"--bind /tmp/sgpt-verify-1 /tmp/sgpt-verify-1", "--chdir /tmp/sgpt-verify-1 --"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("bwrap arguments %q lack %q", args, want)
+		}
+	}
+	if strings.Index(args, "--tmpfs /tmp") > strings.Index(args, "--bind /tmp/sgpt-verify-1") {
+		t.Errorf("bwrap arguments %q hide the snippet's directory under the private /tmp", args)
+	}
+	if strings.Contains(args, "--ro-bind / /") || strings.Contains(args, "--share-net") {
+		t.Errorf("bwrap arguments %q expose the file system or the network", args)
+	}
+}
+
+// Without a sandbox, snippets only run with --verifyUnsandboxed
+func TestRunSnippetNeedsSandbox(t *testing.T) {
+	if detectSandbox(); sandboxBwrap {
+		t.Skip("bubblewrap is available")
+	}
+	if err := checkSnippetSandbox([]string{"calc", "python"}); err == nil {
+		t.Error("checkSnippetSandbox accepted python without a sandbox")
+	}
+	if got := runSnippet("python", "print(1)"); !strings.HasPrefix(got, "error:") {
+		t.Errorf("runSnippet without a sandbox = %q, want an error", got)
+	}
+
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	viper.Set("verifyUnsandboxed", true)
+	defer viper.Set("verifyUnsandboxed", false)
+	if err := checkSnippetSandbox([]string{"python"}); err != nil {
+		t.Error(err)
+	}
+	if got := runSnippet("python", "print(6 * 7)"); got != "42" {
+		t.Errorf("runSnippet python = %q, want 42", got)
+	}
+	if got := runSnippet("go", "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(6 * 7) }\n"); got != "42" {
+		t.Errorf("runSnippet go = %q, want 42", got)
+	}
+}
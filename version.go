@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Build metadata, set at build time with
+// -ldflags "-X main.version=v1.2.3 -X main.commit=abc1234"
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+// Repository whose releases are checked by --checkUpdate
+const releasesURL = "https://api.github.com/repos/pdfinn/sgpt/releases/latest"
+
+// Function to describe this build for --version
+func versionString() string {
+	return fmt.Sprintf("sgpt %s (commit %s)", version, commit)
+}
+
+// Function to build the User-Agent sent with every API request
+func userAgent() string {
+	return "sgpt/" + strings.TrimPrefix(version, "v")
+}
+
+// Function to create a unique ID for an API request, tagged with the version that sent it
+func newRequestID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return fmt.Sprintf("sgpt-%s-%s", strings.TrimPrefix(version, "v"), hex.EncodeToString(b))
+}
+
+// Function to log a message only when debug output is enabled
+func debugf(format string, args ...interface{}) {
+	if viper.GetBool("debug") {
+		log.Printf("debug: "+format, args...)
+	}
+}
+
+// Function to warn on stderr when the latest release is a newer minor or major version than this build
+func checkForUpdate() {
+	if version == "dev" {
+		return
+	}
+
+	client := &http.Client{Transport: httpClient.Transport, Timeout: 3 * time.Second}
+	req, err := http.NewRequest("GET", releasesURL, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		debugf("update check failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil || release.TagName == "" {
+		debugf("update check failed: unexpected response %s", resp.Status)
+		return
+	}
+
+	latest, current := parseVersion(release.TagName), parseVersion(version)
+	if latest == nil || current == nil {
+		return
+	}
+	if latest[0] > current[0] || (latest[0] == current[0] && latest[1] > current[1]) {
+		log.Printf("A newer version of sgpt is available: %s (you have %s), see %s", release.TagName, version, release.HTMLURL)
+	}
+}
+
+// Function to parse a vMAJOR.MINOR.PATCH version into its numbers, or nil if it is not one
+func parseVersion(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	numbers := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+		numbers[i] = n
+	}
+	return numbers
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"sgpt/pkg/fileblocks"
+	"sgpt/pkg/i18n"
+	"strings"
+)
+
+// Instruction added with --writeFiles so that every file can be told apart
+const writeFilesInstruction = "\n\nWrite every file in its own fenced code block, with the file's relative path alone on the line before the block."
+
+// Function to write the files of a reply with --writeFiles into the --out directory. The files are
+// listed on stderr first, marked as new or replacing an existing file, and written only once that
+// is confirmed. Paths leading outside the directory are refused.
+func writeFiles(reply string) error {
+	files := fileblocks.Parse(reply)
+	if len(files) == 0 {
+		return fmt.Errorf("--writeFiles: the reply holds no code blocks labelled with a file name")
+	}
+	dir := viper.GetString("out")
+	for _, f := range files {
+		if !filepath.IsLocal(f.Path) {
+			return fmt.Errorf("--writeFiles: refusing to write %s, which is outside %s", f.Path, dir)
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, i18n.T("Files in the reply:"))
+	for _, f := range files {
+		status := i18n.T("new")
+		if _, err := os.Stat(filepath.Join(dir, f.Path)); err == nil {
+			status = i18n.T("replaces the existing file")
+		}
+		fmt.Fprintf(os.Stderr, "  %s (%s)\n", filepath.Join(dir, f.Path), i18n.Sprintf("%d lines, %s", strings.Count(f.Content, "\n"), status))
+	}
+	if !confirm(i18n.Sprintf("Write these %d files?", len(files))) {
+		return i18n.Errorf("no files written")
+	}
+
+	for _, f := range files {
+		path := filepath.Join(dir, f.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(f.Content), 0644); err != nil {
+			return err
+		}
+		debugf("wrote %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"sgpt/pkg/fileblocks"
+)
+
+// A reply of several files, which only survives if nothing stops it at a newline
+const multiFileReply = "Here are the files.\n\nmain.go\n```go\npackage main\n\nfunc main() {}\n```\n\nREADME.md\n```markdown\n# Demo\n\nRun it.\n```\n"
+
+// Replies spanning many lines, such as those of --writeFiles, come back whole, streamed or not
+func TestMultiLineReplyIntact(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		if stop, ok := payload["stop"]; ok {
+			t.Errorf("request has stop sequences %v", stop)
+		}
+		content, _ := json.Marshal(multiFileReply)
+		if payload["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%s}}]}\n\n", content)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprintf(w, "{\"choices\":[{\"message\":{\"role\":\"assistant\",\"content\":%s},\"finish_reason\":\"stop\"}]}", content)
+	}))
+	defer server.Close()
+	viper.Set("provider", "openai")
+	viper.Set("baseURL", server.URL+"/v1")
+	defer viper.Set("provider", "")
+	defer viper.Set("baseURL", "")
+
+	calls := map[string]func() (string, error){
+		"callProvider": func() (string, error) {
+			return callProvider(context.Background(), "key", "gpt-4o", "instruction", "input", 0)
+		},
+		"callModelStream": func() (string, error) {
+			return callModelStream(context.Background(), "key", "gpt-4o", "instruction", "input", 0, nil)
+		},
+	}
+	for name, call := range calls {
+		reply, err := call()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		files := fileblocks.Parse(reply)
+		if len(files) != 2 || files[0].Content != "package main\n\nfunc main() {}\n" || files[1].Content != "# Demo\n\nRun it.\n" {
+			t.Errorf("%s returned %q, parsed into %+v", name, reply, files)
+		}
+	}
+}